@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"goscript/compiler"
+	"goscript/evaluator"
+	"goscript/object"
+	"goscript/program"
+	"goscript/repl"
+	"goscript/vm"
+	"io"
+	"os"
+)
+
+// 退出码，运行时错误和编译错误分开，方便脚本判断
+const (
+	exitOK      = 0
+	exitRuntime = 1
+	exitUsage   = 2
+	exitCompile = 3
+)
+
+const usage = `usage:
+	goscript run [--engine=vm|tree] [--check] file.go
+	goscript eval [--engine=vm|tree] [--check] -e 'stmt'
+	goscript repl [--engine=vm|tree]
+	goscript disasm [--check] file.go
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	engine := fs.String("engine", "vm", "execution engine: vm or tree")
+	check := fs.Bool("check", false, "type check the source before running")
+	var stmt *string
+	switch args[0] {
+	case "run", "repl", "disasm":
+	case "eval":
+		stmt = fs.String("e", "", "statements to evaluate")
+	default:
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+	if *engine != "vm" && *engine != "tree" {
+		fmt.Fprintf(stderr, "unknown engine %q\n", *engine)
+		return exitUsage
+	}
+
+	if args[0] == "repl" {
+		if fs.NArg() != 0 {
+			fmt.Fprint(stderr, usage)
+			return exitUsage
+		}
+		repl.Start(stdin, stdout, *engine)
+		return exitOK
+	}
+
+	input := program.Input{IsCheck: *check}
+	name := ""
+	if stmt != nil {
+		if fs.NArg() != 0 || *stmt == "" {
+			fmt.Fprint(stderr, usage)
+			return exitUsage
+		}
+		input.Content = *stmt
+		input.IsStmt = true
+	} else {
+		if fs.NArg() != 1 {
+			fmt.Fprint(stderr, usage)
+			return exitUsage
+		}
+		content, err := os.ReadFile(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+		input.Content = string(content)
+		input.Name = fs.Arg(0)
+		name = fs.Arg(0)
+	}
+
+	prog, err := program.ParseFile(input)
+	if err != nil {
+		fmt.Fprintln(stderr, withFile(name, err))
+		return exitCompile
+	}
+
+	if args[0] == "disasm" {
+		comp := compiler.New()
+		err = comp.CompileProgram(prog)
+		if err != nil {
+			fmt.Fprintln(stderr, withFile(name, err))
+			return exitCompile
+		}
+		comp.Bytecode().Disassemble(stdout)
+		return exitOK
+	}
+
+	result, code, err := execute(prog, *engine)
+	var rerr *vm.RuntimeError
+	if errors.As(err, &rerr) {
+		// vm 的运行时错误和 Go 一样输出调用栈
+		fmt.Fprint(stderr, rerr.Trace())
+		return code
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, withFile(name, err))
+		return code
+	}
+	// eval 的最后一条语句是表达式时输出它的值
+	if stmt != nil && endsWithExpr(prog) && result != nil && result != object.NULL {
+		fmt.Fprintln(stdout, result.String())
+	}
+	return exitOK
+}
+
+func execute(prog *program.Program, engine string) (object.Object, int, error) {
+	if engine == "tree" {
+		result := evaluator.EvalProgram(prog)
+		if rerr, ok := result.(*object.Error); ok {
+			return nil, exitRuntime, errors.New(rerr.Message)
+		}
+		return result, exitOK, nil
+	}
+
+	comp := compiler.New()
+	err := comp.CompileProgram(prog)
+	if err != nil {
+		return nil, exitCompile, err
+	}
+	machine := vm.New(comp.Bytecode())
+	err = machine.Run()
+	if err != nil {
+		return nil, exitRuntime, err
+	}
+	return machine.LastPoppedStackElem(), exitOK, nil
+}
+
+// withFile 错误信息以行列号开头时加上文件名
+func withFile(name string, err error) string {
+	msg := err.Error()
+	if name != "" && msg != "" && msg[0] >= '0' && msg[0] <= '9' {
+		return name + ":" + msg
+	}
+	return msg
+}
+
+func endsWithExpr(prog *program.Program) bool {
+	n := len(prog.Statements)
+	if n == 0 {
+		return false
+	}
+	_, ok := prog.Statements[n-1].(*ast.ExprStmt)
+	return ok
+}
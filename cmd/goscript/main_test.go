@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{"eval", "-e", "x := 2\nx * 21"}, exitOK, "42\n"},
+		{[]string{"eval", "--engine=tree", "-e", "x := 2\nx * 21"}, exitOK, "42\n"},
+		{[]string{"eval", "-e", "x := 2"}, exitOK, ""},
+		{[]string{"eval", "-e", "f := func() {}\nf()"}, exitOK, ""},
+		{[]string{"eval", "--engine=tree", "-e", "f := func() {}\nf()"}, exitOK, ""},
+		{[]string{"eval", "-e", "f := func() int { return 3 }\nf()"}, exitOK, "3\n"},
+		{[]string{"eval", "-e", "a := []int{1}\na[5]"}, exitRuntime, ""},
+		{[]string{"eval", "--engine=tree", "-e", `panic("boom")`}, exitRuntime, ""},
+		{[]string{"eval", "-e", "x :="}, exitCompile, ""},
+		{[]string{"eval", "--check", "-e", `var x int = "a"`}, exitCompile, ""},
+		{[]string{"eval", "--check", "-e", "x := 1; x"}, exitOK, "1\n"},
+		{[]string{"eval", "--check", "-e", "x := 1.5\nint(x) + len(\"ab\")"}, exitOK, "3\n"},
+		{[]string{"eval", "--check", "-e", "x := 1\ny := 2\nx"}, exitCompile, ""},
+		{[]string{"eval", "--engine=js", "-e", "1"}, exitUsage, ""},
+		{[]string{"eval"}, exitUsage, ""},
+		{[]string{"build"}, exitUsage, ""},
+		{nil, exitUsage, ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, nil, &stdout, &stderr)
+		if code != tt.code {
+			t.Errorf("%q: wrong exit code. want=%d, got=%d (%s)", tt.args, tt.code, code, stderr.String())
+		}
+		if stdout.String() != tt.expected {
+			t.Errorf("%q: wrong output. want=%q, got=%q", tt.args, tt.expected, stdout.String())
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{"eval", "--engine=tree", "-e", "x := 1\ny := 0\nx / y"}, exitRuntime, "3:1 integer divide by zero\n"},
+		{[]string{"eval", "-e", "x := 1\ny := 0\nx / y"}, exitRuntime, "panic: integer divide by zero\n\ngoroutine 1 [running]:\nmain()\n\t3:1\n"},
+		{[]string{"eval", "--engine=tree", "-e", "x := 1\ny := zz + x"}, exitRuntime, "2:6 ident not found: zz\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, nil, &stdout, &stderr)
+		if code != tt.code {
+			t.Errorf("%q: wrong exit code. want=%d, got=%d (%s)", tt.args, tt.code, code, stderr.String())
+		}
+		if stderr.String() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.args, tt.expected, stderr.String())
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	ok := filepath.Join(dir, "ok.go")
+	bad := filepath.Join(dir, "bad.go")
+	os.WriteFile(ok, []byte("package tmp\n\nfunc main() {\n\tx := 1\n\t_ = x\n}\n"), 0o644)
+	os.WriteFile(bad, []byte("package tmp\n\nfunc main() {\n\tx := 1\n\ty := \"a\" + x\n}\n"), 0o644)
+	panics := filepath.Join(dir, "panics.go")
+	os.WriteFile(panics, []byte("package tmp\n\nfunc f(n int) {\n\tpanic(n)\n}\n\nfunc main() {\n\tf(42)\n}\n"), 0o644)
+
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{"run", ok}, exitOK, ""},
+		{[]string{"run", "--engine=tree", ok}, exitOK, ""},
+		{[]string{"run", "--engine=tree", bad}, exitRuntime, bad + ":5:7 cannot convert (untyped 'string' constant) to type int\n"},
+		{[]string{"run", panics}, exitRuntime, "panic: 42\n\ngoroutine 1 [running]:\nf(42)\n\t" + panics + ":4:2\nmain()\n\t" + panics + ":8:2\n"},
+		{[]string{"run", filepath.Join(dir, "missing.go")}, exitUsage, ""},
+		{[]string{"run"}, exitUsage, ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, nil, &stdout, &stderr)
+		if code != tt.code {
+			t.Errorf("%q: wrong exit code. want=%d, got=%d (%s)", tt.args, tt.code, code, stderr.String())
+		}
+		if tt.expected != "" && stderr.String() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.args, tt.expected, stderr.String())
+		}
+	}
+}
+
+func TestRepl(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"repl", "--engine=tree"}, strings.NewReader("x := 6\nx * 7\n"), &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("wrong exit code. want=%d, got=%d (%s)", exitOK, code, stderr.String())
+	}
+	if stdout.String() != ">> >> 42\n>> " {
+		t.Errorf("wrong output. got=%q", stdout.String())
+	}
+}
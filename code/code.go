@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"go/token"
+	"sort"
 )
 
 type Opcode byte
@@ -77,6 +79,7 @@ const (
 	OpSetNil
 
 	OpArray
+	OpFixedArray
 	OpHash
 	OpIndex
 
@@ -92,8 +95,41 @@ const (
 	OpContinue
 	OpBreak
 
-	OpSetGlobalIndex
-	OpSetLocalIndex
+	OpSetIndex
+
+	OpStruct
+	OpGetField
+	OpSetField
+	OpTypeAssert
+
+	OpCase
+	OpTypeCase
+
+	OpDefer
+
+	OpChannel
+	OpSend
+	OpGo
+	OpSelect
+
+	OpSlice
+	OpMakeSlice
+
+	OpPointer
+	OpDeref
+	OpSetDeref
+	OpIndexAddr
+	OpFieldAddr
+
+	OpBranch
+	OpJumpBranch
+)
+
+// select 各分支的类型，OpSelect 的常量按分支顺序记录
+const (
+	SelectRecv = iota
+	SelectSend
+	SelectDefault
 )
 
 var codeLitMap = map[Opcode]string{
@@ -164,9 +200,10 @@ var codeLitMap = map[Opcode]string{
 	OpGetBuiltin: "getBuiltin",
 	OpSetNil:     "setNil",
 
-	OpArray: "array",
-	OpHash:  "hash",
-	OpIndex: "index",
+	OpArray:      "array",
+	OpFixedArray: "fixedArray",
+	OpHash:       "hash",
+	OpIndex:      "index",
 
 	OpCall:        "call",
 	OpReturnValue: "return",
@@ -180,8 +217,35 @@ var codeLitMap = map[Opcode]string{
 	OpContinue:  "continue",
 	OpBreak:     "break",
 
-	OpSetGlobalIndex: "setGIndex",
-	OpSetLocalIndex:  "setLIndex",
+	OpSetIndex: "setIndex",
+
+	OpStruct:   "struct",
+	OpGetField: "getField",
+	OpSetField: "setField",
+
+	OpTypeAssert: "typeAssert",
+
+	OpCase:     "case",
+	OpTypeCase: "typeCase",
+
+	OpDefer: "defer",
+
+	OpChannel: "chan",
+	OpSend:    "send",
+	OpGo:      "go",
+	OpSelect:  "select",
+
+	OpSlice:     "slice",
+	OpMakeSlice: "makeSlice",
+
+	OpPointer:   "pointer",
+	OpDeref:     "deref",
+	OpSetDeref:  "setDeref",
+	OpIndexAddr: "indexAddr",
+	OpFieldAddr: "fieldAddr",
+
+	OpBranch:     "branch",
+	OpJumpBranch: "jumpBranch",
 }
 
 func (o Opcode) String() string {
@@ -223,11 +287,11 @@ var definitons = map[Opcode]*Definition{
 	OpSHR_ASSIGN:     {"OpSHR_ASSIGN", []int{}},     // >>=
 	OpAND_NOT_ASSIGN: {"OpAND_NOT_ASSIGN", []int{}}, // &^=
 
-	OpLAND:  {"OpLAND", []int{}},  // &&
-	OpLOR:   {"OpLOR", []int{}},   // ||
-	OpARROW: {"OpARROW", []int{}}, // <-
-	OpINC:   {"OpINC", []int{}},   // ++
-	OpDEC:   {"OpDEC", []int{}},   // --
+	OpLAND:  {"OpLAND", []int{}},   // &&
+	OpLOR:   {"OpLOR", []int{}},    // ||
+	OpARROW: {"OpARROW", []int{1}}, // <-，操作数为 1 时压入 v, ok
+	OpINC:   {"OpINC", []int{}},    // ++
+	OpDEC:   {"OpDEC", []int{}},    // --
 
 	OpEQL:    {"OpEQL", []int{}},    // ==
 	OpLSS:    {"OpLSS", []int{}},    // <
@@ -235,11 +299,11 @@ var definitons = map[Opcode]*Definition{
 	OpASSIGN: {"OpASSIGN", []int{}}, // =
 	OpNOT:    {"OpNOT", []int{}},    // !
 
-	OpNEQ:      {"OpNEQ", []int{}},      // !=
-	OpLEQ:      {"OpLEQ", []int{}},      // <=
-	OpGEQ:      {"OpGEQ", []int{}},      // >=
-	OpDEFINE:   {"OpDEFINE", []int{}},   // :=
-	OpELLIPSIS: {"OpELLIPSIS", []int{}}, // ...
+	OpNEQ:      {"OpNEQ", []int{}},       // !=
+	OpLEQ:      {"OpLEQ", []int{}},       // <=
+	OpGEQ:      {"OpGEQ", []int{}},       // >=
+	OpDEFINE:   {"OpDEFINE", []int{}},    // :=
+	OpELLIPSIS: {"OpELLIPSIS", []int{1}}, // ...，参数个数，调用时展开最后一个参数
 
 	// ---------------------
 	OpPrefixSub: {"OpPrefixSub", []int{}},
@@ -261,9 +325,10 @@ var definitons = map[Opcode]*Definition{
 	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
 	OpSetNil:     {"OpSetNil", []int{}},
 
-	OpArray: {"OpArray", []int{2}},
-	OpHash:  {"OpHash", []int{2}},
-	OpIndex: {"OpIndex", []int{}},
+	OpArray:      {"OpArray", []int{2, 1}},   // 元素个数和元素类型
+	OpFixedArray: {"OpFixedArray", []int{2}}, // 数组类型，元素个数为数组长度
+	OpHash:       {"OpHash", []int{2, 1, 1}}, // 键和值的个数，键和值的类型
+	OpIndex:      {"OpIndex", []int{}},
 
 	OpCall:        {"OpCall", []int{1}},
 	OpReturnValue: {"OpReturnValue", []int{1}},
@@ -277,8 +342,35 @@ var definitons = map[Opcode]*Definition{
 	OpContinue:  {"OpContinue", []int{}},
 	OpBreak:     {"OpBreak", []int{}},
 
-	OpSetGlobalIndex: {"OpSetGlobalIndex", []int{2}},
-	OpSetLocalIndex:  {"OpSetLocalIndex", []int{2}},
+	OpSetIndex: {"OpSetIndex", []int{}}, // a[i] = v，栈中依次为 a、i 和 v，原地修改 a
+
+	OpStruct:   {"OpStruct", []int{2}},
+	OpGetField: {"OpGetField", []int{2}},
+	OpSetField: {"OpSetField", []int{2}},
+
+	OpTypeAssert: {"OpTypeAssert", []int{2, 1}},
+
+	OpCase:     {"OpCase", []int{2}},        // 与 tag 相等时弹出 tag 并跳转
+	OpTypeCase: {"OpTypeCase", []int{2, 2}}, // tag 的动态类型匹配时跳转，保留 tag
+
+	OpDefer: {"OpDefer", []int{1}}, // 参数个数，函数和参数登记到当前函数帧
+
+	OpChannel: {"OpChannel", []int{2}}, // 元素零值，容量在栈顶
+	OpSend:    {"OpSend", []int{}},
+	OpGo:      {"OpGo", []int{1}},     // 参数个数
+	OpSelect:  {"OpSelect", []int{2}}, // 分支类型数组，压入选中分支接收的值和分支序号
+
+	OpSlice:     {"OpSlice", []int{}},      // x[low:high:max]，缺省的下标为 nil
+	OpMakeSlice: {"OpMakeSlice", []int{2}}, // 元素零值，长度和容量在栈顶
+
+	OpPointer:   {"OpPointer", []int{}},    // 栈顶的值复制到新分配的单元，压入指向它的指针
+	OpDeref:     {"OpDeref", []int{}},      // *p
+	OpSetDeref:  {"OpSetDeref", []int{}},   // *p = v，指针在栈顶
+	OpIndexAddr: {"OpIndexAddr", []int{}},  // &a[i]
+	OpFieldAddr: {"OpFieldAddr", []int{2}}, // &x.f，字段名常量
+
+	OpBranch:     {"OpBranch", []int{2}},        // 带标签的跳转常量，结束当前循环帧交给外层处理
+	OpJumpBranch: {"OpJumpBranch", []int{2, 2}}, // 内层循环因该标签结束时跳转
 }
 
 type Instructions []byte
@@ -378,3 +470,33 @@ func ReadUint8(ins Instructions) uint8 {
 func ReadUint16(instructions Instructions) uint16 {
 	return binary.BigEndian.Uint16(instructions)
 }
+
+// LineTable 指令偏移到源码位置的映射，按偏移递增，每一项覆盖到下一项之前的指令
+type LineTable []LineEntry
+
+type LineEntry struct {
+	Offset int
+	Pos    token.Pos
+}
+
+// Add 记录从 offset 开始的指令的位置，与上一项位置相同时不重复记录
+func (lt LineTable) Add(offset int, pos token.Pos) LineTable {
+	n := len(lt)
+	if n > 0 && lt[n-1].Offset == offset {
+		lt[n-1].Pos = pos
+		return lt
+	}
+	if (n > 0 && lt[n-1].Pos == pos) || (n == 0 && !pos.IsValid()) {
+		return lt
+	}
+	return append(lt, LineEntry{Offset: offset, Pos: pos})
+}
+
+// Lookup offset 处指令的源码位置，没有记录时为 token.NoPos
+func (lt LineTable) Lookup(offset int) token.Pos {
+	i := sort.Search(len(lt), func(i int) bool { return lt[i].Offset > offset })
+	if i == 0 {
+		return token.NoPos
+	}
+	return lt[i-1].Pos
+}
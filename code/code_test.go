@@ -1,6 +1,7 @@
 package code
 
 import (
+	"go/token"
 	"testing"
 )
 
@@ -24,6 +25,17 @@ func TestMake(t *testing.T) {
 		{OpGetFree, []int{255}, []byte{byte(OpGetFree), 255}},
 		{OpCall, []int{255}, []byte{byte(OpCall), 255}},
 		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpCase, []int{65534}, []byte{byte(OpCase), 255, 254}},
+		{OpTypeCase, []int{65534, 2}, []byte{byte(OpTypeCase), 255, 254, 0, 2}},
+		{OpDefer, []int{2}, []byte{byte(OpDefer), 2}},
+		{OpChannel, []int{65534}, []byte{byte(OpChannel), 255, 254}},
+		{OpGo, []int{1}, []byte{byte(OpGo), 1}},
+		{OpARROW, []int{1}, []byte{byte(OpARROW), 1}},
+		{OpSelect, []int{65534}, []byte{byte(OpSelect), 255, 254}},
+		{OpMakeSlice, []int{65534}, []byte{byte(OpMakeSlice), 255, 254}},
+		{OpELLIPSIS, []int{3}, []byte{byte(OpELLIPSIS), 3}},
+		{OpBranch, []int{65534}, []byte{byte(OpBranch), 255, 254}},
+		{OpJumpBranch, []int{65534, 2}, []byte{byte(OpJumpBranch), 255, 254, 0, 2}},
 	}
 
 	for _, tt := range tests {
@@ -121,3 +133,34 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestLineTable(t *testing.T) {
+	var lt LineTable
+	lt = lt.Add(0, token.NoPos)
+	lt = lt.Add(0, 10)
+	lt = lt.Add(3, 10)
+	lt = lt.Add(5, 20)
+	lt = lt.Add(5, 30)
+	lt = lt.Add(8, 40)
+
+	if len(lt) != 3 {
+		t.Fatalf("wrong entries. got=%v", lt)
+	}
+
+	tests := []struct {
+		offset   int
+		expected token.Pos
+	}{
+		{0, 10},
+		{4, 10},
+		{5, 30},
+		{7, 30},
+		{8, 40},
+		{100, 40},
+	}
+	for _, tt := range tests {
+		if pos := lt.Lookup(tt.offset); pos != tt.expected {
+			t.Errorf("wrong pos at %d. want=%d, got=%d", tt.offset, tt.expected, pos)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"goscript/code"
 	"goscript/object"
 	"goscript/program"
+	"strings"
 	"testing"
 )
 
@@ -267,7 +268,7 @@ func TestArrayLiterals(t *testing.T) {
 			input:             "[]int{}",
 			expectedConstants: []any{},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpArray, 0),
+				code.Make(code.OpArray, 0, int(object.INT_OBJ)),
 				code.Make(code.OpPop),
 			},
 		},
@@ -278,7 +279,7 @@ func TestArrayLiterals(t *testing.T) {
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
-				code.Make(code.OpArray, 3),
+				code.Make(code.OpArray, 3, int(object.INT_OBJ)),
 				code.Make(code.OpPop),
 			},
 		},
@@ -295,7 +296,7 @@ func TestArrayLiterals(t *testing.T) {
 				code.Make(code.OpConstant, 4),
 				code.Make(code.OpConstant, 5),
 				code.Make(code.OpMUL),
-				code.Make(code.OpArray, 3),
+				code.Make(code.OpArray, 3, int(object.INT_OBJ)),
 				code.Make(code.OpPop),
 			},
 		},
@@ -310,7 +311,7 @@ func TestHashLiterals(t *testing.T) {
 			input:             "map[string]int{}",
 			expectedConstants: []any{},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpHash, 0),
+				code.Make(code.OpHash, 0, int(object.STRING_OBJ), int(object.INT_OBJ)),
 				code.Make(code.OpPop),
 			},
 		},
@@ -324,7 +325,7 @@ func TestHashLiterals(t *testing.T) {
 				code.Make(code.OpConstant, 3),
 				code.Make(code.OpConstant, 4),
 				code.Make(code.OpConstant, 5),
-				code.Make(code.OpHash, 6),
+				code.Make(code.OpHash, 6, int(object.INT_OBJ), int(object.INT_OBJ)),
 				code.Make(code.OpPop),
 			},
 		},
@@ -340,7 +341,7 @@ func TestHashLiterals(t *testing.T) {
 				code.Make(code.OpConstant, 4),
 				code.Make(code.OpConstant, 5),
 				code.Make(code.OpMUL),
-				code.Make(code.OpHash, 4),
+				code.Make(code.OpHash, 4, int(object.INT_OBJ), int(object.INT_OBJ)),
 				code.Make(code.OpPop),
 			},
 		},
@@ -358,7 +359,7 @@ func TestIndexExpr(t *testing.T) {
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
-				code.Make(code.OpArray, 3),
+				code.Make(code.OpArray, 3, int(object.INT_OBJ)),
 				code.Make(code.OpConstant, 3),
 				code.Make(code.OpConstant, 4),
 				code.Make(code.OpADD),
@@ -372,7 +373,7 @@ func TestIndexExpr(t *testing.T) {
 			expectedIns: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpHash, 2),
+				code.Make(code.OpHash, 2, int(object.INT_OBJ), int(object.INT_OBJ)),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpConstant, 3),
 				code.Make(code.OpSUB),
@@ -390,7 +391,7 @@ func TestIndexExpr(t *testing.T) {
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
-				code.Make(code.OpArray, 3),
+				code.Make(code.OpArray, 3, int(object.INT_OBJ)),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 3),
@@ -417,7 +418,7 @@ func TestIndexExpr(t *testing.T) {
 				code.Make(code.OpConstant, 6),
 				code.Make(code.OpConstant, 7),
 				code.Make(code.OpMUL),
-				code.Make(code.OpHash, 6),
+				code.Make(code.OpHash, 6, int(object.INT_OBJ), int(object.INT_OBJ)),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 8),
@@ -584,6 +585,300 @@ func TestIfStmt(t *testing.T) {
 	runCompilerTests(t, tests, true)
 }
 
+func TestSwitchStmt(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `switch 2 { case 1: 10; default: 20 }`,
+			expectedConstants: []any{2, 1, 10, 20},
+			expectedIns: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpConstant, 1),
+				// 0006
+				code.Make(code.OpCase, 13),
+				// 0009
+				code.Make(code.OpPop),
+				// 0010
+				code.Make(code.OpJump, 19),
+				// 0013
+				code.Make(code.OpConstant, 2),
+				// 0016
+				code.Make(code.OpJump, 25),
+				// 0019
+				code.Make(code.OpConstant, 3),
+				// 0022
+				code.Make(code.OpJump, 25),
+				// 0025
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `switch { case true: 10; fallthrough; case false: 20 }`,
+			expectedConstants: []any{10, 20},
+			expectedIns: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpTrue),
+				// 0002
+				code.Make(code.OpCase, 13),
+				// 0005
+				code.Make(code.OpFalse),
+				// 0006
+				code.Make(code.OpCase, 16),
+				// 0009
+				code.Make(code.OpPop),
+				// 0010
+				code.Make(code.OpJump, 22),
+				// 0013
+				code.Make(code.OpConstant, 0),
+				// 0016
+				code.Make(code.OpConstant, 1),
+				// 0019
+				code.Make(code.OpJump, 22),
+				// 0022
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests, true)
+}
+
+func TestDeferStmt(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `defer println(1); panic("x")`,
+			expectedConstants: []any{1, "x"},
+			expectedIns: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 15),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpDefer, 1),
+				code.Make(code.OpGetBuiltin, 16),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests, true)
+}
+
+func TestChannel(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `ch := make(chan int, 1); ch <- 2; go println(<-ch)`,
+			expectedConstants: []any{1, 0, 2},
+			expectedIns: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpChannel, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSend),
+				code.Make(code.OpGetBuiltin, 15),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpARROW, 0),
+				code.Make(code.OpGo, 1),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests, true)
+}
+
+func TestSliceExpr(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `a := make([]int, 2); a[1:]`,
+			expectedConstants: []any{2, 0, 1},
+			expectedIns: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpMakeSlice, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpNull),
+				code.Make(code.OpNull),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests, true)
+}
+
+func TestPointer(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `x := 1; p := &x; *p = 2; *p`,
+			expectedConstants: []any{1, 2},
+			expectedIns: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPointer),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpSetDeref),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpDeref),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests, true)
+}
+
+func TestConstDecl(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `const ( a = iota * 10; b; c ); x := c + b`,
+			expectedConstants: []any{30},
+			expectedIns: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input:             `const big = 1 << 62; x := 1; big >> 60 + x`,
+			expectedConstants: []any{1, 4},
+			expectedIns: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpADD),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests, true)
+}
+
+func TestGenericFunction(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+					package tmp
+
+					func Id[T any](x T) T {
+						return x
+					}
+
+					func main() {
+						Id(1)
+						Id[int](2)
+					}
+					`,
+			expectedConstants: []any{1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue, 1),
+				},
+				2,
+			},
+			expectedIns: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests, false)
+}
+
+func TestLabeledStmt(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+				goto end
+			loop:
+				1
+				goto loop
+			end:
+				2
+				`,
+			expectedConstants: []any{1, 2},
+			expectedIns: []code.Instructions{
+				code.Make(code.OpJump, 9),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 3),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			sw:
+				switch {
+				default:
+					break sw
+				}
+				`,
+			expectedConstants: []any{},
+			expectedIns: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 5),
+				// 0005
+				code.Make(code.OpJump, 11),
+				code.Make(code.OpJump, 11),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests, true)
+}
+
+func TestSelectStmt(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `ch := make(chan int); select { case v := <-ch: v; default: }`,
+			expectedConstants: []any{0, 0, []int{code.SelectRecv, code.SelectDefault}, 0, 1},
+			expectedIns: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpChannel, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSelect, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpCase, 27),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpCase, 37),
+				// 0027
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpJump, 41),
+				// 0037
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 41),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests, true)
+}
+
 func TestFunction(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -809,7 +1104,7 @@ func TestBuiltins(t *testing.T) {
 			expectedConstants: []any{},
 			expectedIns: []code.Instructions{
 				code.Make(code.OpGetBuiltin, 13),
-				code.Make(code.OpArray, 0),
+				code.Make(code.OpArray, 0, int(object.INT_OBJ)),
 				code.Make(code.OpCall, 1),
 				code.Make(code.OpPop),
 			},
@@ -819,7 +1114,7 @@ func TestBuiltins(t *testing.T) {
 			expectedConstants: []any{1},
 			expectedIns: []code.Instructions{
 				code.Make(code.OpGetBuiltin, 14),
-				code.Make(code.OpArray, 0),
+				code.Make(code.OpArray, 0, int(object.INT_OBJ)),
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpCall, 2),
 				code.Make(code.OpPop),
@@ -932,6 +1227,117 @@ func TestClosures(t *testing.T) {
 	runCompilerTests(t, tests, true)
 }
 
+func TestDisassemble(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			`package tmp
+
+func double(n int) int {
+	return n * 2
+}
+
+func main() {
+	s := []int{1}
+	for _, v := range s {
+		f := func() int { return double(v) }
+		f()
+	}
+}
+`,
+			[]string{
+				"main:",
+				"8 0000 OpConstant 2 ; 1",
+				"8 0003 OpArray 1 1",
+				"8 0007 OpSetGlobal 1 ; s",
+				"9 0010 OpClosure 4 0 ; main.range1",
+				"9 0014 OpRangeLoop",
+				"- 0015 OpPop",
+				"main.range1.x:",
+				"9 0000 OpGetGlobal 1 ; s",
+				"main.range1.body:",
+				"9 0000 OpGetLocal 1 ; loop_V",
+				"9 0003 OpSetLocal 2 ; v",
+				"10 0006 OpGetLocal 2 ; v",
+				"10 0009 OpClosure 3 1 ; main.range1.func1",
+				"10 0013 OpSetLocal 3 ; f",
+				"11 0016 OpGetLocal 3 ; f",
+				"11 0019 OpCall 0",
+				"main.range1.func1:",
+				"10 0000 OpGetGlobal 0 ; double",
+				"10 0003 OpGetFree 0 ; v",
+				"10 0005 OpCall 1",
+				"10 0007 OpReturnValue 1",
+				"double:",
+				"4 0000 OpGetLocal 0 ; n",
+				"4 0003 OpConstant 1 ; 2",
+				"4 0006 OpMUL",
+				"4 0007 OpReturnValue 1",
+			},
+		},
+		{
+			`package tmp
+
+func Id[T any](x T) T {
+	return x
+}
+
+func main() {
+	a := Id(1)
+	f := func() int { return a }
+	f()
+}
+`,
+			// 泛型函数的实例按类型实参命名，不影响函数字面量的编号
+			[]string{
+				"main:",
+				"8 0000 OpClosure 1 0 ; Id[int]",
+				"8 0004 OpConstant 0 ; 1",
+				"8 0007 OpCall 1",
+				"8 0009 OpSetGlobal 0 ; a",
+				"9 0012 OpClosure 2 0 ; main.func1",
+				"9 0016 OpSetGlobal 1 ; f",
+				"10 0019 OpGetGlobal 1 ; f",
+				"10 0022 OpCall 0",
+				"- 0024 OpPop",
+				"Id[int]:",
+				"4 0000 OpGetLocal 0 ; x",
+				"4 0003 OpReturnValue 1",
+				"main.func1:",
+				"9 0000 OpGetGlobal 0 ; a",
+				"9 0003 OpReturnValue 1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		prog := parseProgram(t, tt.input, false)
+		comp := New()
+		err := comp.CompileProgram(prog)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		var out strings.Builder
+		err = comp.Bytecode().Disassemble(&out)
+		if err != nil {
+			t.Fatalf("disassemble error: %s", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != len(tt.expected) {
+			t.Fatalf("wrong number of lines. want=%d, got=%d\n%s", len(tt.expected), len(lines), out.String())
+		}
+		for i, line := range lines {
+			// 列的宽度由 tabwriter 决定，只比较内容
+			if got := strings.Join(strings.Fields(line), " "); got != tt.expected[i] {
+				t.Errorf("wrong line %d. want=%q, got=%q", i, tt.expected[i], got)
+			}
+		}
+	}
+}
+
 func testInstructions(expected []code.Instructions, actual code.Instructions) error {
 	concatted := concatInstructions(expected)
 	if len(actual) != len(concatted) {
@@ -969,6 +1375,17 @@ func testConstants(expected []any, actual []object.Object) error {
 			if err != nil {
 				return fmt.Errorf("constant %d - testStringObject failed: %s", i, err)
 			}
+		case []int:
+			arr, ok := actual[i].(*object.Array)
+			if !ok || len(arr.Elements) != len(constant) {
+				return fmt.Errorf("constant %d - not an array of %d: %T", i, len(constant), actual[i])
+			}
+			for j, v := range constant {
+				err := testIntegerObject(int64(v), arr.Elements[j])
+				if err != nil {
+					return fmt.Errorf("constant %d - element %d: %s", i, j, err)
+				}
+			}
 		case []code.Instructions:
 			fn, ok := actual[i].(*object.CompiledFunction)
 			if !ok {
@@ -2,6 +2,7 @@ package compiler
 
 import (
 	"fmt"
+	"go/ast"
 	"go/token"
 	"goscript/code"
 	"goscript/object"
@@ -19,6 +20,26 @@ type CompilationScope struct {
 
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+
+	// 每层 switch 中 break 跳转指令的位置
+	switchBreaks [][]int
+	switchLabels []string
+
+	// 循环体是单独的帧，带标签的跳转目标不在当前帧时交给外层处理
+	loopLabel string
+	loopBody  *ast.BlockStmt
+	labels    map[string]int   // 已编译的标签位置
+	gotos     map[string][]int // 向前跳转的 goto，定义标签时回填
+	escapes   []branchEscape
+
+	lines code.LineTable
+}
+
+// branchEscape 跳出当前循环帧的 break、continue 或 goto
+type branchEscape struct {
+	tok    token.Token
+	target *ast.LabeledStmt
+	idx    int // 常量池中的 Branch
 }
 
 type Bytecode struct {
@@ -26,6 +47,8 @@ type Bytecode struct {
 	SymbolTable  *SymbolTable
 	Instructions code.Instructions
 	GlobalDecls  int
+	Lines        code.LineTable // main 的指令位置
+	Fset         *token.FileSet
 }
 
 type Compiler struct {
@@ -35,6 +58,16 @@ type Compiler struct {
 	scopes      []CompilationScope
 	scopeIndex  int
 	globalDecls int
+
+	instances map[string]int // 泛型函数的实例在常量池中的位置
+	generics  []*object.GenericType
+	methods   map[string]bool // 已编译的泛型类型实例的方法
+	results   []*ast.Ident    // 正在编译的函数的具名返回值
+
+	ptrMethods map[string]bool // 命名类型的指针接收者方法，调用时接收者要放在堆上
+
+	pos  token.Pos // 正在编译的节点的位置，记录到发出的指令上
+	fset *token.FileSet
 }
 
 func New() *Compiler {
@@ -53,6 +86,9 @@ func New() *Compiler {
 		constants:   []object.Object{},
 		SymbolTable: global,
 		scopes:      []CompilationScope{mainScope},
+		instances:   make(map[string]int),
+		methods:     make(map[string]bool),
+		ptrMethods:  make(map[string]bool),
 	}
 }
 
@@ -66,6 +102,8 @@ func (c *Compiler) Bytecode() *Bytecode {
 		Constants:    c.constants,
 		SymbolTable:  c.SymbolTable,
 		GlobalDecls:  c.globalDecls,
+		Lines:        c.scopes[c.scopeIndex].lines,
+		Fset:         c.fset,
 	}
 }
 
@@ -82,10 +120,19 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	return pos
 }
 
+// emitZero 接口、通道和函数的零值是 nil
+func (c *Compiler) emitZero(obj object.Object) int {
+	if object.Zero(obj) == object.NULL {
+		return c.emit(code.OpNull)
+	}
+	return c.emit(code.OpConstant, c.addConstants(obj))
+}
+
 func (c *Compiler) addInstruction(ins []byte) int {
 	newInsPos := len(c.currentInstructions())
 	newInstructions := append(c.currentInstructions(), ins...)
 	c.scopes[c.scopeIndex].instructions = newInstructions
+	c.scopes[c.scopeIndex].lines = c.scopes[c.scopeIndex].lines.Add(newInsPos, c.pos)
 	return newInsPos
 }
 
@@ -111,9 +158,14 @@ func (c *Compiler) removeLastPop() {
 	c.scopes[c.scopeIndex].lastInstruction = previous
 }
 
+// changeOperand 修改第一个操作数，其余操作数不变
 func (c *Compiler) changeOperand(opPos int, operand int) {
-	op := code.Opcode(c.currentInstructions()[opPos])
-	newInstruction := code.Make(op, operand)
+	ins := c.currentInstructions()
+	op := code.Opcode(ins[opPos])
+	def, _ := code.Lookup(byte(op))
+	operands, _ := code.ReadOperands(def, ins[opPos+1:])
+	operands[0] = operand
+	newInstruction := code.Make(op, operands...)
 	c.replaceInstruction(opPos, newInstruction)
 }
 
@@ -144,7 +196,101 @@ func (c *Compiler) leaveScope() code.Instructions {
 	return instructions
 }
 
+func (c *Compiler) enterSwitch(label string) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.switchBreaks = append(scope.switchBreaks, nil)
+	scope.switchLabels = append(scope.switchLabels, label)
+}
+
+func (c *Compiler) leaveSwitch(end int) {
+	scope := &c.scopes[c.scopeIndex]
+	n := len(scope.switchBreaks) - 1
+	for _, pos := range scope.switchBreaks[n] {
+		c.changeOperand(pos, end)
+	}
+	scope.switchBreaks = scope.switchBreaks[:n]
+	scope.switchLabels = scope.switchLabels[:n]
+}
+
+// emitBreak 在 switch 中的 break 跳转到 switch 结尾
+func (c *Compiler) emitBreak() {
+	scope := &c.scopes[c.scopeIndex]
+	n := len(scope.switchBreaks) - 1
+	if n < 0 {
+		c.emit(code.OpBreak)
+		return
+	}
+	pos := c.emit(code.OpJump, 0)
+	scope.switchBreaks[n] = append(scope.switchBreaks[n], pos)
+}
+
+// switchIndex 当前帧中带该标签的 switch 或 select
+func (c *Compiler) switchIndex(label string) int {
+	scope := &c.scopes[c.scopeIndex]
+	for i := len(scope.switchLabels) - 1; i >= 0; i-- {
+		if scope.switchLabels[i] == label {
+			return i
+		}
+	}
+	return -1
+}
+
+// defineLabel 记录标签位置，回填之前向前跳转的 goto
+func (c *Compiler) defineLabel(label string) {
+	scope := &c.scopes[c.scopeIndex]
+	if scope.labels == nil {
+		scope.labels = make(map[string]int)
+	}
+	pos := len(scope.instructions)
+	scope.labels[label] = pos
+	for _, p := range scope.gotos[label] {
+		c.changeOperand(p, pos)
+	}
+	delete(scope.gotos, label)
+}
+
+// emitGoto 标签还未编译时等待回填
+func (c *Compiler) emitGoto(label string) {
+	scope := &c.scopes[c.scopeIndex]
+	if pos, ok := scope.labels[label]; ok {
+		c.emit(code.OpJump, pos)
+		return
+	}
+	if scope.gotos == nil {
+		scope.gotos = make(map[string][]int)
+	}
+	pos := c.emit(code.OpJump, 0)
+	scope.gotos[label] = append(scope.gotos[label], pos)
+}
+
 func (c *Compiler) loadSymbol(s Symbol) {
+	c.loadSlot(s)
+	if s.Heap {
+		c.emit(code.OpDeref)
+	}
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	if s.Heap {
+		c.loadSlot(s)
+		c.emit(code.OpSetDeref)
+		return
+	}
+	c.storeSlot(s)
+}
+
+// initSymbol 定义变量，堆上的变量每次定义都分配新的单元
+func (c *Compiler) initSymbol(s Symbol) {
+	c.storeSlot(s)
+	if s.Heap {
+		c.loadSlot(s)
+		c.emit(code.OpPointer)
+		c.storeSlot(s)
+	}
+}
+
+// loadSlot 槽位中的值，堆上变量为指向它的指针，闭包和循环捕获的是这个指针
+func (c *Compiler) loadSlot(s Symbol) {
 	switch s.Scope {
 	case GlobalScope:
 		c.emit(code.OpGetGlobal, s.Index)
@@ -159,7 +305,7 @@ func (c *Compiler) loadSymbol(s Symbol) {
 	}
 }
 
-func (c *Compiler) storeSymbol(s Symbol) {
+func (c *Compiler) storeSlot(s Symbol) {
 	if s.Name == "_" {
 		c.emit(code.OpSetNil)
 	} else if s.Scope == GlobalScope {
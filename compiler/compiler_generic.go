@@ -0,0 +1,259 @@
+package compiler
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"goscript/code"
+	"goscript/object"
+	"goscript/program"
+	"strings"
+)
+
+// compileGenericCall 类型实参要等实参编译完才能推断出来，先占住函数的位置再回填
+func (c *Compiler) compileGenericCall(node *ast.CallExpr, name string, fn *object.Function) (*Symbol, error) {
+	pos := c.emit(code.OpClosure, 0, 0)
+	args := make([]object.Object, len(node.Args))
+	consts := map[int]int{}
+	for i, arg := range node.Args {
+		symbol, err := c.compileExpr(arg)
+		if err != nil {
+			return nil, err
+		}
+		if symbol != nil {
+			args[i] = symbol.Type
+		}
+		if object.ConstOperand(arg, c.SymbolTable) && c.lastInstructionIs(code.OpConstant) {
+			consts[i] = c.scopes[c.scopeIndex].lastInstruction.Position
+		}
+	}
+
+	typeArgs, err := object.InferTypeArgs(name, fn, args, node.Ellipsis.IsValid(), c.SymbolTable)
+	if err != nil {
+		line, column := parsePos(node.Pos())
+		return nil, fmt.Errorf("%d:%d %s", line, column, err)
+	}
+	if err := c.convertConstArgs(node, fn, args, typeArgs, consts); err != nil {
+		return nil, err
+	}
+	instance, idx, err := c.instantiate(name, fn, typeArgs)
+	if err != nil {
+		return nil, err
+	}
+	c.replaceInstruction(pos, code.Make(code.OpClosure, idx, 0))
+
+	if node.Ellipsis.IsValid() {
+		c.emit(code.OpELLIPSIS, len(node.Args))
+	} else {
+		c.emit(code.OpCall, len(node.Args))
+	}
+	return &Symbol{Type: instance}, nil
+}
+
+// convertConstArgs 推断出类型实参后，类型不同的常量实参按参数的类型重新求值，
+// 替换已生成的常量；consts 为常量实参的序号到指令位置
+func (c *Compiler) convertConstArgs(node *ast.CallExpr, fn *object.Function, args, typeArgs []object.Object, consts map[int]int) error {
+	if len(consts) == 0 || node.Ellipsis.IsValid() {
+		return nil
+	}
+	table := NewEnclosedSymbolTable(c.SymbolTable)
+	for i, name := range object.TypeParamNames(fn.TypeParams) {
+		table.DefineType(name, &object.TypeArg{Name: name, Zero: typeArgs[i]})
+	}
+	for i, pos := range consts {
+		if i >= len(fn.Params) || (fn.Variadic && i == len(fn.Params)-1) {
+			continue
+		}
+		typ := object.GetDefaultValueFromElem(fn.Params[i].Type, table)
+		if !object.IsConstType(object.Unnamed(typ).Type()) || object.TypeName(typ) == object.TypeName(args[i]) {
+			continue
+		}
+		cst, err := object.EvalConst(node.Args[i], c.SymbolTable, -1)
+		if err != nil {
+			return constErr(err)
+		}
+		obj, err := cst.Assign(node.Args[i], typ, "argument to "+types.ExprString(node.Fun))
+		if err != nil {
+			return constErr(err)
+		}
+		c.replaceInstruction(pos, code.Make(code.OpConstant, c.addConstants(obj)))
+	}
+	return nil
+}
+
+// compileInstantiate 不调用的泛型函数必须给出全部类型实参
+func (c *Compiler) compileInstantiate(node ast.Expr) (*Symbol, error) {
+	line, column := parsePos(node.Pos())
+	x, indices := object.TypeIndices(node)
+	ident, _ := x.(*ast.Ident)
+	if ident == nil {
+		return nil, fmt.Errorf("%d:%d not support %T", line, column, x)
+	}
+	symbol, ok := c.SymbolTable.Resolve(ident.Name)
+	if !ok || symbol.Scope != GenericScope {
+		return nil, fmt.Errorf("%d:%d %s is not a generic function", line, column, ident.Name)
+	}
+	fn, err := c.explicitTypeArgs(symbol.Type.(*object.Function), ident.Name, indices)
+	if err != nil {
+		return nil, fmt.Errorf("%d:%d %s", line, column, err)
+	}
+	typeArgs, err := object.InferTypeArgs(ident.Name, fn, nil, false, c.SymbolTable)
+	if err != nil {
+		return nil, fmt.Errorf("%d:%d %s", line, column, err)
+	}
+	instance, idx, err := c.instantiate(ident.Name, fn, typeArgs)
+	if err != nil {
+		return nil, err
+	}
+	c.emit(code.OpClosure, idx, 0)
+	return &Symbol{Type: instance}, nil
+}
+
+func (c *Compiler) explicitTypeArgs(fn *object.Function, name string, indices []ast.Expr) (*object.Function, error) {
+	typeArgs, err := object.TypeArgsOf(indices, c.SymbolTable)
+	if err != nil {
+		return nil, err
+	}
+	names := object.TypeParamNames(fn.TypeParams)
+	if len(typeArgs) > len(names) {
+		return nil, fmt.Errorf("got %d type arguments but %s has %d type parameters", len(typeArgs), name, len(names))
+	}
+	generic := *fn
+	generic.TypeArgs = typeArgs
+	return &generic, nil
+}
+
+// instantiate 每组类型实参只编译一次，实例按 Map[int,string] 命名，不占用全局变量的槽位
+func (c *Compiler) instantiate(name string, fn *object.Function, typeArgs []object.Object) (*object.Function, int, error) {
+	instance := *fn
+	instance.TypeArgs = typeArgs
+
+	names := make([]string, len(typeArgs))
+	for i, arg := range typeArgs {
+		names[i] = object.TypeName(arg)
+	}
+	key := fmt.Sprintf("%s[%s]", name, strings.Join(names, ","))
+	if idx, ok := c.instances[key]; ok {
+		return &instance, idx, nil
+	}
+
+	// 先占住位置，递归调用自身时使用同一个实例
+	idx := c.addConstants(nil)
+	c.instances[key] = idx
+	compiledFn, err := c.compileInstance(&instance)
+	if err != nil {
+		delete(c.instances, key)
+		return nil, 0, err
+	}
+	compiledFn.Name = key
+	c.constants[idx] = compiledFn
+	return &instance, idx, nil
+}
+
+// compileInstance 在全局作用域中编译，类型参数绑定到类型实参
+func (c *Compiler) compileInstance(fn *object.Function) (*object.CompiledFunction, error) {
+	saved := c.SymbolTable
+	root := saved
+	for root.Outer != nil {
+		root = root.Outer
+	}
+	c.SymbolTable = NewEnclosedSymbolTable(root)
+	for i, name := range object.TypeParamNames(fn.TypeParams) {
+		c.SymbolTable.DefineType(name, &object.TypeArg{Name: name, Zero: fn.TypeArgs[i]})
+	}
+	compiledFn, err := c.compileFunction(fn, "")
+	c.SymbolTable = saved
+	return compiledFn, err
+}
+
+// compileGenericMethods 泛型类型的每个实例都编译一份方法，编译方法时可能产生新的实例
+func (c *Compiler) compileGenericMethods() error {
+	for compiled := true; compiled; {
+		compiled = false
+		for _, g := range c.generics {
+			for _, st := range g.Instances() {
+				for _, name := range g.MethodNames() {
+					methodName := program.MethodName(st.Name, name)
+					if c.methods[methodName] {
+						continue
+					}
+					c.methods[methodName] = true
+					instance := *g.Methods[name]
+					instance.TypeArgs = st.TypeArgs
+					compiledFn, err := c.compileInstance(&instance)
+					if err != nil {
+						return err
+					}
+					compiledFn.Name = methodName
+					c.addConstants(compiledFn)
+					compiled = true
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// truncateConstants 编译失败时丢弃新加入的常量，以及指向它们的实例
+func (c *Compiler) truncateConstants(n int) {
+	c.constants = c.constants[:n]
+	for key, idx := range c.instances {
+		if idx >= n {
+			delete(c.instances, key)
+		}
+	}
+}
+
+// compileExpr 编译表达式并返回它的类型，类型未知时返回 nil
+func (c *Compiler) compileExpr(expr ast.Expr) (*Symbol, error) {
+	symbol, err := c.compileConstExpr(expr, nil, "assignment")
+	if err != nil || symbol != nil {
+		return symbol, err
+	}
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		symbol, err := c.compileIdent(expr)
+		return &symbol, err
+	case *ast.BasicLit:
+		obj, err := c.compileBasicLit(expr, nil)
+		return &Symbol{Type: obj}, err
+	case *ast.CompositeLit:
+		return c.compileCompositeLit(expr, nil)
+	case *ast.FuncLit:
+		return c.compileFuncLit(expr)
+	case *ast.CallExpr:
+		fnSymbol, err := c.compileCallExpr(expr)
+		if err != nil {
+			return nil, err
+		}
+		return resultSymbol(fnSymbol, 0, c.SymbolTable), nil
+	case *ast.SelectorExpr:
+		return c.compileSelectorExpr(expr)
+	case *ast.SliceExpr:
+		return c.compileSliceExpr(expr)
+	case *ast.StarExpr:
+		return c.compileStarExpr(expr)
+	case *ast.IndexListExpr:
+		return c.compileInstantiate(expr)
+	case *ast.UnaryExpr:
+		if expr.Op == token.ARROW || expr.Op == token.AND {
+			return c.compileUnaryExpr(expr, nil)
+		}
+	case *ast.IndexExpr:
+		symbol, err := c.compileIndexExpr(expr)
+		if err != nil || symbol.Type == nil {
+			return nil, err
+		}
+		switch x := symbol.Type.(type) {
+		case *object.Array:
+			return &Symbol{Type: object.GetDefaultObject(x.ElemType.String())}, nil
+		case *object.Hash:
+			return &Symbol{Type: object.GetDefaultObject(x.ValueType.String())}, nil
+		case *object.Function:
+			return symbol, nil
+		}
+		return nil, nil
+	}
+	return nil, c.compile(expr, nil)
+}
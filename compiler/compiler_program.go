@@ -1,14 +1,15 @@
 package compiler
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"go/ast"
 	"go/token"
+	"go/types"
 	"goscript/code"
 	"goscript/object"
 	"goscript/program"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -19,6 +20,8 @@ const (
 	VarIdent VarType = iota
 	VarIndex
 	VarAttr
+	VarDeref
+	VarTemp // 并行赋值的临时变量，总是在当前作用域新定义
 )
 
 type Variable struct {
@@ -26,13 +29,57 @@ type Variable struct {
 	Index     ast.Node
 	Attribute ast.Node
 	Type      VarType
+	Pos       token.Pos
+	Define    bool // := 定义的变量
 }
 
 func (c *Compiler) CompileProgram(prog *program.Program) error {
 	tokenFile = prog.TokenFile
+	c.fset = prog.Fset
+	// REPL 用同一个 Compiler 编译每次输入，main 每次从头开始，上次出错时可能停在函数内部
+	for c.SymbolTable.Outer != nil {
+		c.SymbolTable = c.SymbolTable.Outer
+	}
+	c.scopes = []CompilationScope{{instructions: code.Instructions{}}}
+	c.scopeIndex = 0
+
 	store := prog.Env.GetStore()
 	symbolTable := c.SymbolTable
 	for name, value := range store {
+		switch value := value.(type) {
+		case *object.StructType, *object.InterfaceType:
+			symbolTable.DefineType(name, value)
+		case *object.NamedType:
+			for method, fn := range value.Methods {
+				if fn.PointerRecv() {
+					c.ptrMethods[method] = true
+				}
+			}
+			symbolTable.DefineType(name, value)
+		case *object.GenericType:
+			if _, ok := symbolTable.Resolve(name); !ok {
+				c.generics = append(c.generics, value)
+			}
+			symbolTable.DefineType(name, value)
+		case *object.Constant:
+			symbolTable.DefineConst(name, value)
+		case *object.Function:
+			if value.TypeParams != nil {
+				symbolTable.DefineGeneric(name, value)
+			}
+		}
+	}
+	sort.Slice(c.generics, func(i, j int) bool {
+		return c.generics[i].Name < c.generics[j].Name
+	})
+	// 按名字排序，编译结果不依赖 map 的遍历顺序
+	names := make([]string, 0, len(store))
+	for name := range store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := store[name]
 		fn, ok := value.(*object.Function)
 		if _, exist := symbolTable.Resolve(name); exist {
 			continue
@@ -43,7 +90,7 @@ func (c *Compiler) CompileProgram(prog *program.Program) error {
 			err := c.compileAstFunction(name, fn, symbolTable, constantNum)
 			if err != nil {
 				symbolTable.DeleteSymbol(name)
-				c.constants = c.constants[:constantNum]
+				c.truncateConstants(constantNum)
 
 				msg := err.Error()
 				if !strings.HasPrefix(msg, "undefined") {
@@ -67,21 +114,25 @@ func (c *Compiler) CompileProgram(prog *program.Program) error {
 	}
 	c.globalDecls = prog.GlobalDecls
 
+	symbolTable.Addressed = make(map[string]bool)
+	for _, stmt := range prog.Statements {
+		c.addressed(stmt, symbolTable.Addressed)
+	}
 	num := len(prog.Statements)
 	for i, stmt := range prog.Statements {
 		err := c.compile(stmt, nil)
 		if err != nil {
-			return nil
+			return err
 		}
 		switch stmt.(type) {
-		case *ast.DeclStmt, *ast.AssignStmt:
+		case *ast.DeclStmt, *ast.AssignStmt, *ast.DeferStmt, *ast.GoStmt, *ast.SendStmt, *ast.SelectStmt:
 		default:
 			if num == i+1 {
 				c.emit(code.OpPop)
 			}
 		}
 	}
-	return nil
+	return c.compileGenericMethods()
 }
 
 func (c *Compiler) compileAstFunction(fnName string, fn *object.Function, symbolTable *SymbolTable, constantNum int) error {
@@ -92,8 +143,13 @@ func (c *Compiler) compileAstFunction(fnName string, fn *object.Function, symbol
 	_ = symbolTable.DefineWithType(fnName, fnTy)
 	c.constants = append(c.constants, nil)
 
+	// 出错时可能停在函数或循环体内部，恢复作用域后才能先编译依赖的函数再重试
+	scopes, symbols := len(c.scopes), c.SymbolTable
 	compiledFn, err := c.compileFunction(fn, fnName)
 	if err != nil {
+		c.scopes = c.scopes[:scopes]
+		c.scopeIndex = scopes - 1
+		c.SymbolTable = symbols
 		return err
 	}
 
@@ -103,6 +159,17 @@ func (c *Compiler) compileAstFunction(fnName string, fn *object.Function, symbol
 }
 
 func (c *Compiler) compile(node ast.Node, defaultType object.Object) error {
+	if pos := node.Pos(); pos.IsValid() {
+		saved := c.pos
+		c.pos = pos
+		defer func() { c.pos = saved }()
+	}
+	if expr, ok := node.(ast.Expr); ok {
+		symbol, err := c.compileConstExpr(expr, defaultType, "assignment")
+		if err != nil || symbol != nil {
+			return err
+		}
+	}
 	switch node := node.(type) {
 	case *ast.DeclStmt:
 		return c.compile(node.Decl, defaultType)
@@ -116,49 +183,83 @@ func (c *Compiler) compile(node ast.Node, defaultType object.Object) error {
 		return c.compileIncDecStmt(node)
 	case *ast.ReturnStmt:
 		return c.compileReturnStmt(node)
+	case *ast.DeferStmt:
+		return c.compileDeferStmt(node)
+	case *ast.GoStmt:
+		return c.compileGoStmt(node)
+	case *ast.SendStmt:
+		return c.compileSendStmt(node)
+	case *ast.SelectStmt:
+		return c.compileSelectStmt(node, "")
 	case *ast.BlockStmt:
 		return c.compileBlockStmt(node, defaultType)
 	case *ast.IfStmt:
 		return c.compileIfStmt(node)
+	case *ast.SwitchStmt:
+		return c.compileSwitchStmt(node, "")
+	case *ast.TypeSwitchStmt:
+		return c.compileTypeSwitchStmt(node, "")
 	case *ast.ForStmt:
-		return c.compileForStmt(node)
+		return c.compileForStmt(node, "")
 	case *ast.RangeStmt:
-		return c.compileRangeStmt(node)
+		return c.compileRangeStmt(node, "")
+	case *ast.LabeledStmt:
+		return c.compileLabeledStmt(node)
+	case *ast.EmptyStmt:
 	case *ast.BinaryExpr:
 		return c.compileBinaryExpr(node)
 	case *ast.ParenExpr:
 		return c.compile(node.X, defaultType)
 	case *ast.UnaryExpr:
-		err := c.compile(node.X, defaultType)
+		_, err := c.compileUnaryExpr(node, defaultType)
 		if err != nil {
 			return err
 		}
-		switch node.Op {
-		case token.NOT:
-			c.emit(code.OpNOT)
-		case token.SUB:
-			c.emit(code.OpPrefixSub)
-		case token.ADD:
-		default:
-			return fmt.Errorf("operator %s not support", node.Op)
+	case *ast.StarExpr:
+		_, err := c.compileStarExpr(node)
+		if err != nil {
+			return err
 		}
 	case *ast.IndexExpr:
 		_, err := c.compileIndexExpr(node)
 		if err != nil {
 			return err
 		}
+	case *ast.IndexListExpr:
+		_, err := c.compileInstantiate(node)
+		if err != nil {
+			return err
+		}
+	case *ast.SliceExpr:
+		_, err := c.compileSliceExpr(node)
+		if err != nil {
+			return err
+		}
+	case *ast.SelectorExpr:
+		_, err := c.compileSelectorExpr(node)
+		if err != nil {
+			return err
+		}
 	case *ast.FuncLit:
 		_, err := c.compileFuncLit(node)
 		if err != nil {
 			return err
 		}
 	case *ast.CallExpr:
-		return c.compileCallExpr(node)
+		_, err := c.compileCallExpr(node)
+		if err != nil {
+			return err
+		}
 	case *ast.CompositeLit:
 		_, err := c.compileCompositeLit(node, defaultType)
 		if err != nil {
 			return err
 		}
+	case *ast.TypeAssertExpr:
+		_, err := c.compileTypeAssertExpr(node, false)
+		if err != nil {
+			return err
+		}
 	case *ast.Ident:
 		_, err := c.compileIdent(node)
 		if err != nil {
@@ -170,12 +271,19 @@ func (c *Compiler) compile(node ast.Node, defaultType object.Object) error {
 			return err
 		}
 	case *ast.BranchStmt:
+		if node.Label != nil {
+			c.compileBranch(node.Tok, node.Label.Obj.Decl.(*ast.LabeledStmt))
+			return nil
+		}
 		if node.Tok == token.CONTINUE {
 			c.emit(code.OpContinue)
 			return nil
 		} else if node.Tok == token.BREAK {
-			c.emit(code.OpBreak)
+			c.emitBreak()
 			return nil
+		} else if node.Tok == token.FALLTHROUGH {
+			line, column := parsePos(node.Pos())
+			return fmt.Errorf("%d:%d fallthrough statement out of place", line, column)
 		} else {
 			panic(fmt.Sprintf("compiler: not support ast.BranchStmt %s", node.Tok))
 		}
@@ -185,6 +293,178 @@ func (c *Compiler) compile(node ast.Node, defaultType object.Object) error {
 	return nil
 }
 
+// compileConstExpr 引用了常量的表达式在编译期求值，结果加入常量池；
+// 返回 nil 表示不是常量表达式，按普通表达式编译
+func (c *Compiler) compileConstExpr(expr ast.Expr, typ object.Object, context string) (*Symbol, error) {
+	if !object.UsesConst(expr, c.SymbolTable) {
+		return nil, nil
+	}
+	return c.foldConst(expr, typ, context)
+}
+
+// compileConstValue 声明和赋值的右值，字面量之间的运算也整体求值以确定变量类型；
+// 有类型要求时字面量转换为该类型
+func (c *Compiler) compileConstValue(expr ast.Expr, typ object.Object, context string) (*Symbol, error) {
+	if object.ConstBinary(expr, c.SymbolTable) || typ != nil && object.ConstOperand(expr, c.SymbolTable) {
+		return c.foldConst(expr, typ, context)
+	}
+	return c.compileConstExpr(expr, typ, context)
+}
+
+func (c *Compiler) foldConst(expr ast.Expr, typ object.Object, context string) (*Symbol, error) {
+	cst, err := object.EvalConst(expr, c.SymbolTable, -1)
+	if err == object.ErrNotConstant {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, constErr(err)
+	}
+	if typ != nil && !object.IsConstType(typ.Type()) && typ.Type() != object.INTERFACE_OBJ {
+		typ = nil
+	}
+	obj, err := cst.Assign(expr, typ, context)
+	if err != nil {
+		return nil, constErr(err)
+	}
+	c.emit(code.OpConstant, c.addConstants(obj))
+	return &Symbol{Type: obj}, nil
+}
+
+// operandType 变量操作数的类型，用于确定另一侧常量的类型
+func (c *Compiler) operandType(expr ast.Expr) object.Object {
+	if index, ok := expr.(*ast.IndexExpr); ok {
+		// 字符串的元素是 byte
+		if typ := c.operandType(index.X); typ != nil && typ.Type() == object.STRING_OBJ {
+			return &object.Byte{}
+		}
+		if ident, ok := index.X.(*ast.Ident); ok {
+			if symbol, ok := c.SymbolTable.lookup(ident.Name); ok {
+				return object.ElemConstType(symbol.Type)
+			}
+		}
+		return nil
+	}
+	switch x := expr.(type) {
+	case *ast.ParenExpr:
+		return c.operandType(x.X)
+	case *ast.UnaryExpr:
+		if x.Op == token.SUB || x.Op == token.ADD || x.Op == token.XOR {
+			return c.operandType(x.X)
+		}
+		return nil
+	}
+	if binary, ok := expr.(*ast.BinaryExpr); ok {
+		if !arithmeticOp(binary.Op) {
+			return nil
+		}
+		if typ := c.operandType(binary.X); typ != nil || binary.Op == token.SHL || binary.Op == token.SHR {
+			return typ
+		}
+		return c.operandType(binary.Y)
+	}
+	if call, ok := expr.(*ast.CallExpr); ok {
+		// 类型转换的结果是该类型
+		ident, ok := call.Fun.(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		symbol, ok := c.SymbolTable.Resolve(ident.Name)
+		if !ok {
+			return nil
+		}
+		if symbol.Scope != BuiltinScope {
+			return object.ConstResultType(symbol.Type, c.SymbolTable)
+		}
+		if object.IntBuiltin(ident.Name) {
+			return &object.Int{}
+		}
+		if object.TypedBuiltin(ident.Name) {
+			for _, arg := range call.Args {
+				if typ := c.operandType(arg); typ != nil {
+					return object.BuiltinResultType(ident.Name, typ)
+				}
+			}
+			return nil
+		}
+		if typ := object.GetDefaultObject(ident.Name); object.IsConstType(typ.Type()) {
+			return typ
+		}
+		return nil
+	}
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	symbol, ok := c.SymbolTable.lookup(ident.Name)
+	if !ok || symbol.Scope == ConstScope || symbol.Type == nil || !object.IsConstType(object.Unnamed(symbol.Type).Type()) {
+		return nil
+	}
+	return symbol.Type
+}
+
+// valueType 变量和复合字面量的类型，未知时为 nil
+func (c *Compiler) valueType(expr ast.Expr) object.Object {
+	switch x := expr.(type) {
+	case *ast.ParenExpr:
+		return c.valueType(x.X)
+	case *ast.CompositeLit:
+		if x.Type == nil {
+			return nil
+		}
+		if typ := object.GetDefaultValueWithExpr(x.Type, c.SymbolTable); !object.IsError(typ) {
+			return typ
+		}
+	case *ast.Ident:
+		symbol, ok := c.SymbolTable.lookup(x.Name)
+		if ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope || symbol.Scope == FreeScope) {
+			return symbol.Type
+		}
+	}
+	return nil
+}
+
+// checkBuiltinArgs 参数的类型已知时在编译时检查内置函数的参数
+func (c *Compiler) checkBuiltinArgs(node *ast.CallExpr, name string) error {
+	if node.Ellipsis.IsValid() {
+		return nil
+	}
+	args := make([]object.Object, len(node.Args))
+	for i, arg := range node.Args {
+		if args[i] = c.valueType(arg); args[i] != nil {
+			continue
+		}
+		if lit, ok := arg.(*ast.BasicLit); ok {
+			args[i], _ = parseBasicLit(lit)
+			continue
+		}
+		args[i] = c.operandType(arg)
+	}
+	if err := object.CheckBuiltinArgs(name, args); err != nil {
+		line, column := parsePos(node.Pos())
+		return fmt.Errorf("%d:%d %s", line, column, err)
+	}
+	return nil
+}
+
+// arithmeticOp 结果和操作数类型相同的运算
+func arithmeticOp(op token.Token) bool {
+	switch op {
+	case token.ADD, token.SUB, token.MUL, token.QUO, token.REM,
+		token.AND, token.OR, token.XOR, token.SHL, token.SHR, token.AND_NOT:
+		return true
+	}
+	return false
+}
+
+// constErr 常量求值的错误加上位置
+func constErr(err error) error {
+	if cerr, ok := err.(*object.ConstError); ok {
+		line, column := parsePos(cerr.Pos)
+		return fmt.Errorf("%d:%d %s", line, column, cerr.Msg)
+	}
+	return err
+}
+
 func (c *Compiler) compileBasicLit(node *ast.BasicLit, defaultType object.Object) (object.Object, error) {
 	basic, err := parseBasicLit(node)
 	if err != nil {
@@ -193,7 +473,8 @@ func (c *Compiler) compileBasicLit(node *ast.BasicLit, defaultType object.Object
 	if defaultType != nil && basic.Type() != defaultType.Type() {
 		basic = object.ConvertValueWithType(basic, defaultType)
 		if object.IsError(basic) {
-			return nil, errors.New(basic.(*object.Error).Message)
+			line, column := parsePos(node.Pos())
+			return nil, fmt.Errorf("%d:%d %s", line, column, basic.(*object.Error).Message)
 		}
 	}
 	c.emit(code.OpConstant, c.addConstants(basic))
@@ -204,7 +485,17 @@ func (c *Compiler) compileGenDecl(node *ast.GenDecl) error {
 	line, column := parsePos(node.Pos())
 	switch node.Tok {
 	case token.CONST:
-		return fmt.Errorf("%d:%d not support const", line, column)
+		err := object.DeclareConsts(node, c.SymbolTable, c.SymbolTable, func(name *ast.Ident, cst *object.Constant) error {
+			if _, ok := c.SymbolTable.Store[name.Name]; ok {
+				line, column := parsePos(name.Pos())
+				return fmt.Errorf("%d:%d %s redeclared in this block", line, column, name.Name)
+			}
+			if name.Name != "_" {
+				c.SymbolTable.DefineConst(name.Name, cst)
+			}
+			return nil
+		})
+		return constErr(err)
 	case token.VAR:
 		for _, spec := range node.Specs {
 			err := c.compileGenVar(spec.(*ast.ValueSpec))
@@ -213,6 +504,23 @@ func (c *Compiler) compileGenDecl(node *ast.GenDecl) error {
 			}
 		}
 		return nil
+	case token.TYPE:
+		for _, spec := range node.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			typ := program.ParseTypeSpec(typeSpec)
+			if object.IsError(typ) {
+				line, column = parsePos(typeSpec.Pos())
+				return fmt.Errorf("%d:%d %s", line, column, typ)
+			}
+			if it, ok := typ.(*object.InterfaceType); ok {
+				if err := it.ResolveEmbeds(c.SymbolTable); err != nil {
+					line, column = parsePos(typeSpec.Pos())
+					return fmt.Errorf("%d:%d %s", line, column, err)
+				}
+			}
+			c.SymbolTable.DefineType(typeSpec.Name.Name, typ)
+		}
+		return nil
 	default:
 		return fmt.Errorf("%d:%d ast.GenDecl with not known type: %s", line, column, node.Tok)
 	}
@@ -237,21 +545,48 @@ func (c *Compiler) compileGenVar(spec *ast.ValueSpec) error {
 
 	var defObj object.Object
 	if spec.Type != nil {
-		defObj = object.GetDefaultValueWithExpr(spec.Type)
+		defObj = object.GetDefaultValueWithExpr(spec.Type, c.SymbolTable)
+		if object.IsError(defObj) {
+			line, column := parsePos(spec.Type.Pos())
+			return fmt.Errorf("%d:%d %s", line, column, defObj)
+		}
 	}
 
 	if spec.Values == nil {
-		idx := c.addConstants(defObj)
 		for _, v := range vars {
-			c.emit(code.OpConstant, idx)
+			c.emitZero(defObj)
 			symbol := c.SymbolTable.DefineWithType(v, defObj)
-			c.storeSymbol(symbol)
+			c.initSymbol(symbol)
 		}
 		return nil
 	}
 
 	n := 0
 	for _, expr := range spec.Values {
+		symbol, err := c.compileConstValue(expr, defObj, "variable declaration")
+		if err != nil {
+			return err
+		}
+		if symbol != nil {
+			typ, err := varType(defObj, symbol.Type, expr)
+			if err != nil {
+				return err
+			}
+			c.initSymbol(c.SymbolTable.DefineWithType(vars[n], typ))
+			n++
+			continue
+		}
+		// 字面量赋值给指定类型的变量时检查能否表示
+		if defObj != nil && object.IsConstType(defObj.Type()) {
+			if cst, err := object.EvalConst(expr, c.SymbolTable, -1); err == nil {
+				if _, err = cst.Assign(expr, defObj, "variable declaration"); err != nil {
+					return constErr(err)
+				}
+			} else if err != object.ErrNotConstant {
+				return constErr(err)
+			}
+		}
+
 		switch expr := expr.(type) {
 		case *ast.BasicLit:
 			obj, err := c.compileBasicLit(expr, defObj)
@@ -259,78 +594,42 @@ func (c *Compiler) compileGenVar(spec *ast.ValueSpec) error {
 				return err
 			}
 			symbol := c.SymbolTable.DefineWithType(vars[n], obj)
-			c.storeSymbol(symbol)
+			c.initSymbol(symbol)
 			n++
 		case *ast.Ident:
 			symbol, err := c.compileIdent(expr)
 			if err != nil {
 				return err
 			}
-			symbol = c.SymbolTable.DefineWithType(vars[n], symbol.Type)
-			c.storeSymbol(symbol)
+			typ, err := varType(defObj, symbol.Type, expr)
+			if err != nil {
+				return err
+			}
+			symbol = c.SymbolTable.DefineWithType(vars[n], typ)
+			c.initSymbol(symbol)
 			n++
 		case *ast.CallExpr:
-			fun := expr.Fun
-			switch fn := fun.(type) {
-			case *ast.Ident:
-				symbol, ok := c.SymbolTable.Resolve(fn.Name)
-				if !ok {
-					return fmt.Errorf("undefined: %s", fn.Name)
+			fnSymbol, err := c.compileCallExpr(expr)
+			if err != nil {
+				return err
+			}
+			num := 1
+			if len(spec.Values) == 1 {
+				num = len(vars)
+			}
+			for i := 0; i < num; i++ {
+				rtSymbol := resultSymbol(fnSymbol, i, c.SymbolTable)
+				if defObj != nil {
+					rtSymbol = &Symbol{Type: defObj}
 				}
-				c.loadSymbol(symbol)
-
-				switch symbol.Type.Type() {
-				case object.FUNCTION_OBJ:
-					fnc := symbol.Type.(*object.Function)
-					for _, arg := range expr.Args {
-						err := c.compile(arg, nil)
-						if err != nil {
-							return err
-						}
-					}
-					nArgs := len(fnc.Params)
-					nRet := 0
-					for _, result := range fnc.Results {
-						if result.Symbol != nil {
-							obj := object.GetDefaultValueFromElem(result.Type)
-							c.emit(code.OpConstant, c.addConstants(obj))
-							nRet++
-						}
-					}
-					c.emit(code.OpCall, nArgs+nRet)
-
-					if fnc.Results[0].IsFun {
-						rtSymbol := Symbol{Type: &object.Function{Params: fnc.Results[0].Params, Results: fnc.Results[0].Results}}
-						err := c.assignValue(Variable{Name: vars[0], Type: VarIdent}, &rtSymbol)
-						if err != nil {
-							return err
-						}
-						n++
-					} else {
-						for i, s := range vars {
-							rtSymbol := Symbol{Type: object.GetDefaultValueFromElem(fnc.Results[i].Type)}
-							err := c.assignValue(Variable{Name: s, Type: VarIdent}, &rtSymbol)
-							if err != nil {
-								return err
-							}
-							n++
-						}
-					}
-				case object.BUILTIN_OBJ:
-					for _, arg := range expr.Args {
-						err := c.compile(arg, nil)
-						if err != nil {
-							return err
-						}
-					}
-					c.emit(code.OpCall, len(expr.Args))
-
-					err := c.assignValue(Variable{Name: vars[0], Type: VarIdent}, nil)
-					if err != nil {
-						return err
-					}
-					n++
+				var symbol Symbol
+				if rtSymbol != nil {
+					symbol = c.SymbolTable.DefineWithType(vars[n], rtSymbol.Type)
+				} else {
+					symbol = c.SymbolTable.Define(vars[n])
 				}
+				c.initSymbol(symbol)
+				n++
 			}
 		case *ast.IndexExpr:
 			rtSymbol, err := c.compileIndexExpr(expr)
@@ -343,20 +642,20 @@ func (c *Compiler) compileGenVar(spec *ast.ValueSpec) error {
 					defObj = object.GetDefaultObject(rtSymbol.Type.(*object.Array).ElemType.String())
 				}
 				symbol := c.SymbolTable.DefineWithType(vars[n], defObj)
-				c.storeSymbol(symbol)
+				c.initSymbol(symbol)
 				n++
 			} else if rtSymbol.Type.Type() == object.HASH_OBJ {
 				if defObj == nil {
 					defObj = object.GetDefaultObject(rtSymbol.Type.(*object.Hash).ValueType.String())
 				}
 				symbol := c.SymbolTable.DefineWithType(vars[n], defObj)
-				c.storeSymbol(symbol)
+				c.initSymbol(symbol)
 				n++
 
 				if len(vars) == 2 && len(spec.Values) == 1 {
 					defObj = object.GetDefaultObject(object.BOOLEAN_OBJ.String())
 					symbol = c.SymbolTable.DefineWithType(vars[n], defObj)
-					c.storeSymbol(symbol)
+					c.initSymbol(symbol)
 					n++
 				}
 			}
@@ -366,7 +665,78 @@ func (c *Compiler) compileGenVar(spec *ast.ValueSpec) error {
 				return err
 			}
 			symbol := c.SymbolTable.Define(vars[n])
-			c.storeSymbol(symbol)
+			c.initSymbol(symbol)
+			n++
+		case *ast.UnaryExpr:
+			if expr.Op == token.ARROW {
+				commaOk := len(vars) == 2 && len(spec.Values) == 1
+				rtSymbol, err := c.compileRecvExpr(expr, commaOk)
+				if err != nil {
+					return err
+				}
+				typ := defObj
+				if typ == nil && rtSymbol != nil {
+					typ = rtSymbol.Type
+				}
+				symbol := c.SymbolTable.DefineWithType(vars[n], typ)
+				c.initSymbol(symbol)
+				n++
+				if commaOk {
+					symbol = c.SymbolTable.DefineWithType(vars[n], object.FALSE)
+					c.initSymbol(symbol)
+					n++
+				}
+				continue
+			}
+			rtSymbol, err := c.compileUnaryExpr(expr, defObj)
+			if err != nil {
+				return err
+			}
+			var symbol Symbol
+			if defObj != nil {
+				symbol = c.SymbolTable.DefineWithType(vars[n], defObj)
+			} else if rtSymbol != nil {
+				symbol = c.SymbolTable.DefineWithType(vars[n], rtSymbol.Type)
+			} else {
+				symbol = c.SymbolTable.Define(vars[n])
+			}
+			c.initSymbol(symbol)
+			n++
+		case *ast.StarExpr:
+			rtSymbol, err := c.compileStarExpr(expr)
+			if err != nil {
+				return err
+			}
+			typ := defObj
+			if typ == nil && rtSymbol != nil {
+				typ = rtSymbol.Type
+			}
+			symbol := c.SymbolTable.DefineWithType(vars[n], typ)
+			c.initSymbol(symbol)
+			n++
+		case *ast.SliceExpr:
+			rtSymbol, err := c.compileSliceExpr(expr)
+			if err != nil {
+				return err
+			}
+			typ := defObj
+			if typ == nil {
+				typ = rtSymbol.Type
+			}
+			symbol := c.SymbolTable.DefineWithType(vars[n], typ)
+			c.initSymbol(symbol)
+			n++
+		case *ast.SelectorExpr:
+			rtSymbol, err := c.compileSelectorExpr(expr)
+			if err != nil {
+				return err
+			}
+			typ, err := varType(defObj, rtSymbol.Type, expr)
+			if err != nil {
+				return err
+			}
+			symbol := c.SymbolTable.DefineWithType(vars[n], typ)
+			c.initSymbol(symbol)
 			n++
 		case *ast.FuncLit:
 			fnSymbol, err := c.compileFuncLit(expr)
@@ -374,16 +744,34 @@ func (c *Compiler) compileGenVar(spec *ast.ValueSpec) error {
 				return err
 			}
 			symbol := c.SymbolTable.DefineWithType(vars[n], fnSymbol.Type)
-			c.storeSymbol(symbol)
+			c.initSymbol(symbol)
 			n++
 		case *ast.CompositeLit:
 			rtSymbol, err := c.compileCompositeLit(expr, defObj)
 			if err != nil {
 				return err
 			}
-			symbol := c.SymbolTable.DefineWithType(vars[n], (*rtSymbol).Type)
-			c.storeSymbol(symbol)
+			typ, err := varType(defObj, rtSymbol.Type, expr)
+			if err != nil {
+				return err
+			}
+			symbol := c.SymbolTable.DefineWithType(vars[n], typ)
+			c.initSymbol(symbol)
+			n++
+		case *ast.TypeAssertExpr:
+			commaOk := len(vars) == 2 && len(spec.Values) == 1
+			rtSymbol, err := c.compileTypeAssertExpr(expr, commaOk)
+			if err != nil {
+				return err
+			}
+			symbol := c.SymbolTable.DefineWithType(vars[n], rtSymbol.Type)
+			c.initSymbol(symbol)
 			n++
+			if commaOk {
+				symbol = c.SymbolTable.DefineWithType(vars[n], object.FALSE)
+				c.initSymbol(symbol)
+				n++
+			}
 		default:
 			line, column := parsePos(expr.Pos())
 			return fmt.Errorf("%d:%d GenVar not support %T", line, column, expr)
@@ -398,181 +786,436 @@ func (c *Compiler) compileGenVar(spec *ast.ValueSpec) error {
 	return nil
 }
 
+// varType 声明为接口类型的变量保留接口类型，并检查值是否实现了该接口
+func varType(defObj, typ object.Object, expr ast.Expr) (object.Object, error) {
+	if typ == object.NULL && defObj != nil {
+		return defObj, nil
+	}
+	if defObj != nil && !arrayAssignable(defObj, typ) {
+		line, column := parsePos(expr.Pos())
+		return nil, fmt.Errorf("%d:%d cannot use %s (value of type %s) as %s value in variable declaration", line, column, types.ExprString(expr), object.TypeName(typ), object.TypeName(defObj))
+	}
+	iface, ok := defObj.(*object.Interface)
+	if !ok {
+		return typ, nil
+	}
+	if err := implements(iface, typ, expr, "variable declaration"); err != nil {
+		return nil, err
+	}
+	return defObj, nil
+}
+
+// implements 值的类型已知时检查是否实现了接口
+func implements(iface *object.Interface, typ object.Object, expr ast.Expr, context string) error {
+	switch typ := typ.(type) {
+	case *object.Struct, *object.Named:
+	case *object.Pointer:
+		switch typ.Elem.(type) {
+		case *object.Struct, *object.Named:
+		default:
+			return nil
+		}
+	default:
+		return nil
+	}
+	if msg := iface.InterfaceType.Missing(typ); msg != "" {
+		line, column := parsePos(expr.Pos())
+		return fmt.Errorf("%d:%d cannot use %s (value of type %s) as %s value in %s: %s", line, column, types.ExprString(expr), object.TypeName(typ), iface.InterfaceType, context, msg)
+	}
+	return nil
+}
+
+// arrayAssignable 定长数组只能赋值为同样长度的数组
+func arrayAssignable(typ, value object.Object) bool {
+	array, ok := typ.(*object.Array)
+	other, isArray := value.(*object.Array)
+	if !ok || !isArray || !(array.Fixed || other.Fixed) {
+		return true
+	}
+	return array.SameType(other)
+}
+
 func (c *Compiler) compileDefineStmt(node *ast.AssignStmt) error {
 	var vars []Variable
 	for i := 0; i < len(node.Lhs); i++ {
 		switch item := node.Lhs[i].(type) {
 		case *ast.Ident:
-			vars = append(vars, Variable{Name: item.Name, Type: VarIdent})
+			vars = append(vars, Variable{Name: item.Name, Type: VarIdent, Pos: item.Pos(), Define: node.Tok == token.DEFINE})
 		case *ast.IndexExpr:
-			tmp, _ := item.X.(*ast.Ident)
-			variable := Variable{Name: tmp.Name, Type: VarIndex}
+			variable := Variable{Type: VarIndex, Pos: item.Pos()}
 			variable.Index = item.Index
+			// g[1][0] 和 t.Arr[0] 的容器是表达式
+			if tmp, ok := item.X.(*ast.Ident); ok {
+				variable.Name = tmp.Name
+			} else {
+				variable.Attribute = item.X
+			}
+			vars = append(vars, variable)
+		case *ast.SelectorExpr:
+			variable := Variable{Name: item.Sel.Name, Type: VarAttr}
+			variable.Attribute = item.X
 			vars = append(vars, variable)
+		case *ast.StarExpr:
+			vars = append(vars, Variable{Attribute: item.X, Type: VarDeref})
 		default:
 			line, column := parsePos(item.Pos())
 			return fmt.Errorf("%d:%d not support", line, column)
 		}
 	}
 
-	n := 0
-	for _, expr := range node.Rhs {
-		switch expr := expr.(type) {
-		case *ast.BasicLit:
-			basic, err := parseBasicLit(expr)
-			if err != nil {
-				return err
-			}
-			variable := vars[n]
-			c.emit(code.OpConstant, c.addConstants(basic))
-			err = c.assignValue(variable, &Symbol{Type: basic})
-			if err != nil {
-				return err
-			}
-			n++
-		case *ast.Ident:
-			symbol, err := c.compileIdent(expr)
-			if err != nil {
-				return err
-			}
-			variable := vars[n]
-			err = c.assignValue(variable, &symbol)
+	if len(node.Rhs) == 1 && (len(vars) == 1 || multiValue(node.Rhs[0], len(vars))) {
+		if num, ok := c.builtinReturnNum(node.Rhs[0]); ok && num != len(vars) {
+			line, column := parsePos(node.Pos())
+			return fmt.Errorf("%d:%d assignment mismatch: %d variables but %d value", line, column, len(vars), num)
+		}
+		if len(vars) == 1 && vars[0].Type == VarIndex {
+			err := c.compileIndexTarget(vars[0])
 			if err != nil {
 				return err
 			}
-			n++
-		case *ast.CallExpr:
-			fun := expr.Fun
-			switch fn := fun.(type) {
-			case *ast.Ident:
-				symbol, ok := c.SymbolTable.Resolve(fn.Name)
-				if !ok {
-					return fmt.Errorf("undefined: %s", fn.Name)
-				}
-				c.loadSymbol(symbol)
-
-				switch symbol.Type.Type() {
-				case object.FUNCTION_OBJ:
-					fnc := symbol.Type.(*object.Function)
-					for _, arg := range expr.Args {
-						err := c.compile(arg, nil)
-						if err != nil {
-							return err
-						}
-					}
-					nArgs := len(fnc.Params)
-					nRet := 0
-					for _, result := range fnc.Results {
-						if result.Symbol != nil {
-							obj := object.GetDefaultValueFromElem(result.Type)
-							c.emit(code.OpConstant, c.addConstants(obj))
-							nRet++
-						}
-					}
-					c.emit(code.OpCall, nArgs+nRet)
-
-					if fnc.Results[0].IsFun {
-						rtSymbol := Symbol{Type: &object.Function{Params: fnc.Results[0].Params, Results: fnc.Results[0].Results}}
-						err := c.assignValue(vars[0], &rtSymbol)
-						if err != nil {
-							return err
-						}
-					} else {
-						for i := 0; i < len(vars); i++ {
-							rtSymbol := Symbol{Type: object.GetDefaultValueFromElem(fnc.Results[i].Type)}
-							err := c.assignValue(vars[0], &rtSymbol)
-							if err != nil {
-								return err
-							}
-						}
-					}
-				case object.BUILTIN_OBJ:
-					for _, arg := range expr.Args {
-						err := c.compile(arg, nil)
-						if err != nil {
-							return err
-						}
-					}
-					c.emit(code.OpCall, len(expr.Args))
+		}
+		if len(vars) == 1 || !hasIndexTarget(vars) {
+			return c.compileRhs(node.Rhs[0], vars, c.varType(vars[0]))
+		}
+	} else if len(vars) != len(node.Rhs) {
+		line, column := parsePos(node.Pos())
+		return fmt.Errorf("%d:%d assignment mismatch: %d variables but %d value", line, column, len(vars), len(node.Rhs))
+	}
 
-					variable := vars[n]
-					err := c.assignValue(variable, nil)
-					if err != nil {
-						return err
-					}
-					n++
-				}
-			}
-		case *ast.IndexExpr:
-			symbol, err := c.compileIndexExpr(expr)
+	// 左边的下标操作数在赋值之前求值，从后向前压栈，赋值时从前向后取出
+	for i := len(vars) - 1; i >= 0; i-- {
+		if vars[i].Type == VarIndex {
+			err := c.compileIndexTarget(vars[i])
 			if err != nil {
 				return err
 			}
+		}
+	}
+	// 右边全部求值后才赋值，a, b = b, a 的值先保存到临时变量
+	temps := make([]Variable, len(vars))
+	for i := range temps {
+		temps[i] = Variable{Name: fmt.Sprintf("assign_%d", i), Type: VarTemp}
+	}
+	if len(node.Rhs) == 1 {
+		err := c.compileRhs(node.Rhs[0], temps, c.varType(vars[0]))
+		if err != nil {
+			return err
+		}
+	}
+	for i, expr := range node.Rhs {
+		if len(node.Rhs) == 1 {
+			break
+		}
+		err := c.compileRhs(expr, temps[i:i+1], c.varType(vars[i]))
+		if err != nil {
+			return err
+		}
+	}
+	for i, temp := range temps {
+		symbol, _ := c.SymbolTable.Resolve(temp.Name)
+		c.loadSymbol(symbol)
+		err := c.assignValue(vars[i], &Symbol{Type: symbol.Type})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			variable := vars[n]
-			if symbol.Type.Type() == object.ARRAY_OBJ {
-				defObj := object.GetDefaultObject(symbol.Type.(*object.Array).ElemType.String())
-				err = c.assignValue(variable, &Symbol{Type: defObj})
-				if err != nil {
-					return err
-				}
-				n++
-			} else if symbol.Type.Type() == object.HASH_OBJ {
-				defObj := object.GetDefaultObject(symbol.Type.(*object.Hash).ValueType.String())
-				err = c.assignValue(variable, &Symbol{Type: defObj})
-				if err != nil {
-					return err
-				}
-
-				if len(vars) == 1 {
-					vars = append(vars, Variable{Name: "_", Type: VarIdent})
-				}
+func hasIndexTarget(vars []Variable) bool {
+	for _, v := range vars {
+		if v.Type == VarIndex {
+			return true
+		}
+	}
+	return false
+}
 
-				variable = vars[1]
-				defObj = object.GetDefaultObject(object.BOOLEAN_OBJ.String())
-				err = c.assignValue(variable, &Symbol{Type: defObj})
-				if err != nil {
-					return err
-				}
-				n += 2
+// compileIndexTarget 压入赋值目标 a[i] 的容器和下标
+func (c *Compiler) compileIndexTarget(v Variable) error {
+	if v.Attribute != nil {
+		// 数组元素和结构体字段按引用取出，赋值修改的是原来的容器
+		symbol, err := c.compileExpr(v.Attribute.(ast.Expr))
+		if err != nil {
+			return err
+		}
+		var typ object.Object
+		if symbol != nil {
+			typ = keyType(symbol.Type)
+		}
+		return c.compile(v.Index, typ)
+	}
+	symbol, ok := c.SymbolTable.Resolve(v.Name)
+	if !ok {
+		return fmt.Errorf("undefined: %s", v.Name)
+	}
+	switch symbol.Scope {
+	case GlobalScope, LocalScope, FreeScope:
+	default:
+		line, column := parsePos(v.Pos)
+		return fmt.Errorf("%d:%d cannot assign to %s[%s] (neither addressable nor a map index expression)", line, column, v.Name, types.ExprString(v.Index.(ast.Expr)))
+	}
+	c.loadSymbol(symbol)
+	return c.compile(v.Index, keyType(symbol.Type))
+}
+
+// multiValue 单个右值能否赋给多个变量：函数调用或 comma-ok 形式
+func multiValue(expr ast.Expr, n int) bool {
+	switch expr := expr.(type) {
+	case *ast.CallExpr:
+		return true
+	case *ast.IndexExpr, *ast.TypeAssertExpr:
+		return n == 2
+	case *ast.UnaryExpr:
+		return n == 2 && expr.Op == token.ARROW
+	}
+	return false
+}
+
+// builtinReturnNum 内置函数调用的返回值个数
+func (c *Compiler) builtinReturnNum(expr ast.Expr) (int, bool) {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return 0, false
+	}
+	ident, ok := call.Fun.(*ast.Ident)
+	if !ok {
+		return 0, false
+	}
+	if symbol, ok := c.SymbolTable.Resolve(ident.Name); !ok || symbol.Scope != BuiltinScope {
+		return 0, false
+	}
+	return object.GetBuiltinReturnNum(ident.Name)
+}
+
+// varType 赋值目标已有的类型，常量按该类型转换
+func (c *Compiler) varType(v Variable) object.Object {
+	if v.Type != VarIdent {
+		return nil
+	}
+	if symbol, ok := c.SymbolTable.Resolve(v.Name); ok {
+		return symbol.Type
+	}
+	return nil
+}
+
+// compileRhs 编译一个右值并依次赋给 vars，多返回值和 comma-ok 形式对应多个变量
+func (c *Compiler) compileRhs(expr ast.Expr, vars []Variable, typ object.Object) error {
+	n := 0
+	symbol, err := c.compileConstValue(expr, typ, "assignment")
+	if err != nil {
+		return err
+	}
+	if symbol != nil {
+		return c.assignValue(vars[n], symbol)
+	}
+
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		basic, err := parseBasicLit(expr)
+		if err != nil {
+			return err
+		}
+		variable := vars[n]
+		c.emit(code.OpConstant, c.addConstants(basic))
+		err = c.assignValue(variable, &Symbol{Type: basic})
+		if err != nil {
+			return err
+		}
+		n++
+	case *ast.Ident:
+		symbol, err := c.compileIdent(expr)
+		if err != nil {
+			return err
+		}
+		variable := vars[n]
+		err = c.assignValue(variable, &symbol)
+		if err != nil {
+			return err
+		}
+		n++
+	case *ast.CallExpr:
+		fnSymbol, err := c.compileCallExpr(expr)
+		if err != nil {
+			return err
+		}
+		for i := range vars {
+			err = c.assignValue(vars[n], resultSymbol(fnSymbol, i, c.SymbolTable))
+			if err != nil {
+				return err
 			}
-		case *ast.BinaryExpr:
-			err := c.compileBinaryExpr(expr)
+			n++
+		}
+	case *ast.IndexExpr:
+		symbol, err := c.compileIndexExpr(expr)
+		if err != nil {
+			return err
+		}
+
+		variable := vars[n]
+		if symbol.Type.Type() == object.ARRAY_OBJ {
+			defObj := object.GetDefaultObject(symbol.Type.(*object.Array).ElemType.String())
+			err = c.assignValue(variable, &Symbol{Type: defObj})
+			if err != nil {
+				return err
+			}
+			n++
+		} else if symbol.Type.Type() == object.HASH_OBJ {
+			defObj := object.GetDefaultObject(symbol.Type.(*object.Hash).ValueType.String())
+			err = c.assignValue(variable, &Symbol{Type: defObj})
+			if err != nil {
+				return err
+			}
+
+			if len(vars) == 1 {
+				vars = append(vars[:1:1], Variable{Name: "_", Type: VarIdent})
+			}
+
+			variable = vars[1]
+			defObj = object.GetDefaultObject(object.BOOLEAN_OBJ.String())
+			err = c.assignValue(variable, &Symbol{Type: defObj})
 			if err != nil {
 				return err
 			}
-			variable := vars[n]
-			err = c.assignValue(variable, nil)
+			n += 2
+		} else if symbol.Type.Type() == object.FUNCTION_OBJ {
+			err = c.assignValue(variable, symbol)
 			if err != nil {
 				return err
 			}
 			n++
-		case *ast.FuncLit:
-			fnSymbol, err := c.compileFuncLit(expr)
+		} else if symbol.Type.Type() == object.STRING_OBJ {
+			err = c.assignValue(variable, &Symbol{Type: &object.Byte{}})
+			if err != nil {
+				return err
+			}
+			n++
+		}
+	case *ast.IndexListExpr:
+		symbol, err := c.compileInstantiate(expr)
+		if err != nil {
+			return err
+		}
+		err = c.assignValue(vars[n], symbol)
+		if err != nil {
+			return err
+		}
+		n++
+	case *ast.UnaryExpr:
+		if expr.Op != token.ARROW {
+			rtSymbol, err := c.compileUnaryExpr(expr, nil)
 			if err != nil {
 				return err
 			}
-			variable := vars[n]
-			err = c.assignValue(variable, fnSymbol)
+			err = c.assignValue(vars[n], rtSymbol)
 			if err != nil {
 				return err
 			}
 			n++
-		case *ast.CompositeLit:
-			rtSymbol, err := c.compileCompositeLit(expr, nil)
+			return nil
+		}
+		commaOk := len(vars) == 2
+		rtSymbol, err := c.compileRecvExpr(expr, commaOk)
+		if err != nil {
+			return err
+		}
+		err = c.assignValue(vars[n], rtSymbol)
+		if err != nil {
+			return err
+		}
+		n++
+		if commaOk {
+			err = c.assignValue(vars[n], &Symbol{Type: object.FALSE})
 			if err != nil {
 				return err
 			}
-			variable := vars[n]
-			err = c.assignValue(variable, rtSymbol)
+			n++
+		}
+	case *ast.BinaryExpr:
+		err := c.compile(expr, nil)
+		if err != nil {
+			return err
+		}
+		variable := vars[n]
+		err = c.assignValue(variable, nil)
+		if err != nil {
+			return err
+		}
+		n++
+	case *ast.SliceExpr:
+		rtSymbol, err := c.compileSliceExpr(expr)
+		if err != nil {
+			return err
+		}
+		err = c.assignValue(vars[n], rtSymbol)
+		if err != nil {
+			return err
+		}
+		n++
+	case *ast.StarExpr:
+		rtSymbol, err := c.compileStarExpr(expr)
+		if err != nil {
+			return err
+		}
+		err = c.assignValue(vars[n], rtSymbol)
+		if err != nil {
+			return err
+		}
+		n++
+	case *ast.SelectorExpr:
+		rtSymbol, err := c.compileSelectorExpr(expr)
+		if err != nil {
+			return err
+		}
+		variable := vars[n]
+		err = c.assignValue(variable, rtSymbol)
+		if err != nil {
+			return err
+		}
+		n++
+	case *ast.FuncLit:
+		fnSymbol, err := c.compileFuncLit(expr)
+		if err != nil {
+			return err
+		}
+		variable := vars[n]
+		err = c.assignValue(variable, fnSymbol)
+		if err != nil {
+			return err
+		}
+		n++
+	case *ast.CompositeLit:
+		rtSymbol, err := c.compileCompositeLit(expr, nil)
+		if err != nil {
+			return err
+		}
+		variable := vars[n]
+		err = c.assignValue(variable, rtSymbol)
+		if err != nil {
+			return err
+		}
+		n++
+	case *ast.TypeAssertExpr:
+		commaOk := len(vars) == 2
+		rtSymbol, err := c.compileTypeAssertExpr(expr, commaOk)
+		if err != nil {
+			return err
+		}
+		err = c.assignValue(vars[n], rtSymbol)
+		if err != nil {
+			return err
+		}
+		n++
+		if commaOk {
+			err = c.assignValue(vars[n], &Symbol{Type: object.FALSE})
 			if err != nil {
 				return err
 			}
 			n++
-		default:
-			line, column := parsePos(expr.Pos())
-			return fmt.Errorf("%d:%d DefineStmt not support %T", line, column, expr)
 		}
+	default:
+		line, column := parsePos(expr.Pos())
+		return fmt.Errorf("%d:%d DefineStmt not support %T", line, column, expr)
 	}
 	return nil
 }
@@ -599,8 +1242,24 @@ func (c *Compiler) compileIdent(node *ast.Ident) (Symbol, error) {
 		}
 		return Symbol{Type: object.FALSE}, nil
 	}
+	if node.Name == "nil" {
+		c.emit(code.OpNull)
+		return Symbol{Type: object.NULL}, nil
+	}
 
 	symbol, ok := c.SymbolTable.Resolve(node.Name)
+	if ok && symbol.Scope == ConstScope {
+		obj, err := symbol.Type.(*object.Constant).Assign(node, nil, "assignment")
+		if err != nil {
+			return symbol, constErr(err)
+		}
+		c.emit(code.OpConstant, c.addConstants(obj))
+		return Symbol{Name: symbol.Name, Type: obj}, nil
+	}
+	if ok && symbol.Scope == GenericScope {
+		line, column := parsePos(node.Pos())
+		return symbol, fmt.Errorf("%d:%d cannot use generic function %s without instantiation", line, column, node.Name)
+	}
 	if ok {
 		c.loadSymbol(symbol)
 		return symbol, nil
@@ -610,12 +1269,34 @@ func (c *Compiler) compileIdent(node *ast.Ident) (Symbol, error) {
 }
 
 func (c *Compiler) compileBinaryExpr(node *ast.BinaryExpr) error {
-	err := c.compile(node.X, nil)
+	// 常量和变量运算时，常量转换为变量的类型
+	var xType, yType object.Object
+	if node.Op != token.SHL && node.Op != token.SHR {
+		if object.ConstOperand(node.X, c.SymbolTable) {
+			xType = c.operandType(node.Y)
+		}
+		if object.ConstOperand(node.Y, c.SymbolTable) {
+			yType = c.operandType(node.X)
+		}
+		// 两边都是常量时按较宽的类型，1 + 2.5 和 1 + 2i
+		if object.ConstBinary(node, c.SymbolTable) {
+			xType = object.ConstArgsType([]ast.Expr{node.X, node.Y}, c.SymbolTable)
+			yType = xType
+		}
+	}
+	if node.Op == token.EQL || node.Op == token.NEQ {
+		x, y := c.valueType(node.X), c.valueType(node.Y)
+		if x != nil && y != nil && !arrayAssignable(x, y) {
+			line, column := parsePos(node.Pos())
+			return fmt.Errorf("%d:%d invalid operation: %s (mismatched types %s and %s)", line, column, types.ExprString(node), object.TypeName(x), object.TypeName(y))
+		}
+	}
+	err := c.compile(node.X, xType)
 	if err != nil {
 		return err
 	}
 
-	err = c.compile(node.Y, nil)
+	err = c.compile(node.Y, yType)
 	if err != nil {
 		return err
 	}
@@ -665,26 +1346,186 @@ func (c *Compiler) compileBinaryExpr(node *ast.BinaryExpr) error {
 	return nil
 }
 
+func (c *Compiler) compileUnaryExpr(node *ast.UnaryExpr, defaultType object.Object) (*Symbol, error) {
+	switch node.Op {
+	case token.ARROW:
+		return c.compileRecvExpr(node, false)
+	case token.AND:
+		return c.compileAddrExpr(node)
+	}
+	err := c.compile(node.X, defaultType)
+	if err != nil {
+		return nil, err
+	}
+	switch node.Op {
+	case token.NOT:
+		c.emit(code.OpNOT)
+	case token.SUB:
+		c.emit(code.OpPrefixSub)
+	case token.ADD:
+	default:
+		return nil, fmt.Errorf("operator %s not support", node.Op)
+	}
+	return nil, nil
+}
+
+// compileAddrExpr 可以取地址的有堆上的变量、复合字面量、结构体字段和切片元素
+func (c *Compiler) compileAddrExpr(node *ast.UnaryExpr) (*Symbol, error) {
+	line, column := parsePos(node.Pos())
+	x := node.X
+	for {
+		paren, ok := x.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		x = paren.X
+	}
+
+	var elem object.Object
+	switch x := x.(type) {
+	case *ast.Ident:
+		symbol, ok := c.SymbolTable.Resolve(x.Name)
+		if !ok {
+			return nil, fmt.Errorf("undefined: %s", x.Name)
+		}
+		if !symbol.Heap {
+			return nil, fmt.Errorf("%d:%d invalid operation: cannot take address of %s", line, column, x.Name)
+		}
+		c.loadSlot(symbol)
+		elem = symbol.Type
+	case *ast.CompositeLit:
+		symbol, err := c.compileCompositeLit(x, nil)
+		if err != nil {
+			return nil, err
+		}
+		c.emit(code.OpPointer)
+		if symbol != nil {
+			elem = symbol.Type
+		}
+	case *ast.SelectorExpr:
+		symbol, err := c.compileSelectorExpr(x)
+		if err != nil {
+			return nil, err
+		}
+		if !c.lastInstructionIs(code.OpGetField) {
+			return nil, fmt.Errorf("%d:%d invalid operation: cannot take address of %s", line, column, types.ExprString(x))
+		}
+		last := &c.scopes[c.scopeIndex].lastInstruction
+		idx := code.ReadUint16(c.currentInstructions()[last.Position+1:])
+		c.replaceInstruction(last.Position, code.Make(code.OpFieldAddr, int(idx)))
+		last.Opcode = code.OpFieldAddr
+		elem = symbol.Type
+	case *ast.IndexExpr:
+		symbol, err := c.compileIndexExpr(x)
+		if err != nil {
+			return nil, err
+		}
+		last := &c.scopes[c.scopeIndex].lastInstruction
+		c.replaceInstruction(last.Position, code.Make(code.OpIndexAddr))
+		last.Opcode = code.OpIndexAddr
+		switch typ := symbol.Type.(type) {
+		case *object.Array:
+			elem = object.GetDefaultObject(typ.ElemType.String())
+		case *object.Hash:
+			return nil, fmt.Errorf("%d:%d invalid operation: cannot take address of %s (map index expression)", line, column, types.ExprString(x))
+		}
+	default:
+		return nil, fmt.Errorf("%d:%d invalid operation: cannot take address of %s", line, column, types.ExprString(x))
+	}
+	if elem == nil {
+		return nil, nil
+	}
+	return &Symbol{Type: &object.Pointer{Elem: elem}}, nil
+}
+
+// compileStarExpr *p 的类型为指针指向的类型
+func (c *Compiler) compileStarExpr(node *ast.StarExpr) (*Symbol, error) {
+	var xType object.Object
+	if ident, ok := node.X.(*ast.Ident); ok {
+		symbol, err := c.compileIdent(ident)
+		if err != nil {
+			return nil, err
+		}
+		xType = symbol.Type
+	} else {
+		err := c.compile(node.X, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.emit(code.OpDeref)
+
+	if p, ok := xType.(*object.Pointer); ok {
+		return &Symbol{Type: c.pointee(p)}, nil
+	}
+	return nil, nil
+}
+
+// pointee 指向命名结构体的指针保存的是类型，取其零值
+func (c *Compiler) pointee(p *object.Pointer) object.Object {
+	switch typ := p.Elem.(type) {
+	case *object.StructType:
+		return typ.Zero(c.SymbolTable)
+	case *object.NamedType:
+		return typ.Zero(c.SymbolTable)
+	}
+	return p.Elem
+}
+
+// compileFixedArray 定长数组字面量，未给出的元素补零值
+func (c *Compiler) compileFixedArray(node *ast.CompositeLit, typ *object.Array) (*Symbol, error) {
+	n := len(typ.Elements)
+	if len(node.Elts) > n {
+		line, column := parsePos(node.Elts[n].Pos())
+		return nil, fmt.Errorf("%d:%d array index %d out of bounds [0:%d]", line, column, n, n)
+	}
+	for i, elem := range typ.Elements {
+		if i >= len(node.Elts) {
+			c.emitZero(elem)
+			continue
+		}
+		err := c.compile(node.Elts[i], elem)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.emit(code.OpFixedArray, c.addConstants(typ))
+	return &Symbol{Type: typ}, nil
+}
+
 func (c *Compiler) compileCompositeLit(node *ast.CompositeLit, defaultObj object.Object) (*Symbol, error) {
 	if node.Type != nil {
 		switch ty := node.Type.(type) {
 		case *ast.ArrayType:
-			defObj := object.GetDefaultValueWithExpr(ty.Elt)
+			defObj := object.GetDefaultValueWithExpr(ty.Elt, c.SymbolTable)
+			if ty.Len != nil {
+				// [...]T 的长度为元素个数
+				n := len(node.Elts)
+				if _, ok := ty.Len.(*ast.Ellipsis); !ok {
+					var err error
+					n, err = object.ArrayLen(ty.Len, c.SymbolTable)
+					if err != nil {
+						line, column := parsePos(ty.Len.Pos())
+						return nil, fmt.Errorf("%d:%d %s", line, column, err)
+					}
+				}
+				return c.compileFixedArray(node, object.ArrayOf(defObj, n))
+			}
 			for _, elt := range node.Elts {
 				err := c.compile(elt, defObj)
 				if err != nil {
 					return nil, err
 				}
 			}
-			c.emit(code.OpArray, len(node.Elts))
+			c.emit(code.OpArray, len(node.Elts), int(defObj.Type()))
 			symbol := Symbol{Type: &object.Array{ElemType: defObj.Type()}}
 			return &symbol, nil
 		case *ast.MapType:
 			mm := &object.Hash{}
 
-			defKObj := object.GetDefaultValueWithExpr(ty.Key)
-			defVObj := object.GetDefaultValueWithExpr(ty.Value)
-			if _, ok := defKObj.(object.Hashable); !ok {
+			defKObj := object.GetDefaultValueWithExpr(ty.Key, c.SymbolTable)
+			defVObj := object.GetDefaultValueWithExpr(ty.Value, c.SymbolTable)
+			if !object.IsKeyType(defKObj) {
 				line, column := parsePos(ty.Key.Pos())
 				return nil, fmt.Errorf("%d:%d key not a HashKey type", line, column)
 			}
@@ -700,9 +1541,38 @@ func (c *Compiler) compileCompositeLit(node *ast.CompositeLit, defaultObj object
 					return nil, err
 				}
 			}
-			c.emit(code.OpHash, len(node.Elts)*2)
+			c.emit(code.OpHash, len(node.Elts)*2, int(mm.KeyType), int(mm.ValueType))
 			return &Symbol{Type: mm}, nil
+		case *ast.Ident:
+			typ, ok := c.SymbolTable.ResolveType(ty.Name)
+			if !ok {
+				return nil, fmt.Errorf("undefined: %s", ty.Name)
+			}
+			if nt, ok := typ.(*object.NamedType); ok {
+				return c.compileNamedLit(node, nt)
+			}
+			st, ok := typ.(*object.StructType)
+			if !ok {
+				line, column := parsePos(ty.Pos())
+				return nil, fmt.Errorf("%d:%d invalid composite literal type %s", line, column, ty.Name)
+			}
+			return c.compileStructLit(node, st)
+		case *ast.StructType:
+			return c.compileStructLit(node, object.NewStructType("", ty))
+		case *ast.IndexExpr, *ast.IndexListExpr:
+			st, err := object.InstantiateExpr(ty, c.SymbolTable)
+			if err != nil {
+				line, column := parsePos(ty.Pos())
+				return nil, fmt.Errorf("%d:%d %s", line, column, err)
+			}
+			return c.compileStructLit(node, st)
 		}
+	} else if named, ok := defaultObj.(*object.Named); ok {
+		return c.compileNamedLit(node, named.NamedType)
+	} else if st, ok := defaultObj.(*object.Struct); ok {
+		return c.compileStructLit(node, st.StructType)
+	} else if array, ok := defaultObj.(*object.Array); ok && array.Fixed {
+		return c.compileFixedArray(node, array)
 	} else if node.Elts != nil {
 		eltt := node.Elts[0]
 		switch eltt.(type) {
@@ -717,7 +1587,7 @@ func (c *Compiler) compileCompositeLit(node *ast.CompositeLit, defaultObj object
 					return nil, err
 				}
 			}
-			c.emit(code.OpHash, len(node.Elts)*2)
+			c.emit(code.OpHash, len(node.Elts)*2, int(hashObj.KeyType), int(hashObj.ValueType))
 			return nil, nil
 		default:
 			if defaultObj.Type() == object.ARRAY_OBJ {
@@ -727,7 +1597,7 @@ func (c *Compiler) compileCompositeLit(node *ast.CompositeLit, defaultObj object
 						return nil, err
 					}
 				}
-				c.emit(code.OpArray, len(node.Elts))
+				c.emit(code.OpArray, len(node.Elts), int(defaultObj.(*object.Array).ElemType))
 				return nil, nil
 			}
 		}
@@ -736,12 +1606,219 @@ func (c *Compiler) compileCompositeLit(node *ast.CompositeLit, defaultObj object
 	return nil, nil
 }
 
+func (c *Compiler) compileStructLit(node *ast.CompositeLit, st *object.StructType) (*Symbol, error) {
+	zero := st.Zero(c.SymbolTable)
+	if object.IsError(zero) {
+		line, column := parsePos(node.Pos())
+		return nil, fmt.Errorf("%d:%d %s", line, column, zero)
+	}
+
+	values := make([]ast.Expr, len(st.Fields))
+	for i, elt := range node.Elts {
+		line, column := parsePos(elt.Pos())
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			key, _ := kv.Key.(*ast.Ident)
+			if key == nil || st.FieldIndex(key.Name) < 0 {
+				return nil, fmt.Errorf("%d:%d unknown field %s in struct literal of type %s", line, column, kv.Key, st)
+			}
+			values[st.FieldIndex(key.Name)] = kv.Value
+		} else if i < len(st.Fields) {
+			values[i] = elt
+		} else {
+			return nil, fmt.Errorf("%d:%d too many values in struct literal of type %s", line, column, st)
+		}
+	}
+
+	fields := zero.(*object.Struct).Fields
+	for i, value := range values {
+		if value == nil {
+			c.emit(code.OpConstant, c.addConstants(fields[i]))
+			continue
+		}
+		err := c.compile(value, fields[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.emit(code.OpStruct, c.addConstants(st))
+	return &Symbol{Type: zero}, nil
+}
+
+// compileNamedLit 按底层类型编译复合字面量，再转换为命名类型
+func (c *Compiler) compileNamedLit(node *ast.CompositeLit, nt *object.NamedType) (*Symbol, error) {
+	zero := nt.Zero(c.SymbolTable)
+	if object.IsError(zero) {
+		line, column := parsePos(node.Pos())
+		return nil, fmt.Errorf("%d:%d %s", line, column, zero)
+	}
+	c.emit(code.OpConstant, c.addConstants(nt.Conversion(zero)))
+	lit := &ast.CompositeLit{Type: nt.Underlying, Lbrace: node.Lbrace, Elts: node.Elts, Rbrace: node.Rbrace}
+	if _, err := c.compileCompositeLit(lit, nil); err != nil {
+		return nil, err
+	}
+	c.emit(code.OpCall, 1)
+	return &Symbol{Type: zero}, nil
+}
+
+func (c *Compiler) compileSelectorExpr(node *ast.SelectorExpr) (*Symbol, error) {
+	if recv, typ, ok := c.methodExprRecv(node.X); ok {
+		return c.compileMethodExpr(node, recv, typ)
+	}
+	var xType object.Object
+	switch x := node.X.(type) {
+	case *ast.Ident:
+		symbol, ok := c.SymbolTable.Resolve(x.Name)
+		if ok && symbol.Heap && c.ptrMethod(symbol.Type, node.Sel.Name) {
+			// 指针接收者的方法取变量的地址
+			c.loadSlot(symbol)
+			xType = symbol.Type
+			break
+		}
+		symbol, err := c.compileIdent(x)
+		if err != nil {
+			return nil, err
+		}
+		xType = symbol.Type
+	case *ast.SelectorExpr:
+		symbol, err := c.compileSelectorExpr(x)
+		if err != nil {
+			return nil, err
+		}
+		xType = symbol.Type
+		if c.ptrMethod(xType, node.Sel.Name) && c.lastInstructionIs(code.OpGetField) {
+			last := &c.scopes[c.scopeIndex].lastInstruction
+			idx := code.ReadUint16(c.currentInstructions()[last.Position+1:])
+			c.replaceInstruction(last.Position, code.Make(code.OpFieldAddr, int(idx)))
+			last.Opcode = code.OpFieldAddr
+		}
+	default:
+		symbol, err := c.compileExpr(node.X)
+		if err != nil {
+			return nil, err
+		}
+		if symbol != nil {
+			xType = symbol.Type
+		}
+		if _, ok := node.X.(*ast.IndexExpr); ok && c.ptrMethod(xType, node.Sel.Name) && c.lastInstructionIs(code.OpIndex) {
+			last := &c.scopes[c.scopeIndex].lastInstruction
+			c.replaceInstruction(last.Position, code.Make(code.OpIndexAddr))
+			last.Opcode = code.OpIndexAddr
+		}
+	}
+	c.emit(code.OpGetField, c.addConstants(&object.String{Value: node.Sel.Name}))
+
+	if p, ok := xType.(*object.Pointer); ok {
+		xType = c.pointee(p)
+	}
+	symbol := Symbol{}
+	if st, ok := xType.(*object.Struct); ok {
+		if value, ok := st.Get(node.Sel.Name); ok {
+			symbol.Type = value
+		} else if _, fn := st.Method(node.Sel.Name); fn != nil {
+			recv, _ := st.Method(node.Sel.Name)
+			symbol.Type = &object.Function{Params: fn.Params[1:], Results: fn.Results, TypeParams: fn.TypeParams, TypeArgs: recv.StructType.TypeArgs}
+		} else {
+			line, column := parsePos(node.Sel.Pos())
+			return nil, fmt.Errorf("%d:%d %s undefined (type %s has no field or method %s)", line, column, types.ExprString(node), st.StructType, node.Sel.Name)
+		}
+	} else if named, ok := xType.(*object.Named); ok {
+		fn := named.NamedType.Methods[node.Sel.Name]
+		if fn == nil {
+			line, column := parsePos(node.Sel.Pos())
+			return nil, fmt.Errorf("%d:%d %s undefined (type %s has no field or method %s)", line, column, types.ExprString(node), named.NamedType, node.Sel.Name)
+		}
+		symbol.Type = &object.Function{Params: fn.Params[1:], Results: fn.Results}
+	} else if iface, ok := xType.(*object.Interface); ok {
+		ft, ok := iface.InterfaceType.Methods[node.Sel.Name]
+		if !ok {
+			line, column := parsePos(node.Sel.Pos())
+			return nil, fmt.Errorf("%d:%d %s undefined (type %s has no field or method %s)", line, column, types.ExprString(node), iface.InterfaceType, node.Sel.Name)
+		}
+		symbol.Type = program.ParseFuncLit(&ast.FuncLit{Type: ft}, nil)
+	}
+	return &symbol, nil
+}
+
+func (c *Compiler) compileTypeAssertExpr(node *ast.TypeAssertExpr, commaOk bool) (*Symbol, error) {
+	if node.Type == nil {
+		line, column := parsePos(node.Pos())
+		return nil, fmt.Errorf("%d:%d use of .(type) outside type switch", line, column)
+	}
+	typ := object.TypeOf(node.Type, c.SymbolTable)
+	if object.IsError(typ) {
+		line, column := parsePos(node.Type.Pos())
+		return nil, fmt.Errorf("%d:%d %s", line, column, typ)
+	}
+	err := c.compile(node.X, nil)
+	if err != nil {
+		return nil, err
+	}
+	ok := 0
+	if commaOk {
+		ok = 1
+	}
+	c.emit(code.OpTypeAssert, c.addConstants(typ), ok)
+	return &Symbol{Type: typ}, nil
+}
+
+// ptrMethod 命名类型的值调用指针接收者的方法
+func (c *Compiler) ptrMethod(typ object.Object, name string) bool {
+	named, ok := typ.(*object.Named)
+	if !ok {
+		return false
+	}
+	fn := named.NamedType.Methods[name]
+	return fn != nil && fn.PointerRecv()
+}
+
+// methodExprRecv 方法表达式 T.M 或 (*T).M 中的接收者类型，recv 为 T 或 *T
+func (c *Compiler) methodExprRecv(x ast.Expr) (ast.Expr, object.Object, bool) {
+	recv := x
+	for {
+		paren, ok := recv.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		recv = paren.X
+	}
+	ident, ok := recv.(*ast.Ident)
+	if star, isStar := recv.(*ast.StarExpr); isStar {
+		ident, ok = star.X.(*ast.Ident)
+	}
+	if !ok {
+		return nil, nil, false
+	}
+	typ, ok := c.SymbolTable.ResolveType(ident.Name)
+	return recv, typ, ok
+}
+
+func (c *Compiler) compileMethodExpr(node *ast.SelectorExpr, recv ast.Expr, typ object.Object) (*Symbol, error) {
+	name := program.MethodName(typ.String(), node.Sel.Name)
+	fn, err := program.MethodExprFunc(recv, typ, node.Sel.Name)
+	if err != nil {
+		line, column := parsePos(node.Sel.Pos())
+		return nil, fmt.Errorf("%d:%d %s", line, column, err)
+	}
+	if star, ok := recv.(*ast.StarExpr); ok && !fn.PointerRecv() {
+		return c.compileFuncLit(program.MethodExprLit(node, star.X, fn))
+	}
+	symbol, ok := c.SymbolTable.Resolve(name)
+	if !ok {
+		return nil, fmt.Errorf("undefined: %s", name)
+	}
+	c.loadSymbol(symbol)
+	return &symbol, nil
+}
+
 func (c *Compiler) compileIndexExpr(node *ast.IndexExpr) (*Symbol, error) {
 	symbol := Symbol{}
 	switch x := node.X.(type) {
 	case *ast.Ident:
 		idtName := x.Name
 		symbol, _ = c.SymbolTable.Resolve(idtName)
+		if symbol.Scope == GenericScope {
+			return c.compileInstantiate(node)
+		}
 		c.loadSymbol(symbol)
 	case *ast.IndexExpr:
 		_, err := c.compileIndexExpr(node.X.(*ast.IndexExpr))
@@ -753,11 +1830,30 @@ func (c *Compiler) compileIndexExpr(node *ast.IndexExpr) (*Symbol, error) {
 		if err != nil {
 			return nil, err
 		}
+	case *ast.SelectorExpr:
+		rtSymbol, err := c.compileSelectorExpr(x)
+		if err != nil {
+			return nil, err
+		}
+		symbol = *rtSymbol
+	case *ast.SliceExpr:
+		rtSymbol, err := c.compileSliceExpr(x)
+		if err != nil {
+			return nil, err
+		}
+		symbol = *rtSymbol
+	case *ast.BasicLit:
+		obj, err := c.compileBasicLit(x, nil)
+		if err != nil {
+			return nil, err
+		}
+		symbol.Type = obj
 	default:
-		return nil, errors.New("not support x node in IndexExpr")
+		line, column := parsePos(x.Pos())
+		return nil, fmt.Errorf("%d:%d not support %s in IndexExpr", line, column, types.ExprString(x))
 	}
 
-	err := c.compile(node.Index, nil)
+	err := c.compile(node.Index, keyType(symbol.Type))
 	if err != nil {
 		return nil, err
 	}
@@ -765,6 +1861,85 @@ func (c *Compiler) compileIndexExpr(node *ast.IndexExpr) (*Symbol, error) {
 	return &symbol, nil
 }
 
+// keyType map 下标中的常量按键的类型编译
+func keyType(typ object.Object) object.Object {
+	if hash, ok := typ.(*object.Hash); ok {
+		if key := object.GetDefaultObject(hash.KeyType.String()); object.IsConstType(key.Type()) {
+			return key
+		}
+	}
+	return nil
+}
+
+// compileSliceExpr 返回被切片的变量的类型，切片和原值类型相同
+func (c *Compiler) compileSliceExpr(node *ast.SliceExpr) (*Symbol, error) {
+	symbol := &Symbol{}
+	switch x := node.X.(type) {
+	case *ast.Ident:
+		s, err := c.compileIdent(x)
+		if err != nil {
+			return nil, err
+		}
+		symbol = &s
+	case *ast.BasicLit:
+		obj, err := c.compileBasicLit(x, nil)
+		if err != nil {
+			return nil, err
+		}
+		symbol.Type = obj
+	case *ast.CallExpr:
+		fnSymbol, err := c.compileCallExpr(x)
+		if err != nil {
+			return nil, err
+		}
+		if rt := resultSymbol(fnSymbol, 0, c.SymbolTable); rt != nil {
+			symbol = rt
+		}
+	case *ast.SliceExpr:
+		s, err := c.compileSliceExpr(x)
+		if err != nil {
+			return nil, err
+		}
+		symbol = s
+	case *ast.SelectorExpr:
+		s, err := c.compileSelectorExpr(x)
+		if err != nil {
+			return nil, err
+		}
+		symbol = s
+	case *ast.CompositeLit:
+		s, err := c.compileCompositeLit(x, nil)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			symbol = s
+		}
+	default:
+		err := c.compile(x, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if node.Slice3 && symbol.Type != nil && symbol.Type.Type() == object.STRING_OBJ {
+		line, column := parsePos(node.Pos())
+		return nil, fmt.Errorf("%d:%d invalid operation: 3-index slice of string", line, column)
+	}
+
+	for _, index := range []ast.Expr{node.Low, node.High, node.Max} {
+		if index == nil {
+			c.emit(code.OpNull)
+			continue
+		}
+		err := c.compile(index, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.emit(code.OpSlice)
+	return &Symbol{Type: symbol.Type}, nil
+}
+
 func (c *Compiler) compileFuncLit(node *ast.FuncLit) (*Symbol, error) {
 	tmp := program.ParseFuncLit(node, nil)
 	fn := tmp.(*object.Function)
@@ -782,20 +1957,49 @@ func (c *Compiler) compileFuncLit(node *ast.FuncLit) (*Symbol, error) {
 }
 
 func (c *Compiler) compileFunction(fn *object.Function, fnName string) (*object.CompiledFunction, error) {
+	if fn.Body != nil {
+		saved := c.pos
+		c.pos = fn.Body.Pos()
+		defer func() { c.pos = saved }()
+	}
 	c.enterScope()
 	if fnName != "" {
 		symbol, _ := c.SymbolTable.Resolve(fnName)
 		c.SymbolTable.DefineFunctionName(fnName, symbol.Type)
 	}
+	c.SymbolTable.Addressed = make(map[string]bool)
+	c.addressed(fn.Body, c.SymbolTable.Addressed)
+	results := c.results
+	c.results = nil
+	defer func() { c.results = results }()
 
 	numArgs, numResult := 0, 0
 	for _, param := range fn.Params {
-		c.SymbolTable.DefineWithType(param.Symbol.Name, object.GetDefaultValueFromElem(param.Type))
+		defObj := object.GetDefaultValueFromElem(param.Type, c.SymbolTable)
+		if param.Symbol == nil || param.Symbol.Name == "_" {
+			// 匿名参数也要占用一个位置
+			c.SymbolTable.NumDefinitions++
+			numArgs++
+			continue
+		}
+		symbol := c.SymbolTable.DefineWithType(param.Symbol.Name, defObj)
+		// 结构体和定长数组按值传递，进入函数时复制一份
+		array, isArray := defObj.(*object.Array)
+		if symbol.Heap || (defObj.Type() == object.STRUCT_OBJ && param.Type.TypeElem != object.ElemPointer) || (isArray && array.Fixed) {
+			c.loadSlot(symbol)
+			c.initSymbol(symbol)
+		}
 		numArgs++
 	}
+	var resultHeap []bool
 	for _, result := range fn.Results {
 		if result.Symbol != nil {
-			c.SymbolTable.DefineWithType(result.Symbol.Name, object.GetDefaultValueFromElem(result.Type))
+			defObj := object.GetDefaultValueFromElem(result.Type, c.SymbolTable)
+			symbol := c.SymbolTable.DefineWithType(result.Symbol.Name, defObj)
+			c.emitZero(defObj)
+			c.initSymbol(symbol)
+			c.results = append(c.results, result.Symbol)
+			resultHeap = append(resultHeap, symbol.Heap)
 			numResult++
 		}
 	}
@@ -810,10 +2014,12 @@ func (c *Compiler) compileFunction(fn *object.Function, fnName string) (*object.
 
 	numLocals := c.SymbolTable.NumDefinitions
 	freeSymbols := c.SymbolTable.FreeSymbols
+	localNames, freeNames := c.SymbolTable.Names, c.SymbolTable.FreeNames()
+	lines := c.scopes[c.scopeIndex].lines
 	instructions := c.leaveScope()
 
 	for _, s := range freeSymbols {
-		c.loadSymbol(s)
+		c.loadSlot(s)
 	}
 
 	compiledFn := &object.CompiledFunction{
@@ -821,7 +2027,12 @@ func (c *Compiler) compileFunction(fn *object.Function, fnName string) (*object.
 		NumLocals:    numLocals,
 		NumParams:    numArgs,
 		NumResult:    numResult,
+		ResultHeap:   resultHeap,
 		FreeNum:      len(freeSymbols),
+		Variadic:     fn.Variadic,
+		Lines:        lines,
+		LocalNames:   localNames,
+		FreeNames:    freeNames,
 	}
 
 	return compiledFn, err
@@ -849,7 +2060,7 @@ func (c *Compiler) compileIfStmt(node *ast.IfStmt) error {
 	}
 	if len(existSymbol) > 0 {
 		for _, symbol := range existSymbol {
-			c.loadSymbol(symbol)
+			c.loadSlot(symbol)
 		}
 		for _, symbol := range existSymbol {
 			c.SymbolTable.DeleteSymbol(symbol.Name)
@@ -898,13 +2109,269 @@ func (c *Compiler) compileIfStmt(node *ast.IfStmt) error {
 	}
 	if len(existSymbol) > 0 {
 		for i := len(existSymbol) - 1; i >= 0; i-- {
-			c.storeSymbol(existSymbol[i])
+			c.storeSlot(existSymbol[i])
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileSwitchStmt(node *ast.SwitchStmt, label string) error {
+	if node.Init != nil {
+		err := c.compile(node.Init, nil)
+		if err != nil {
+			return err
+		}
+	}
+	var tagType object.Object
+	if node.Tag != nil {
+		if ident, ok := node.Tag.(*ast.Ident); ok {
+			if symbol, ok := c.SymbolTable.Resolve(ident.Name); ok {
+				tagType = symbol.Type
+			}
+		}
+		err := c.compile(node.Tag, nil)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.emit(code.OpTrue)
+	}
+
+	clauses := node.Body.List
+	casePos := make([][]int, len(clauses))
+	defaultIdx := -1
+	for i, stmt := range clauses {
+		clause := stmt.(*ast.CaseClause)
+		if clause.List == nil {
+			defaultIdx = i
+			continue
+		}
+		for _, expr := range clause.List {
+			err := c.compile(expr, tagType)
+			if err != nil {
+				return err
+			}
+			casePos[i] = append(casePos[i], c.emit(code.OpCase, 0))
 		}
 	}
+	c.emit(code.OpPop)
+	defaultPos := c.emit(code.OpJump, 0)
+
+	c.enterSwitch(label)
+	var endPos []int
+	for i, stmt := range clauses {
+		clause := stmt.(*ast.CaseClause)
+		bodyPos := len(c.currentInstructions())
+		for _, pos := range casePos[i] {
+			c.changeOperand(pos, bodyPos)
+		}
+		if i == defaultIdx {
+			c.changeOperand(defaultPos, bodyPos)
+		}
+
+		body, fall := splitFallthrough(clause.Body)
+		if fall && i == len(clauses)-1 {
+			line, column := parsePos(clause.Body[len(clause.Body)-1].Pos())
+			return fmt.Errorf("%d:%d cannot fallthrough final case in switch", line, column)
+		}
+		for _, s := range body {
+			err := c.compile(s, nil)
+			if err != nil {
+				return err
+			}
+		}
+		if !fall {
+			endPos = append(endPos, c.emit(code.OpJump, 0))
+		}
+	}
+
+	end := len(c.currentInstructions())
+	if defaultIdx < 0 {
+		c.changeOperand(defaultPos, end)
+	}
+	for _, pos := range endPos {
+		c.changeOperand(pos, end)
+	}
+	c.leaveSwitch(end)
 	return nil
 }
 
-func (c *Compiler) compileForStmt(node *ast.ForStmt) error {
+func (c *Compiler) compileTypeSwitchStmt(node *ast.TypeSwitchStmt, label string) error {
+	if node.Init != nil {
+		err := c.compile(node.Init, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	var name string
+	var assert *ast.TypeAssertExpr
+	switch stmt := node.Assign.(type) {
+	case *ast.AssignStmt:
+		name = stmt.Lhs[0].(*ast.Ident).Name
+		assert = stmt.Rhs[0].(*ast.TypeAssertExpr)
+	case *ast.ExprStmt:
+		assert = stmt.X.(*ast.TypeAssertExpr)
+	}
+	var xType object.Object
+	if ident, ok := assert.X.(*ast.Ident); ok {
+		if symbol, ok := c.SymbolTable.Resolve(ident.Name); ok {
+			xType = symbol.Type
+		}
+	}
+	err := c.compile(assert.X, nil)
+	if err != nil {
+		return err
+	}
+
+	type typeCase struct {
+		pos, idx int
+	}
+	clauses := node.Body.List
+	cases := make([][]typeCase, len(clauses))
+	clauseTypes := make([]object.Object, len(clauses))
+	defaultIdx := -1
+	for i, stmt := range clauses {
+		clause := stmt.(*ast.CaseClause)
+		if clause.List == nil {
+			defaultIdx = i
+			continue
+		}
+		for _, expr := range clause.List {
+			var typ object.Object = object.NULL
+			if ident, ok := expr.(*ast.Ident); !ok || ident.Name != "nil" {
+				typ = object.TypeOf(expr, c.SymbolTable)
+				if object.IsError(typ) {
+					line, column := parsePos(expr.Pos())
+					return fmt.Errorf("%d:%d %s", line, column, typ)
+				}
+			}
+			if len(clause.List) == 1 && typ != object.NULL {
+				clauseTypes[i] = typ
+			}
+			idx := c.addConstants(typ)
+			cases[i] = append(cases[i], typeCase{pos: c.emit(code.OpTypeCase, idx, 0), idx: idx})
+		}
+	}
+	defaultPos := c.emit(code.OpJump, 0)
+
+	c.enterSwitch(label)
+	var endPos []int
+	for i, stmt := range clauses {
+		clause := stmt.(*ast.CaseClause)
+		bodyPos := len(c.currentInstructions())
+		for _, tc := range cases[i] {
+			c.replaceInstruction(tc.pos, code.Make(code.OpTypeCase, tc.idx, bodyPos))
+		}
+		if i == defaultIdx {
+			c.changeOperand(defaultPos, bodyPos)
+		}
+
+		// 每个子句中的变量是独立的，类型为该子句的类型
+		old, existed := c.SymbolTable.Store[name]
+		if name != "" && name != "_" {
+			typ := clauseTypes[i]
+			if typ == nil {
+				typ = xType
+			}
+			delete(c.SymbolTable.Store, name)
+			c.initSymbol(c.SymbolTable.DefineWithType(name, typ))
+		} else {
+			c.emit(code.OpPop)
+		}
+		for _, s := range clause.Body {
+			err := c.compile(s, nil)
+			if err != nil {
+				return err
+			}
+		}
+		if name != "" && name != "_" {
+			if existed {
+				c.SymbolTable.Store[name] = old
+			} else {
+				delete(c.SymbolTable.Store, name)
+			}
+		}
+		endPos = append(endPos, c.emit(code.OpJump, 0))
+	}
+
+	if defaultIdx < 0 {
+		c.changeOperand(defaultPos, len(c.currentInstructions()))
+		c.emit(code.OpPop)
+	}
+	end := len(c.currentInstructions())
+	for _, pos := range endPos {
+		c.changeOperand(pos, end)
+	}
+	c.leaveSwitch(end)
+	return nil
+}
+
+// splitFallthrough 去掉子句末尾的 fallthrough
+func splitFallthrough(body []ast.Stmt) ([]ast.Stmt, bool) {
+	if n := len(body); n > 0 {
+		if branch, ok := body[n-1].(*ast.BranchStmt); ok && branch.Tok == token.FALLTHROUGH {
+			return body[:n-1], true
+		}
+	}
+	return body, false
+}
+
+// addressed 记录被取地址的变量名，包括嵌套的函数字面量中的，
+// 在函数字面量中被赋值的变量也要和外层共享，同样分配在堆上
+func (c *Compiler) addressed(node ast.Node, names map[string]bool) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.FuncLit); ok {
+			assigned(lit.Body, names)
+			return true
+		}
+		// x.Inc() 中 Inc 的接收者是 *x
+		if sel, ok := n.(*ast.SelectorExpr); ok && c.ptrMethods[sel.Sel.Name] {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				names[ident.Name] = true
+			}
+			return true
+		}
+		unary, ok := n.(*ast.UnaryExpr)
+		if !ok || unary.Op != token.AND {
+			return true
+		}
+		x := unary.X
+		for {
+			paren, ok := x.(*ast.ParenExpr)
+			if !ok {
+				break
+			}
+			x = paren.X
+		}
+		if ident, ok := x.(*ast.Ident); ok {
+			names[ident.Name] = true
+		}
+		return true
+	})
+}
+
+func assigned(node ast.Node, names map[string]bool) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		var lhs []ast.Expr
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if n.Tok != token.DEFINE {
+				lhs = n.Lhs
+			}
+		case *ast.IncDecStmt:
+			lhs = []ast.Expr{n.X}
+		}
+		for _, x := range lhs {
+			if ident, ok := x.(*ast.Ident); ok {
+				names[ident.Name] = true
+			}
+		}
+		return true
+	})
+}
+
+func (c *Compiler) compileForStmt(node *ast.ForStmt, label string) error {
 	var loop object.ForLoop
 
 	c.enterScope()
@@ -916,7 +2383,11 @@ func (c *Compiler) compileForStmt(node *ast.ForStmt) error {
 				if !ok {
 					return fmt.Errorf("forStmt init is not *ast.Ident")
 				}
-				c.SymbolTable.Define(ident.Name)
+				symbol := c.SymbolTable.Define(ident.Name)
+				if symbol.Heap {
+					c.emit(code.OpNull)
+					c.initSymbol(symbol)
+				}
 			}
 		}
 		err := c.compile(node.Init, nil)
@@ -925,39 +2396,52 @@ func (c *Compiler) compileForStmt(node *ast.ForStmt) error {
 		}
 	}
 	loop.Init = c.currentInstructions()
+	loop.InitLines = c.scopes[c.scopeIndex].lines
 	c.scopes[c.scopeIndex] = CompilationScope{
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
 	}
 
-	err := c.compile(node.Cond, nil)
-	if err != nil {
-		return err
+	if node.Cond != nil {
+		err := c.compile(node.Cond, nil)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.emit(code.OpTrue)
 	}
 	loop.Cond = c.currentInstructions()
+	loop.CondLines = c.scopes[c.scopeIndex].lines
 	c.scopes[c.scopeIndex] = CompilationScope{
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
+		loopLabel:           label,
+		loopBody:            node.Body,
 	}
 
-	err = c.compile(node.Body, nil)
+	err := c.compile(node.Body, nil)
 	if err != nil {
 		return err
 	}
 	loop.Body = c.currentInstructions()
+	loop.BodyLines = c.scopes[c.scopeIndex].lines
+	escapes := c.scopes[c.scopeIndex].escapes
 	c.scopes[c.scopeIndex] = CompilationScope{
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
 	}
 
-	err = c.compile(node.Post, nil)
-	if err != nil {
-		return err
+	if node.Post != nil {
+		err = c.compile(node.Post, nil)
+		if err != nil {
+			return err
+		}
 	}
 	loop.Post = c.currentInstructions()
+	loop.PostLines = c.scopes[c.scopeIndex].lines
 	c.scopes[c.scopeIndex] = CompilationScope{
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
@@ -966,9 +2450,10 @@ func (c *Compiler) compileForStmt(node *ast.ForStmt) error {
 
 	numLocals := c.SymbolTable.NumDefinitions
 	freeSymbols := c.SymbolTable.FreeSymbols
+	loop.LocalNames, loop.FreeNames = c.SymbolTable.Names, c.SymbolTable.FreeNames()
 	c.leaveScope()
 	for _, s := range freeSymbols {
-		c.loadSymbol(s)
+		c.loadSlot(s)
 	}
 
 	loop.NumLocals = numLocals
@@ -977,191 +2462,779 @@ func (c *Compiler) compileForStmt(node *ast.ForStmt) error {
 	fnIdx := c.addConstants(&loop)
 	c.emit(code.OpClosure, fnIdx, loop.FreeNum)
 	c.emit(code.OpForLoop)
+	c.storeFrees(freeSymbols)
+	c.catchBranches(escapes)
+	return nil
+}
+
+func (c *Compiler) compileRangeStmt(node *ast.RangeStmt, label string) error {
+	var rangeLoop object.RangeLoop
+
+	c.enterScope()
+	idtX, isIdent := node.X.(*ast.Ident)
+	if !isIdent {
+		idtX = ast.NewIdent("loop_x")
+		var init ast.AssignStmt
+		init.Lhs = []ast.Expr{idtX}
+		init.Tok = token.DEFINE
+		init.Rhs = []ast.Expr{node.X}
+		err := c.compile(&init, nil)
+		if err != nil {
+			return err
+		}
+		rangeLoop.IsAnonymous = true
+	}
+	xSymbol, _ := c.SymbolTable.Resolve(idtX.Name)
+	c.loadSymbol(xSymbol)
+	rangeLoop.X = c.currentInstructions()
+	rangeLoop.XLines = c.scopes[c.scopeIndex].lines
+	c.scopes[c.scopeIndex] = CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+		loopLabel:           label,
+		loopBody:            node.Body,
+	}
+
+	c.SymbolTable.Define("loop_K")
+	c.SymbolTable.Define("loop_V")
+
+	var body ast.BlockStmt
+	if node.Key != nil {
+		ident, _ := node.Key.(*ast.Ident)
+		if ident.Name != "_" {
+			body.List = append(body.List, &ast.AssignStmt{Lhs: []ast.Expr{node.Key}, Tok: token.DEFINE, Rhs: []ast.Expr{&ast.Ident{Name: "loop_K"}}})
+		}
+	}
+	if node.Value != nil {
+		ident, _ := node.Value.(*ast.Ident)
+		if ident.Name != "_" {
+			body.List = append(body.List, &ast.AssignStmt{Lhs: []ast.Expr{node.Value}, Tok: token.DEFINE, Rhs: []ast.Expr{&ast.Ident{Name: "loop_V"}}})
+		}
+	}
+	body.List = append(body.List, node.Body.List...)
+	err := c.compile(&body, nil)
+	if err != nil {
+		return err
+	}
+	rangeLoop.Body = c.currentInstructions()
+	rangeLoop.BodyLines = c.scopes[c.scopeIndex].lines
+	escapes := c.scopes[c.scopeIndex].escapes
+	c.scopes[c.scopeIndex] = CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	numLocals := c.SymbolTable.NumDefinitions
+	freeSymbols := c.SymbolTable.FreeSymbols
+	rangeLoop.LocalNames, rangeLoop.FreeNames = c.SymbolTable.Names, c.SymbolTable.FreeNames()
+	c.leaveScope()
+	for _, s := range freeSymbols {
+		c.loadSlot(s)
+	}
+
+	rangeLoop.NumLocals = numLocals
+	rangeLoop.FreeNum = len(freeSymbols)
+
+	fnIdx := c.addConstants(&rangeLoop)
+	c.emit(code.OpClosure, fnIdx, rangeLoop.FreeNum)
+	c.emit(code.OpRangeLoop)
+	c.storeFrees(freeSymbols)
+	c.catchBranches(escapes)
+	return nil
+}
+
+// storeFrees 循环结束后把自由变量的新值写回外层变量
+func (c *Compiler) storeFrees(freeSymbols []Symbol) {
+	for i := len(freeSymbols) - 1; i >= 0; i-- {
+		c.storeSlot(freeSymbols[i])
+	}
+}
+
+// compileLabeledStmt 标签是 goto 的目标，循环、switch 和 select 还是带标签的 break、continue 的目标
+func (c *Compiler) compileLabeledStmt(node *ast.LabeledStmt) error {
+	label := node.Label.Name
+	c.defineLabel(label)
+	switch stmt := node.Stmt.(type) {
+	case *ast.ForStmt:
+		return c.compileForStmt(stmt, label)
+	case *ast.RangeStmt:
+		return c.compileRangeStmt(stmt, label)
+	case *ast.SwitchStmt:
+		return c.compileSwitchStmt(stmt, label)
+	case *ast.TypeSwitchStmt:
+		return c.compileTypeSwitchStmt(stmt, label)
+	case *ast.SelectStmt:
+		return c.compileSelectStmt(stmt, label)
+	}
+	return c.compile(node.Stmt, nil)
+}
+
+// compileBranch 带标签的 break、continue 和 goto，目标在外层帧时设置信号结束当前循环帧
+func (c *Compiler) compileBranch(tok token.Token, target *ast.LabeledStmt) {
+	scope := &c.scopes[c.scopeIndex]
+	label := target.Label.Name
+	if tok == token.BREAK && scope.loopLabel == label {
+		c.emit(code.OpBreak)
+		return
+	}
+	if tok == token.CONTINUE && scope.loopLabel == label {
+		c.emit(code.OpContinue)
+		return
+	}
+	if i := c.switchIndex(label); tok == token.BREAK && i >= 0 {
+		pos := c.emit(code.OpJump, 0)
+		scope.switchBreaks[i] = append(scope.switchBreaks[i], pos)
+		return
+	}
+	body := scope.loopBody
+	if tok == token.GOTO && (body == nil || body.Pos() <= target.Pos() && target.End() <= body.End()) {
+		c.emitGoto(label)
+		return
+	}
+
+	idx := c.addConstants(&object.Branch{Tok: tok, Label: label})
+	c.emit(code.OpBranch, idx)
+	for _, e := range scope.escapes {
+		if e.tok == tok && e.target == target {
+			return
+		}
+	}
+	scope.escapes = append(scope.escapes, branchEscape{tok: tok, target: target, idx: idx})
+}
+
+// catchBranches 内层循环因带标签的跳转结束，在当前帧中继续处理这个跳转
+func (c *Compiler) catchBranches(escapes []branchEscape) {
+	if len(escapes) == 0 {
+		return
+	}
+	jumps := make([]int, len(escapes))
+	for i, e := range escapes {
+		jumps[i] = c.emit(code.OpJumpBranch, 0, e.idx)
+	}
+	end := c.emit(code.OpJump, 0)
+	for i, e := range escapes {
+		c.changeOperand(jumps[i], len(c.currentInstructions()))
+		c.compileBranch(e.tok, e.target)
+	}
+	c.changeOperand(end, len(c.currentInstructions()))
+}
+
+func (c *Compiler) compileBlockStmt(node *ast.BlockStmt, defaultType object.Object) error {
+	for _, stmt := range node.List {
+		err := c.compile(stmt, defaultType)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileReturnStmt(node *ast.ReturnStmt) error {
+	if node.Results == nil {
+		c.emit(code.OpReturn)
+		return nil
+	}
+	// 有具名返回值时先写入返回值变量，defer 中可以读取和修改，OpReturn 执行完 defer 后再从槽位读取
+	if c.namedResults() {
+		lhs := make([]ast.Expr, len(c.results))
+		for i, result := range c.results {
+			lhs[i] = result
+		}
+		err := c.compileAssignStmt(&ast.AssignStmt{Lhs: lhs, TokPos: node.Pos(), Tok: token.ASSIGN, Rhs: node.Results})
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpReturn)
+		return nil
+	}
+	for _, result := range node.Results {
+		err := c.compile(result, nil)
+		if err != nil {
+			return err
+		}
+	}
+	n := len(node.Results)
+	c.emit(code.OpReturnValue, n)
+	return nil
+}
+
+// namedResults 空白标识符的返回值不能通过赋值写入，仍然由 OpReturnValue 返回
+func (c *Compiler) namedResults() bool {
+	for _, result := range c.results {
+		if result.Name == "_" {
+			return false
+		}
+	}
+	return len(c.results) > 0
+}
+
+// compileDeferStmt 函数和参数在 defer 时求值，调用推迟到函数返回
+func (c *Compiler) compileDeferStmt(node *ast.DeferStmt) error {
+	_, err := c.compileCallExpr(node.Call)
+	if err != nil {
+		return err
+	}
+	last := &c.scopes[c.scopeIndex].lastInstruction
+	c.replaceInstruction(last.Position, code.Make(code.OpDefer, len(node.Call.Args)))
+	last.Opcode = code.OpDefer
+	return nil
+}
+
+// compileGoStmt 和 defer 一样先求值函数和参数，再交给新的 goroutine 调用
+func (c *Compiler) compileGoStmt(node *ast.GoStmt) error {
+	_, err := c.compileCallExpr(node.Call)
+	if err != nil {
+		return err
+	}
+	last := &c.scopes[c.scopeIndex].lastInstruction
+	c.replaceInstruction(last.Position, code.Make(code.OpGo, len(node.Call.Args)))
+	last.Opcode = code.OpGo
+	return nil
+}
+
+func (c *Compiler) compileSendStmt(node *ast.SendStmt) error {
+	err := c.compile(node.Chan, nil)
+	if err != nil {
+		return err
+	}
+	err = c.compile(node.Value, nil)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpSend)
 	return nil
 }
 
-func (c *Compiler) compileRangeStmt(node *ast.RangeStmt) error {
-	var rangeLoop object.RangeLoop
+// compileRecvExpr 接收表达式的类型取通道的元素类型
+func (c *Compiler) compileRecvExpr(node *ast.UnaryExpr, commaOk bool) (*Symbol, error) {
+	elemSymbol, err := c.compileChanExpr(node.X)
+	if err != nil {
+		return nil, err
+	}
+	ok := 0
+	if commaOk {
+		ok = 1
+	}
+	c.emit(code.OpARROW, ok)
+	return elemSymbol, nil
+}
+
+// compileChanExpr 返回通道元素类型的符号，类型未知时为 nil
+func (c *Compiler) compileChanExpr(node ast.Expr) (*Symbol, error) {
+	var chSymbol *Symbol
+	switch x := node.(type) {
+	case *ast.Ident:
+		symbol, err := c.compileIdent(x)
+		if err != nil {
+			return nil, err
+		}
+		chSymbol = &symbol
+	case *ast.CallExpr:
+		fnSymbol, err := c.compileCallExpr(x)
+		if err != nil {
+			return nil, err
+		}
+		chSymbol = resultSymbol(fnSymbol, 0, c.SymbolTable)
+	case *ast.SelectorExpr:
+		symbol, err := c.compileSelectorExpr(x)
+		if err != nil {
+			return nil, err
+		}
+		chSymbol = symbol
+	default:
+		err := c.compile(x, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if chSymbol != nil {
+		if ch, ok := chSymbol.Type.(*object.Channel); ok {
+			return &Symbol{Type: ch.Elem}, nil
+		}
+	}
+	return nil, nil
+}
+
+// compileSelectStmt 按分支顺序压入通道和发送的值，OpSelect 压入选中的分支序号，再像 switch 一样跳转
+func (c *Compiler) compileSelectStmt(node *ast.SelectStmt, label string) error {
+	clauses := node.Body.List
+	kinds := make([]object.Object, len(clauses))
+	elems := make([]*Symbol, len(clauses))
+	for i, stmt := range clauses {
+		clause := stmt.(*ast.CommClause)
+		var recv ast.Expr
+		switch comm := clause.Comm.(type) {
+		case nil:
+			kinds[i] = &object.Int{Value: code.SelectDefault}
+			continue
+		case *ast.SendStmt:
+			err := c.compile(comm.Chan, nil)
+			if err != nil {
+				return err
+			}
+			err = c.compile(comm.Value, nil)
+			if err != nil {
+				return err
+			}
+			kinds[i] = &object.Int{Value: code.SelectSend}
+			continue
+		case *ast.ExprStmt:
+			recv = comm.X
+		case *ast.AssignStmt:
+			recv = comm.Rhs[0]
+		}
 
-	c.enterScope()
-	idtX, isIdent := node.X.(*ast.Ident)
-	if !isIdent {
-		idtX = ast.NewIdent("loop_x")
-		var init ast.AssignStmt
-		init.Lhs = []ast.Expr{idtX}
-		init.Tok = token.DEFINE
-		init.Rhs = []ast.Expr{node.X}
-		err := c.compile(&init, nil)
+		unary, ok := recv.(*ast.UnaryExpr)
+		if !ok || unary.Op != token.ARROW {
+			line, column := parsePos(clause.Pos())
+			return fmt.Errorf("%d:%d select case must be receive, send or assign recv", line, column)
+		}
+		elemSymbol, err := c.compileChanExpr(unary.X)
 		if err != nil {
 			return err
 		}
-		rangeLoop.IsAnonymous = true
+		kinds[i] = &object.Int{Value: code.SelectRecv}
+		elems[i] = elemSymbol
 	}
-	xSymbol, _ := c.SymbolTable.Resolve(idtX.Name)
-	c.loadSymbol(xSymbol)
-	rangeLoop.X = c.currentInstructions()
-	c.scopes[c.scopeIndex] = CompilationScope{
-		instructions:        code.Instructions{},
-		lastInstruction:     EmittedInstruction{},
-		previousInstruction: EmittedInstruction{},
+	c.emit(code.OpSelect, c.addConstants(&object.Array{ElemType: object.INT_OBJ, Elements: kinds}))
+
+	casePos := make([]int, len(clauses))
+	for i := range clauses {
+		c.emit(code.OpConstant, c.addConstants(&object.Int{Value: i}))
+		casePos[i] = c.emit(code.OpCase, 0)
 	}
 
-	c.SymbolTable.Define("loop_K")
-	c.SymbolTable.Define("loop_V")
+	c.enterSwitch(label)
+	var endPos []int
+	for i, stmt := range clauses {
+		clause := stmt.(*ast.CommClause)
+		c.changeOperand(casePos[i], len(c.currentInstructions()))
 
-	var body ast.BlockStmt
-	if node.Key != nil {
-		ident, _ := node.Key.(*ast.Ident)
-		if ident.Name != "_" {
-			body.List = append(body.List, &ast.AssignStmt{Lhs: []ast.Expr{node.Key}, Tok: token.DEFINE, Rhs: []ast.Expr{&ast.Ident{Name: "loop_K"}}})
+		// case x, ok := <-ch 定义的变量只在该子句中可见
+		shadowed := make(map[string]*Symbol)
+		assign, ok := clause.Comm.(*ast.AssignStmt)
+		if ok {
+			for j, lhs := range assign.Lhs {
+				ident, ok := lhs.(*ast.Ident)
+				if !ok {
+					line, column := parsePos(lhs.Pos())
+					return fmt.Errorf("%d:%d not support", line, column)
+				}
+				symbol := elems[i]
+				if j == 1 {
+					symbol = &Symbol{Type: object.FALSE}
+				}
+				if assign.Tok != token.DEFINE {
+					err := c.assignValue(Variable{Name: ident.Name, Type: VarIdent}, symbol)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				var typ object.Object
+				if symbol != nil {
+					typ = symbol.Type
+				}
+				if _, done := shadowed[ident.Name]; !done && ident.Name != "_" {
+					old, existed := c.SymbolTable.Store[ident.Name]
+					shadowed[ident.Name] = nil
+					if existed {
+						shadowed[ident.Name] = &old
+					}
+				}
+				delete(c.SymbolTable.Store, ident.Name)
+				c.initSymbol(c.SymbolTable.DefineWithType(ident.Name, typ))
+			}
 		}
-	}
-	if node.Value != nil {
-		ident, _ := node.Value.(*ast.Ident)
-		if ident.Name != "_" {
-			body.List = append(body.List, &ast.AssignStmt{Lhs: []ast.Expr{node.Value}, Tok: token.DEFINE, Rhs: []ast.Expr{&ast.Ident{Name: "loop_V"}}})
+		if !ok || len(assign.Lhs) == 1 {
+			c.emit(code.OpPop)
 		}
-	}
-	body.List = append(body.List, node.Body.List...)
-	err := c.compile(&body, nil)
-	if err != nil {
-		return err
-	}
-	rangeLoop.Body = c.currentInstructions()
-	c.scopes[c.scopeIndex] = CompilationScope{
-		instructions:        code.Instructions{},
-		lastInstruction:     EmittedInstruction{},
-		previousInstruction: EmittedInstruction{},
-	}
 
-	numLocals := c.SymbolTable.NumDefinitions
-	freeSymbols := c.SymbolTable.FreeSymbols
-	c.leaveScope()
-	for _, s := range freeSymbols {
-		c.loadSymbol(s)
+		for _, s := range clause.Body {
+			err := c.compile(s, nil)
+			if err != nil {
+				return err
+			}
+		}
+		for name, old := range shadowed {
+			if old != nil {
+				c.SymbolTable.Store[name] = *old
+			} else {
+				delete(c.SymbolTable.Store, name)
+			}
+		}
+		endPos = append(endPos, c.emit(code.OpJump, 0))
 	}
 
-	rangeLoop.NumLocals = numLocals
-	rangeLoop.FreeNum = len(freeSymbols)
-
-	fnIdx := c.addConstants(&rangeLoop)
-	c.emit(code.OpClosure, fnIdx, rangeLoop.FreeNum)
-	c.emit(code.OpRangeLoop)
+	end := len(c.currentInstructions())
+	for _, pos := range endPos {
+		c.changeOperand(pos, end)
+	}
+	c.leaveSwitch(end)
 	return nil
 }
 
-func (c *Compiler) compileBlockStmt(node *ast.BlockStmt, defaultType object.Object) error {
-	for _, stmt := range node.List {
-		err := c.compile(stmt, defaultType)
+// compileMake 支持 make(chan T, n) 和 make([]T, len, cap)
+func (c *Compiler) compileMake(node *ast.CallExpr) (*Symbol, error) {
+	line, column := parsePos(node.Pos())
+	if len(node.Args) == 0 || len(node.Args) > 3 {
+		return nil, fmt.Errorf("%d:%d wrong number of arguments to make", line, column)
+	}
+
+	var elemExpr ast.Expr
+	var elemEnum object.ElemTypeEnum
+	switch ty := node.Args[0].(type) {
+	case *ast.ChanType:
+		elemExpr = ty.Value
+		elemEnum = object.ElemChan
+		if len(node.Args) > 2 {
+			return nil, fmt.Errorf("%d:%d wrong number of arguments to make", line, column)
+		}
+	case *ast.ArrayType:
+		elemExpr = ty.Elt
+		elemEnum = object.ElemArray
+		if ty.Len != nil || len(node.Args) < 2 {
+			return nil, fmt.Errorf("%d:%d invalid operation: make %s expects 2 or 3 arguments", line, column, types.ExprString(ty))
+		}
+	default:
+		return nil, fmt.Errorf("%d:%d make not support %s", line, column, types.ExprString(node.Args[0]))
+	}
+	elem := object.GetDefaultValueWithExpr(elemExpr, c.SymbolTable)
+	if object.IsError(elem) {
+		line, column := parsePos(elemExpr.Pos())
+		return nil, fmt.Errorf("%d:%d %s", line, column, elem)
+	}
+
+	for _, arg := range node.Args[1:] {
+		err := c.compile(arg, nil)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
-	return nil
+	if elemEnum == object.ElemChan {
+		if len(node.Args) == 1 {
+			c.emit(code.OpConstant, c.addConstants(&object.Int{Value: 0}))
+		}
+		c.emit(code.OpChannel, c.addConstants(elem))
+	} else {
+		if len(node.Args) == 2 {
+			c.emit(code.OpNull)
+		}
+		c.emit(code.OpMakeSlice, c.addConstants(elem))
+	}
+
+	elemIdent, _ := elemExpr.(*ast.Ident)
+	result := object.FunResult{Type: object.ElemType{Type: elemIdent, TypeElem: elemEnum, Expr: node.Args[0]}}
+	return &Symbol{Type: &object.Function{Results: []object.FunResult{result}}}, nil
 }
 
-func (c *Compiler) compileReturnStmt(node *ast.ReturnStmt) error {
-	if node.Results == nil {
-		c.emit(code.OpReturn)
-		return nil
+// compileNew new(T) 分配 T 的零值，返回指向它的指针
+func (c *Compiler) compileNew(node *ast.CallExpr) (*Symbol, error) {
+	if len(node.Args) != 1 {
+		line, column := parsePos(node.Pos())
+		return nil, fmt.Errorf("%d:%d wrong number of arguments to new", line, column)
 	}
-	for _, result := range node.Results {
-		err := c.compile(result, nil)
-		if err != nil {
-			return err
-		}
+	zero := object.GetDefaultValueWithExpr(node.Args[0], c.SymbolTable)
+	if object.IsError(zero) {
+		line, column := parsePos(node.Args[0].Pos())
+		return nil, fmt.Errorf("%d:%d %s", line, column, zero)
 	}
-	n := len(node.Results)
-	c.emit(code.OpReturnValue, n)
-	return nil
+	c.emitZero(zero)
+	c.emit(code.OpPointer)
+
+	ident, ok := node.Args[0].(*ast.Ident)
+	if !ok {
+		return &Symbol{Type: &object.Function{}}, nil
+	}
+	result := object.FunResult{Type: object.ElemType{Type: ident, TypeElem: object.ElemPointer}}
+	return &Symbol{Type: &object.Function{Results: []object.FunResult{result}}}, nil
 }
 
-func (c *Compiler) compileCallExpr(node *ast.CallExpr) error {
-	fun := node.Fun
-	switch fn := fun.(type) {
+func (c *Compiler) compileCallExpr(node *ast.CallExpr) (*Symbol, error) {
+	var fnSymbol *Symbol
+	switch fn := node.Fun.(type) {
 	case *ast.Ident:
 		symbol, ok := c.SymbolTable.Resolve(fn.Name)
 		if !ok {
-			return fmt.Errorf("undefiend: %s", fn.Name)
+			return nil, fmt.Errorf("undefined: %s", fn.Name)
 		}
-		c.loadSymbol(symbol)
-
-		switch symbol.Type.Type() {
-		case object.FUNCTION_OBJ:
-			fnc := symbol.Type.(*object.Function)
-			for _, arg := range node.Args {
-				err := c.compile(arg, nil)
-				if err != nil {
-					return err
-				}
+		if symbol.Scope == BuiltinScope {
+			if err := c.checkBuiltinArgs(node, fn.Name); err != nil {
+				return nil, err
 			}
-			nArgs := len(fnc.Params)
-			nRet := 0
-			for _, result := range fnc.Results {
-				if result.Symbol != nil {
-					obj := object.GetDefaultValueFromElem(result.Type)
-					c.emit(code.OpConstant, c.addConstants(obj))
-					nRet++
-				}
+			switch {
+			case fn.Name == "make":
+				return c.compileMake(node)
+			case fn.Name == "new":
+				return c.compileNew(node)
+			case object.TypedBuiltin(fn.Name):
+				return c.compileTypedBuiltin(node, fn.Name, symbol)
+			case fn.Name == "delete" && len(node.Args) == 2 && !node.Ellipsis.IsValid():
+				return c.compileDelete(node, symbol)
 			}
-			c.emit(code.OpCall, nArgs+nRet)
-		case object.BUILTIN_OBJ:
-			for _, arg := range node.Args {
-				err := c.compile(arg, nil)
+		}
+		if symbol.Scope == GenericScope {
+			return c.compileGenericCall(node, fn.Name, symbol.Type.(*object.Function))
+		}
+		if nt, ok := symbol.Type.(*object.NamedType); ok && symbol.Scope == TypeScope {
+			return c.compileNamedConversion(node, nt)
+		}
+		c.loadSymbol(symbol)
+		fnSymbol = &symbol
+	case *ast.FuncLit:
+		symbol, err := c.compileFuncLit(fn)
+		if err != nil {
+			return nil, err
+		}
+		fnSymbol = symbol
+	case *ast.CallExpr:
+		symbol, err := c.compileCallExpr(fn)
+		if err != nil {
+			return nil, err
+		}
+		fnSymbol = resultSymbol(symbol, 0, c.SymbolTable)
+	case *ast.SelectorExpr:
+		symbol, err := c.compileSelectorExpr(fn)
+		if err != nil {
+			return nil, err
+		}
+		fnSymbol = symbol
+	case *ast.ParenExpr:
+		return c.compileCallExpr(&ast.CallExpr{Fun: fn.X, Lparen: node.Lparen, Args: node.Args, Rparen: node.Rparen})
+	case *ast.ArrayType:
+		return c.compileSliceConversion(node, fn)
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		x, indices := object.TypeIndices(fn)
+		ident, _ := x.(*ast.Ident)
+		if ident != nil {
+			if symbol, ok := c.SymbolTable.Resolve(ident.Name); ok && symbol.Scope == GenericScope {
+				generic, err := c.explicitTypeArgs(symbol.Type.(*object.Function), ident.Name, indices)
 				if err != nil {
-					return err
+					line, column := parsePos(fn.Pos())
+					return nil, fmt.Errorf("%d:%d %s", line, column, err)
 				}
+				return c.compileGenericCall(node, ident.Name, generic)
 			}
-			c.emit(code.OpCall, len(node.Args))
 		}
-	case *ast.FuncLit:
-		fnObj := program.ParseFuncLit(fn, nil).(*object.Function)
-		compiledFn, err := c.compileFunction(fnObj, "")
+		if _, ok := fn.(*ast.IndexListExpr); ok {
+			line, column := parsePos(fn.Pos())
+			return nil, fmt.Errorf("%d:%d %s is not a generic function", line, column, types.ExprString(x))
+		}
+		// map 或切片中的函数值
+		symbol, err := c.compileExpr(fn)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		fnSymbol = symbol
+	default:
+		symbol, err := c.compileExpr(fn)
+		if err != nil {
+			return nil, err
 		}
-		c.emit(code.OpClosure, c.addConstants(compiledFn), 0)
+		fnSymbol = symbol
+	}
 
-		nArgs := 0
-		for _, arg := range node.Args {
-			err = c.compile(arg, nil)
+	params := c.paramTypes(fnSymbol, node)
+	context := "argument to " + types.ExprString(node.Fun)
+	for i, arg := range node.Args {
+		if iface, ok := params[i].(*object.Interface); ok {
+			symbol, err := c.compileExpr(arg)
 			if err != nil {
-				return err
+				return nil, err
+			}
+			if symbol != nil {
+				if err := implements(iface, symbol.Type, arg, context); err != nil {
+					return nil, err
+				}
 			}
-			nArgs++
+			continue
 		}
-
-		nRet := 0
-		for _, result := range fnObj.Results {
-			if result.Symbol != nil {
-				obj := object.GetDefaultValueFromElem(result.Type)
-				c.emit(code.OpConstant, c.addConstants(obj))
-				nRet++
+		// 常量实参转换为参数的类型
+		if params[i] != nil && object.IsConstType(object.Unnamed(params[i]).Type()) {
+			symbol, err := c.compileConstValue(arg, params[i], context)
+			if err != nil {
+				return nil, err
+			}
+			if symbol != nil {
+				continue
 			}
 		}
+		if err := c.compile(arg, nil); err != nil {
+			return nil, err
+		}
+	}
+	if node.Ellipsis.IsValid() {
+		c.emit(code.OpELLIPSIS, len(node.Args))
+	} else {
+		c.emit(code.OpCall, len(node.Args))
+	}
+	return fnSymbol, nil
+}
+
+// paramTypes 调用的参数对应的参数类型，类型未知时为 nil
+func (c *Compiler) paramTypes(fnSymbol *Symbol, node *ast.CallExpr) []object.Object {
+	params := make([]object.Object, len(node.Args))
+	if fnSymbol == nil || node.Ellipsis.IsValid() {
+		return params
+	}
+	fn, ok := fnSymbol.Type.(*object.Function)
+	if !ok || fn.TypeParams != nil {
+		return params
+	}
+	for i := range node.Args {
+		if i >= len(fn.Params) || (fn.Variadic && i == len(fn.Params)-1) {
+			break
+		}
+		params[i] = object.GetDefaultValueFromElem(fn.Params[i].Type, c.SymbolTable)
+	}
+	return params
+}
 
-		c.emit(code.OpCall, nArgs+nRet)
-	case *ast.CallExpr:
-		err := c.compileCallExpr(fun.(*ast.CallExpr))
-		if err != nil {
-			return err
+// compileTypedBuiltin min、max、complex、real 和 imag 的常量参数转换为其他参数的类型
+func (c *Compiler) compileTypedBuiltin(node *ast.CallExpr, name string, symbol Symbol) (*Symbol, error) {
+	var typ object.Object
+	for _, arg := range node.Args {
+		if typ = c.operandType(arg); typ != nil {
+			break
+		}
+	}
+	if typ == nil {
+		typ = object.BuiltinArgType(name, node.Args, c.SymbolTable)
+	}
+	c.loadSymbol(symbol)
+	for _, arg := range node.Args {
+		var argType object.Object
+		if object.ConstOperand(arg, c.SymbolTable) {
+			argType = typ
+		} else if other := c.operandType(arg); other != nil && typ != nil && object.TypeName(other) != object.TypeName(typ) {
+			line, column := parsePos(node.Pos())
+			return nil, fmt.Errorf("%d:%d invalid argument: mismatched types %s and %s in %s", line, column, object.TypeName(typ), object.TypeName(other), name)
 		}
-		nArgs := 0
-		for _, arg := range node.Args {
-			err = c.compile(arg, nil)
+		if argType != nil && object.IsConstType(object.Unnamed(argType).Type()) {
+			symbol, err := c.compileConstValue(arg, argType, "argument to "+name)
 			if err != nil {
-				return err
+				return nil, err
+			}
+			if symbol != nil {
+				continue
 			}
-			nArgs++
 		}
-		c.emit(code.OpCall, nArgs)
-	default:
-		return fmt.Errorf("not support CallExpr: %T", fn)
+		err := c.compile(arg, argType)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return nil
+	c.emit(code.OpCall, len(node.Args))
+	if typ == nil {
+		return &symbol, nil
+	}
+	typ = object.BuiltinResultType(name, typ)
+	result := object.FunResult{Type: object.ElemType{Type: &ast.Ident{Name: object.TypeName(typ)}}}
+	return &Symbol{Type: &object.Function{Results: []object.FunResult{result}}}, nil
+}
+
+// compileDelete delete 的常量键转换为 map 的键类型
+func (c *Compiler) compileDelete(node *ast.CallExpr, symbol Symbol) (*Symbol, error) {
+	c.loadSymbol(symbol)
+	m, err := c.compileExpr(node.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	var typ object.Object
+	if m != nil {
+		typ = keyType(m.Type)
+		hash, ok := object.Unnamed(m.Type).(*object.Hash)
+		if key := c.valueType(node.Args[1]); ok && key != nil && !hash.KeyAssignable(key) {
+			line, column := parsePos(node.Args[1].Pos())
+			return nil, fmt.Errorf("%d:%d cannot use %s as %s value in argument to delete", line, column, key.Type(), hash.KeyType)
+		}
+	}
+	if typ != nil && object.IsConstType(object.Unnamed(typ).Type()) {
+		key, err := c.compileConstValue(node.Args[1], typ, "argument to delete")
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			c.emit(code.OpCall, 2)
+			return &symbol, nil
+		}
+	}
+	if err := c.compile(node.Args[1], typ); err != nil {
+		return nil, err
+	}
+	c.emit(code.OpCall, 2)
+	return &symbol, nil
+}
+
+// compileSliceConversion []byte(s) 和 []rune(s)，转换函数作为常量调用
+func (c *Compiler) compileSliceConversion(node *ast.CallExpr, ty *ast.ArrayType) (*Symbol, error) {
+	line, column := parsePos(node.Pos())
+	elemIdent, _ := ty.Elt.(*ast.Ident)
+	if elemIdent == nil || ty.Len != nil || len(node.Args) != 1 {
+		return nil, fmt.Errorf("%d:%d cannot convert to %s", line, column, types.ExprString(ty))
+	}
+	elem := object.GetDefaultValueWithExpr(elemIdent, c.SymbolTable)
+	if object.IsError(elem) {
+		return nil, fmt.Errorf("%d:%d %s", line, column, elem)
+	}
+	c.emit(code.OpConstant, c.addConstants(object.SliceConversion(elem.Type())))
+	err := c.compile(node.Args[0], nil)
+	if err != nil {
+		return nil, err
+	}
+	c.emit(code.OpCall, 1)
+	result := object.FunResult{Type: object.ElemType{Type: elemIdent, TypeElem: object.ElemArray}}
+	return &Symbol{Type: &object.Function{Results: []object.FunResult{result}}}, nil
+}
+
+// compileNamedConversion T(x) 转换为命名类型，转换函数作为常量调用
+func (c *Compiler) compileNamedConversion(node *ast.CallExpr, nt *object.NamedType) (*Symbol, error) {
+	line, column := parsePos(node.Pos())
+	if len(node.Args) != 1 {
+		return nil, fmt.Errorf("%d:%d wrong argument count in conversion to %s", line, column, nt)
+	}
+	zero := nt.Zero(c.SymbolTable)
+	if object.IsError(zero) {
+		return nil, fmt.Errorf("%d:%d %s", line, column, zero)
+	}
+	c.emit(code.OpConstant, c.addConstants(nt.Conversion(zero)))
+	err := c.compile(node.Args[0], nil)
+	if err != nil {
+		return nil, err
+	}
+	c.emit(code.OpCall, 1)
+	result := object.FunResult{Type: object.ElemType{Type: &ast.Ident{Name: nt.Name}}}
+	return &Symbol{Type: &object.Function{Results: []object.FunResult{result}}}, nil
+}
+
+// resultSymbol 返回函数第 i 个返回值的类型
+func resultSymbol(fnSymbol *Symbol, i int, resolver object.TypeResolver) *Symbol {
+	if fnSymbol == nil {
+		return nil
+	}
+	fn, ok := fnSymbol.Type.(*object.Function)
+	if !ok || i >= len(fn.Results) {
+		return nil
+	}
+	if fn.TypeParams != nil {
+		resolver = object.BindTypeParams(fn.TypeParams, fn.TypeArgs, resolver)
+	}
+	return &Symbol{Type: object.GetDefaultValueFromElem(fn.Results[i].Type, resolver)}
 }
 
 func (c *Compiler) compileIncDecStmt(node *ast.IncDecStmt) error {
+	if _, ok := node.X.(*ast.IndexExpr); ok {
+		// a[i]++ 按 a[i] += 1 赋值
+		tok := token.ADD_ASSIGN
+		if node.Tok == token.DEC {
+			tok = token.SUB_ASSIGN
+		}
+		one := &ast.BasicLit{ValuePos: node.TokPos, Kind: token.INT, Value: "1"}
+		return c.compileBinaryAssign(&ast.AssignStmt{Lhs: []ast.Expr{node.X}, Tok: tok, Rhs: []ast.Expr{one}})
+	}
 	err := c.compile(node.X, nil)
 	if err != nil {
 		return err
@@ -1172,39 +3245,71 @@ func (c *Compiler) compileIncDecStmt(node *ast.IncDecStmt) error {
 	case token.DEC:
 		c.emit(code.OpDEC)
 	}
-	ident, ok := node.X.(*ast.Ident)
-	if ok {
-		symbol, _ := c.SymbolTable.Resolve(ident.Name)
+	switch x := node.X.(type) {
+	case *ast.Ident:
+		symbol, _ := c.SymbolTable.Resolve(x.Name)
 		c.storeSymbol(symbol)
+	case *ast.SelectorExpr:
+		return c.assignValue(Variable{Name: x.Sel.Name, Attribute: x.X, Type: VarAttr}, nil)
+	case *ast.StarExpr:
+		return c.assignValue(Variable{Attribute: x.X, Type: VarDeref}, nil)
 	}
 	return nil
 }
 
 func (c *Compiler) assignValue(v Variable, varSymbol *Symbol) error {
 	switch v.Type {
+	case VarTemp:
+		var symbol Symbol
+		if varSymbol == nil {
+			symbol = c.SymbolTable.Define(v.Name)
+		} else {
+			symbol = c.SymbolTable.DefineWithType(v.Name, varSymbol.Type)
+		}
+		c.initSymbol(symbol)
+		return nil
 	case VarIdent:
 		symbol, ok := c.SymbolTable.Resolve(v.Name)
-		if !ok {
+		if !ok || symbol.Scope == BuiltinScope {
 			if varSymbol == nil {
 				symbol = c.SymbolTable.Define(v.Name)
 			} else {
 				symbol = c.SymbolTable.DefineWithType(v.Name, varSymbol.Type)
 			}
+			c.initSymbol(symbol)
+			return nil
+		}
+		if symbol.Scope == ConstScope {
+			return fmt.Errorf("cannot assign to %s (neither addressable nor a map index expression)", v.Name)
+		}
+		if varSymbol != nil && !arrayAssignable(symbol.Type, varSymbol.Type) {
+			line, column := parsePos(v.Pos)
+			return fmt.Errorf("%d:%d cannot use value of type %s as %s value in assignment", line, column, object.TypeName(varSymbol.Type), object.TypeName(symbol.Type))
+		}
+		// 代码块不单独分配槽位，之前的定义可能没有执行，堆上的变量要分配新的单元
+		if _, local := c.SymbolTable.Store[v.Name]; v.Define && local && symbol.Scope != FreeScope {
+			c.initSymbol(symbol)
+			return nil
 		}
 		c.storeSymbol(symbol)
 		return nil
 	case VarIndex:
-		symbol, _ := c.SymbolTable.Resolve(v.Name)
-		c.loadSymbol(symbol)
-		err := c.compile(v.Index, nil)
+		// 容器和下标已经由 compileIndexTarget 压栈
+		c.emit(code.OpSetIndex)
+		return nil
+	case VarAttr:
+		err := c.compile(v.Attribute, nil)
 		if err != nil {
 			return err
 		}
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobalIndex, symbol.Index)
-		} else if symbol.Scope == LocalScope {
-			c.emit(code.OpSetLocalIndex, symbol.Index)
+		c.emit(code.OpSetField, c.addConstants(&object.String{Value: v.Name}))
+		return nil
+	case VarDeref:
+		err := c.compile(v.Attribute, nil)
+		if err != nil {
+			return err
 		}
+		c.emit(code.OpSetDeref)
 		return nil
 	default:
 		return nil
@@ -1214,7 +3319,7 @@ func (c *Compiler) assignValue(v Variable, varSymbol *Symbol) error {
 func parseBasicLit(node *ast.BasicLit) (object.Object, error) {
 	switch node.Kind {
 	case token.INT:
-		value, err := strconv.ParseInt(node.Value, 10, 64)
+		value, err := strconv.ParseInt(node.Value, 0, 64)
 		if err != nil {
 			return nil, err
 		} else {
@@ -1228,56 +3333,42 @@ func parseBasicLit(node *ast.BasicLit) (object.Object, error) {
 			return &object.Float64{Value: value}, nil
 		}
 	case token.STRING:
-		value := parseString(node)
-		return &object.String{Value: value}, nil
+		value, err := parseString(node)
+		if err != nil {
+			return nil, err
+		} else {
+			return &object.String{Value: value}, nil
+		}
 	case token.CHAR:
 		value, err := parseChar(node)
 		if err != nil {
 			return nil, err
 		} else {
-			return &object.Byte{Value: value}, nil
+			return &object.Rune{Value: value}, nil
+		}
+	case token.IMAG:
+		value, err := strconv.ParseComplex(node.Value, 128)
+		if err != nil {
+			return nil, err
+		} else {
+			return &object.Complex128{Value: value}, nil
 		}
 	default:
 		return nil, fmt.Errorf("not support basic type %s", node.Kind.String())
 	}
 }
 
-var escapeChMap = map[byte]byte{
-	't':  '\t',
-	'n':  '\n',
-	'"':  '"',
-	'\\': '\\',
-	'r':  '\r',
-}
-
-func parseString(node *ast.BasicLit) string {
-	str := node.Value[1 : len(node.Value)-1]
-	var out bytes.Buffer
-	for i := 0; i < len(str); i++ {
-		cur := str[i]
-		if cur == '\\' {
-			next := str[i+1]
-			if v, ok := escapeChMap[next]; ok {
-				i += 1
-				out.WriteByte(v)
-			}
-		} else if cur != '"' {
-			out.WriteByte(cur)
-		}
-		if cur == '"' || cur == 0 {
-			break
-		}
-	}
-	return out.String()
+// parseString 解释型和原始字符串字面量
+func parseString(node *ast.BasicLit) (string, error) {
+	return strconv.Unquote(node.Value)
 }
 
-func parseChar(node *ast.BasicLit) (uint8, error) {
-	str := node.Value
-	if strings.HasPrefix(str, "'") && strings.HasSuffix(str, "'") && len(str) == 3 {
-		b := []byte(str)
-		return b[1], nil
+func parseChar(node *ast.BasicLit) (rune, error) {
+	value, _, tail, err := strconv.UnquoteChar(node.Value[1:len(node.Value)-1], '\'')
+	if err == nil && tail != "" {
+		err = errors.New("more than one character in rune literal")
 	}
-	return 0, errors.New("")
+	return value, err
 }
 
 func parsePos(p token.Pos) (int, int) {
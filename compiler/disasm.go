@@ -0,0 +1,217 @@
+package compiler
+
+import (
+	"fmt"
+	"go/token"
+	"goscript/code"
+	"goscript/object"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// disasmUnit 反汇编的一段指令：函数、main 或循环帧的一部分
+type disasmUnit struct {
+	name   string
+	ins    code.Instructions
+	lines  code.LineTable
+	locals []string
+	frees  []string
+}
+
+type disassembler struct {
+	bytecode *Bytecode
+	globals  []string
+	names    map[int]string // 常量池中函数和循环的名字
+	counts   map[string]int // 每个函数中已命名的闭包和循环的个数
+	printed  map[int]bool
+	w        *tabwriter.Writer
+}
+
+// Disassemble 从 main 开始输出指令，函数字面量和循环体跟在创建它们的函数之后，
+// 每条指令标注源码行以及常量和变量槽位的名字
+func (b *Bytecode) Disassemble(w io.Writer) error {
+	d := &disassembler{
+		bytecode: b,
+		globals:  b.SymbolTable.Names,
+		names:    make(map[int]string),
+		counts:   make(map[string]int),
+		printed:  make(map[int]bool),
+		w:        tabwriter.NewWriter(w, 0, 8, 2, ' ', 0),
+	}
+	for i, constant := range b.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok && fn.Name != "" {
+			d.names[i] = fn.Name
+		}
+	}
+
+	d.function("main", disasmUnit{name: "main", ins: b.Instructions, lines: b.Lines})
+	for i, constant := range b.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok && fn.Name != "" && !d.printed[i] {
+			d.printed[i] = true
+			d.function(fn.Name, unitOf(fn.Name, fn))
+		}
+	}
+	// 没有被引用的函数字面量只能通过常量池找到
+	for i, constant := range b.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok && !d.printed[i] {
+			d.printed[i] = true
+			d.function(d.constName(i), unitOf(d.constName(i), fn))
+		}
+	}
+	return d.w.Flush()
+}
+
+func unitOf(name string, fn *object.CompiledFunction) disasmUnit {
+	return disasmUnit{name: name, ins: fn.Instructions, lines: fn.Lines, locals: fn.LocalNames, frees: fn.FreeNames}
+}
+
+// function 输出一段指令，再输出其中创建的闭包和循环
+func (d *disassembler) function(name string, u disasmUnit) {
+	d.closures(name, d.unit(name, u))
+}
+
+func (d *disassembler) closures(parent string, children []int) {
+	for _, idx := range children {
+		if d.printed[idx] {
+			continue
+		}
+		d.printed[idx] = true
+		name := d.names[idx]
+		switch constant := d.bytecode.Constants[idx].(type) {
+		case *object.CompiledFunction:
+			d.function(name, unitOf(name, constant))
+		case *object.ForLoop:
+			var nested []int
+			for _, part := range []struct {
+				name  string
+				ins   code.Instructions
+				lines code.LineTable
+			}{
+				{"init", constant.Init, constant.InitLines},
+				{"cond", constant.Cond, constant.CondLines},
+				{"body", constant.Body, constant.BodyLines},
+				{"post", constant.Post, constant.PostLines},
+			} {
+				if len(part.ins) == 0 {
+					continue
+				}
+				u := disasmUnit{name: name + "." + part.name, ins: part.ins, lines: part.lines, locals: constant.LocalNames, frees: constant.FreeNames}
+				nested = append(nested, d.unit(name, u)...)
+			}
+			d.closures(name, nested)
+		case *object.RangeLoop:
+			nested := d.unit(name, disasmUnit{name: name + ".x", ins: constant.X, lines: constant.XLines, locals: constant.LocalNames, frees: constant.FreeNames})
+			nested = append(nested, d.unit(name, disasmUnit{name: name + ".body", ins: constant.Body, lines: constant.BodyLines, locals: constant.LocalNames, frees: constant.FreeNames})...)
+			d.closures(name, nested)
+		}
+	}
+}
+
+// unit 输出一段指令，返回其中 OpClosure 引用的常量，它们按 parent 命名
+func (d *disassembler) unit(parent string, u disasmUnit) []int {
+	var children []int
+	fmt.Fprintf(d.w, "%s:\n", u.name)
+	for offset := 0; offset < len(u.ins); {
+		def, err := code.Lookup(u.ins[offset])
+		if err != nil {
+			fmt.Fprintf(d.w, "\t\t%04d\tERROR: %s\n", offset, err)
+			break
+		}
+		op := code.Opcode(u.ins[offset])
+		operands, read := code.ReadOperands(def, u.ins[offset+1:])
+		text := def.Name
+		for _, operand := range operands {
+			text += " " + strconv.Itoa(operand)
+		}
+		if op == code.OpClosure {
+			d.nameClosure(parent, operands[0])
+			children = append(children, operands[0])
+		}
+		fmt.Fprintf(d.w, "\t%s\t%04d\t%s\t%s\n", d.line(u.lines.Lookup(offset)), offset, text, d.comment(op, operands, u))
+		offset += 1 + read
+	}
+	return children
+}
+
+// nameClosure 仿照 Go 的命名：main.func1、main.for1
+func (d *disassembler) nameClosure(parent string, idx int) {
+	if _, ok := d.names[idx]; ok || idx >= len(d.bytecode.Constants) {
+		return
+	}
+	kind := ""
+	switch d.bytecode.Constants[idx].(type) {
+	case *object.CompiledFunction:
+		kind = "func"
+	case *object.ForLoop:
+		kind = "for"
+	case *object.RangeLoop:
+		kind = "range"
+	default:
+		return
+	}
+	d.counts[parent+"."+kind]++
+	d.names[idx] = fmt.Sprintf("%s.%s%d", parent, kind, d.counts[parent+"."+kind])
+}
+
+func (d *disassembler) line(pos token.Pos) string {
+	if !pos.IsValid() || d.bytecode.Fset == nil {
+		return "-"
+	}
+	p := d.bytecode.Fset.Position(pos)
+	if p.Filename == "" {
+		return strconv.Itoa(p.Line)
+	}
+	return p.Filename + ":" + strconv.Itoa(p.Line)
+}
+
+// comment 常量的值、变量的名字和闭包的名字
+func (d *disassembler) comment(op code.Opcode, operands []int, u disasmUnit) string {
+	if len(operands) == 0 {
+		return ""
+	}
+	switch op {
+	case code.OpSetGlobal, code.OpGetGlobal:
+		return slotName(d.globals, operands[0])
+	case code.OpSetLocal, code.OpGetLocal:
+		return slotName(u.locals, operands[0])
+	case code.OpSetFree, code.OpGetFree:
+		return slotName(u.frees, operands[0])
+	case code.OpGetBuiltin:
+		if operands[0] < len(object.Builtins) {
+			return "; " + object.Builtins[operands[0]].Name
+		}
+	case code.OpClosure:
+		return "; " + d.constName(operands[0])
+	case code.OpConstant, code.OpFixedArray, code.OpStruct, code.OpGetField, code.OpSetField, code.OpFieldAddr,
+		code.OpTypeAssert, code.OpTypeCase, code.OpChannel, code.OpMakeSlice, code.OpBranch, code.OpSelect:
+		return "; " + d.constName(operands[0])
+	}
+	return ""
+}
+
+func slotName(names []string, idx int) string {
+	if idx < len(names) && names[idx] != "" {
+		return "; " + names[idx]
+	}
+	return ""
+}
+
+func (d *disassembler) constName(idx int) string {
+	if idx >= len(d.bytecode.Constants) {
+		return "?"
+	}
+	if name, ok := d.names[idx]; ok {
+		return name
+	}
+	switch constant := d.bytecode.Constants[idx].(type) {
+	case nil:
+		return "nil"
+	case *object.String:
+		return strconv.Quote(constant.Value)
+	case *object.CompiledFunction, *object.ForLoop, *object.RangeLoop:
+		return "const" + strconv.Itoa(idx)
+	default:
+		return constant.String()
+	}
+}
@@ -10,6 +10,9 @@ const (
 	BuiltinScope  SymbolScope = "BUILTIN"
 	FreeScope     SymbolScope = "FREE"
 	FunctionScope SymbolScope = "FUNCTION"
+	TypeScope     SymbolScope = "TYPE"
+	ConstScope    SymbolScope = "CONST"
+	GenericScope  SymbolScope = "GENERIC"
 )
 
 type Symbol struct {
@@ -17,6 +20,7 @@ type Symbol struct {
 	Scope SymbolScope
 	Index int
 	Type  object.Object
+	Heap  bool // 被取地址的变量分配在堆上，槽位中保存指向它的指针
 }
 
 type FreeSymbol struct {
@@ -29,6 +33,8 @@ type SymbolTable struct {
 	Store          map[string]Symbol
 	NumDefinitions int
 	FreeSymbols    []Symbol
+	Addressed      map[string]bool // 函数中被取地址的变量名
+	Names          []string        // 每个槽位最后定义的变量名，反汇编时使用
 }
 
 func NewSymbolTable() *SymbolTable {
@@ -40,6 +46,7 @@ func NewSymbolTable() *SymbolTable {
 func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	s := NewSymbolTable()
 	s.Outer = outer
+	s.Addressed = outer.Addressed
 	return s
 }
 
@@ -47,11 +54,12 @@ func (st *SymbolTable) Define(name string) Symbol {
 	if name == "_" {
 		return Symbol{Name: name}
 	}
+	// 同名变量遮蔽内置函数
 	symbol, ok := st.Store[name]
-	if ok {
+	if ok && symbol.Scope != BuiltinScope {
 		return symbol
 	} else {
-		symbol = Symbol{Name: name, Index: st.NumDefinitions}
+		symbol = Symbol{Name: name, Index: st.NumDefinitions, Heap: st.Addressed[name]}
 	}
 	if st.Outer == nil {
 		symbol.Scope = GlobalScope
@@ -59,6 +67,7 @@ func (st *SymbolTable) Define(name string) Symbol {
 		symbol.Scope = LocalScope
 	}
 	st.Store[name] = symbol
+	st.nameSlot(symbol.Index, name)
 	st.NumDefinitions++
 	return symbol
 }
@@ -68,10 +77,10 @@ func (st *SymbolTable) DefineWithType(name string, defObj object.Object) Symbol
 		return Symbol{Name: name}
 	}
 	symbol, ok := st.Store[name]
-	if ok && symbol.Type != nil {
+	if ok && symbol.Type != nil && symbol.Scope != BuiltinScope {
 		return symbol
 	} else {
-		symbol = Symbol{Name: name, Index: st.NumDefinitions, Type: defObj}
+		symbol = Symbol{Name: name, Index: st.NumDefinitions, Type: defObj, Heap: st.Addressed[name]}
 	}
 	if st.Outer == nil {
 		symbol.Scope = GlobalScope
@@ -79,10 +88,27 @@ func (st *SymbolTable) DefineWithType(name string, defObj object.Object) Symbol
 		symbol.Scope = LocalScope
 	}
 	st.Store[name] = symbol
+	st.nameSlot(symbol.Index, name)
 	st.NumDefinitions++
 	return symbol
 }
 
+func (st *SymbolTable) nameSlot(index int, name string) {
+	for len(st.Names) <= index {
+		st.Names = append(st.Names, "")
+	}
+	st.Names[index] = name
+}
+
+// FreeNames 自由变量按序号的名字
+func (st *SymbolTable) FreeNames() []string {
+	names := make([]string, len(st.FreeSymbols))
+	for i, s := range st.FreeSymbols {
+		names[i] = s.Name
+	}
+	return names
+}
+
 func (st *SymbolTable) DeleteSymbol(name string) {
 	_, ok := st.Store[name]
 	if ok {
@@ -107,7 +133,7 @@ func (st *SymbolTable) Resolve(name string) (Symbol, bool) {
 			return symbol, ok
 		}
 
-		if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope || symbol.Scope == FunctionScope {
+		if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope || symbol.Scope == FunctionScope || symbol.Scope == TypeScope || symbol.Scope == ConstScope || symbol.Scope == GenericScope {
 			return symbol, ok
 		}
 
@@ -129,6 +155,52 @@ func (st *SymbolTable) DefineFunctionName(name string, defObj object.Object) Sym
 	return symbol
 }
 
+func (st *SymbolTable) DefineType(name string, typ object.Object) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: TypeScope, Type: typ}
+	st.Store[name] = symbol
+	return symbol
+}
+
+func (st *SymbolTable) ResolveType(name string) (object.Object, bool) {
+	symbol, ok := st.Resolve(name)
+	if !ok || symbol.Scope != TypeScope {
+		return nil, false
+	}
+	return symbol.Type, true
+}
+
+// DefineConst 常量不占用槽位，使用时直接加载它的值
+func (st *SymbolTable) DefineConst(name string, c *object.Constant) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: ConstScope, Type: c}
+	st.Store[name] = symbol
+	return symbol
+}
+
+// DefineGeneric 泛型函数在调用时按类型实参实例化，本身不占用槽位
+func (st *SymbolTable) DefineGeneric(name string, fn *object.Function) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: GenericScope, Type: fn}
+	st.Store[name] = symbol
+	return symbol
+}
+
+func (st *SymbolTable) Const(name string) (*object.Constant, bool) {
+	symbol, ok := st.lookup(name)
+	if !ok || symbol.Scope != ConstScope {
+		return nil, false
+	}
+	return symbol.Type.(*object.Constant), true
+}
+
+// lookup 查找符号，不会把外层函数的变量定义为自由变量
+func (st *SymbolTable) lookup(name string) (Symbol, bool) {
+	for s := st; s != nil; s = s.Outer {
+		if symbol, ok := s.Store[name]; ok {
+			return symbol, true
+		}
+	}
+	return Symbol{}, false
+}
+
 func (st *SymbolTable) defineFree(original Symbol) Symbol {
 	st.FreeSymbols = append(st.FreeSymbols, original)
 	symbol := Symbol{
@@ -136,6 +208,7 @@ func (st *SymbolTable) defineFree(original Symbol) Symbol {
 		Index: len(st.FreeSymbols) - 1,
 		Scope: FreeScope,
 		Type:  original.Type,
+		Heap:  original.Heap,
 	}
 	st.Store[original.Name] = symbol
 	return symbol
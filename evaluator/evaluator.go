@@ -1,26 +1,55 @@
 package evaluator
 
 import (
-	"bytes"
 	"errors"
 	"go/ast"
 	"go/token"
+	"go/types"
 	"goscript/object"
 	"goscript/program"
 	"strconv"
 	"strings"
 )
 
-var tokenFile *token.File
+var fileSet *token.FileSet
+
+var (
+	callDepth  int
+	panicking  *object.Error // 正在执行 defer 的 panic
+	deferDepth int           // 被 defer 直接调用的函数所在层，recover 只在这里生效
+
+	recoverBuiltin = object.GetBuiltinByName("recover")
+)
 
 func EvalProgram(prog *program.Program) object.Object {
-	tokenFile = prog.TokenFile
+	fileSet = prog.Fset
+	callDepth, panicking = 0, nil
+
+	result := evalMain(prog)
+	// main 结束时执行 defer
+	rt := runDefers(prog.Env, result)
+	if object.IsError(rt) {
+		return rt
+	}
+	if object.IsError(result) {
+		return nil
+	}
+	return result
+}
+
+func evalMain(prog *program.Program) object.Object {
 	var result object.Object
-	for _, stmt := range prog.Statements {
-		result = eval(stmt, prog.Env)
+	for i := 0; i < len(prog.Statements); i++ {
+		result = eval(prog.Statements[i], prog.Env)
 
 		switch rt := result.(type) {
+		case *object.Branch:
+			i = labelIndex(prog.Statements, rt) - 1
 		case *object.SingleReturn:
+			// 调用语句的返回值被丢弃，最后一条语句的值作为结果
+			if !isReturn(rt) && i < len(prog.Statements)-1 {
+				continue
+			}
 			return rt.Value
 		case *object.MapExist:
 			return rt.Value
@@ -32,6 +61,11 @@ func EvalProgram(prog *program.Program) object.Object {
 }
 
 func eval(node ast.Node, env *object.Environment) object.Object {
+	if expr, ok := node.(ast.Expr); ok {
+		if obj := evalConstExpr(expr, nil, "assignment", env); obj != nil {
+			return obj
+		}
+	}
 	switch node := node.(type) {
 	case *ast.ExprStmt:
 		return eval(node.X, env)
@@ -43,14 +77,24 @@ func eval(node ast.Node, env *object.Environment) object.Object {
 		return evalAssignStmt(node, env)
 	case *ast.IfStmt:
 		return evalIfStmt(node, env)
+	case *ast.SwitchStmt:
+		return evalSwitchStmt(node, env)
+	case *ast.TypeSwitchStmt:
+		return evalTypeSwitchStmt(node, env)
 	case *ast.ForStmt:
-		return evalForStmt(node, env)
+		return evalForStmt(node, env, "")
 	case *ast.RangeStmt:
-		return evalRangeStmt(node, env)
+		return evalRangeStmt(node, env, "")
+	case *ast.LabeledStmt:
+		return evalLabeledStmt(node, env)
+	case *ast.EmptyStmt:
+		return nil
 	case *ast.BlockStmt:
 		return evalBlockStmt(node, env)
 	case *ast.ReturnStmt:
 		return evalReturnStmt(node, env)
+	case *ast.DeferStmt:
+		return evalDeferStmt(node, env)
 	case *ast.IncDecStmt:
 		return evalIncDecStmt(node, env)
 	case *ast.BinaryExpr:
@@ -59,12 +103,22 @@ func eval(node ast.Node, env *object.Environment) object.Object {
 		return evalUnaryExpr(node, env)
 	case *ast.ParenExpr:
 		return eval(node.X, env)
+	case *ast.StarExpr:
+		return evalStarExpr(node, env)
 	case *ast.IndexExpr:
 		return evalIndexExpr(node, env)
+	case *ast.IndexListExpr:
+		return evalInstantiate(node, env)
+	case *ast.SliceExpr:
+		return evalSliceExpr(node, env)
+	case *ast.SelectorExpr:
+		return evalSelectorExpr(node, env)
 	case *ast.CallExpr:
 		return evalCallExpr(node, env)
 	case *ast.CompositeLit:
 		return evalCompositeLit(node, env)
+	case *ast.TypeAssertExpr:
+		return evalTypeAssertExpr(node, env, false)
 	case *ast.FuncLit:
 		return evalFuncLit(node, env)
 	case *ast.Ident:
@@ -72,10 +126,16 @@ func eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.BasicLit:
 		return parseBasicLit(node)
 	case *ast.BranchStmt:
+		if node.Label != nil {
+			return &object.Branch{Tok: node.Tok, Label: node.Label.Name}
+		}
 		if node.Tok == token.CONTINUE {
 			return object.CONTINUE
 		} else if node.Tok == token.BREAK {
 			return object.BREAK
+		} else if node.Tok == token.FALLTHROUGH {
+			line, column := parsePos(node.Pos())
+			return object.NewError("%d:%d fallthrough statement out of place", line, column)
 		} else {
 			return object.NewError("evaluator: not support ast.BranchStmt %s", node.Tok)
 		}
@@ -87,17 +147,29 @@ func eval(node ast.Node, env *object.Environment) object.Object {
 func evalGenDecl(node *ast.GenDecl, env *object.Environment) object.Object {
 	switch node.Tok {
 	case token.CONST:
+		return parseGenConst(node, env)
+	case token.VAR:
 		for _, spec := range node.Specs {
-			obj := parseGenConst(spec.(*ast.ValueSpec), env)
+			obj := parseGenVar(spec.(*ast.ValueSpec), env)
 			if object.IsError(obj) {
 				return obj
 			}
 		}
-	case token.VAR:
+	case token.TYPE:
 		for _, spec := range node.Specs {
-			obj := parseGenVar(spec.(*ast.ValueSpec), env)
-			if object.IsError(obj) {
-				return obj
+			typeSpec := spec.(*ast.TypeSpec)
+			line, column := parsePos(typeSpec.Pos())
+			typ := program.ParseTypeSpec(typeSpec)
+			if object.IsError(typ) {
+				return object.NewError("%d:%d %s", line, column, typ)
+			}
+			if it, ok := typ.(*object.InterfaceType); ok {
+				if err := it.ResolveEmbeds(env); err != nil {
+					return object.NewError("%d:%d %s", line, column, err)
+				}
+			}
+			if _, err := env.Set(typeSpec.Name.Name, typ); err != nil {
+				return object.NewError("%d:%d %s", line, column, err)
 			}
 		}
 	default:
@@ -121,68 +193,65 @@ func evalAssignStmt(node *ast.AssignStmt, env *object.Environment) object.Object
 	case token.ADD_ASSIGN, token.SUB_ASSIGN, token.MUL_ASSIGN, token.QUO_ASSIGN, token.REM_ASSIGN,
 		token.AND_ASSIGN, token.OR_ASSIGN, token.XOR_ASSIGN, token.SHL_ASSIGN, token.SHR_ASSIGN, token.AND_NOT_ASSIGN:
 		pairTok, _ := object.PairToken[node.Tok]
-		left := eval(node.Lhs[0], env)
-		if object.IsError(left) {
-			return left
-		}
-		right := eval(node.Rhs[0], env)
-		if object.IsError(right) {
-			return right
-		}
-		obj := handleBinaryExpr(pairTok, left, right)
+		binary := &ast.BinaryExpr{X: node.Lhs[0], OpPos: node.TokPos, Op: pairTok, Y: node.Rhs[0]}
+		assign := &ast.AssignStmt{Lhs: node.Lhs, TokPos: node.TokPos, Tok: token.ASSIGN, Rhs: []ast.Expr{binary}}
+		obj := parseAssignStmt(assign, env)
 		if object.IsError(obj) {
 			return obj
 		}
-		if tmp, ok := node.Lhs[0].(*ast.Ident); ok {
-			if evObj, ok := env.Get(tmp.Name); ok {
-				env.SetWithDepth(tmp.Name, obj, evObj.Depth)
-			} else {
-				env.SetWithDepth(tmp.Name, obj, 0)
-			}
-		}
-		return obj
 	default:
 		return object.NewError("ast.AssignStmt with not support type: %s", node.Tok)
 	}
 	return nil
 }
 
-func parseGenConst(spec *ast.ValueSpec, env *object.Environment) object.Object {
-	n := len(spec.Names)
-	if len(spec.Values) != n || spec.Values == nil {
-		tn := spec.Names[len(spec.Names)]
-		tl, tc := parsePos(tn.Pos())
-		return object.NewError("%d:%d missing init expr for '%s'", tl, tc, tn.Name)
-	}
-
-	if spec.Type != nil {
-		obj := object.GetDefaultValueWithExpr(spec.Type)
-
-		line, column := parsePos(spec.Type.Pos())
-		if obj.Type() < object.INT_OBJ || obj.Type() > object.STRING_OBJ {
-			return object.NewError("%d:%d Invalid constant type", line, column)
+func parseGenConst(node *ast.GenDecl, env *object.Environment) object.Object {
+	err := object.DeclareConsts(node, env, env, func(name *ast.Ident, c *object.Constant) error {
+		if _, ok := env.Get(name.Name); ok {
+			return &object.ConstError{Pos: name.Pos(), Msg: name.Name + " redeclared"}
 		}
+		env.Define(name.Name, c)
+		return nil
+	})
+	if err != nil {
+		return constErr(err)
 	}
+	return nil
+}
 
-	for i := 0; i < n; i++ {
-		line, column := parsePos(spec.Names[i].Pos())
-		key := spec.Names[i].Name
-		if _, ok := env.Get(key); ok {
-			return object.NewError("%d:%d %s redeclared", line, column, key)
+// evalConstExpr 引用了常量的表达式和字面量之间的运算按常量规则求值，typ 为上下文要求的类型；
+// 返回 nil 表示不是常量表达式
+func evalConstExpr(expr ast.Expr, typ object.Object, context string, env *object.Environment) object.Object {
+	if !object.UsesConst(expr, env) && !object.ConstBinary(expr, env) {
+		// 字面量转换为上下文要求的类型
+		if typ == nil || !object.IsConstType(object.Unnamed(typ).Type()) || !object.ConstOperand(expr, env) {
+			return nil
 		}
+	}
+	c, err := object.EvalConst(expr, env, -1)
+	if err == object.ErrNotConstant {
+		return nil
+	}
+	if err != nil {
+		return constErr(err)
+	}
+	if typ != nil && !object.IsConstType(object.Unnamed(typ).Type()) && typ.Type() != object.INTERFACE_OBJ {
+		typ = nil
+	}
+	obj, err := c.Assign(expr, typ, context)
+	if err != nil {
+		return constErr(err)
+	}
+	return obj
+}
 
-		defObj := object.GetDefaultValueWithExpr(spec.Type)
-		rhsObj := eval(spec.Values[i], env)
-		obj := object.ConvertValueWithType(rhsObj, defObj)
-		line, column = parsePos(spec.Names[i].Pos())
-		if object.IsError(obj) {
-			return object.NewError("%d:%d %s", line, column, obj)
-		}
-		if _, err := env.Set(key, obj); err != nil {
-			return object.NewError("%d:%d %s", line, column, err)
-		}
+// constErr 常量求值的错误加上位置
+func constErr(err error) *object.Error {
+	if cerr, ok := err.(*object.ConstError); ok {
+		line, column := parsePos(cerr.Pos)
+		return object.NewError("%d:%d %s", line, column, cerr.Msg)
 	}
-	return nil
+	return object.NewError("%s", err)
 }
 
 func parseGenVar(spec *ast.ValueSpec, env *object.Environment) object.Object {
@@ -199,7 +268,7 @@ func parseGenVar(spec *ast.ValueSpec, env *object.Environment) object.Object {
 
 	var defObj object.Object
 	if spec.Type != nil {
-		defObj = object.GetDefaultValueWithExpr(spec.Type)
+		defObj = object.GetDefaultValueWithExpr(spec.Type, env)
 	}
 
 	var keys []string
@@ -212,17 +281,15 @@ func parseGenVar(spec *ast.ValueSpec, env *object.Environment) object.Object {
 		keys = append(keys, key)
 	}
 
+	if defObj != nil && object.IsError(defObj) {
+		line, column := parsePos(spec.Type.Pos())
+		return object.NewError("%d:%d %s", line, column, defObj)
+	}
+
 	if spec.Values == nil {
-		if ty, ok := spec.Type.(*ast.ArrayType); ok {
-			n := -1
+		if ty, ok := spec.Type.(*ast.ArrayType); ok && ty.Len == nil {
 			for i, key := range keys {
-				var array object.Array
-				if ty.Len != nil {
-					n = int(eval(ty.Len, env).(object.Integer).Integer())
-					array = object.NewArray(defObj.Type(), []object.Object{}, true, n)
-				} else {
-					array = object.NewArray(defObj.Type(), []object.Object{}, false, -1)
-				}
+				array := object.NewArray(defObj.(*object.Array).ElemType, []object.Object{}, false, -1)
 				if _, err := env.Set(key, &array); err != nil {
 					line, column := parsePos(spec.Names[i].Pos())
 					return object.NewError("%d:%d %s", line, column, err)
@@ -230,7 +297,11 @@ func parseGenVar(spec *ast.ValueSpec, env *object.Environment) object.Object {
 			}
 		} else {
 			for i, key := range keys {
-				if _, err := env.Set(key, defObj); err != nil {
+				zero := object.CopyValue(defObj)
+				if _, ok := defObj.(*object.Function); ok {
+					zero = object.NULL
+				}
+				if _, err := env.Set(key, zero); err != nil {
 					line, column := parsePos(spec.Names[i].Pos())
 					return object.NewError("%d:%d %s", line, column, err)
 				}
@@ -243,7 +314,28 @@ func parseGenVar(spec *ast.ValueSpec, env *object.Environment) object.Object {
 	for _, vexpr := range spec.Values {
 		line, column := parsePos(vexpr.Pos())
 
-		rhsObj := eval(vexpr, env)
+		if obj := evalConstExpr(vexpr, defObj, "variable declaration", env); obj != nil {
+			if object.IsError(obj) {
+				return obj
+			}
+			if _, err := env.Set(keys[i], obj); err != nil {
+				return object.NewError("%d:%d %s", line, column, err)
+			}
+			i++
+			continue
+		}
+		// 字面量赋值给指定类型的变量时检查能否表示
+		if defObj != nil && object.IsConstType(defObj.Type()) {
+			if c, err := object.EvalConst(vexpr, env, -1); err == nil {
+				if _, err = c.Assign(vexpr, defObj, "variable declaration"); err != nil {
+					return constErr(err)
+				}
+			} else if err != object.ErrNotConstant {
+				return constErr(err)
+			}
+		}
+
+		rhsObj := evalRhs(vexpr, env, n1 == 2 && len(spec.Values) == 1)
 		if object.IsError(rhsObj) {
 			return rhsObj
 		}
@@ -254,7 +346,7 @@ func parseGenVar(spec *ast.ValueSpec, env *object.Environment) object.Object {
 			if object.IsError(tObj) {
 				return object.NewError("%d:%d %s", line, column, tObj)
 			}
-			if _, err := env.Set(keys[i], tObj); err != nil {
+			if _, err := env.Set(keys[i], object.CopyValue(tObj)); err != nil {
 				return object.NewError("%d:%d %s", line, column, err)
 			}
 			i++
@@ -284,7 +376,7 @@ func parseGenVar(spec *ast.ValueSpec, env *object.Environment) object.Object {
 			if object.IsError(tObj) {
 				return object.NewError("%d:%d %s", line, column, tObj)
 			}
-			if _, err := env.Set(keys[i], tObj); err != nil {
+			if _, err := env.Set(keys[i], object.CopyValue(tObj)); err != nil {
 				return object.NewError("%d:%d %s", line, column, err)
 			}
 			i++
@@ -323,21 +415,26 @@ func parseDefineStmt(node *ast.AssignStmt, env *object.Environment) object.Objec
 		return object.NewError("%d:%d no new variables on left side of :=", line, column)
 	}
 
-	i := 0
+	// 先求出所有右值再定义，a, b := b, a 使用的是原来的值
+	var rhsObjs []object.Object
 	for _, vexpr := range node.Rhs {
-		line, column = parsePos(vexpr.Pos())
-
-		rhsObj := eval(vexpr, env)
+		rhsObj := evalRhs(vexpr, env, n1 == 2 && len(node.Rhs) == 1)
 		if object.IsError(rhsObj) {
 			return rhsObj
 		}
+		rhsObjs = append(rhsObjs, rhsObj)
+	}
+
+	i := 0
+	for j, rhsObj := range rhsObjs {
+		line, column = parsePos(node.Rhs[j].Pos())
 
 		switch obj := rhsObj.(type) {
 		case *object.SingleReturn:
 			if object.IsError(obj.Value) {
 				return object.NewError("%d:%d %s", line, column, obj.Value)
 			}
-			if _, err := env.SetWithDepth(keys[i], obj.Value, keyDepths[keys[i]]); err != nil {
+			if _, err := env.SetWithDepth(keys[i], object.CopyValue(obj.Value), keyDepths[keys[i]]); err != nil {
 				return object.NewError("%d:%d %s", line, column, err)
 			}
 			i++
@@ -352,7 +449,7 @@ func parseDefineStmt(node *ast.AssignStmt, env *object.Environment) object.Objec
 				i++
 			}
 		case *object.MapExist:
-			if _, err := env.SetWithDepth(keys[i], obj.Value, keyDepths[keys[i]]); err != nil {
+			if _, err := env.SetWithDepth(keys[i], object.CopyValue(obj.Value), keyDepths[keys[i]]); err != nil {
 				return object.NewError("%d:%d %s", line, column, err)
 			}
 			i++
@@ -363,7 +460,7 @@ func parseDefineStmt(node *ast.AssignStmt, env *object.Environment) object.Objec
 				i++
 			}
 		default:
-			if _, err := env.SetWithDepth(keys[i], rhsObj, keyDepths[keys[i]]); err != nil {
+			if _, err := env.SetWithDepth(keys[i], object.CopyValue(rhsObj), keyDepths[keys[i]]); err != nil {
 				return object.NewError("%d:%d %s", line, column, err)
 			}
 			i++
@@ -387,46 +484,102 @@ func parseAssignStmt(node *ast.AssignStmt, env *object.Environment) object.Objec
 			if item.Name == "_" {
 				lhsItems = append(lhsItems, LhsItem{Name: "_", Depth: 0})
 			} else if tmp, ok := env.Get(item.Name); ok {
+				if tmp.GetValue().Type() == object.CONSTANT_OBJ {
+					return object.NewError("%d:%d cannot assign to %s (neither addressable nor a map index expression)", line, column, item.Name)
+				}
 				lhsItems = append(lhsItems, LhsItem{Name: item.Name, Depth: tmp.Depth})
 			} else {
 				return object.NewError("%d:%d undefined %s", line, column, item.Name)
 			}
 		case *ast.IndexExpr:
-			tmp, ok := item.X.(*ast.Ident)
-			if !ok {
-				return object.NewError("%d:%d not ast.Ident", line, column)
+			var container object.Object
+			lhsItem := LhsItem{IsIndex: true}
+			if tmp, ok := item.X.(*ast.Ident); ok {
+				vObj, ex := env.Get(tmp.Name)
+				if !ex {
+					return object.NewError("%d:%d undefined %s", line, column, tmp.Name)
+				}
+				container = vObj.GetValue()
+				lhsItem.Name, lhsItem.Depth = tmp.Name, vObj.Depth
+			} else {
+				// g[1][0] 和 t.Arr[0] 的容器是表达式，数组元素和结构体字段按引用取出
+				container = unwrapValue(eval(item.X, env))
+				if object.IsError(container) {
+					return container
+				}
+				lhsItem.Container = container
 			}
-			idx := eval(item.Index, env)
+			idx := evalIndex(item.Index, container, env)
 			if object.IsError(idx) {
 				return idx
 			}
-			if vObj, ex := env.Get(tmp.Name); ex {
-				var lhsItem LhsItem
-				if vObj.GetValue().Type() == object.ARRAY_OBJ {
-					lhsItem = LhsItem{Name: tmp.Name, Depth: vObj.Depth, IsIndex: true, Index: idx.(object.Integer).Integer()}
-				} else if vObj.GetValue().Type() == object.HASH_OBJ {
-					lhsItem = LhsItem{Name: tmp.Name, Depth: vObj.Depth, IsIndex: true, HashKey: idx.(object.Hashable).HashKey()}
+			switch object.Indexed(container).Type() {
+			case object.ARRAY_OBJ:
+				lhsItem.Index = object.Unnamed(idx).(object.Integer).Integer()
+			case object.HASH_OBJ:
+				if _, err := object.HashOf(idx); err != nil {
+					return object.NewError("%d:%d %s", line, column, err)
 				}
-				lhsItems = append(lhsItems, lhsItem)
-			} else {
-				return object.NewError("%d:%d undefined %s", line, column, tmp.Name)
+				lhsItem.Key = idx
+			default:
+				return object.NewError("%d:%d cannot assign to %s (neither addressable nor a map index expression)", line, column, types.ExprString(item))
+			}
+			lhsItems = append(lhsItems, lhsItem)
+		case *ast.SelectorExpr:
+			owner := evalFieldOwner(item, env)
+			if object.IsError(owner) {
+				return owner
 			}
+			lhsItems = append(lhsItems, LhsItem{Name: item.Sel.Name, Target: owner.(*object.Struct)})
+		case *ast.StarExpr:
+			target := evalPointerTarget(item, env)
+			if object.IsError(target) {
+				return target
+			}
+			lhsItems = append(lhsItems, LhsItem{Pointer: target.(*object.Pointer)})
 		default:
 			return object.NewError("%d:%d not support", line, column)
 		}
 	}
 
-	for i := 0; i < n1; i++ {
-		line, column = parsePos(node.Rhs[i].Pos())
-		obj := eval(node.Rhs[i], env)
+	// 右边全部求值后才赋值，a, b = b, a 交换两个值
+	values, errObj := evalAssignValues(node, lhsItems, env)
+	if errObj != nil {
+		return errObj
+	}
+	for i, obj := range values {
+		line, column = parsePos(node.Rhs[min(i, len(node.Rhs)-1)].Pos())
 		lhsItem := lhsItems[i]
-		if !lhsItem.IsIndex {
+		obj = object.CopyValue(obj)
+		if lhsItem.Pointer != nil {
+			if cur := lhsItem.Pointer.Load(); obj.Type() != cur.Type() {
+				obj = object.ConvertValueWithType(obj, cur)
+				if object.IsError(obj) {
+					return object.NewError("%d:%d %s", line, column, obj)
+				}
+			}
+			lhsItem.Pointer.Store(obj)
+		} else if lhsItem.Target != nil {
+			field, _ := lhsItem.Target.Get(lhsItem.Name)
+			if obj.Type() != field.Type() {
+				obj = object.ConvertValueWithType(obj, field)
+				if object.IsError(obj) {
+					return object.NewError("%d:%d %s", line, column, obj)
+				}
+			}
+			lhsItem.Target.Set(lhsItem.Name, obj)
+		} else if !lhsItem.IsIndex {
+			if cur, ok := env.Get(lhsItem.Name); ok && (cur.GetValue().Type() == object.INTERFACE_OBJ || cur.GetValue().Type() == object.POINTER_OBJ) {
+				obj = object.ConvertValueWithType(obj, cur.GetValue())
+				if object.IsError(obj) {
+					return object.NewError("%d:%d %s", line, column, obj)
+				}
+			}
 			if _, err := env.SetWithDepth(lhsItem.Name, obj, lhsItem.Depth); err != nil {
 				return object.NewError("%d:%d %s", line, column, err)
 			}
 		} else {
-			envObj, _ := env.Get(lhsItem.Name)
-			switch oobj := envObj.GetValue().(type) {
+			switch oobj := object.Indexed(lhsItem.container(env)).(type) {
 			case *object.Array:
 				if obj.Type() != oobj.ElemType {
 					return object.NewError("%d:%d cannot use (untyped %s constant) as %s value in assignment", line, column, obj.Type(), oobj.ElemType)
@@ -436,15 +589,65 @@ func parseAssignStmt(node *ast.AssignStmt, env *object.Environment) object.Objec
 				if obj.Type() != oobj.ValueType {
 					return object.NewError("%d:%d cannot use (untyped %s constant) as %s value in assignment", line, column, obj.Type(), oobj.ValueType)
 				}
-				pair := oobj.Pairs[lhsItem.HashKey]
-				pair.Value = obj
-				oobj.Pairs[lhsItem.HashKey] = pair
+				oobj.Set(lhsItem.Key, obj)
 			}
 		}
 	}
 	return nil
 }
 
+// evalAssignValues 依次求出赋值语句右边的值，单个右值可以是多返回值或 comma-ok 形式
+func evalAssignValues(node *ast.AssignStmt, lhsItems []LhsItem, env *object.Environment) ([]object.Object, object.Object) {
+	if len(node.Rhs) == 1 && len(lhsItems) > 1 {
+		line, column := parsePos(node.Rhs[0].Pos())
+		switch obj := evalRhs(node.Rhs[0], env, len(lhsItems) == 2).(type) {
+		case *object.Error:
+			return nil, obj
+		case *object.MultiReturn:
+			return obj.Values, nil
+		case *object.MapExist:
+			return []object.Object{obj.Value, object.ConvertToBoolean(obj.Exist)}, nil
+		default:
+			return nil, object.NewError("%d:%d assignment mismatch: %d variables but 1 value", line, column, len(lhsItems))
+		}
+	}
+	var values []object.Object
+	for i, rhs := range node.Rhs {
+		typ := lhsType(lhsItems[i], env)
+		obj := evalConstExpr(rhs, typ, "assignment", env)
+		if obj == nil {
+			obj = eval(rhs, env)
+		}
+		obj = unwrapValue(obj)
+		if object.IsError(obj) {
+			return nil, obj
+		}
+		values = append(values, obj)
+	}
+	return values, nil
+}
+
+// lhsType 赋值目标的类型，常量按该类型转换
+func lhsType(lhsItem LhsItem, env *object.Environment) object.Object {
+	if lhsItem.IsIndex {
+		switch x := object.Indexed(lhsItem.container(env)).(type) {
+		case *object.Array:
+			return object.GetDefaultObject(x.ElemType.String())
+		case *object.Hash:
+			return object.GetDefaultObject(x.ValueType.String())
+		}
+		return nil
+	}
+	if lhsItem.Name == "" || lhsItem.Target != nil {
+		return nil
+	}
+	cur, ok := env.Get(lhsItem.Name)
+	if !ok {
+		return nil
+	}
+	return cur.GetValue()
+}
+
 func evalIfStmt(node *ast.IfStmt, env *object.Environment) object.Object {
 	outEnv := env
 	if node.Init != nil {
@@ -454,7 +657,7 @@ func evalIfStmt(node *ast.IfStmt, env *object.Environment) object.Object {
 			return init
 		}
 	}
-	cond := eval(node.Cond, env)
+	cond := unwrapValue(eval(node.Cond, env))
 	if object.IsError(cond) {
 		return cond
 	}
@@ -473,7 +676,164 @@ func evalIfStmt(node *ast.IfStmt, env *object.Environment) object.Object {
 	return rt
 }
 
-func evalForStmt(node *ast.ForStmt, env *object.Environment) object.Object {
+func evalSwitchStmt(node *ast.SwitchStmt, env *object.Environment) object.Object {
+	switchEnv := object.NewEnclosedEnvironment(env)
+	if node.Init != nil {
+		initObj := eval(node.Init, switchEnv)
+		if object.IsError(initObj) {
+			return initObj
+		}
+	}
+
+	var tag object.Object = object.TRUE
+	if node.Tag != nil {
+		tag = unwrapValue(eval(node.Tag, switchEnv))
+		if object.IsError(tag) {
+			return tag
+		}
+	}
+
+	matched, defaultIdx := -1, -1
+	for i, stmt := range node.Body.List {
+		clause := stmt.(*ast.CaseClause)
+		if clause.List == nil {
+			defaultIdx = i
+			continue
+		}
+		for _, expr := range clause.List {
+			value := eval(expr, switchEnv)
+			if object.IsError(value) {
+				return value
+			}
+			rt := handleBinaryExpr(token.EQL, tag, value)
+			if object.IsError(rt) {
+				line, column := parsePos(expr.Pos())
+				return object.NewError("%d:%d %s", line, column, rt)
+			}
+			if object.IsTruthy(rt) {
+				matched = i
+				break
+			}
+		}
+		if matched >= 0 {
+			break
+		}
+	}
+	if matched < 0 {
+		matched = defaultIdx
+	}
+	if matched < 0 {
+		return nil
+	}
+
+	for i := matched; i < len(node.Body.List); i++ {
+		clause := node.Body.List[i].(*ast.CaseClause)
+		body, fall := splitFallthrough(clause.Body)
+		if fall && i == len(node.Body.List)-1 {
+			line, column := parsePos(clause.Body[len(clause.Body)-1].Pos())
+			return object.NewError("%d:%d cannot fallthrough final case in switch", line, column)
+		}
+		rt := evalClause(body, object.NewEnclosedEnvironment(switchEnv))
+		if rt != nil || !fall {
+			return rt
+		}
+	}
+	return nil
+}
+
+func evalTypeSwitchStmt(node *ast.TypeSwitchStmt, env *object.Environment) object.Object {
+	switchEnv := object.NewEnclosedEnvironment(env)
+	if node.Init != nil {
+		initObj := eval(node.Init, switchEnv)
+		if object.IsError(initObj) {
+			return initObj
+		}
+	}
+
+	var name string
+	var assert *ast.TypeAssertExpr
+	switch stmt := node.Assign.(type) {
+	case *ast.AssignStmt:
+		name = stmt.Lhs[0].(*ast.Ident).Name
+		assert = stmt.Rhs[0].(*ast.TypeAssertExpr)
+	case *ast.ExprStmt:
+		assert = stmt.X.(*ast.TypeAssertExpr)
+	}
+	x := unwrapValue(eval(assert.X, switchEnv))
+	if object.IsError(x) {
+		return x
+	}
+
+	var matched, defaultClause *ast.CaseClause
+	value := x
+	for _, stmt := range node.Body.List {
+		clause := stmt.(*ast.CaseClause)
+		if clause.List == nil {
+			defaultClause = clause
+			continue
+		}
+		for _, expr := range clause.List {
+			if ident, ok := expr.(*ast.Ident); ok && ident.Name == "nil" {
+				if object.Underlying(x) == object.NULL {
+					matched = clause
+					break
+				}
+				continue
+			}
+			typ := object.TypeOf(expr, switchEnv)
+			if object.IsError(typ) {
+				line, column := parsePos(expr.Pos())
+				return object.NewError("%d:%d %s", line, column, typ)
+			}
+			if rt, ok := object.AssertType(x, typ); ok {
+				matched = clause
+				if len(clause.List) == 1 {
+					value = rt
+					if iface, ok := typ.(*object.Interface); ok {
+						value = &object.Interface{InterfaceType: iface.InterfaceType, Value: rt}
+					}
+				}
+				break
+			}
+		}
+		if matched != nil {
+			break
+		}
+	}
+	if matched == nil {
+		matched = defaultClause
+	}
+	if matched == nil {
+		return nil
+	}
+
+	clauseEnv := object.NewEnclosedEnvironment(switchEnv)
+	if name != "" {
+		clauseEnv.Define(name, value)
+	}
+	return evalClause(matched.Body, clauseEnv)
+}
+
+// evalClause 执行 case 子句，break 只结束当前 switch
+func evalClause(body []ast.Stmt, env *object.Environment) object.Object {
+	rt := evalBlockStmt(&ast.BlockStmt{List: body}, env)
+	if rt == object.BREAK {
+		return nil
+	}
+	return rt
+}
+
+// splitFallthrough 去掉子句末尾的 fallthrough
+func splitFallthrough(body []ast.Stmt) ([]ast.Stmt, bool) {
+	if n := len(body); n > 0 {
+		if branch, ok := body[n-1].(*ast.BranchStmt); ok && branch.Tok == token.FALLTHROUGH {
+			return body[:n-1], true
+		}
+	}
+	return body, false
+}
+
+func evalForStmt(node *ast.ForStmt, env *object.Environment, label string) object.Object {
 	forEnv := object.NewEnclosedEnvironment(env)
 
 	initObj := eval(node.Init, forEnv)
@@ -490,12 +850,15 @@ func evalForStmt(node *ast.ForStmt, env *object.Environment) object.Object {
 			return object.NewError("%d:%d: non-boolean condition in for statement", line, column)
 		}
 		if cond == object.TRUE {
-			obj := evalBlockStmt(node.Body, forEnv)
+			// 每次迭代的循环体有自己的作用域，其中定义的变量互不影响
+			obj := evalBlockStmt(node.Body, object.NewEnclosedEnvironment(forEnv))
 			if object.IsError(obj) {
 				return obj
 			}
 			if obj == object.BREAK {
 				break
+			} else if isReturn(obj) || isBranch(obj, label) {
+				return obj
 			}
 			post := eval(node.Post, forEnv)
 			if object.IsError(post) {
@@ -508,7 +871,7 @@ func evalForStmt(node *ast.ForStmt, env *object.Environment) object.Object {
 	return nil
 }
 
-func evalRangeStmt(node *ast.RangeStmt, env *object.Environment) object.Object {
+func evalRangeStmt(node *ast.RangeStmt, env *object.Environment, label string) object.Object {
 	var rangeObj object.Object
 	line, column := parsePos(node.X.Pos())
 	switch xt := node.X.(type) {
@@ -517,12 +880,19 @@ func evalRangeStmt(node *ast.RangeStmt, env *object.Environment) object.Object {
 		if !ok {
 			return object.NewError("%d:%d undefined: %s", line, column, xt.Name)
 		}
-		rangeObj = obj.GetValue()
+		// 数组遍历的是副本，指向数组的指针不复制
+		rangeObj = object.Indexed(object.CopyValue(obj.GetValue()))
 		if !rangeObj.Type().IsRange() {
 			return object.NewError("%d:%d cannot range over %s (variable of type %s)", line, column, xt.Name, rangeObj.Type())
 		}
 	default:
-		return object.NewError("%d:%d cannot range over (variable of type %s)", line, column, xt)
+		rangeObj = object.Indexed(object.CopyValue(unwrapValue(eval(xt, env))))
+		if object.IsError(rangeObj) {
+			return rangeObj
+		}
+		if !rangeObj.Type().IsRange() {
+			return object.NewError("%d:%d cannot range over %s (value of type %s)", line, column, types.ExprString(xt), rangeObj.Type())
+		}
 	}
 
 	ranKey, _ := node.Key.(*ast.Ident)
@@ -535,7 +905,7 @@ func evalRangeStmt(node *ast.RangeStmt, env *object.Environment) object.Object {
 	case *object.Array:
 		for i := 0; i < len(ranObj.Elements); i++ {
 			ranEnv := object.NewEnclosedEnvironment(env)
-			if ranKey.Name != "_" {
+			if ranKey != nil && ranKey.Name != "_" {
 				ranKeyVal := &object.Int{Value: i}
 				ranEnv.SetWithDepth(ranKey.Name, ranKeyVal, 0)
 			}
@@ -549,12 +919,14 @@ func evalRangeStmt(node *ast.RangeStmt, env *object.Environment) object.Object {
 			}
 			if obj == object.BREAK {
 				break
+			} else if isReturn(obj) || isBranch(obj, label) {
+				return obj
 			}
 		}
 	case *object.Hash:
-		for _, pair := range ranObj.Pairs {
+		for _, pair := range ranObj.Entries() {
 			ranEnv := object.NewEnclosedEnvironment(env)
-			if ranKey.Name != "_" {
+			if ranKey != nil && ranKey.Name != "_" {
 				ranEnv.SetWithDepth(ranKey.Name, pair.Key, 0)
 			}
 			if ranVal != nil {
@@ -566,17 +938,20 @@ func evalRangeStmt(node *ast.RangeStmt, env *object.Environment) object.Object {
 			}
 			if obj == object.BREAK {
 				break
+			} else if isReturn(obj) || isBranch(obj, label) {
+				return obj
 			}
 		}
 	case *object.String:
-		for i := 0; i < len(ranObj.Value); i++ {
+		// 按 UTF-8 解码，键是每个字符首字节的下标
+		for i, r := range ranObj.Value {
 			ranEnv := object.NewEnclosedEnvironment(env)
-			if ranKey.Name != "_" {
+			if ranKey != nil && ranKey.Name != "_" {
 				ranKeyVal := &object.Int{Value: i}
 				ranEnv.SetWithDepth(ranKey.Name, ranKeyVal, 0)
 			}
 			if ranVal != nil {
-				ranValVal := &object.Int32{Value: int32(ranObj.Value[i])}
+				ranValVal := &object.Rune{Value: r}
 				ranEnv.SetWithDepth(ranVal.Name, ranValVal, 0)
 			}
 			obj := evalBlockStmt(node.Body, ranEnv)
@@ -585,6 +960,8 @@ func evalRangeStmt(node *ast.RangeStmt, env *object.Environment) object.Object {
 			}
 			if obj == object.BREAK {
 				break
+			} else if isReturn(obj) || isBranch(obj, label) {
+				return obj
 			}
 		}
 	}
@@ -619,56 +996,108 @@ func evalReturnStmt(node *ast.ReturnStmt, env *object.Environment) object.Object
 }
 
 func evalBlockStmt(node *ast.BlockStmt, env *object.Environment) object.Object {
-	for _, stmt := range node.List {
-		obj := eval(stmt, env)
-		if object.IsError(obj) {
+	for i := 0; i < len(node.List); i++ {
+		obj := eval(node.List[i], env)
+		if object.IsError(obj) || isReturn(obj) {
 			return obj
 		}
-		switch tmpRs := obj.(type) {
-		case *object.SingleReturn:
-			if !tmpRs.FromFun {
-				return tmpRs
-			}
-		case *object.MultiReturn:
-			if !tmpRs.FromFun {
-				return tmpRs
-			}
+		switch obj := obj.(type) {
 		case *object.Continue, *object.Break:
 			return obj
+		case *object.Branch:
+			j := labelIndex(node.List, obj)
+			if j < 0 {
+				return obj
+			}
+			i = j - 1
 		}
 	}
 	return nil
 }
 
+// evalLabeledStmt 指向该语句的 break 在这里结束，continue 由循环处理
+func evalLabeledStmt(node *ast.LabeledStmt, env *object.Environment) object.Object {
+	label := node.Label.Name
+	var rt object.Object
+	switch stmt := node.Stmt.(type) {
+	case *ast.ForStmt:
+		rt = evalForStmt(stmt, env, label)
+	case *ast.RangeStmt:
+		rt = evalRangeStmt(stmt, env, label)
+	default:
+		rt = eval(stmt, env)
+	}
+	if branch, ok := rt.(*object.Branch); ok && branch.Tok == token.BREAK && branch.Label == label {
+		return nil
+	}
+	return rt
+}
+
+// labelIndex goto 的标签在语句列表中的位置，不在这一层时返回 -1
+func labelIndex(stmts []ast.Stmt, branch *object.Branch) int {
+	if branch.Tok != token.GOTO {
+		return -1
+	}
+	for i, stmt := range stmts {
+		if labeled, ok := stmt.(*ast.LabeledStmt); ok && labeled.Label.Name == branch.Label {
+			return i
+		}
+	}
+	return -1
+}
+
+// isBranch 带标签的跳转，除了继续当前循环的 continue 都要跳出循环
+func isBranch(obj object.Object, label string) bool {
+	branch, ok := obj.(*object.Branch)
+	return ok && (branch.Tok != token.CONTINUE || branch.Label != label)
+}
+
+// isReturn 函数体内的 return，需要穿过外层的块和循环
+func isReturn(obj object.Object) bool {
+	switch rt := obj.(type) {
+	case *object.SingleReturn:
+		return !rt.FromFun
+	case *object.MultiReturn:
+		return !rt.FromFun
+	}
+	return false
+}
+
 func evalCallExpr(node *ast.CallExpr, env *object.Environment) object.Object {
-	args := evalExpressions(node.Args, env)
+	if idt, ok := node.Fun.(*ast.Ident); ok && (idt.Name == "make" || idt.Name == "new") {
+		if _, defined := env.Get(idt.Name); !defined && idt.Name == "make" {
+			return evalMake(node, env)
+		} else if !defined {
+			return evalNew(node, env)
+		}
+	}
+	var args []object.Object
+	if idt, ok := node.Fun.(*ast.Ident); ok && object.TypedBuiltin(idt.Name) && !isDefined(idt.Name, env) {
+		args = evalTypedArgs(idt.Name, node.Args, env)
+	} else if ok && idt.Name == "delete" && len(node.Args) == 2 && !isDefined(idt.Name, env) {
+		args = evalDeleteArgs(node.Args, env)
+	} else {
+		args = evalExpressions(node.Args, env)
+	}
 	if len(args) == 1 && object.IsError(args[0]) {
 		return args[0]
 	}
 
 	line, column := parsePos(node.Pos())
 	switch fnIdt := node.Fun.(type) {
-	case *ast.Ident:
-		fn := evalIdentifier(fnIdt, env)
-		if object.IsError(fn) {
-			return fn
+	case *ast.ArrayType:
+		// []byte(s) 和 []rune(s)
+		elem := object.GetDefaultValueWithExpr(fnIdt.Elt, env)
+		if object.IsError(elem) {
+			return elem
 		}
-
-		switch function := fn.(type) {
-		case *object.Function:
-			extendEnv, err := extendFunctionEnv(function, args)
-			if err != nil {
-				return object.NewError("%d:%d %s to %s", line, column, err.Message, fnIdt.Name)
-			}
-			evaluated := eval(function.Body, extendEnv)
-			return unwrapFuncReturn(evaluated, function)
-		case *object.Builtin:
-			if result := function.Fn(args...); result != nil {
-				return result
-			}
-			return nil
-		default:
-			return object.NewError("%d:%d not a function %s", line, column, fn.Type())
+		if fnIdt.Len != nil || len(args) != 1 {
+			return object.NewError("%d:%d cannot convert to %s", line, column, types.ExprString(fnIdt))
+		}
+		if result := object.ConvertToSlice(elem.Type(), unwrapValue(args[0])); object.IsError(result) {
+			return object.NewError("%d:%d %s", line, column, result)
+		} else {
+			return result
 		}
 	case *ast.FuncLit:
 		tmpFun := eval(fnIdt, env)
@@ -676,67 +1105,367 @@ func evalCallExpr(node *ast.CallExpr, env *object.Environment) object.Object {
 		if !ok {
 			return object.NewError("%d:%d function literal error", line, column)
 		}
-		extendEnv, err := extendFunctionEnv(function, args)
+		if err := convertConstArgs(node, function, args, env); err != nil {
+			return err
+		}
+		extendEnv, err := extendFunctionEnv(function, args, node.Ellipsis.IsValid())
 		if err != nil {
 			return object.NewError("%d:%d %s", line, column, err.Message)
 		}
-		evaluated := eval(function.Body, extendEnv)
-		return unwrapFuncReturn(evaluated, function)
+		return callFunction(function, extendEnv)
 	default:
-		return nil
-	}
-}
-
-func evalExpressions(exprs []ast.Expr, env *object.Environment) []object.Object {
-	var result []object.Object
-	for _, expr := range exprs {
-		evaluated := eval(expr, env)
-		if object.IsError(evaluated) {
-			return []object.Object{evaluated}
+		// 函数值可以来自任意表达式：变量、字段、map 和切片元素、函数调用的结果
+		fn := eval(fnIdt, env)
+		if object.IsError(fn) {
+			return fn
 		}
-		switch evaluated.Type() {
-		case object.SINGLE_RETURN_OBJ:
-			result = append(result, evaluated.(*object.SingleReturn).Value)
-		case object.MULTI_RETURN_OBJ:
-			multi := evaluated.(*object.MultiReturn)
-			for _, value := range multi.Values {
-				result = append(result, value)
+		if nt, ok := fn.(*object.NamedType); ok {
+			if len(args) != 1 {
+				return object.NewError("%d:%d wrong argument count in conversion to %s", line, column, nt)
 			}
-		case object.MAP_EXIST_OBJ:
-			result = append(result, evaluated.(*object.MapExist).Value)
-		default:
-			result = append(result, evaluated)
+			zero := nt.Zero(env)
+			if object.IsError(zero) {
+				return object.NewError("%d:%d %s", line, column, zero)
+			}
+			return object.ConvertValueWithType(unwrapValue(args[0]), zero)
 		}
+		return applyFunction(node, fn, args, env)
 	}
-	return result
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, *object.Error) {
-	env := object.NewEnclosedEnvironment(fn.Env)
+func applyFunction(node *ast.CallExpr, fn object.Object, args []object.Object, env *object.Environment) object.Object {
+	line, column := parsePos(node.Pos())
+	switch function := fn.(type) {
+	case *object.Function:
+		if function.TypeParams != nil {
+			typeArgs, err := object.InferTypeArgs(types.ExprString(node.Fun), function, args, node.Ellipsis.IsValid(), function.Env)
+			if err != nil {
+				return object.NewError("%d:%d %s", line, column, err)
+			}
+			instance := *function
+			instance.TypeArgs = typeArgs
+			function = &instance
+		}
+		if node.Ellipsis.IsValid() && !function.Variadic {
+			return object.NewError("%d:%d cannot use ... in call to non-variadic %s", line, column, types.ExprString(node.Fun))
+		}
+		if err := convertConstArgs(node, function, args, env); err != nil {
+			return err
+		}
+		extendEnv, err := extendFunctionEnv(function, args, node.Ellipsis.IsValid())
+		if err != nil {
+			return object.NewError("%d:%d %s to %s", line, column, err.Message, types.ExprString(node.Fun))
+		}
+		return callFunction(function, extendEnv)
+	case *object.BoundMethod:
+		return applyFunction(node, function.Fn, append([]object.Object{function.Recv}, args...), env)
+	case *object.MapExist:
+		return applyFunction(node, function.Value, args, env)
+	case *object.SingleReturn:
+		return applyFunction(node, function.Value, args, env)
+	case *object.Null:
+		return object.NewError("%d:%d invalid memory address or nil pointer dereference", line, column)
+	case *object.Builtin:
+		if function == recoverBuiltin {
+			return recoverPanic()
+		}
+		if node.Ellipsis.IsValid() {
+			array, ok := args[len(args)-1].(*object.Array)
+			if !ok {
+				return object.NewError("%d:%d cannot use ... with non-slice argument", line, column)
+			}
+			args = append(args[:len(args)-1:len(args)-1], array.Elements...)
+		}
+		if result := object.ApplyBuiltin(function, args); result != nil {
+			return result
+		}
+		return nil
+	default:
+		return object.NewError("%d:%d not a function %s", line, column, fn.Type())
+	}
+}
+
+// convertConstArgs 常量实参按形参的类型求值，args 比 node.Args 多出的是方法的接收者
+func convertConstArgs(node *ast.CallExpr, fn *object.Function, args []object.Object, env *object.Environment) object.Object {
+	fnEnv := newFunctionEnv(fn)
+	offset := len(args) - len(node.Args)
+	for i, expr := range node.Args {
+		j := i + offset
+		if j >= len(fn.Params) || fn.Variadic && j == len(fn.Params)-1 {
+			break
+		}
+		typ := object.GetDefaultValueFromElem(fn.Params[j].Type, fnEnv)
+		if !object.IsConstType(object.Unnamed(typ).Type()) {
+			continue
+		}
+		obj := evalConstExpr(expr, typ, "argument to "+types.ExprString(node.Fun), env)
+		if object.IsError(obj) {
+			return obj
+		} else if obj != nil {
+			args[j] = obj
+		}
+	}
+	return nil
+}
+
+// callFunction 执行函数体，返回前按后进先出执行 defer
+func callFunction(function *object.Function, env *object.Environment) object.Object {
+	callDepth++
+	evaluated := eval(function.Body, env)
+	callDepth--
+	evaluated = storeResults(evaluated, function, env)
+	evaluated = runDefers(env, evaluated)
+	return unwrapFuncReturn(evaluated, function, env)
+}
+
+// storeResults 有具名返回值时先把返回的值写入返回值变量，defer 中可以读取和修改，
+// 之后按不带值的 return 从变量读取
+func storeResults(rt object.Object, fn *object.Function, env *object.Environment) object.Object {
+	if len(fn.Results) == 0 {
+		return rt
+	}
+	for _, re := range fn.Results {
+		if re.Symbol == nil || re.Symbol.Name == "_" {
+			return rt
+		}
+	}
+	var values []object.Object
+	switch rt := rt.(type) {
+	case *object.SingleReturn:
+		if multi, ok := rt.Value.(*object.MultiReturn); ok {
+			values = multi.Values
+		} else if rt.Value != nil {
+			values = []object.Object{rt.Value}
+		}
+	case *object.MultiReturn:
+		values = rt.Values
+	}
+	if values == nil {
+		return rt
+	}
+	if len(values) != len(fn.Results) {
+		return object.NewError("wrong number of return values (have %d, want %d)", len(values), len(fn.Results))
+	}
+	for i, re := range fn.Results {
+		value := object.CopyValue(unwrapValue(values[i]))
+		defObj := object.GetDefaultValueFromElem(re.Type, env)
+		if defObj.Type() == object.INTERFACE_OBJ {
+			value = object.ConvertValueWithType(value, defObj)
+			if object.IsError(value) {
+				return value
+			}
+		}
+		if ref, ok := env.Addr(re.Symbol.Name); ok {
+			*ref = value
+		}
+	}
+	return &object.SingleReturn{}
+}
+
+// evalDeferStmt 函数和参数立即求值，调用推迟到函数返回
+func evalDeferStmt(node *ast.DeferStmt, env *object.Environment) object.Object {
+	fn := eval(node.Call.Fun, env)
+	if object.IsError(fn) {
+		return fn
+	}
+	args := evalExpressions(node.Call.Args, env)
+	if len(args) == 1 && object.IsError(args[0]) {
+		return args[0]
+	}
+	env.Defer(func() object.Object {
+		return applyFunction(node.Call, fn, args, env)
+	})
+	return nil
+}
+
+// runDefers rt 为错误时按 panic 处理，被 recover 后函数正常返回
+func runDefers(env *object.Environment, rt object.Object) object.Object {
+	for deferred := env.PopDefer(); deferred != nil; deferred = env.PopDefer() {
+		p, _ := rt.(*object.Error)
+		saved, savedDepth := panicking, deferDepth
+		panicking, deferDepth = p, callDepth+1
+		result := deferred()
+		if p != nil && panicking == nil {
+			rt = &object.SingleReturn{}
+		}
+		panicking, deferDepth = saved, savedDepth
+		if object.IsError(result) {
+			rt = result
+		}
+	}
+	return rt
+}
+
+func recoverPanic() object.Object {
+	if panicking == nil || callDepth != deferDepth {
+		return object.NULL
+	}
+	value := object.PanicValue(panicking)
+	if panicking.Value == nil {
+		// 运行时错误和 vm 一样不带位置
+		value = &object.String{Value: errorText(panicking.Message)}
+	}
+	panicking = nil
+	return value
+}
+
+// errorText 去掉错误信息前的位置 line:column
+func errorText(msg string) string {
+	pos, text, ok := strings.Cut(msg, " ")
+	if !ok {
+		return msg
+	}
+	line, column, ok := strings.Cut(strings.TrimSuffix(pos, ":"), ":")
+	if !ok {
+		return msg
+	}
+	if _, err := strconv.Atoi(line); err != nil {
+		return msg
+	}
+	if _, err := strconv.Atoi(column); err != nil {
+		return msg
+	}
+	return text
+}
+
+func evalExpressions(exprs []ast.Expr, env *object.Environment) []object.Object {
+	var result []object.Object
+	for _, expr := range exprs {
+		evaluated := eval(expr, env)
+		if object.IsError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		switch evaluated.Type() {
+		case object.SINGLE_RETURN_OBJ:
+			result = append(result, evaluated.(*object.SingleReturn).Value)
+		case object.MULTI_RETURN_OBJ:
+			multi := evaluated.(*object.MultiReturn)
+			for _, value := range multi.Values {
+				result = append(result, value)
+			}
+		case object.MAP_EXIST_OBJ:
+			result = append(result, evaluated.(*object.MapExist).Value)
+		default:
+			result = append(result, evaluated)
+		}
+	}
+	return result
+}
+
+func isDefined(name string, env *object.Environment) bool {
+	_, ok := env.Get(name)
+	return ok
+}
+
+// evalTypedArgs min、max、complex、real 和 imag 的常量参数转换为其他参数的类型
+func evalTypedArgs(name string, exprs []ast.Expr, env *object.Environment) []object.Object {
+	var typ object.Object
+	for _, expr := range exprs {
+		if typ = operandType(expr, env); typ != nil {
+			break
+		}
+	}
+	if typ == nil {
+		typ = object.BuiltinArgType(name, exprs, env)
+	}
+	var result []object.Object
+	for _, expr := range exprs {
+		var evaluated object.Object
+		if object.ConstOperand(expr, env) {
+			evaluated = evalConstExpr(expr, typ, "argument to "+name, env)
+		}
+		if evaluated == nil {
+			evaluated = eval(expr, env)
+		}
+		evaluated = unwrapValue(evaluated)
+		if object.IsError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+	return result
+}
+
+// evalDeleteArgs delete 的常量键转换为 map 的键类型
+func evalDeleteArgs(exprs []ast.Expr, env *object.Environment) []object.Object {
+	m := unwrapValue(eval(exprs[0], env))
+	if object.IsError(m) {
+		return []object.Object{m}
+	}
+	var key object.Object
+	if hash, ok := object.Unnamed(m).(*object.Hash); ok {
+		if typ := object.GetDefaultObject(hash.KeyType.String()); object.IsConstType(typ.Type()) {
+			key = evalConstExpr(exprs[1], typ, "argument to delete", env)
+		}
+	}
+	if key == nil {
+		key = eval(exprs[1], env)
+	}
+	key = unwrapValue(key)
+	if object.IsError(key) {
+		return []object.Object{key}
+	}
+	return []object.Object{m, key}
+}
+
+// newFunctionEnv 函数的环境，类型参数绑定到推断出的类型实参
+func newFunctionEnv(fn *object.Function) *object.Environment {
+	env := object.NewFunctionEnvironment(fn.Env)
+	for i, name := range object.TypeParamNames(fn.TypeParams) {
+		env.Define(name, &object.TypeArg{Name: name, Zero: fn.TypeArgs[i]})
+	}
+	return env
+}
+
+func extendFunctionEnv(fn *object.Function, args []object.Object, spread bool) (*object.Environment, *object.Error) {
+	env := newFunctionEnv(fn)
+	if n := len(fn.Params) - 1; fn.Variadic && !spread && len(args) >= n {
+		// 多出的参数打包为切片，作为最后一个参数
+		slice := object.GetDefaultValueFromElem(fn.Params[n].Type, env).(*object.Array)
+		elems := make([]object.Object, len(args)-n)
+		for i, arg := range args[n:] {
+			elems[i] = object.CopyValue(unwrapValue(arg))
+		}
+		args = append(args[:n:n], &object.Array{ElemType: slice.ElemType, Elements: elems})
+	}
 	if len(fn.Params) > len(args) {
 		return env, object.NewError("not enough arguments in call")
 	} else if len(fn.Params) < len(args) {
 		return env, object.NewError("too many arguments in call")
 	}
 	for i, funArg := range fn.Params {
-		defObj := object.GetDefaultValueFromElem(funArg.Type)
-		if args[i].Type() != defObj.Type() {
+		defObj := object.GetDefaultValueFromElem(funArg.Type, env)
+		if defObj.Type() == object.INTERFACE_OBJ {
+			args[i] = object.ConvertValueWithType(args[i], defObj)
+			if object.IsError(args[i]) {
+				return env, args[i].(*object.Error)
+			}
+		}
+		isPointer := funArg.Type.TypeElem == object.ElemPointer && (args[i].Type() == object.POINTER_OBJ || args[i] == object.NULL)
+		if !isPointer && args[i].Type() != defObj.Type() {
 			return env, object.NewError("cannot use '%s' (untyped %s constant) as %s value in argument", args[i], args[i].Type(), defObj.Type())
 		}
-		env.Set(funArg.Symbol.Name, args[i])
+		if funArg.Symbol == nil || funArg.Symbol.Name == "_" {
+			continue
+		}
+		if funArg.Type.TypeElem == object.ElemPointer {
+			env.Define(funArg.Symbol.Name, args[i])
+		} else {
+			env.Define(funArg.Symbol.Name, object.CopyValue(args[i]))
+		}
 	}
 
 	for _, funResult := range fn.Results {
 		if funResult.Symbol != nil {
-			defObj := object.GetDefaultValueFromElem(funResult.Type)
-			env.Set(funResult.Symbol.Name, defObj)
+			defObj := object.GetDefaultValueFromElem(funResult.Type, env)
+			env.Define(funResult.Symbol.Name, defObj)
 		}
 	}
 
 	return env, nil
 }
 
-func unwrapFuncReturn(rt object.Object, fn *object.Function) object.Object {
+func unwrapFuncReturn(rt object.Object, fn *object.Function, env *object.Environment) object.Object {
 	if object.IsError(rt) {
 		return rt
 	}
@@ -752,7 +1481,11 @@ func unwrapFuncReturn(rt object.Object, fn *object.Function) object.Object {
 		} else if len(fn.Results) > 0 {
 			var objs []object.Object
 			for _, re := range fn.Results {
-				obj, _ := fn.Env.Get(re.Symbol.Name)
+				if re.Symbol == nil {
+					objs = append(objs, object.GetDefaultValueFromElem(re.Type, env))
+					continue
+				}
+				obj, _ := env.Get(re.Symbol.Name)
 				objs = append(objs, obj.Value)
 			}
 			if len(fn.Results) == 1 {
@@ -760,6 +1493,8 @@ func unwrapFuncReturn(rt object.Object, fn *object.Function) object.Object {
 			} else {
 				return &object.MultiReturn{Values: objs, FromFun: true}
 			}
+		} else {
+			return nil
 		}
 	}
 	return rt
@@ -769,34 +1504,233 @@ func evalFuncLit(node *ast.FuncLit, env *object.Environment) object.Object {
 	return program.ParseFuncLit(node, env)
 }
 
+func evalSelectorExpr(node *ast.SelectorExpr, env *object.Environment) object.Object {
+	line, column := parsePos(node.Sel.Pos())
+	if recv, typ, ok := methodExprRecv(node.X, env); ok {
+		fn, err := program.MethodExprFunc(recv, typ, node.Sel.Name)
+		if err != nil {
+			return object.NewError("%d:%d %s", line, column, err)
+		}
+		if star, ok := recv.(*ast.StarExpr); ok && !fn.PointerRecv() {
+			return program.ParseFuncLit(program.MethodExprLit(node, star.X, fn), env)
+		}
+		return fn
+	}
+	obj := unwrapValue(eval(node.X, env))
+	if object.IsError(obj) {
+		return obj
+	}
+
+	if iface, ok := obj.(*object.Interface); ok {
+		if _, ok := iface.InterfaceType.Methods[node.Sel.Name]; !ok {
+			return object.NewError("%d:%d %s undefined (type %s has no field or method %s)", line, column, types.ExprString(node), iface.InterfaceType, node.Sel.Name)
+		}
+		obj = iface.Unwrap()
+	}
+	x := obj
+	if p, ok := obj.(*object.Pointer); ok && !p.IsNil() {
+		obj = p.Load()
+	}
+	if named, ok := obj.(*object.Named); ok {
+		return namedMethod(node, x, named, env)
+	}
+	switch x := obj.(type) {
+	case *object.Null, *object.Pointer:
+		return object.NewError("%d:%d invalid memory address or nil pointer dereference", line, column)
+	case *object.Struct:
+		if value, ok := x.Get(node.Sel.Name); ok {
+			return value
+		}
+		recv, fn := x.Method(node.Sel.Name)
+		if fn == nil {
+			return object.NewError("%d:%d %s undefined (type %s has no field or method %s)", line, column, types.ExprString(node), x.StructType, node.Sel.Name)
+		}
+		if fn.PointerRecv() {
+			return &object.BoundMethod{Recv: recv, Fn: fn}
+		}
+		return &object.BoundMethod{Recv: recv.Copy(), Fn: fn}
+	case *object.StructType:
+		fn, ok := x.Methods[node.Sel.Name]
+		if !ok {
+			return object.NewError("%d:%d %s undefined (type %s has no method %s)", line, column, types.ExprString(node), x, node.Sel.Name)
+		}
+		return fn
+	default:
+		return object.NewError("%d:%d %s undefined (type %s has no field or method %s)", line, column, types.ExprString(node), obj.Type(), node.Sel.Name)
+	}
+}
+
+// methodExprRecv 方法表达式 T.M 或 (*T).M 中的接收者类型，recv 为 T 或 *T
+func methodExprRecv(x ast.Expr, env *object.Environment) (ast.Expr, object.Object, bool) {
+	recv := x
+	for {
+		paren, ok := recv.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		recv = paren.X
+	}
+	ident, ok := recv.(*ast.Ident)
+	if star, isStar := recv.(*ast.StarExpr); isStar {
+		ident, ok = star.X.(*ast.Ident)
+	}
+	if !ok {
+		return nil, nil, false
+	}
+	typ, ok := env.ResolveType(ident.Name)
+	return recv, typ, ok
+}
+
+// namedMethod 命名类型的方法，指针接收者不是通过指针调用时取 x 的地址
+func namedMethod(node *ast.SelectorExpr, x object.Object, named *object.Named, env *object.Environment) object.Object {
+	line, column := parsePos(node.Sel.Pos())
+	fn := named.NamedType.Methods[node.Sel.Name]
+	if fn == nil {
+		return object.NewError("%d:%d %s undefined (type %s has no field or method %s)", line, column, types.ExprString(node), named.NamedType, node.Sel.Name)
+	}
+	if !fn.PointerRecv() {
+		return &object.BoundMethod{Recv: object.CopyValue(named), Fn: fn}
+	}
+	if _, ok := x.(*object.Pointer); !ok {
+		x = evalAddrExpr(&ast.UnaryExpr{OpPos: node.X.Pos(), Op: token.AND, X: node.X}, env)
+		if object.IsError(x) {
+			return x
+		}
+	}
+	return &object.BoundMethod{Recv: x, Fn: fn}
+}
+
+func evalFieldOwner(node *ast.SelectorExpr, env *object.Environment) object.Object {
+	obj := object.Underlying(unwrapValue(eval(node.X, env)))
+	if object.IsError(obj) {
+		return obj
+	}
+	line, column := parsePos(node.Sel.Pos())
+	if object.IsNil(obj) {
+		return object.NewError("%d:%d invalid memory address or nil pointer dereference", line, column)
+	}
+	if p, ok := obj.(*object.Pointer); ok {
+		obj = p.Load()
+	}
+	st, ok := obj.(*object.Struct)
+	if !ok {
+		return object.NewError("%d:%d %s undefined (type %s has no field or method %s)", line, column, types.ExprString(node), obj.Type(), node.Sel.Name)
+	}
+	if _, ok := st.Get(node.Sel.Name); !ok {
+		return object.NewError("%d:%d %s undefined (type %s has no field or method %s)", line, column, types.ExprString(node), st.StructType, node.Sel.Name)
+	}
+	return st
+}
+
+func evalTypeAssertExpr(node *ast.TypeAssertExpr, env *object.Environment, commaOk bool) object.Object {
+	line, column := parsePos(node.Pos())
+	if node.Type == nil {
+		return object.NewError("%d:%d use of .(type) outside type switch", line, column)
+	}
+	typ := object.TypeOf(node.Type, env)
+	if object.IsError(typ) {
+		return object.NewError("%d:%d %s", line, column, typ)
+	}
+	x := unwrapValue(eval(node.X, env))
+	if object.IsError(x) {
+		return x
+	}
+
+	value, ok := object.AssertType(x, typ)
+	if iface, isIface := typ.(*object.Interface); isIface && ok {
+		value = &object.Interface{InterfaceType: iface.InterfaceType, Value: value}
+	}
+	if commaOk {
+		return &object.MapExist{Value: value, Exist: ok}
+	}
+	if !ok {
+		return object.NewError("%d:%d %s", line, column, object.AssertError(x, typ))
+	}
+	return value
+}
+
+// evalRhs 单个类型断言赋值给两个变量时使用 comma-ok 形式
+func evalRhs(expr ast.Expr, env *object.Environment, commaOk bool) object.Object {
+	if ta, ok := expr.(*ast.TypeAssertExpr); ok && commaOk {
+		return evalTypeAssertExpr(ta, env, true)
+	}
+	return eval(expr, env)
+}
+
 func evalIndexExpr(node *ast.IndexExpr, env *object.Environment) object.Object {
 	idt := eval(node.X, env)
 	if object.IsError(idt) {
 		return idt
 	}
-	idx := eval(node.Index, env)
+	if fn, ok := idt.(*object.Function); ok && fn.TypeParams != nil {
+		return evalInstantiate(node, env)
+	}
+	idx := evalIndex(node.Index, idt, env)
 	if object.IsError(idx) {
 		return idx
 	}
 	return doIndex(idt, idx)
 }
 
+// evalIndex map 的下标是常量时转换为键的类型
+func evalIndex(expr ast.Expr, source object.Object, env *object.Environment) object.Object {
+	if hash, ok := object.Unnamed(source).(*object.Hash); ok {
+		if typ := object.GetDefaultObject(hash.KeyType.String()); object.IsConstType(typ.Type()) {
+			if obj := evalConstExpr(expr, typ, "map index", env); obj != nil {
+				return obj
+			}
+		}
+	}
+	return eval(expr, env)
+}
+
+// evalInstantiate 显式给出类型实参的泛型函数，其余的类型实参在调用时推断
+func evalInstantiate(node ast.Expr, env *object.Environment) object.Object {
+	x, indices := object.TypeIndices(node)
+	fn, ok := eval(x, env).(*object.Function)
+	line, column := parsePos(node.Pos())
+	if !ok || fn.TypeParams == nil {
+		return object.NewError("%d:%d %s is not a generic function", line, column, types.ExprString(x))
+	}
+	typeArgs, err := object.TypeArgsOf(indices, env)
+	if err != nil {
+		return object.NewError("%d:%d %s", line, column, err)
+	}
+	names := object.TypeParamNames(fn.TypeParams)
+	if len(typeArgs) > len(names) {
+		return object.NewError("%d:%d got %d type arguments but %s has %d type parameters", line, column, len(typeArgs), x, len(names))
+	}
+	instance := *fn
+	instance.TypeArgs = typeArgs
+	return &instance
+}
+
 func doIndex(source object.Object, index object.Object) object.Object {
+	source = object.Indexed(source)
 	switch source.Type() {
 	case object.ARRAY_OBJ:
 		array := source.(*object.Array)
-		i := index.(object.Integer).Integer()
+		i := object.Unnamed(index).(object.Integer).Integer()
+		if i < 0 || int(i) >= len(array.Elements) {
+			return object.NewError("index out of range [%d] with length %d", i, len(array.Elements))
+		}
 		return array.Elements[i]
 	case object.HASH_OBJ:
 		m := source.(*object.Hash)
-		pair, ok := m.Pairs[index.(object.Hashable).HashKey()]
+		if _, err := object.HashOf(index); err != nil {
+			return err
+		}
+		pair, ok := m.Get(index)
 		if !ok {
-			pair.Value = object.GetDefaultObject(m.ValueType.String())
+			pair.Value = m.Zero()
 		}
 		return &object.MapExist{Value: pair.Value, Exist: ok}
 	case object.STRING_OBJ:
 		ss := source.(*object.String)
-		i := index.(object.Integer).Integer()
+		i := object.Unnamed(index).(object.Integer).Integer()
+		if i < 0 || int(i) >= len(ss.Value) {
+			return object.NewError("index out of range [%d] with length %d", i, len(ss.Value))
+		}
 		return &object.Uint8{Value: ss.Value[i]}
 	case object.MAP_EXIST_OBJ:
 		tmp := source.(*object.MapExist).Value
@@ -806,79 +1740,174 @@ func doIndex(source object.Object, index object.Object) object.Object {
 	}
 }
 
+func evalSliceExpr(node *ast.SliceExpr, env *object.Environment) object.Object {
+	x := unwrapValue(eval(node.X, env))
+	if object.IsError(x) {
+		return x
+	}
+	var indexes [3]object.Object
+	for i, expr := range []ast.Expr{node.Low, node.High, node.Max} {
+		if expr == nil {
+			continue
+		}
+		index := unwrapValue(eval(expr, env))
+		if object.IsError(index) {
+			return index
+		}
+		indexes[i] = index
+	}
+	rt := object.Slice(x, indexes[0], indexes[1], indexes[2])
+	if object.IsError(rt) {
+		line, column := parsePos(node.Pos())
+		return object.NewError("%d:%d %s", line, column, rt)
+	}
+	return rt
+}
+
+// evalMake 目前只支持 make([]T, len, cap)
+func evalMake(node *ast.CallExpr, env *object.Environment) object.Object {
+	line, column := parsePos(node.Pos())
+	ty, ok := node.Args[0].(*ast.ArrayType)
+	if !ok || ty.Len != nil {
+		return object.NewError("%d:%d make not support %s", line, column, types.ExprString(node.Args[0]))
+	}
+	if len(node.Args) < 2 || len(node.Args) > 3 {
+		return object.NewError("%d:%d invalid operation: make %s expects 2 or 3 arguments", line, column, types.ExprString(ty))
+	}
+	args := evalExpressions(node.Args[1:], env)
+	if len(args) == 1 && object.IsError(args[0]) {
+		return args[0]
+	}
+	sizes := make([]int, len(args))
+	for i, arg := range args {
+		size, ok := arg.(object.Integer)
+		if !ok {
+			return object.NewError("%d:%d cannot convert %s (untyped %s constant) to type int", line, column, arg, arg.Type())
+		}
+		sizes[i] = int(size.Integer())
+	}
+	if len(sizes) == 1 {
+		sizes = append(sizes, sizes[0])
+	}
+	rt := object.MakeSlice(object.GetDefaultValueWithExpr(ty.Elt, env), sizes[0], sizes[1])
+	if object.IsError(rt) {
+		return object.NewError("%d:%d %s", line, column, rt)
+	}
+	return rt
+}
+
 func evalCompositeLit(node *ast.CompositeLit, env *object.Environment) object.Object {
 	if node.Type != nil {
 		switch nodeType := node.Type.(type) {
 		case *ast.ArrayType:
-			var elems []object.Object
-			defObj := object.GetDefaultValueWithExpr(nodeType.Elt)
+			elems := make([]object.Object, 0, len(node.Elts))
+			defObj := object.GetDefaultValueWithExpr(nodeType.Elt, env)
 			for _, elt := range node.Elts {
-				obj := eval(elt, env)
-				obj = object.ConvertValueWithType(obj, defObj)
+				obj := evalElement(elt, nodeType.Elt, env)
+				if object.IsError(obj) {
+					return obj
+				}
+				obj = object.CopyValue(object.ConvertValueWithType(obj, defObj))
 				if object.IsError(obj) {
 					line, column := parsePos(elt.Pos())
 					return object.NewError("%d:%d cannot use (untyped '%s' constant) as %s value in array or slice literal", line, column, obj, defObj.Type())
 				}
 				elems = append(elems, obj)
 			}
-			var array object.Array
 			if nodeType.Len == nil {
-				array = object.NewArray(defObj.Type(), elems, false, -1)
-			} else {
-				ll := eval(nodeType.Len, env)
-				if int(ll.(object.Integer).Integer()) != len(elems) {
-					line, column := parsePos(node.Pos())
-					return object.NewError("%d:%d out of bounds", line, column)
+				array := object.NewArray(defObj.Type(), elems, false, -1)
+				return &array
+			}
+			// 定长数组未给出的元素补零值，[...]T 的长度为元素个数
+			n := len(elems)
+			if _, ok := nodeType.Len.(*ast.Ellipsis); !ok {
+				var err error
+				n, err = object.ArrayLen(nodeType.Len, env)
+				if err != nil {
+					line, column := parsePos(nodeType.Len.Pos())
+					return object.NewError("%d:%d %s", line, column, err)
 				}
-				array = object.NewArray(defObj.Type(), elems, true, len(elems))
 			}
-			return &array
-		case *ast.MapType:
-			mm := &object.Hash{
-				Pairs: make(map[object.HashKey]object.HashPair),
+			if len(elems) > n {
+				line, column := parsePos(node.Elts[n].Pos())
+				return object.NewError("%d:%d array index %d out of bounds [0:%d]", line, column, n, n)
 			}
-			defKObj := object.GetDefaultValueWithExpr(nodeType.Key)
-			defVObj := object.GetDefaultValueWithExpr(nodeType.Value)
-			if _, ok := defKObj.(object.Hashable); !ok {
+			array := object.ArrayOf(defObj, n)
+			copy(array.Elements, elems)
+			return array
+		case *ast.MapType:
+			defKObj := object.GetDefaultValueWithExpr(nodeType.Key, env)
+			defVObj := object.GetDefaultValueWithExpr(nodeType.Value, env)
+			if !object.IsKeyType(defKObj) {
 				line, column := parsePos(node.Pos())
 				return object.NewError("%d:%d key not a Hashable type", line, column)
 			}
 
-			mm.KeyType = defKObj.Type()
-			mm.ValueType = defVObj.Type()
+			mm := object.NewHash(defKObj.Type(), defVObj.Type())
 			for _, elt := range node.Elts {
 				line, column := parsePos(node.Pos())
 				eltNode, ok := elt.(*ast.KeyValueExpr)
 				if !ok {
 					return object.NewError("%d:%d not a ast.KeyValueExpr", line, column)
 				}
-				keyVal := eval(eltNode.Key, env)
+				keyVal := evalElement(eltNode.Key, nodeType.Key, env)
 				keyVal = object.ConvertValueWithType(keyVal, defKObj)
 				if object.IsError(keyVal) {
 					return keyVal
 				}
-				valVal := eval(eltNode.Value, env)
+				valVal := evalElement(eltNode.Value, nodeType.Value, env)
 				valVal = object.ConvertValueWithType(valVal, defVObj)
 				if object.IsError(valVal) {
 					return valVal
 				}
+				valVal = object.CopyValue(valVal)
 
-				pair := object.HashPair{Key: keyVal, Value: valVal}
-				mm.Pairs[keyVal.(object.Hashable).HashKey()] = pair
+				if err := mm.Set(keyVal, valVal); err != nil {
+					return object.NewError("%d:%d %s", line, column, err)
+				}
 			}
 			return mm
+		case *ast.Ident:
+			line, column := parsePos(nodeType.Pos())
+			typ, ok := env.ResolveType(nodeType.Name)
+			if !ok {
+				return object.NewError("%d:%d undefined: %s", line, column, nodeType.Name)
+			}
+			if nt, ok := typ.(*object.NamedType); ok {
+				// 按底层类型求值
+				lit := evalCompositeLit(&ast.CompositeLit{Type: nt.Underlying, Lbrace: node.Lbrace, Elts: node.Elts, Rbrace: node.Rbrace}, env)
+				if object.IsError(lit) {
+					return lit
+				}
+				return nt.Wrap(lit)
+			}
+			st, ok := typ.(*object.StructType)
+			if !ok {
+				return object.NewError("%d:%d invalid composite literal type %s", line, column, nodeType.Name)
+			}
+			return evalStructLit(node, st, env)
+		case *ast.StructType:
+			return evalStructLit(node, object.NewStructType("", nodeType), env)
+		case *ast.IndexExpr, *ast.IndexListExpr:
+			st, err := object.InstantiateExpr(nodeType, env)
+			if err != nil {
+				line, column := parsePos(nodeType.Pos())
+				return object.NewError("%d:%d %s", line, column, err)
+			}
+			return evalStructLit(node, st, env)
 		}
 	} else if node.Elts != nil {
 		eltt := node.Elts[0]
 		switch eltt.(type) {
 		case *ast.KeyValueExpr:
-			hash := &object.Hash{}
-			hash.Pairs = make(map[object.HashKey]object.HashPair)
+			hash := object.NewHash(0, 0)
 			for _, elt := range node.Elts {
 				eltKV := elt.(*ast.KeyValueExpr)
 				k := eval(eltKV.Key, env)
 				v := eval(eltKV.Value, env)
-				hash.Pairs[k.(object.Hashable).HashKey()] = object.HashPair{Key: k, Value: v}
+				if err := hash.Set(k, v); err != nil {
+					return err
+				}
 			}
 			return hash
 		default:
@@ -893,13 +1922,66 @@ func evalCompositeLit(node *ast.CompositeLit, env *object.Environment) object.Ob
 	return nil
 }
 
+func evalStructLit(node *ast.CompositeLit, st *object.StructType, env *object.Environment) object.Object {
+	zero := st.Zero(env)
+	if object.IsError(zero) {
+		line, column := parsePos(node.Pos())
+		return object.NewError("%d:%d %s", line, column, zero)
+	}
+
+	obj := zero.(*object.Struct)
+	for i, elt := range node.Elts {
+		line, column := parsePos(elt.Pos())
+		idx, value := i, elt
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			key, _ := kv.Key.(*ast.Ident)
+			if key == nil || st.FieldIndex(key.Name) < 0 {
+				return object.NewError("%d:%d unknown field %s in struct literal of type %s", line, column, kv.Key, st)
+			}
+			idx, value = st.FieldIndex(key.Name), kv.Value
+		} else if i >= len(st.Fields) {
+			return object.NewError("%d:%d too many values in struct literal of type %s", line, column, st)
+		}
+
+		fieldVal := evalElement(value, st.Fields[idx].Type, env)
+		if object.IsError(fieldVal) {
+			return fieldVal
+		}
+		fieldVal = object.ConvertValueWithType(fieldVal, obj.Fields[idx])
+		if object.IsError(fieldVal) {
+			return object.NewError("%d:%d %s", line, column, fieldVal)
+		}
+		obj.Fields[idx] = object.CopyValue(fieldVal)
+	}
+	return obj
+}
+
+// 省略类型的复合字面量使用元素类型
+func evalElement(expr ast.Expr, typ ast.Expr, env *object.Environment) object.Object {
+	if lit, ok := expr.(*ast.CompositeLit); ok && lit.Type == nil {
+		elided := *lit
+		elided.Type = typ
+		return evalCompositeLit(&elided, env)
+	}
+	return unwrapValue(eval(expr, env))
+}
+
 func evalIdentifier(node *ast.Ident, env *object.Environment) object.Object {
 	if node.Name == "true" {
 		return object.TRUE
 	} else if node.Name == "false" {
 		return object.FALSE
+	} else if node.Name == "nil" {
+		return object.NULL
 	} else {
 		val, ok := env.Get(node.Name)
+		if c, isConst := val.GetValue().(*object.Constant); ok && isConst {
+			obj, err := c.Assign(node, nil, "assignment")
+			if err != nil {
+				return constErr(err)
+			}
+			return obj
+		}
 		if ok {
 			return val.GetValue()
 		}
@@ -913,11 +1995,21 @@ func evalIdentifier(node *ast.Ident, env *object.Environment) object.Object {
 }
 
 func evalUnaryExpr(node *ast.UnaryExpr, env *object.Environment) object.Object {
-	line, column := parsePos(node.X.Pos())
+	if node.Op == token.AND {
+		return evalAddrExpr(node, env)
+	}
 	obj := eval(node.X, env)
 	if object.IsError(obj) {
 		return obj
 	}
+	if named, ok := obj.(*object.Named); ok {
+		return named.NamedType.Result(evalUnaryOp(node, named.Value))
+	}
+	return evalUnaryOp(node, obj)
+}
+
+func evalUnaryOp(node *ast.UnaryExpr, obj object.Object) object.Object {
+	line, column := parsePos(node.X.Pos())
 	switch node.Op {
 	case token.NOT:
 		if obj == object.TRUE {
@@ -932,6 +2024,8 @@ func evalUnaryExpr(node *ast.UnaryExpr, env *object.Environment) object.Object {
 			return object.ConvertToInt(obj.Type(), -obj.(object.Integer).Integer())
 		} else if obj.Type().IsFloat() {
 			return object.ConvertToFloat(obj.Type(), -obj.(object.Float).Float())
+		} else if obj.Type().IsComplex() {
+			return object.ConvertToComplex(obj.Type(), -obj.(object.Complex).Complex())
 		} else {
 			return object.NewError("%d:%d operator - not defined on %s", line, column, obj.Type())
 		}
@@ -946,12 +2040,120 @@ func evalUnaryExpr(node *ast.UnaryExpr, env *object.Environment) object.Object {
 	}
 }
 
+// evalAddrExpr &x 取变量、复合字面量、结构体字段或切片元素的地址
+func evalAddrExpr(node *ast.UnaryExpr, env *object.Environment) object.Object {
+	line, column := parsePos(node.Pos())
+	x := node.X
+	for {
+		paren, ok := x.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		x = paren.X
+	}
+
+	switch x := x.(type) {
+	case *ast.Ident:
+		ref, ok := env.Addr(x.Name)
+		if !ok {
+			return object.NewError("%d:%d undefined: %s", line, column, x.Name)
+		}
+		return &object.Pointer{Elem: *ref, Ref: ref}
+	case *ast.CompositeLit:
+		obj := evalCompositeLit(x, env)
+		if object.IsError(obj) {
+			return obj
+		}
+		return object.NewPointer(obj)
+	case *ast.SelectorExpr:
+		owner := evalFieldOwner(x, env)
+		if object.IsError(owner) {
+			return owner
+		}
+		ref := owner.(*object.Struct).FieldRef(x.Sel.Name)
+		return &object.Pointer{Elem: *ref, Ref: ref}
+	case *ast.IndexExpr:
+		source := unwrapValue(eval(x.X, env))
+		if object.IsError(source) {
+			return source
+		}
+		index := unwrapValue(eval(x.Index, env))
+		if object.IsError(index) {
+			return index
+		}
+		array, ok := object.Indexed(source).(*object.Array)
+		if !ok {
+			return object.NewError("%d:%d invalid operation: cannot take address of %s", line, column, types.ExprString(x))
+		}
+		i := object.Unnamed(index).(object.Integer).Integer()
+		if i < 0 || int(i) >= len(array.Elements) {
+			return object.NewError("%d:%d index out of range [%d] with length %d", line, column, i, len(array.Elements))
+		}
+		ref := &array.Elements[i]
+		return &object.Pointer{Elem: *ref, Ref: ref}
+	default:
+		return object.NewError("%d:%d invalid operation: cannot take address of %s", line, column, types.ExprString(x))
+	}
+}
+
+func evalStarExpr(node *ast.StarExpr, env *object.Environment) object.Object {
+	target := evalPointerTarget(node, env)
+	if object.IsError(target) {
+		return target
+	}
+	return target.(*object.Pointer).Load()
+}
+
+// evalPointerTarget *p 中的指针，指针接收者方法中的接收者是结构体本身
+func evalPointerTarget(node *ast.StarExpr, env *object.Environment) object.Object {
+	line, column := parsePos(node.Pos())
+	obj := unwrapValue(eval(node.X, env))
+	if object.IsError(obj) {
+		return obj
+	}
+	if object.IsNil(obj) {
+		return object.NewError("%d:%d invalid memory address or nil pointer dereference", line, column)
+	}
+	switch obj := obj.(type) {
+	case *object.Pointer:
+		return obj
+	case *object.Struct:
+		return object.NewPointer(obj)
+	default:
+		return object.NewError("%d:%d invalid operation: cannot indirect %s (variable of type %s)", line, column, types.ExprString(node.X), obj.Type())
+	}
+}
+
+// evalNew new(T) 返回指向 T 的零值的指针
+func evalNew(node *ast.CallExpr, env *object.Environment) object.Object {
+	line, column := parsePos(node.Pos())
+	if len(node.Args) != 1 {
+		return object.NewError("%d:%d wrong number of arguments to new", line, column)
+	}
+	zero := object.GetDefaultValueWithExpr(node.Args[0], env)
+	if object.IsError(zero) {
+		return object.NewError("%d:%d %s", line, column, zero)
+	}
+	return object.NewPointer(object.Zero(zero))
+}
+
 func evalIncDecStmt(node *ast.IncDecStmt, env *object.Environment) object.Object {
+	if _, ok := node.X.(*ast.IndexExpr); ok {
+		// a[i]++ 按 a[i] += 1 赋值
+		tok := token.ADD_ASSIGN
+		if node.Tok == token.DEC {
+			tok = token.SUB_ASSIGN
+		}
+		one := &ast.BasicLit{ValuePos: node.TokPos, Kind: token.INT, Value: "1"}
+		return evalAssignStmt(&ast.AssignStmt{Lhs: []ast.Expr{node.X}, TokPos: node.TokPos, Tok: tok, Rhs: []ast.Expr{one}}, env)
+	}
 	line, column := parsePos(node.Pos())
 	obj := eval(node.X, env)
 	if object.IsError(obj) {
 		return obj
 	}
+	nt := object.NamedTypeOf(obj)
+	obj = object.Unnamed(obj)
 	if !obj.Type().IsInteger() && !obj.Type().IsFloat() {
 		return object.NewError("%d:%d invalid operation: %s (non-numeric type %s)", line, column, node.Tok, obj.Type())
 	}
@@ -969,22 +2171,132 @@ func evalIncDecStmt(node *ast.IncDecStmt, env *object.Environment) object.Object
 			obj = object.ConvertToFloat(obj.Type(), obj.(object.Float).Float()-float64(1))
 		}
 	}
-	if idt, ok := node.X.(*ast.Ident); ok {
-		if evObj, ok := env.Get(idt.Name); ok {
-			env.SetWithDepth(idt.Name, obj, evObj.Depth)
+	obj = nt.Result(obj)
+	switch x := node.X.(type) {
+	case *ast.Ident:
+		if evObj, ok := env.Get(x.Name); ok {
+			env.SetWithDepth(x.Name, obj, evObj.Depth)
 		} else {
-			env.SetWithDepth(idt.Name, obj, 0)
+			env.SetWithDepth(x.Name, obj, 0)
+		}
+	case *ast.SelectorExpr:
+		owner := evalFieldOwner(x, env)
+		if object.IsError(owner) {
+			return owner
 		}
+		owner.(*object.Struct).Set(x.Sel.Name, obj)
+	case *ast.StarExpr:
+		target := evalPointerTarget(x, env)
+		if object.IsError(target) {
+			return target
+		}
+		target.(*object.Pointer).Store(obj)
 	}
 	return nil
 }
 
+// evalOperand 常量和变量运算时，常量转换为变量的类型
+func evalOperand(expr, other ast.Expr, op token.Token, env *object.Environment) object.Object {
+	if op == token.SHL || op == token.SHR || !object.ConstOperand(expr, env) {
+		return eval(expr, env)
+	}
+	typ := operandType(other, env)
+	if object.ConstOperand(other, env) || object.ConstBinary(other, env) {
+		// 两边都是常量时按较宽的类型，1 + 2.5 和 1 + 2i
+		typ = object.ConstArgsType([]ast.Expr{expr, other}, env)
+	}
+	if typ == nil {
+		return eval(expr, env)
+	}
+	// 字面量直接转换，和编译器的错误一致
+	if basic, ok := expr.(*ast.BasicLit); ok {
+		obj := object.ConvertValueWithType(parseBasicLit(basic), typ)
+		if object.IsError(obj) {
+			line, column := parsePos(expr.Pos())
+			return object.NewError("%d:%d %s", line, column, obj)
+		}
+		return obj
+	}
+	if obj := evalConstExpr(expr, typ, "assignment", env); obj != nil {
+		return obj
+	}
+	return eval(expr, env)
+}
+
+// operandType 变量操作数的类型，用于确定另一侧常量的类型
+func operandType(expr ast.Expr, env *object.Environment) object.Object {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		if cur, ok := env.Get(expr.Name); ok && object.IsConstType(object.Unnamed(cur.GetValue()).Type()) {
+			return cur.GetValue()
+		}
+	case *ast.IndexExpr:
+		// 字符串的元素是 byte
+		if typ := operandType(expr.X, env); typ != nil && typ.Type() == object.STRING_OBJ {
+			return &object.Byte{}
+		}
+		if ident, ok := expr.X.(*ast.Ident); ok {
+			if cur, ok := env.Get(ident.Name); ok {
+				return object.ElemConstType(cur.GetValue())
+			}
+		}
+	case *ast.ParenExpr:
+		return operandType(expr.X, env)
+	case *ast.UnaryExpr:
+		if expr.Op == token.SUB || expr.Op == token.ADD || expr.Op == token.XOR {
+			return operandType(expr.X, env)
+		}
+	case *ast.BinaryExpr:
+		if !arithmeticOp(expr.Op) {
+			return nil
+		}
+		if typ := operandType(expr.X, env); typ != nil || expr.Op == token.SHL || expr.Op == token.SHR {
+			return typ
+		}
+		return operandType(expr.Y, env)
+	case *ast.CallExpr:
+		// 类型转换的结果是该类型
+		ident, ok := expr.Fun.(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		if fn, ok := env.Get(ident.Name); ok {
+			return object.ConstResultType(fn.GetValue(), env)
+		}
+		if object.IntBuiltin(ident.Name) {
+			return &object.Int{}
+		}
+		if object.TypedBuiltin(ident.Name) {
+			for _, arg := range expr.Args {
+				if typ := operandType(arg, env); typ != nil {
+					return object.BuiltinResultType(ident.Name, typ)
+				}
+			}
+			return nil
+		}
+		if typ := object.GetDefaultObject(ident.Name); object.IsConstType(typ.Type()) {
+			return typ
+		}
+	}
+	return nil
+}
+
+// arithmeticOp 结果和操作数类型相同的运算
+func arithmeticOp(op token.Token) bool {
+	switch op {
+	case token.ADD, token.SUB, token.MUL, token.QUO, token.REM,
+		token.AND, token.OR, token.XOR, token.SHL, token.SHR, token.AND_NOT:
+		return true
+	}
+	return false
+}
+
 func evalBinaryExpr(node *ast.BinaryExpr, env *object.Environment) object.Object {
-	leftObj := eval(node.X, env)
+	leftObj := evalOperand(node.X, node.Y, node.Op, env)
 	if object.IsError(leftObj) {
 		return leftObj
 	}
-	rightObj := eval(node.Y, env)
+	rightObj := evalOperand(node.Y, node.X, node.Op, env)
 	if object.IsError(rightObj) {
 		return rightObj
 	}
@@ -999,7 +2311,7 @@ func evalBinaryExpr(node *ast.BinaryExpr, env *object.Environment) object.Object
 func parseBasicLit(basic *ast.BasicLit) object.Object {
 	switch basic.Kind {
 	case token.INT:
-		if value, err := strconv.ParseInt(basic.Value, 10, 64); err != nil {
+		if value, err := strconv.ParseInt(basic.Value, 0, 64); err != nil {
 			return object.NewError("%s cannot be represented by the type int", basic.Value)
 		} else {
 			return &object.Int{Value: int(value)}
@@ -1011,13 +2323,22 @@ func parseBasicLit(basic *ast.BasicLit) object.Object {
 			return &object.Float64{Value: value}
 		}
 	case token.STRING:
-		value := parseString(basic)
-		return &object.String{Value: value}
+		if value, err := parseString(basic); err != nil {
+			return object.NewError("invalid string literal %s", basic.Value)
+		} else {
+			return &object.String{Value: value}
+		}
 	case token.CHAR:
 		if value, err := parseChar(basic); err != nil {
-			return object.NewError("%s cannot be represented by the type char", basic.Value)
+			return object.NewError("%s cannot be represented by the type rune", basic.Value)
 		} else {
-			return &object.Byte{Value: value}
+			return &object.Rune{Value: value}
+		}
+	case token.IMAG:
+		if value, err := strconv.ParseComplex(basic.Value, 128); err != nil {
+			return object.NewError("%s cannot be represented by the type complex128", basic.Value)
+		} else {
+			return &object.Complex128{Value: value}
 		}
 	default:
 		return object.NewError("not support ast.BasicLit kind: %T", basic.Kind)
@@ -1041,6 +2362,23 @@ func handleBinaryExpr(op token.Token, left, right object.Object) object.Object {
 	default:
 	}
 
+	left, right = object.Underlying(left), object.Underlying(right)
+	if object.IsNil(left) || object.IsNil(right) {
+		switch op {
+		case token.EQL:
+			return object.ConvertToBoolean(object.IsNil(left) && object.IsNil(right))
+		case token.NEQ:
+			return object.ConvertToBoolean(!object.IsNil(left) || !object.IsNil(right))
+		}
+	}
+	if ln, rn := object.NamedTypeOf(left), object.NamedTypeOf(right); ln != nil || rn != nil {
+		// 只有接口中的值可能属于不同的命名类型
+		if ln != nil && rn != nil && ln != rn && (op == token.EQL || op == token.NEQ) {
+			return object.ConvertToBoolean(op == token.NEQ)
+		}
+		left, right, nt := object.NamedOperands(left, right, op == token.SHL || op == token.SHR)
+		return nt.Result(handleBinaryExpr(op, left, right))
+	}
 	if left.Type() != right.Type() {
 		return object.NewError("mismatched types %s and %s", left.Type(), right.Type())
 	}
@@ -1049,10 +2387,18 @@ func handleBinaryExpr(op token.Token, left, right object.Object) object.Object {
 		return handleIntegerBinaryExpr(op, left, right)
 	case left.Type().IsFloat():
 		return handleFloatBinaryExpr(op, left, right)
+	case left.Type().IsComplex():
+		return handleComplexBinaryExpr(op, left, right)
 	case left.Type() == object.BOOLEAN_OBJ:
 		return handleBooleanBinaryExpr(op, left, right)
 	case left.Type() == object.STRING_OBJ:
 		return handleStringBinaryExpr(op, left, right)
+	case left.Type() == object.STRUCT_OBJ:
+		return handleStructBinaryExpr(op, left, right)
+	case left.Type() == object.ARRAY_OBJ && left.(*object.Array).Fixed:
+		return handleArrayBinaryExpr(op, left, right)
+	case left.Type() == object.POINTER_OBJ:
+		return handlePointerBinaryExpr(op, left, right)
 	default:
 		return object.NewError("unknown operator: %s %s %s", left.Type(), op, right.Type())
 	}
@@ -1062,6 +2408,9 @@ func handleIntegerBinaryExpr(op token.Token, left, right object.Object) object.O
 	valType := left.Type()
 	leftVal := left.(object.Integer).Integer()
 	rightVal := right.(object.Integer).Integer()
+	if rightVal == 0 && (op == token.QUO || op == token.REM) {
+		return object.NewError("integer divide by zero")
+	}
 	switch op {
 	case token.ADD:
 		return object.ConvertToInt(valType, leftVal+rightVal)
@@ -1132,6 +2481,28 @@ func handleFloatBinaryExpr(op token.Token, left, right object.Object) object.Obj
 	}
 }
 
+func handleComplexBinaryExpr(op token.Token, left, right object.Object) object.Object {
+	valType := left.Type()
+	leftVal := left.(object.Complex).Complex()
+	rightVal := right.(object.Complex).Complex()
+	switch op {
+	case token.ADD:
+		return object.ConvertToComplex(valType, leftVal+rightVal)
+	case token.SUB:
+		return object.ConvertToComplex(valType, leftVal-rightVal)
+	case token.MUL:
+		return object.ConvertToComplex(valType, leftVal*rightVal)
+	case token.QUO:
+		return object.ConvertToComplex(valType, leftVal/rightVal)
+	case token.EQL:
+		return object.ConvertToBoolean(leftVal == rightVal)
+	case token.NEQ:
+		return object.ConvertToBoolean(leftVal != rightVal)
+	default:
+		return object.NewError("the operator %s is not defined on %s", op, valType)
+	}
+}
+
 func handleBooleanBinaryExpr(op token.Token, left, right object.Object) object.Object {
 	leftVal := left.(*object.Boolean).Value
 	rightVal := right.(*object.Boolean).Value
@@ -1154,68 +2525,88 @@ func handleStringBinaryExpr(op token.Token, left, right object.Object) object.Ob
 	rightVal := right.(*object.String).Value
 	if op == token.ADD {
 		return &object.String{Value: leftVal + rightVal}
-	} else {
-		cp := strings.Compare(leftVal, rightVal)
-		switch op {
-		case token.EQL:
-			if cp == 0 {
-				return object.TRUE
-			} else {
-				return object.FALSE
-			}
-		case token.NEQ:
-			if cp != 0 {
-				return object.TRUE
-			} else {
-				return object.FALSE
-			}
-		default:
-			return object.NewError("the operator %s is not defined on %s", op, left.Type())
-		}
+	}
+	cp := strings.Compare(leftVal, rightVal)
+	switch op {
+	case token.EQL:
+		return object.ConvertToBoolean(cp == 0)
+	case token.NEQ:
+		return object.ConvertToBoolean(cp != 0)
+	case token.LSS:
+		return object.ConvertToBoolean(cp < 0)
+	case token.LEQ:
+		return object.ConvertToBoolean(cp <= 0)
+	case token.GTR:
+		return object.ConvertToBoolean(cp > 0)
+	case token.GEQ:
+		return object.ConvertToBoolean(cp >= 0)
+	default:
+		return object.NewError("the operator %s is not defined on %s", op, left.Type())
 	}
 }
 
-// 转义符
-var escapeChMap = map[byte]byte{
-	't':  '\t',
-	'n':  '\n',
-	'"':  '"',
-	'\\': '\\',
-	'r':  '\r',
+// parseString 解释型和原始字符串字面量
+func parseString(basic *ast.BasicLit) (string, error) {
+	return strconv.Unquote(basic.Value)
 }
 
-func parseString(basic *ast.BasicLit) string {
-	str := basic.Value[1 : len(basic.Value)-1]
-	var out bytes.Buffer
-	for i := 0; i < len(str); i++ {
-		cur := str[i]
-		if cur == '\\' {
-			next := str[i+1]
-			if v, ok := escapeChMap[next]; ok {
-				i += 1
-				out.WriteByte(v)
-			}
-		} else if cur != '"' {
-			out.WriteByte(cur)
-		}
-		if cur == '"' || cur == 0 {
-			break
-		}
+func parseChar(basic *ast.BasicLit) (rune, error) {
+	value, _, tail, err := strconv.UnquoteChar(basic.Value[1:len(basic.Value)-1], '\'')
+	if err == nil && tail != "" {
+		err = errors.New("more than one character in rune literal")
 	}
-	return out.String()
+	return value, err
 }
 
-func parseChar(basic *ast.BasicLit) (uint8, error) {
-	str := basic.Value
-	if strings.HasPrefix(str, "'") && strings.HasSuffix(str, "'") && len(str) == 3 {
-		b := []byte(str)
-		return b[1], nil
+func handleStructBinaryExpr(op token.Token, left, right object.Object) object.Object {
+	switch op {
+	case token.EQL:
+		return object.ConvertToBoolean(object.Equal(left, right))
+	case token.NEQ:
+		return object.ConvertToBoolean(!object.Equal(left, right))
+	default:
+		return object.NewError("the operator %s is not defined on %s", op, left.(*object.Struct).StructType)
+	}
+}
+
+func handleArrayBinaryExpr(op token.Token, left, right object.Object) object.Object {
+	if !left.(*object.Array).SameType(right.(*object.Array)) {
+		return object.NewError("invalid operation: mismatched types %s and %s", object.TypeName(left), object.TypeName(right))
+	}
+	switch op {
+	case token.EQL:
+		return object.ConvertToBoolean(object.Equal(left, right))
+	case token.NEQ:
+		return object.ConvertToBoolean(!object.Equal(left, right))
+	default:
+		return object.NewError("the operator %s is not defined on %s", op, object.TypeName(left))
+	}
+}
+
+func handlePointerBinaryExpr(op token.Token, left, right object.Object) object.Object {
+	switch op {
+	case token.EQL:
+		return object.ConvertToBoolean(object.Equal(left, right))
+	case token.NEQ:
+		return object.ConvertToBoolean(!object.Equal(left, right))
+	default:
+		return object.NewError("the operator %s is not defined on %s", op, object.TypeName(left))
+	}
+}
+
+func unwrapValue(obj object.Object) object.Object {
+	switch tobj := obj.(type) {
+	case *object.SingleReturn:
+		return tobj.Value
+	case *object.MapExist:
+		return tobj.Value
+	default:
+		return obj
 	}
-	return 0, errors.New("")
 }
 
 func parsePos(p token.Pos) (int, int) {
-	pos := tokenFile.Position(p)
+	pos := fileSet.Position(p)
 	return pos.Line, pos.Column
 }
 
@@ -1231,24 +2622,27 @@ func parseRightNum(exprs []ast.Expr, env *object.Environment) (int, int) {
 		case *ast.CallExpr:
 			switch funIdt := expr.Fun.(type) {
 			case *ast.Ident:
-				if i, ok := object.GetBuiltinReturnNum(funIdt.Name); ok {
+				if fn, ok := env.Get(funIdt.Name); ok {
+					n += resultNum(fn.GetValue())
+				} else if i, ok := object.GetBuiltinReturnNum(funIdt.Name); ok {
 					n += i
-				} else if fn, ok := env.Get(funIdt.Name); ok {
-					funResult := fn.GetValue().(*object.Function).Results
-					for _, result := range funResult {
-						if !result.IsFun {
-							n++
-						} else {
-							n += len(result.Results)
-						}
-					}
 				}
 			case *ast.FuncLit:
 				n += len(funIdt.Type.Results.List)
+			case *ast.ArrayType:
+				n++
+			default:
+				n += resultNum(calleeType(funIdt, env))
 			}
+		case *ast.SelectorExpr:
+			n++
 		case *ast.IndexExpr:
-			comName := expr.X.(*ast.Ident).Name
-			if comVal, ok := env.Get(comName); ok {
+			ident, ok := expr.X.(*ast.Ident)
+			if !ok {
+				n++
+				continue
+			}
+			if comVal, ok := env.Get(ident.Name); ok {
 				if _, ok1 := comVal.GetValue().(*object.Hash); ok1 {
 					n++
 					m = n + 1
@@ -1256,23 +2650,79 @@ func parseRightNum(exprs []ast.Expr, env *object.Environment) (int, int) {
 					n++
 				}
 			}
-		case *ast.BinaryExpr:
+		case *ast.BinaryExpr, *ast.SliceExpr:
 			n++
 		case *ast.BasicLit:
 			n++
+		case *ast.UnaryExpr, *ast.StarExpr:
+			n++
 		case *ast.FuncLit:
 			n++
 		case *ast.CompositeLit:
 			n++
+		case *ast.TypeAssertExpr:
+			n++
+			m = n + 1
 		}
 	}
 	return n, m
 }
 
+func resultNum(fn object.Object) int {
+	n := 0
+	switch fn := fn.(type) {
+	case *object.Function:
+		n = len(fn.Results)
+	case *object.BoundMethod:
+		n = resultNum(fn.Fn)
+	case *object.MapExist:
+		n = resultNum(fn.Value)
+	case *object.NamedType:
+		// 类型转换
+		n = 1
+	}
+	return n
+}
+
+// calleeType 被调用的函数值，调用结果只取返回值类型，不执行调用
+func calleeType(fun ast.Expr, env *object.Environment) object.Object {
+	call, ok := fun.(*ast.CallExpr)
+	if !ok {
+		return eval(fun, env)
+	}
+	fn := calleeType(call.Fun, env)
+	switch f := fn.(type) {
+	case *object.MapExist:
+		fn = f.Value
+	case *object.BoundMethod:
+		fn = f.Fn
+	}
+	if fn, ok := fn.(*object.Function); ok && len(fn.Results) > 0 {
+		return object.GetDefaultValueFromElem(fn.Results[0].Type, env)
+	}
+	return nil
+}
+
 type LhsItem struct {
 	Name    string
 	Depth   int
 	IsIndex bool
 	Index   int64
-	HashKey object.HashKey
+	Key     object.Object
+	Target  *object.Struct
+	Pointer *object.Pointer
+
+	Container object.Object // 下标赋值的容器不是变量时为求出的容器
+}
+
+// container 下标赋值的数组或 map
+func (item LhsItem) container(env *object.Environment) object.Object {
+	if item.Container != nil {
+		return item.Container
+	}
+	envObj, ok := env.Get(item.Name)
+	if !ok {
+		return nil
+	}
+	return envObj.GetValue()
 }
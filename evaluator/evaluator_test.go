@@ -49,7 +49,12 @@ func TestObject(t *testing.T) {
 		{`"hello"`, "hello"},
 		{`"hello\tworld"`, "hello	world"},
 		{`"hello\"world"`, `hello"world`},
-		{"'b'", "b"[0]},
+		{"'b'", 'b'},
+		{`"b"[0]`, "b"[0]},
+		{"'世'", '世'},
+		{`'\n'`, '\n'},
+		{"`a\\n\"b\"`", `a\n"b"`},
+		{`"\x41\101\u00e9\U0001F600"`, "AAé😀"},
 	}
 
 	for _, tt := range tests {
@@ -117,6 +122,8 @@ func TestBinaryOperator(t *testing.T) {
 		{"3 &^ 1", 2},
 		{"-50 + 100 + -50", 0},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"0x10 + 1_000 + 0b11 + 0o7 + 017", 1041},
+		{"x := 0xFF; x", 255},
 
 		{"3 > 1", true},
 		{"3 >= 1", true},
@@ -371,6 +378,23 @@ func TestBuiltinFunc(t *testing.T) {
 		{`len([]int{})`, 0},
 		{`append([]int{}, 1)`, []int{1}},
 		{`append(1, 1)`, "argument to 'append' must be array, got int"},
+		{`m := map[string]int{"a": 1, "b": 2}; delete(m, "a"); delete(m, "z"); len(m)`, 1},
+		{`delete(1, 2)`, "invalid argument: int is not a map"},
+		{`max()`, "not enough arguments in call to max"},
+		{`clear(3)`, "invalid argument: clear expects a map or slice, got int"},
+		{`m := map[int8]int{1: 2}; delete(m, 1); len(m)`, 0},
+		{`m := map[string]int{}; k := 1; delete(m, k)`, "cannot use int as string value in argument to delete"},
+		{`delete(map[string]int{}, 1)`, "1:26 cannot use 1 (untyped int constant) as string value in argument to delete"},
+		{`x := min(); x`, "not enough arguments in call to min"},
+		{`x := cap(map[int]int{}); x`, "argument to 'cap' not support, got hash"},
+		{`x := append(); x`, "not enough arguments in call to append"},
+		{`s := []int{1, 2}; m := map[int]int{1: 1}; clear(s); clear(m); append(s, len(m))`, []int{0, 0, 0}},
+		{`min(3, 1, 2)`, 1},
+		{`x := 2.5; f := max(1, x); int(f * 10)`, 25},
+		{`const c = max(1, 2.5); int(c * 10)`, 25},
+		{`a := 1; b := "a"; min(a, b)`, "invalid argument: mismatched types int and string in min"},
+		{`f := 2.7; int(f) + int(uint8(f))`, 4},
+		{`max := 2; var make int = 3; max * make`, 6},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(t, tt.input, true)
@@ -612,6 +636,2480 @@ func TestRecursiveFunctions(t *testing.T) {
 	}
 }
 
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					type Point struct {
+						x, y int
+					}
+
+					func main() {
+						p := Point{x: 1, y: 2}
+						p.x += 10
+						p.y++
+						p.x + p.y
+					}
+				`,
+			14,
+		},
+		{
+			`
+					package tmp
+
+					type Point struct {
+						x, y int
+					}
+
+					type Line struct {
+						a, b Point
+						name string
+					}
+
+					func main() {
+						l := Line{a: Point{1, 2}, b: Point{y: 4}}
+						l.b.x = 3
+						m := l
+						m.a.x = 100
+						l.a.x + l.b.x + l.b.y
+					}
+				`,
+			8,
+		},
+		{
+			`
+					package tmp
+
+					type Point struct {
+						x, y int
+					}
+
+					func move(p Point) int {
+						p.x = 10
+						return p.x
+					}
+
+					func main() {
+						ps := []Point{{1, 2}, {3, 4}}
+						n := move(ps[0])
+						ps[0].x + ps[1].y + n
+					}
+				`,
+			15,
+		},
+		{
+			`
+					package tmp
+
+					type Base struct {
+						id int
+					}
+
+					type User struct {
+						Base
+						name string
+					}
+
+					func main() {
+						u := User{Base{7}, "go"}
+						u.id = u.id * 2
+						u.id
+					}
+				`,
+			14,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						type Point struct {
+							x, y int
+						}
+						var a Point
+						b := Point{}
+						a == b && a != Point{1, 0}
+					}
+				`,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					type Point struct {
+						x, y int
+					}
+
+					func (p Point) Sum() int {
+						return p.x + p.y
+					}
+
+					func (p *Point) Move(dx, dy int) {
+						p.x += dx
+						p.y += dy
+					}
+
+					func (p Point) Reset() {
+						p.x = 0
+					}
+
+					func main() {
+						p := Point{1, 2}
+						p.Move(10, 20)
+						p.Reset()
+						p.Sum()
+					}
+				`,
+			33,
+		},
+		{
+			`
+					package tmp
+
+					type Counter struct {
+						n int
+					}
+
+					func (c *Counter) Inc() {
+						c.n++
+					}
+
+					func (c Counter) Get() (v int) {
+						v = c.n * 10
+						return
+					}
+
+					func main() {
+						c := Counter{}
+						inc := c.Inc
+						inc()
+						inc()
+						get := Counter.Get
+						get(c)
+					}
+				`,
+			20,
+		},
+		{
+			`
+					package tmp
+
+					type Base struct {
+						id int
+					}
+
+					func (b Base) ID() int {
+						return b.id
+					}
+
+					type User struct {
+						Base
+						name string
+					}
+
+					func (u User) Describe() int {
+						return u.ID() + len(u.name)
+					}
+
+					func main() {
+						u := User{Base{40}, "go"}
+						u.Describe()
+					}
+				`,
+			42,
+		},
+		{
+			`
+					package tmp
+
+					type Point struct {
+						x, y int
+					}
+
+					func (p *Point) Scale(k int) {
+						p.x *= k
+						p.y *= k
+					}
+
+					func (p Point) Sum() int {
+						return p.x + p.y
+					}
+
+					func main() {
+						p := Point{1, 2}
+						scale := (*Point).Scale
+						scale(&p, 10)
+						sum := (*Point).Sum
+						sum(&p) + Point.Sum(p)
+					}
+				`,
+			60,
+		},
+		{
+			`
+					package tmp
+
+					type Weekday int
+
+					const (
+						Sunday Weekday = iota
+						Monday
+						Tuesday
+					)
+
+					func (d Weekday) Next() Weekday {
+						return (d + 1) % 3
+					}
+
+					type Nexter interface {
+						Next() Weekday
+					}
+
+					type IntList []int
+
+					func (l IntList) Sum() int {
+						s := 0
+						for _, v := range l {
+							s += v
+						}
+						return s
+					}
+
+					func (l *IntList) Add(v int) {
+						*l = append(*l, v)
+					}
+
+					type Count int
+
+					func (c *Count) Inc() {
+						*c++
+					}
+
+					func main() {
+						l := IntList{1, 2}
+						l.Add(int(Tuesday.Next().Next()))
+						var n Nexter = Monday
+						d := n.Next()
+						names := map[Weekday]int{Tuesday: 100}
+						switch d {
+						case Tuesday:
+							l.Add(names[d])
+						}
+						var c Count
+						c.Inc()
+						inc := (*Count).Inc
+						inc(&c)
+						l.Sum() + int(d)*1000 + int(c)*10000
+					}
+				`,
+			22104,
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestInterfaces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					type Shape interface {
+						Area() int
+					}
+
+					type Rect struct {
+						w, h int
+					}
+
+					func (r Rect) Area() int {
+						return r.w * r.h
+					}
+
+					type Square struct {
+						side int
+					}
+
+					func (s Square) Area() int {
+						return s.side * s.side
+					}
+
+					func total(a, b Shape) int {
+						return a.Area() + b.Area()
+					}
+
+					func main() {
+						var s Shape = Rect{2, 3}
+						n := s.Area()
+						s = Square{4}
+						total(s, Rect{1, 5}) + n
+					}
+				`,
+			27,
+		},
+		{
+			`
+					package tmp
+
+					func describe(v any) int {
+						if n, ok := v.(int); ok {
+							return n
+						}
+						if s, ok := v.(string); ok {
+							return len(s)
+						}
+						return -1
+					}
+
+					func main() {
+						var x interface{} = 40
+						y := x.(int)
+						describe(y) + describe("go") + describe(true)
+					}
+				`,
+			41,
+		},
+		{
+			`
+					package tmp
+
+					type Namer interface {
+						Name() string
+					}
+
+					type Ager interface {
+						Age() int
+					}
+
+					type Person interface {
+						Namer
+						Ager
+					}
+
+					type Cat struct {
+						age int
+					}
+
+					func (c Cat) Name() string {
+						return "cat"
+					}
+
+					func (c Cat) Age() int {
+						return c.age
+					}
+
+					type Rock struct {
+						kind string
+					}
+
+					func (r Rock) Name() string {
+						return r.kind
+					}
+
+					func score(n Namer) int {
+						p, ok := n.(Person)
+						if !ok {
+							return len(n.Name())
+						}
+						return p.Age() + len(p.Name())
+					}
+
+					func main() {
+						var p Person
+						n := 0
+						if p == nil {
+							n = 100
+						}
+						score(Cat{7}) + score(Rock{"rock"}) + n
+					}
+				`,
+			114,
+		},
+		{
+			`
+					package tmp
+
+					type Shape interface {
+						Area() int
+					}
+
+					type Sq struct {
+						S int
+					}
+
+					func (s Sq) Area() int {
+						return s.S * s.S
+					}
+
+					type Bad struct{}
+
+					func (b Bad) Area() string {
+						return "x"
+					}
+
+					func main() {
+						n := 0
+						var x interface{} = []int{1, 2}
+						if v, ok := x.([]int); ok {
+							n += len(v)
+						}
+						switch v := x.(type) {
+						case []string:
+							n += 100
+						case []int:
+							n += v[1] * 10
+						}
+						var m interface{} = map[string]int{"a": 3}
+						switch v := m.(type) {
+						case map[string]bool:
+							n += 1000
+						case map[string]int:
+							n += v["a"] * 1000
+						}
+						if _, ok := m.(map[int]int); ok {
+							n += 10000
+						}
+						var b interface{} = Bad{}
+						if _, ok := b.(Shape); !ok {
+							n += 100000
+						}
+						var s interface{} = Sq{2}
+						if sh, ok := s.(Shape); ok {
+							n += sh.Area() * 1000000
+						}
+						n
+					}
+				`,
+			4103022,
+		},
+		{
+			`
+					package tmp
+
+					type Shape interface {
+						Area() int
+					}
+
+					type No struct{}
+
+					func use(s Shape) int {
+						return s.Area()
+					}
+
+					func main() {
+						use(No{})
+					}
+				`,
+			object.Error{Message: "15:7 cannot use (value of type No) as Shape value: No does not implement Shape (missing method Area) to use"},
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						var x any = "go"
+						n := x.(int)
+						n
+					}
+				`,
+			object.Error{Message: "6:12 interface conversion: interface {} is string, not int"},
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					func grade(n int) int {
+						r := 0
+						switch m := n % 10; m {
+						case 1, 2:
+							r = 10
+						default:
+							r = 30
+						case 3:
+							r = 20
+							fallthrough
+						case 4:
+							r += 5
+						}
+						return r
+					}
+
+					func main() {
+						grade(1) + grade(13) + grade(4) + grade(7)
+					}
+				`,
+			70,
+		},
+		{
+			`
+					package tmp
+
+					func sign(x int) int {
+						switch {
+						case x < 0:
+							return -1
+						case x == 0:
+							break
+						default:
+							return 1
+						}
+						return 0
+					}
+
+					func main() {
+						total := 0
+						for i := -2; i <= 2; i++ {
+							switch sign(i) {
+							case 1:
+								total += 10
+							case -1:
+								total += 1
+							}
+						}
+						total
+					}
+				`,
+			22,
+		},
+		{
+			`
+					package tmp
+
+					type Point struct {
+						x, y int
+					}
+
+					func kind(v any) int {
+						switch t := v.(type) {
+						case int:
+							return t * 2
+						case string, bool:
+							return 100
+						case Point:
+							return t.x + t.y
+						case nil:
+							return -1
+						default:
+							return 0
+						}
+					}
+
+					func main() {
+						kind(21) + kind("s") + kind(Point{3, 4}) + kind(nil) + kind(1.5)
+					}
+				`,
+			148,
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestDeferPanicRecover(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					func find(arr []int, x int) int {
+						for i, v := range arr {
+							for j := 0; j < 3; j++ {
+								if v == x && j == 2 {
+									return i*100 + j
+								}
+							}
+						}
+						return -1
+					}
+
+					func main() {
+						n := 0
+						for i := 0; i < 10; i++ {
+							if i == 3 {
+								break
+							}
+							n += i
+						}
+						find([]int{4, 5, 6}, 6) + n
+					}
+				`,
+			205,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						order := ""
+						protect := func(s string) {
+							defer func() {
+								r := recover()
+								if r != nil {
+									order = order + r.(string)
+								}
+							}()
+							defer func() { order = order + "a" }()
+							for i := 0; i < 3; i++ {
+								defer func() { order = order + "b" }()
+								if i == 1 {
+									panic(s)
+								}
+							}
+							order = order + "x"
+						}
+						protect("boom")
+						order = order + "!"
+						order
+					}
+				`,
+			"bbaboom!",
+		},
+		{
+			`
+					package tmp
+
+					func div(a, b int) (msg string) {
+						defer func() {
+							msg = recover().(string)
+						}()
+						a = a / b
+						return ""
+					}
+
+					func main() {
+						div(1, 0)
+					}
+				`,
+			"integer divide by zero",
+		},
+		{
+			`
+					package tmp
+
+					func div(a, b int) (q int) {
+						defer func() {
+							recover()
+						}()
+						q = -1
+						return a / b
+					}
+
+					func main() {
+						div(7, 2) * 10 + div(1, 0)
+					}
+				`,
+			29,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						got := 0
+						helper := func() {
+							if r := recover(); r != nil {
+								got = 100
+							}
+						}
+						f := func() {
+							defer func() {
+								helper()
+								if r := recover(); r != nil {
+									got = got + r.(int)
+								}
+							}()
+							arr := []int{1, 2, 3}
+							for _, v := range arr {
+								for j := 0; j < 2; j++ {
+									if v == 2 {
+										panic(v * 10)
+									}
+								}
+							}
+						}
+						for i := 0; i < 2; i++ {
+							f()
+						}
+						r := recover()
+						r == nil && got == 40
+					}
+				`,
+			true,
+		},
+		{
+			`
+					package tmp
+
+					func f(n int) int {
+						for i := 0; i < n; i++ {
+							if i == 3 {
+								panic(i * 14)
+							}
+						}
+						return n
+					}
+
+					func main() {
+						f(10)
+					}
+				`,
+			object.Error{Message: "panic: 42"},
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						f := func() {
+							defer func() {
+								panic("second")
+							}()
+							panic("first")
+						}
+						f()
+					}
+				`,
+			object.Error{Message: "panic: second"},
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a := 0
+						1 / a
+					}
+				`,
+			object.Error{Message: "6:7 integer divide by zero"},
+		},
+		{
+			`
+					package tmp
+
+					func scale() (n int) {
+						defer func() { n *= 10 }()
+						n = 2
+						return n + 1
+					}
+
+					func rescue() (n int) {
+						defer func() {
+							recover()
+							n = 7
+						}()
+						panic("x")
+					}
+
+					func pair() (int, int) { return 3, 4 }
+
+					func swap() (a, b int) {
+						defer func() { a, b = b, a }()
+						return pair()
+					}
+
+					func find() (n int) {
+						defer func() { n++ }()
+						for i := 0; i < 10; i++ {
+							if i == 4 {
+								return i * 2
+							}
+						}
+						return 0
+					}
+
+					func main() {
+						a, b := swap()
+						scale()*1000 + rescue()*100 + find()*10 + a - b
+					}
+				`,
+			30791,
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestSlices(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					func main() {
+						a := []int{1, 2, 3, 4, 5}
+						b := a[1:3]
+						b[0] = 20
+						b = append(b, 40)
+						len(b)*1000 + cap(b)*100 + a[1] + a[3]
+					}
+				`,
+			3460,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a := []int{1, 2, 3, 4, 5}
+						b := a[1:3:4]
+						b = append(b, 6)
+						b = append(b, 7)
+						b[0] = 9
+						a[1]*100 + a[3]*10 + cap(a[2:])
+					}
+				`,
+			263,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						s := make([]int, 2, 5)
+						t := append(s, 3)
+						s = append(s, 4)
+						len(s)*1000 + cap(s)*100 + t[2]
+					}
+				`,
+			3504,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						dst := make([]int, 3)
+						n := copy(dst, []int{7, 8, 9, 10})
+						a := []int{1}
+						a = append(a, dst[1:]...)
+						n*10000 + a[0]*100 + a[1]*10 + a[2]
+					}
+				`,
+			30189,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						s := "hello, world"
+						s[7:] + s[:5] + s[5:6]
+					}
+				`,
+			"worldhello,",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a := make([]int, 2, 3)
+						a[1:4]
+					}
+				`,
+			object.Error{Message: "6:7 slice bounds out of range [:4] with capacity 3"},
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestPointers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					func counter() *int {
+						n := 10
+						return &n
+					}
+
+					func main() {
+						p := counter()
+						q := counter()
+						*p = *p + 1
+						*q++
+						*p*100 + *q
+					}
+				`,
+			1111,
+		},
+		{
+			`
+					package tmp
+
+					func inc(p *int) {
+						*p += 5
+					}
+
+					func main() {
+						x := 1
+						inc(&x)
+						inc(&x)
+						x
+					}
+				`,
+			11,
+		},
+		{
+			`
+					package tmp
+
+					type Node struct {
+						val  int
+						next *Node
+					}
+
+					func main() {
+						var head *Node
+						for i := 1; i <= 3; i++ {
+							head = &Node{val: i, next: head}
+						}
+						sum := 0
+						for n := head; n != nil; n = n.next {
+							sum = sum*10 + n.val
+						}
+						sum
+					}
+				`,
+			321,
+		},
+		{
+			`
+					package tmp
+
+					type Point struct {
+						X, Y int
+					}
+
+					func main() {
+						a := []int{1, 2, 3}
+						p := &a[1]
+						*p = 20
+						s := Point{1, 2}
+						q := &s.Y
+						*q = 30
+						r := new(int)
+						*r = a[1] + s.Y
+						*r
+					}
+				`,
+			50,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						x := 1
+						y := 1
+						p, q, r := &x, &x, &y
+						var n *int
+						p == q && p != r && n == nil && r != nil
+					}
+				`,
+			true,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						x := 0
+						p := &x
+						add := func(n int) {
+							x += n
+						}
+						add(3)
+						add(4)
+						*p * 10 + x
+					}
+				`,
+			77,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						var ps []*int
+						for i := 0; i < 3; i++ {
+							v := i * 10
+							ps = append(ps, &v)
+						}
+						*ps[0] + *ps[1] + *ps[2]
+					}
+				`,
+			30,
+		},
+		{
+			`
+					package tmp
+
+					type Point struct {
+						X, Y int
+					}
+
+					func move(p *Point) {
+						p.X += 10
+					}
+
+					func main() {
+						pt := Point{1, 2}
+						move(&pt)
+						pp := &pt
+						pp.Y = 5
+						(*pp).Y++
+						pt.X*10 + pt.Y
+					}
+				`,
+			116,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a := [3]int{1, 2, 3}
+						p := &a
+						p[0] = 5
+						sum := 0
+						for _, v := range p {
+							sum += v
+						}
+						a[0]*1000 + p[1]*100 + len(p)*10 + sum - 10
+					}
+				`,
+			5230,
+		},
+		{
+			`
+					package tmp
+
+					type Shape interface {
+						Area() int
+					}
+
+					type Rect struct {
+						W, H int
+					}
+
+					func (r *Rect) Area() int {
+						return r.W * r.H
+					}
+
+					func main() {
+						var s Shape = &Rect{2, 3}
+						var x interface{} = &Rect{4, 5}
+						total := s.Area()
+						if sh, ok := x.(Shape); ok {
+							total += sh.Area() * 10
+						}
+						switch v := x.(type) {
+						case Shape:
+							total += v.Area() * 100
+						}
+						var y interface{} = Rect{1, 1}
+						if _, ok := y.(Shape); !ok {
+							total += 5000
+						}
+						total
+					}
+				`,
+			7206,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						var p *int
+						*p = 1
+					}
+				`,
+			object.Error{Message: "6:7 invalid memory address or nil pointer dereference"},
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestConstants(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					const (
+						Sunday = iota
+						Monday
+						Tuesday
+						_
+						Thursday
+					)
+
+					func main() {
+						Sunday*1000 + Monday*100 + Tuesday*10 + Thursday
+					}
+				`,
+			124,
+		},
+		{
+			`
+					package tmp
+
+					const (
+						_  = iota
+						KB = 1 << (10 * iota)
+						MB
+						GB
+					)
+
+					func main() {
+						GB / MB
+					}
+				`,
+			1024,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						const big = 1 << 100
+						big >> 98
+					}
+				`,
+			4,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						const (
+							a, b = iota, iota * 10
+							c, d
+						)
+						c*100 + d
+					}
+				`,
+			110,
+		},
+		{
+			`
+					package tmp
+
+					const scale = 2.5
+
+					func main() {
+						x := 4.0
+						x * scale
+					}
+				`,
+			10.0,
+		},
+		{
+			`
+					package tmp
+
+					func two() int {
+						return 2
+					}
+
+					func main() {
+						xs := []int{1, 2, 3}
+						d := '0' + len(xs)
+						e := 'a' + xs[1]
+						f := '0' + two()
+						var b byte = 'a' + 1
+						s := string(rune('a' + len(xs)))
+						(d*1000000+e*1000+f)*10 + int(b) - 'a' + len(s)
+					}
+				`,
+			510990502,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						const (
+							A int8 = 100
+							B      = A * 2
+						)
+					}
+				`,
+			object.Error{Message: "7:17 A * 2 (constant 200 of type int8) overflows int8"},
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						const big = 1 << 100
+						z := big
+					}
+				`,
+			object.Error{Message: "6:12 cannot use big (untyped int constant 1267650600228229401496703205376) as int value in assignment (overflows)"},
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						var u uint = -1
+					}
+				`,
+			object.Error{Message: "5:20 cannot use -1 (untyped int constant) as uint value in variable declaration (overflows)"},
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						const n = 1
+						n = 2
+					}
+				`,
+			object.Error{Message: "6:7 cannot assign to n (neither addressable nor a map index expression)"},
+		},
+		{
+			`
+					package tmp
+
+					type Celsius float64
+
+					func half(x float64) float64 {
+						return x / 2
+					}
+
+					func G[T any](a T, b float64) T {
+						return a
+					}
+
+					func main() {
+						f := 2.0
+						f = 3
+						var c Celsius = 1
+						m := map[float64]int{2: 1}
+						delete(m, 2)
+						f + 0.5 + half(1) + G[float64](1, 2.5) + float64(c) + float64(len(m))
+					}
+				`,
+			6.0,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						x := 1 << 64
+					}
+				`,
+			object.Error{Message: "5:12 cannot use 1 << 64 (untyped int constant 18446744073709551616) as int value in assignment (overflows)"},
+		},
+		{
+			`
+					package tmp
+
+					func f(n int) int {
+						return n
+					}
+
+					func main() {
+						f(1.5)
+					}
+				`,
+			object.Error{Message: "9:9 cannot use 1.5 (untyped float constant) as int value in argument to f (truncated)"},
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestGenerics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					func Map[T, U any](xs []T, f func(T) U) []U {
+						var result []U
+						for _, x := range xs {
+							result = append(result, f(x))
+						}
+						return result
+					}
+
+					func main() {
+						words := Map([]int{1, 22, 333}, func(n int) string {
+							if n > 10 {
+								return "big"
+							}
+							return "small"
+						})
+						words[0] + words[2]
+					}
+				`,
+			"smallbig",
+		},
+		{
+			`
+					package tmp
+
+					type MyInt int
+
+					type Num interface {
+						~int | ~float64
+					}
+
+					func Double[T Num](x T) T {
+						return x * 2
+					}
+
+					func main() {
+						n := Double(MyInt(4))
+						int(n) + int(Double(2.5))
+					}
+				`,
+			13,
+		},
+		{
+			`
+					package tmp
+
+					type Number interface {
+						~int | ~int64 | ~float64
+					}
+
+					func Sum[T Number](xs []T) T {
+						var total T
+						for _, x := range xs {
+							total += x
+						}
+						return total
+					}
+
+					func main() {
+						Sum([]float64{1.5, 2.5}) + float64(Sum[int]([]int{1, 2, 3}))
+					}
+				`,
+			10.0,
+		},
+		{
+			`
+					package tmp
+
+					type Stack[T any] struct {
+						items []T
+					}
+
+					func (s *Stack[T]) Push(v T) {
+						s.items = append(s.items, v)
+					}
+
+					func (s *Stack[T]) Pop() T {
+						var zero T
+						if len(s.items) == 0 {
+							return zero
+						}
+						v := s.items[len(s.items)-1]
+						s.items = s.items[:len(s.items)-1]
+						return v
+					}
+
+					func main() {
+						s := &Stack[int]{}
+						s.Push(1)
+						s.Push(2)
+						s.Pop()*10 + s.Pop() + s.Pop()
+					}
+				`,
+			21,
+		},
+		{
+			`
+					package tmp
+
+					type Pair[K comparable, V any] struct {
+						Key   K
+						Value V
+					}
+
+					func Swap[K, V comparable](p Pair[K, V]) Pair[V, K] {
+						return Pair[V, K]{Key: p.Value, Value: p.Key}
+					}
+
+					func main() {
+						p := Swap(Pair[string, int]{"a", 7})
+						p.Key
+					}
+				`,
+			7,
+		},
+		{
+			`
+					package tmp
+
+					func Zero[T any]() T {
+						var zero T
+						return zero
+					}
+
+					func main() {
+						Zero()
+					}
+				`,
+			object.Error{Message: "10:7 in call to Zero, cannot infer T"},
+		},
+		{
+			`
+					package tmp
+
+					type Number interface {
+						~int | ~float64
+					}
+
+					func Sum[T Number](xs []T) T {
+						var total T
+						return total
+					}
+
+					func main() {
+						Sum([]string{"a"})
+					}
+				`,
+			object.Error{Message: "14:7 string does not satisfy Number (string missing in ~int | ~float64)"},
+		},
+		{
+			`
+					package tmp
+
+					type MyInt int
+
+					func Inc[T int | float64](x T) T {
+						return x + 1
+					}
+
+					func main() {
+						Inc(MyInt(1))
+					}
+				`,
+			object.Error{Message: "11:7 MyInt does not satisfy int | float64 (MyInt missing in int | float64)"},
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					func main() {
+						grid := [][]int{{1, 2}, {3, 4}, {5, 6}}
+						found := 0
+					outer:
+						for i := 0; i < len(grid); i++ {
+							row := grid[i]
+							for _, v := range row {
+								if v == 4 {
+									found = i*10 + v
+									break outer
+								}
+							}
+						}
+						found
+					}
+				`,
+			14,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						n := 0
+					loop:
+						for i := 0; i < 3; i++ {
+							for j := 0; j < 3; j++ {
+								for k := 0; k < 3; k++ {
+									switch {
+									case i == 1 && k == 1:
+										break loop
+									case k == 2:
+										continue loop
+									}
+									n++
+								}
+							}
+						}
+						n
+					}
+				`,
+			3,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						x := 0
+					sw:
+						switch x {
+						case 0:
+							for i := 0; i < 10; i++ {
+								if i == 3 {
+									break sw
+								}
+								x += i
+							}
+							x = 100
+						}
+						x
+					}
+				`,
+			3,
+		},
+		{
+			`
+					package tmp
+
+					func abs(n int) int {
+						if n < 0 {
+							goto neg
+						}
+						return n
+					neg:
+						return -n
+					}
+
+					func main() {
+						i, sum := 0, 0
+					loop:
+						if i < 5 {
+							sum += i
+							i++
+							goto loop
+						}
+						r := 0
+						for x := 0; x < 3; x++ {
+							for y := 0; y < 3; y++ {
+								if x*y == 2 {
+									r = x*10 + y
+									goto done
+								}
+							}
+						}
+						r = -1
+					done:
+						abs(-3)*1000 + abs(2)*100 + sum*10 + r
+					}
+				`,
+			3312,
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestVariadic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					func sum(xs ...int) int {
+						total := 0
+						for _, x := range xs {
+							total += x
+						}
+						return total
+					}
+
+					func main() {
+						nums := []int{4, 5}
+						sum() + sum(1) + sum(1, 2, 3)*10 + sum(nums...)*100
+					}
+				`,
+			961,
+		},
+		{
+			`
+					package tmp
+
+					func join(sep string, parts ...string) string {
+						out := ""
+						for i, p := range parts {
+							if i > 0 {
+								out += sep
+							}
+							out += p
+						}
+						return out
+					}
+
+					func main() {
+						join("-", "a", "b", "c") + join("+")
+					}
+				`,
+			"a-b-c",
+		},
+		{
+			`
+					package tmp
+
+					func push(s []int, xs ...int) []int {
+						return append(s, xs...)
+					}
+
+					func main() {
+						s := push([]int{7, 8}, 1, 2)
+						s[0] + len(s)*100
+					}
+				`,
+			407,
+		},
+		{
+			`
+					package tmp
+
+					type Number interface {
+						~int | ~float64
+					}
+
+					func Max[T Number](first T, rest ...T) T {
+						m := first
+						for _, x := range rest {
+							if x > m {
+								m = x
+							}
+						}
+						return m
+					}
+
+					func main() {
+						Max(3, 9, 4) + Max(2)
+					}
+				`,
+			11,
+		},
+		{
+			`
+					package tmp
+
+					func add(a int, b int) int {
+						return a + b
+					}
+
+					func main() {
+						add([]int{1, 2}...)
+					}
+				`,
+			object.Error{Message: "9:7 cannot use ... in call to non-variadic add"},
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestFuncValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					type Handler struct {
+						name string
+						fn   func(int) int
+					}
+
+					func getF() func(int) int {
+						return func(x int) int { return x + 1 }
+					}
+
+					func main() {
+						var f func(int) int
+						f = func(x int) int { return x * 3 }
+						m := map[string]func(int) int{"inc": func(x int) int { return x + 1 }}
+						fs := []func() int{func() int { return 7 }}
+						h := Handler{name: "h", fn: f}
+						m["inc"](1) + fs[0]() + getF()(1) + h.fn(2) + f(1)
+					}
+				`,
+			20,
+		},
+		{
+			`
+					package tmp
+
+					func apply(xs []int, f func(int) int) []int {
+						var out []int
+						for _, x := range xs {
+							out = append(out, f(x))
+						}
+						return out
+					}
+
+					func compose(f, g func(int) int) func(int) int {
+						return func(x int) int { return f(g(x)) }
+					}
+
+					func pair() func() (int, int) {
+						return func() (int, int) { return 1, 2 }
+					}
+
+					func main() {
+						double := func(x int) int { return x * 2 }
+						r := apply([]int{1, 2}, compose(double, double))
+						a, b := pair()()
+						r[0] + r[1] + a*100 + b*1000
+					}
+				`,
+			2112,
+		},
+		{
+			`
+					package tmp
+
+					type Handler struct {
+						fn func()
+					}
+
+					func main() {
+						var f func(int) int
+						var h Handler
+						n := 0
+						if f == nil {
+							n += 1
+						}
+						if h.fn == nil {
+							n += 10
+						}
+						f = func(x int) int { return x }
+						if f != nil {
+							n += 100
+						}
+						f = nil
+						if f == nil {
+							n += 1000
+						}
+						n
+					}
+				`,
+			1111,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						var fib func(int) int
+						fib = func(n int) int {
+							if n < 2 {
+								return n
+							}
+							return fib(n-1) + fib(n-2)
+						}
+						fib(10)
+					}
+				`,
+			55,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						var f func() int
+						f()
+					}
+				`,
+			object.Error{Message: "6:7 invalid memory address or nil pointer dereference"},
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					func main() {
+						s := "héllo, 世界"
+						n := 0
+						out := ""
+						for i, r := range s {
+							n += i
+							out = string(r) + out
+						}
+						out + string(rune(n))
+					}
+				`,
+			"界世 ,olléh-",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						n := 0
+						for range "abc" {
+							n++
+						}
+						for range []int{1, 2} {
+							n++
+						}
+						n*1000 + int("abc"[1])
+					}
+				`,
+			5098,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						s := "héllo"
+						bs := []byte(s)
+						rs := []rune(s)
+						bs[0] = 'j'
+						rs[1] = 'e'
+						string(bs) + "|" + string(rs) + "|" + s
+					}
+				`,
+			"jéllo|hello|héllo",
+		},
+		{
+			`
+					package tmp
+
+					func atoi(s string) int {
+						n := 0
+						for i := 0; i < len(s); i++ {
+							if s[i] < '0' || s[i] > '9' {
+								return -1
+							}
+							n = n*10 + int(s[i]-'0')
+						}
+						return n
+					}
+
+					func main() {
+						atoi("409") + atoi("4x")
+					}
+				`,
+			408,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						raw := ` + "`a\\n\"b\"`" + `
+						esc := "\x41\101é\t\U0001F600"
+						raw + "|" + esc
+					}
+				`,
+			"a\\n\"b\"|AAé\t😀",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						n := 0
+						if "apple" < "banana" {
+							n += 1
+						}
+						if "b" > "abc" {
+							n += 10
+						}
+						if "a" <= "a" && "a" >= "a" {
+							n += 100
+						}
+						if "b" < "a" || "b" <= "a" {
+							n += 1000
+						}
+						n
+					}
+				`,
+			111,
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestParallelAssign(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					func main() {
+						a, b, c := 1, 2, 3
+						a, b, c = b, c, a
+						s := []int{1, 2, 3}
+						i, j := 0, 2
+						s[i], s[j] = s[j], s[i]
+						a*100 + b*10 + c + s[0]*1000
+					}
+				`,
+			3231,
+		},
+		{
+			`
+					package tmp
+
+					type P struct {
+						X int
+						Y int
+					}
+
+					func pair(a, b int) (int, int) {
+						return b, a
+					}
+
+					func main() {
+						p := &P{X: 5, Y: 8}
+						p.X, p.Y = p.Y, p.X
+						a, b := 1, 2
+						b, a = pair(a, b)
+						_, b = pair(a, 7)
+						var c int
+						c, _ = pair(3, 4)
+						p.X*10000 + p.Y*1000 + a*100 + b*10 + c
+					}
+				`,
+			85114,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						m := map[string]int{"a": 1}
+						var i interface{} = 3
+						var v int
+						var ok bool
+						n := 0
+						v, ok = m["a"]
+						if ok {
+							n += v
+						}
+						_, ok = m["b"]
+						if !ok {
+							n += 10
+						}
+						v, ok = i.(int)
+						if ok {
+							n += v * 100
+						}
+						var s string
+						s, ok = i.(string)
+						if !ok && s == "" {
+							n += 1000
+						}
+						n
+					}
+				`,
+			1311,
+		},
+		{
+			`
+					package tmp
+
+					func reverse(xs []int) {
+						for i, j := 0, len(xs)-1; i < j; i, j = i+1, j-1 {
+							xs[i], xs[j] = xs[j], xs[i]
+						}
+					}
+
+					func rotate(xs []int, m map[string]int) {
+						shift := func() {
+							for i := 0; i < len(xs)-1; i++ {
+								xs[i], xs[i+1] = xs[i+1], xs[i]
+							}
+							m["a"] = xs[0]
+						}
+						shift()
+					}
+
+					func main() {
+						xs := []int{1, 2, 3, 4}
+						reverse(xs)
+						m := map[string]int{}
+						rotate(xs, m)
+						i := 0
+						ys := []int{0, 0}
+						i, ys[i] = 1, 9
+						i*10000 + xs[0]*1000 + xs[3]*100 + m["a"]*10 + ys[0]
+					}
+				`,
+			13439,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a, b := 1, 2
+						a, b = b
+					}
+				`,
+			object.Error{Message: "6:7 assignment mismatch: 2 variables but 1 value"},
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestComplex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					func main() {
+						z := 1 + 2i
+						w := complex(3, -1)
+						z * w
+					}
+				`,
+			5 + 5i,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						z := 1 + 2i
+						z += complex(3, -1)
+						-z / 2
+					}
+				`,
+			-2 - 0.5i,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						var c complex64 = 2i
+						c = c * c
+						real(c) == -4 && imag(c) == 0
+					}
+				`,
+			true,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						const k = complex(1, 1) * 2
+						imag(k) + real(1+3i)
+					}
+				`,
+			3.0,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						m := map[complex128]int{1i: 7, 2i: 8}
+						m[2i] - m[1i]
+					}
+				`,
+			1,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						complex128(1) == 1+0i && 1+2i != 1
+					}
+				`,
+			true,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						'a' + 1
+					}
+				`,
+			'b',
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a := 1
+						b := 2.5
+						complex(a, b)
+					}
+				`,
+			object.Error{Message: "invalid argument: mismatched types int and float64 in complex"},
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestFixedArrays(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					func bump(a [3]int) int {
+						a[0] = 100
+						return a[0]
+					}
+
+					func main() {
+						var a [3]int
+						b := a
+						b[0] = 5
+						c := [3]int{1, 2}
+						n := bump(c)
+						a[0]*1000 + b[0]*100 + c[0]*10 + c[2] + n*0 + len(c)*10000
+					}
+				`,
+			30510,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						c := [3]int{1, 2}
+						d := [...]int{1, 2, 0}
+						e := [3]int{1, 2, 3}
+						c == d && c != e && len(d) == 3
+					}
+				`,
+			true,
+		},
+		{
+			`
+					package tmp
+
+					type P struct {
+						X int
+					}
+
+					func main() {
+						var ps [3]P
+						qs := ps
+						q := qs[1]
+						q.X = 5
+						qs[1] = q
+						grid := [2][2]int{{1, 2}, {3}}
+						cp := grid
+						row := cp[0]
+						row[0] = 9
+						cp[0] = row
+						ps[1].X*1000 + qs[1].X*100 + grid[0][0]*10 + cp[0][0]
+					}
+				`,
+			519,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						seen := map[[2]string]int{{"a", "b"}: 1}
+						seen[[2]string{"a", "b"}] += 2
+						seen[[2]string{"b", "a"}] = 10
+						key := [2]string{"a", "b"}
+						seen[key]*100 + len(seen)
+					}
+				`,
+			302,
+		},
+		{
+			`
+					package tmp
+
+					type T struct {
+						Arr [3]int
+						M   map[string][]int
+					}
+
+					func main() {
+						var g [2][2]int
+						g[1][0] = 9
+						g[0][1] += 2
+						t := T{M: map[string][]int{"a": {1, 2}}}
+						t.Arr[0] = 5
+						t.Arr[1]++
+						t.M["a"][1] = 7
+						p := &t
+						p.Arr[2] = 4
+						ts := []T{{}, {}}
+						ts[1].Arr[2] = 3
+						f := func() {
+							g[0][0] = 1
+						}
+						f()
+						n := g[0][0]*1000000 + g[1][0]*100000 + g[0][1]*10000 + t.Arr[0]*1000 + t.Arr[1]*100 + t.Arr[2]*10 + t.M["a"][1]
+						n*10 + ts[1].Arr[2]
+					}
+				`,
+			19251473,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a := [3]int{1, 2, 3}
+						s := 0
+						for i, v := range a {
+							a[2] = 100
+							if i == 2 {
+								s += v
+							}
+						}
+						b := [3]int{1, 2, 3}
+						for i, v := range &b {
+							b[2] = 100
+							if i == 2 {
+								s += v * 10
+							}
+						}
+						s
+					}
+				`,
+			1003,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						var a [3]int
+						var b [4]int
+						a = b
+					}
+				`,
+			object.Error{Message: "7:11 cannot use value of type [4]int as [3]int value in assignment"},
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a := [2]int{1, 2, 3}
+					}
+				`,
+			object.Error{Message: "5:25 array index 2 out of bounds [0:2]"},
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestHashKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			`
+					package tmp
+
+					func main() {
+						fm := map[float64]int{}
+						fm[2] = 3
+						fm[0] = 4
+						zero := 0.0
+						nan := zero / zero
+						fm[nan] = 5
+						fm[nan] = 6
+						s := 0
+						for k, v := range fm {
+							if k != k {
+								s += v
+							}
+						}
+						fm[2.0]*100000 + fm[-zero]*10000 + s*100 + len(fm)
+					}
+				`,
+			341104,
+		},
+		{
+			`
+					package tmp
+
+					type P struct {
+						X, Y int
+					}
+
+					func main() {
+						bm := map[bool]int{true: 1}
+						pm := map[P]int{P{1, 2}: 7}
+						pm[P{1, 2}] = 8
+						p := &P{1, 2}
+						q := &P{1, 2}
+						ptr := map[*P]int{p: 1, q: 2}
+						am := map[any]int{1: 1, "a": 2, 2.5: 3, P{1, 1}: 4}
+						ar := map[[2]int]int{{1, 2}: 9}
+						bm[true]*10000 + pm[P{1, 2}]*1000 + len(ptr)*100 + am[P{1, 1}]*10 + ar[[2]int{1, 2}] + len(pm)*0
+					}
+				`,
+			18249,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						m := map[string]int{}
+						m["a"]++
+						m["b"] += 3
+						x := m["zz"] + 1
+						s := map[string]string{}
+						t := s["q"] + "!"
+						l := map[string][]int{}
+						l["k"] = append(l["k"], 4)
+						m["a"]*100000 + m["b"]*10000 + x*1000 + len(t)*100 + len(l["k"])*10 + len(l["none"])
+					}
+				`,
+			131110,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						am := map[any]int{}
+						var s []int
+						am[s] = 1
+					}
+				`,
+			object.Error{Message: "7:7 runtime error: hash of unhashable type []int"},
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, false)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
 func testObject(t *testing.T, evaluated object.Object, expected any) {
 	t.Helper()
 	switch expected := expected.(type) {
@@ -625,6 +3123,11 @@ func testObject(t *testing.T, evaluated object.Object, expected any) {
 		if err != nil {
 			t.Errorf("testFloatObject failed: %s", err)
 		}
+	case complex128:
+		err := testComplexObject(t, evaluated, expected)
+		if err != nil {
+			t.Errorf("testComplexObject failed: %s", err)
+		}
 	case bool:
 		err := testBooleanObject(t, evaluated, expected)
 		if err != nil {
@@ -635,6 +3138,11 @@ func testObject(t *testing.T, evaluated object.Object, expected any) {
 		if err != nil {
 			t.Errorf("testByteObject failed: %s", err)
 		}
+	case rune:
+		err := testRuneObject(t, evaluated, expected)
+		if err != nil {
+			t.Errorf("testRuneObject failed: %s", err)
+		}
 	case string:
 		err := testStringObject(t, evaluated, expected)
 		if err != nil {
@@ -651,7 +3159,7 @@ func testObject(t *testing.T, evaluated object.Object, expected any) {
 			t.Errorf("object is not Error: %T (%+v)", expected, evaluated)
 		}
 		if errObj.Message != expected.Message {
-			t.Errorf("wrong error message. expected=%s, got=%s", expected, errObj.Message)
+			t.Errorf("wrong error message. expected=%s, got=%s", expected.Message, errObj.Message)
 		}
 	case []int:
 		array, ok := evaluated.(*object.Array)
@@ -672,7 +3180,7 @@ func testObject(t *testing.T, evaluated object.Object, expected any) {
 		if !ok {
 			t.Errorf("object is not hash: %T (%+v)", evaluated, evaluated)
 		}
-		for _, pair := range hashObj.Pairs {
+		for _, pair := range hashObj.Entries() {
 			key := pair.Key.(*object.String)
 			v := pair.Value
 			ev, ok1 := expected[key.Value]
@@ -713,6 +3221,18 @@ func testFloatObject(t *testing.T, obj object.Object, expected float64) error {
 	return nil
 }
 
+func testComplexObject(t *testing.T, obj object.Object, expected complex128) error {
+	t.Helper()
+	result, ok := obj.(object.Complex)
+	if !ok {
+		return fmt.Errorf("object is not Complex. got=%T (%+v)", obj, obj)
+	}
+	if result.Complex() != expected {
+		return fmt.Errorf("object has wrong value. got=%v, want=%v", result.Complex(), expected)
+	}
+	return nil
+}
+
 func testByteObject(t *testing.T, obj object.Object, expected byte) error {
 	t.Helper()
 	result, ok := obj.(*object.Byte)
@@ -725,6 +3245,18 @@ func testByteObject(t *testing.T, obj object.Object, expected byte) error {
 	return nil
 }
 
+func testRuneObject(t *testing.T, obj object.Object, expected rune) error {
+	t.Helper()
+	result, ok := obj.(*object.Rune)
+	if !ok {
+		return fmt.Errorf("object is not Rune. got=%T (%+v)", obj, obj)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+	return nil
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) error {
 	t.Helper()
 	result, ok := obj.(*object.Boolean)
@@ -1,8 +1,11 @@
 package object
 
+// Environment 每个变量占用一个单元，取地址得到的指针指向这个单元
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]*Object
+	outer  *Environment
+	isFunc bool
+	defers []func() Object
 }
 
 type EnvObject struct {
@@ -15,7 +18,7 @@ func (eb *EnvObject) GetValue() Object {
 }
 
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
+	s := make(map[string]*Object)
 	return &Environment{store: s, outer: nil}
 }
 
@@ -25,6 +28,31 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 	return env
 }
 
+// NewFunctionEnvironment 函数调用的作用域，defer 注册在这里
+func NewFunctionEnvironment(outer *Environment) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.isFunc = true
+	return env
+}
+
+// Defer 把延迟调用注册到所在函数的作用域
+func (env *Environment) Defer(fn func() Object) {
+	for !env.isFunc && env.outer != nil {
+		env = env.outer
+	}
+	env.defers = append(env.defers, fn)
+}
+
+func (env *Environment) PopDefer() func() Object {
+	n := len(env.defers) - 1
+	if n < 0 {
+		return nil
+	}
+	fn := env.defers[n]
+	env.defers = env.defers[:n]
+	return fn
+}
+
 func (env *Environment) Get(name string) (EnvObject, bool) {
 	obj, depth, ok := env.get(name, 0)
 	return EnvObject{Value: obj, Depth: depth}, ok
@@ -34,12 +62,33 @@ func (env *Environment) get(name string, depth int) (Object, int, bool) {
 	if name == "_" {
 		return nil, 0, false
 	}
-	obj, ok := env.store[name]
+	ref, ok := env.store[name]
 	if !ok && env.outer != nil {
-		obj, depth, ok = env.outer.get(name, depth)
-		depth++
+		obj, depth, ok := env.outer.get(name, depth)
+		return obj, depth + 1, ok
 	}
-	return obj, depth, ok
+	if !ok {
+		return nil, depth, false
+	}
+	return *ref, depth, true
+}
+
+// Addr 变量所在的单元
+func (env *Environment) Addr(name string) (*Object, bool) {
+	ref, ok := env.store[name]
+	if !ok && env.outer != nil {
+		return env.outer.Addr(name)
+	}
+	return ref, ok
+}
+
+// set 已有的变量原地赋值，指向它的指针能看到新值
+func (env *Environment) set(name string, value Object) {
+	if ref, ok := env.store[name]; ok {
+		*ref = value
+		return
+	}
+	env.store[name] = &value
 }
 
 func (env *Environment) Set(name string, value Object) (Object, *Error) {
@@ -47,29 +96,88 @@ func (env *Environment) Set(name string, value Object) (Object, *Error) {
 		return value, nil
 	}
 	obj, _, ok := env.get(name, 0)
-	if ok && value.Type() != FUNCTION_OBJ && obj.Type() != value.Type() {
-		return obj, NewError("cannot use '%s' (untyped %s constant) as %s value in assignment", value, value.Type(), obj.Type())
+	if ok && !assignable(obj, value) {
+		return obj, assignError(obj, value)
 	}
-	env.store[name] = value
+	env.set(name, value)
 	return obj, nil
 }
 
+// assignable 函数变量可以赋值为其他函数或 nil，定长数组的长度也要相同
+func assignable(obj, value Object) bool {
+	if array, ok := obj.(*Array); ok {
+		if other, ok := value.(*Array); ok && (array.Fixed || other.Fixed) {
+			return array.SameType(other)
+		}
+	}
+	if value.Type() == FUNCTION_OBJ || obj.Type() == value.Type() {
+		return true
+	}
+	return obj.Type() == FUNCTION_OBJ && value == NULL
+}
+
+func assignError(obj, value Object) *Error {
+	if obj.Type() == ARRAY_OBJ && value.Type() == ARRAY_OBJ {
+		return NewError("cannot use value of type %s as %s value in assignment", TypeName(value), TypeName(obj))
+	}
+	return NewError("cannot use '%s' (untyped %s constant) as %s value in assignment", value, value.Type(), obj.Type())
+}
+
+// Define 在当前作用域定义变量，不检查外层同名变量
+func (env *Environment) Define(name string, value Object) {
+	if name == "_" {
+		return
+	}
+	env.store[name] = &value
+}
+
 func (env *Environment) SetWithDepth(name string, value Object, depth int) (Object, *Error) {
 	if name == "_" {
 		return value, nil
 	}
 	if depth == 0 {
 		obj, _, ok := env.get(name, 0)
-		if ok && value.Type() != FUNCTION_OBJ && obj.Type() != value.Type() {
-			return obj, NewError("cannot use '%s' (untyped %s constant) as %s value in assignment", value, value.Type(), obj.Type())
+		if ok && !assignable(obj, value) {
+			return obj, assignError(obj, value)
 		}
-		env.store[name] = value
+		env.set(name, value)
 		return obj, nil
 	} else {
 		return env.outer.SetWithDepth(name, value, depth-1)
 	}
 }
 
+// Delete 删除当前作用域中的名字，REPL 在输入出错时撤销新加入的声明
+func (env *Environment) Delete(name string) {
+	delete(env.store, name)
+}
+
 func (env *Environment) GetStore() map[string]Object {
-	return env.store
+	store := make(map[string]Object, len(env.store))
+	for name, ref := range env.store {
+		store[name] = *ref
+	}
+	return store
+}
+
+func (env *Environment) ResolveType(name string) (Object, bool) {
+	obj, _, ok := env.get(name, 0)
+	if !ok {
+		return nil, false
+	}
+	switch obj.Type() {
+	case STRUCT_TYPE_OBJ, INTERFACE_TYPE_OBJ, TYPE_ARG_OBJ, GENERIC_TYPE_OBJ, NAMED_TYPE_OBJ:
+		return obj, true
+	default:
+		return nil, false
+	}
+}
+
+func (env *Environment) Const(name string) (*Constant, bool) {
+	obj, _, ok := env.get(name, 0)
+	if !ok {
+		return nil, false
+	}
+	c, ok := obj.(*Constant)
+	return c, ok
 }
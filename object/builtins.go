@@ -1,6 +1,10 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"go/ast"
+	"slices"
+)
 
 var Builtins = []struct {
 	Name    string
@@ -21,10 +25,8 @@ var Builtins = []struct {
 					return arg
 				case *Uint64:
 					return &Int{Value: int(arg.Value)}
-				case *Byte:
-					return &Int{Value: int(arg.Value)}
-				case *Rune:
-					return &Int{Value: int(arg.Value)}
+				case *Float32, *Float64:
+					return &Int{Value: int(arg.(Float).Float())}
 				default:
 					return NewError("cannot convert the type '%s' to type 'int'", args[0].Type())
 				}
@@ -45,10 +47,8 @@ var Builtins = []struct {
 					return arg
 				case *Uint64:
 					return &Int8{Value: int8(arg.Value)}
-				case *Byte:
-					return &Int8{Value: int8(arg.Value)}
-				case *Rune:
-					return &Int8{Value: int8(arg.Value)}
+				case *Float32, *Float64:
+					return &Int8{Value: int8(arg.(Float).Float())}
 				default:
 					return NewError("cannot convert the type '%s' to type 'int8'", args[0].Type())
 				}
@@ -69,10 +69,8 @@ var Builtins = []struct {
 					return arg
 				case *Uint64:
 					return &Int16{Value: int16(arg.Value)}
-				case *Byte:
-					return &Int16{Value: int16(arg.Value)}
-				case *Rune:
-					return &Int16{Value: int16(arg.Value)}
+				case *Float32, *Float64:
+					return &Int16{Value: int16(arg.(Float).Float())}
 				default:
 					return NewError("cannot convert the type '%s' to type 'int16'", args[0].Type())
 				}
@@ -93,10 +91,8 @@ var Builtins = []struct {
 					return arg
 				case *Uint64:
 					return &Int32{Value: int32(arg.Value)}
-				case *Byte:
-					return &Int32{Value: int32(arg.Value)}
-				case *Rune:
-					return &Int32{Value: arg.Value}
+				case *Float32, *Float64:
+					return &Int32{Value: int32(arg.(Float).Float())}
 				default:
 					return NewError("cannot convert the type '%s' to type 'int32'", args[0].Type())
 				}
@@ -117,10 +113,8 @@ var Builtins = []struct {
 					return arg
 				case *Uint64:
 					return &Int64{Value: int64(arg.Value)}
-				case *Byte:
-					return &Int64{Value: int64(arg.Value)}
-				case *Rune:
-					return &Int64{Value: int64(arg.Value)}
+				case *Float32, *Float64:
+					return &Int64{Value: int64(arg.(Float).Float())}
 				default:
 					return NewError("cannot convert the type '%s' to type 'int64'", args[0].Type())
 				}
@@ -141,10 +135,8 @@ var Builtins = []struct {
 					return arg
 				case *Uint64:
 					return &Uint{Value: uint(arg.Value)}
-				case *Byte:
-					return &Uint{Value: uint(arg.Value)}
-				case *Rune:
-					return &Uint{Value: uint(arg.Value)}
+				case *Float32, *Float64:
+					return &Uint{Value: uint(arg.(Float).Float())}
 				default:
 					return NewError("cannot convert the type '%s' to type 'uint'", args[0].Type())
 				}
@@ -165,10 +157,8 @@ var Builtins = []struct {
 					return arg
 				case *Uint64:
 					return &Uint8{Value: uint8(arg.Value)}
-				case *Byte:
-					return &Uint8{Value: arg.Value}
-				case *Rune:
-					return &Uint8{Value: uint8(arg.Value)}
+				case *Float32, *Float64:
+					return &Uint8{Value: uint8(arg.(Float).Float())}
 				default:
 					return NewError("cannot convert the type '%s' to type 'uint8'", args[0].Type())
 				}
@@ -189,10 +179,8 @@ var Builtins = []struct {
 					return arg
 				case *Uint64:
 					return &Uint16{Value: uint16(arg.Value)}
-				case *Byte:
-					return &Uint16{Value: uint16(arg.Value)}
-				case *Rune:
-					return &Uint16{Value: uint16(arg.Value)}
+				case *Float32, *Float64:
+					return &Uint16{Value: uint16(arg.(Float).Float())}
 				default:
 					return NewError("cannot convert the type '%s' to type 'uint16'", args[0].Type())
 				}
@@ -213,10 +201,8 @@ var Builtins = []struct {
 					return arg
 				case *Uint64:
 					return &Uint32{Value: uint32(arg.Value)}
-				case *Byte:
-					return &Uint32{Value: uint32(arg.Value)}
-				case *Rune:
-					return &Uint32{Value: uint32(arg.Value)}
+				case *Float32, *Float64:
+					return &Uint32{Value: uint32(arg.(Float).Float())}
 				default:
 					return NewError("cannot convert the type '%s' to type 'uint32'", args[0].Type())
 				}
@@ -235,10 +221,8 @@ var Builtins = []struct {
 					return &Uint64{Value: uint64(arg.(Integer).Integer())}
 				case *Uint64:
 					return arg
-				case *Byte:
-					return &Uint64{Value: uint64(arg.Value)}
-				case *Rune:
-					return &Uint64{Value: uint64(arg.Value)}
+				case *Float32, *Float64:
+					return &Uint64{Value: uint64(arg.(Float).Float())}
 				default:
 					return NewError("cannot convert the type '%s' to type 'uint64'", args[0].Type())
 				}
@@ -257,10 +241,8 @@ var Builtins = []struct {
 					return &Byte{Value: uint8(arg.(Integer).Integer())}
 				case *Uint64:
 					return &Byte{Value: uint8(arg.Value)}
-				case *Byte:
-					return arg
-				case *Rune:
-					return &Uint8{Value: uint8(arg.Value)}
+				case *Float32, *Float64:
+					return &Byte{Value: uint8(arg.(Float).Float())}
 				default:
 					return NewError("cannot convert the type '%s' to type 'byte'", args[0].Type())
 				}
@@ -283,10 +265,6 @@ var Builtins = []struct {
 					return arg
 				case *Float64:
 					return &Float32{Value: float32(arg.Value)}
-				case *Byte:
-					return &Float32{Value: float32(arg.Value)}
-				case *Rune:
-					return &Float32{Value: float32(arg.Value)}
 				default:
 					return NewError("cannot convert the type '%s' to type 'float32'", args[0].Type())
 				}
@@ -309,10 +287,6 @@ var Builtins = []struct {
 					return &Float64{Value: float64(arg.Value)}
 				case *Float64:
 					return arg
-				case *Byte:
-					return &Float64{Value: float64(arg.Value)}
-				case *Rune:
-					return &Float64{Value: float64(arg.Value)}
 				default:
 					return NewError("cannot convert the type '%s' to type 'float64'", args[0].Type())
 				}
@@ -327,13 +301,15 @@ var Builtins = []struct {
 				if len(args) != 1 {
 					return NewError("wrong number of arguments. want=1, got=%d", len(args))
 				}
-				switch arg := args[0].(type) {
+				switch arg := Indexed(args[0]).(type) {
 				case *String:
 					return &Int{Value: len(arg.Value)}
 				case *Array:
 					return &Int{Value: len(arg.Elements)}
 				case *Hash:
-					return &Int{Value: len(arg.Pairs)}
+					return &Int{Value: arg.Len()}
+				case *Channel:
+					return &Int{Value: len(arg.Buffer)}
 				default:
 					return NewError("argument to 'len' not support, got %s", args[0].Type())
 				}
@@ -344,20 +320,15 @@ var Builtins = []struct {
 		"append", 1,
 		&Builtin{
 			Fn: func(args ...Object) Object {
-				if len(args) != 2 {
-					return NewError("wrong number of arguments. want=2, got=%d", len(args))
+				if len(args) == 0 {
+					return NewError("not enough arguments in call to append")
 				}
 				if args[0].Type() != ARRAY_OBJ {
 					return NewError("argument to 'append' must be array, got %s", args[0].Type())
 				}
+				// 容量足够时和原切片共享底层数组
 				array := args[0].(*Array)
-
-				length := len(array.Elements)
-				newElems := make([]Object, length+1, length+1)
-				copy(newElems, array.Elements)
-				newElems[length] = args[1]
-				array.Elements = newElems
-				return array
+				return &Array{ElemType: array.ElemType, Elements: append(array.Elements, args[1:]...)}
 			},
 		},
 	},
@@ -372,6 +343,388 @@ var Builtins = []struct {
 			},
 		},
 	},
+	{
+		"panic", 0,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. want=1, got=%d", len(args))
+				}
+				return &Error{Message: "panic: " + args[0].String(), Value: args[0]}
+			},
+		},
+	},
+	{
+		// recover 只在 defer 中有效，由 evaluator 和 vm 处理
+		"recover", 1,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return NULL
+			},
+		},
+	},
+	{
+		"cap", 1,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. want=1, got=%d", len(args))
+				}
+				switch arg := Indexed(args[0]).(type) {
+				case *Array:
+					return &Int{Value: cap(arg.Elements)}
+				case *Channel:
+					return &Int{Value: arg.Cap}
+				default:
+					return NewError("argument to 'cap' not support, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"close", 0,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. want=1, got=%d", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Channel:
+					if err := arg.Close(); err != nil {
+						return err
+					}
+					return nil
+				case *Null:
+					return NewPanic("close of nil channel")
+				default:
+					return NewError("invalid operation: non-chan type %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"copy", 1,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return NewError("wrong number of arguments. want=2, got=%d", len(args))
+				}
+				dst, ok := args[0].(*Array)
+				if !ok {
+					return NewError("invalid argument: copy expects slice arguments, got %s", args[0].Type())
+				}
+				switch src := args[1].(type) {
+				case *Array:
+					return &Int{Value: copy(dst.Elements, src.Elements)}
+				case *String:
+					n := 0
+					for ; n < len(dst.Elements) && n < len(src.Value); n++ {
+						dst.Elements[n] = &Uint8{Value: src.Value[n]}
+					}
+					return &Int{Value: n}
+				default:
+					return NewError("invalid argument: copy expects slice arguments, got %s", args[1].Type())
+				}
+			},
+		},
+	},
+	{
+		"rune", 1,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. want=1, got=%d", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Int, *Int8, *Int16, *Int32, *Int64, *Uint, *Uint8, *Uint16, *Uint32:
+					return &Rune{Value: int32(arg.(Integer).Integer())}
+				case *Uint64:
+					return &Rune{Value: int32(arg.Value)}
+				case *Float32, *Float64:
+					return &Rune{Value: int32(arg.(Float).Float())}
+				default:
+					return NewError("cannot convert the type '%s' to type 'rune'", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"string", 1,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. want=1, got=%d", len(args))
+				}
+				return ConvertToString(args[0])
+			},
+		},
+	},
+	{
+		"delete", 0,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return NewError("wrong number of arguments. want=2, got=%d", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Hash:
+					if !arg.KeyAssignable(args[1]) {
+						return NewError("cannot use %s as %s value in argument to delete", args[1].Type(), arg.KeyType)
+					}
+					if _, err := HashOf(args[1]); err != nil {
+						return err
+					}
+					arg.Delete(args[1])
+					return nil
+				case *Null:
+					return nil
+				default:
+					return NewError("invalid argument: %s is not a map", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"clear", 0,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. want=1, got=%d", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Hash:
+					clear(arg.Pairs)
+					return nil
+				case *Array:
+					// 切片的元素置为零值，长度不变
+					for i, elem := range arg.Elements {
+						arg.Elements[i] = zeroOf(elem)
+					}
+					return nil
+				case *Null:
+					return nil
+				default:
+					return NewError("invalid argument: clear expects a map or slice, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"min", 1,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return ordered("min", args, func(x, y Object) bool { return Less(y, x) })
+			},
+		},
+	},
+	{
+		"max", 1,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return ordered("max", args, Less)
+			},
+		},
+	},
+	{
+		"print", 0,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				for _, arg := range args {
+					fmt.Print(arg)
+				}
+				return nil
+			},
+		},
+	},
+	{
+		// make 和 new 的参数是类型，由 compiler 和 evaluator 处理
+		"make", 1,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return NewError("make must be called with a type")
+			},
+		},
+	},
+	{
+		"new", 1,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return NewError("new must be called with a type")
+			},
+		},
+	},
+	{
+		"complex", 1,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return NewError("wrong number of arguments. want=2, got=%d", len(args))
+				}
+				re, ok1 := args[0].(Float)
+				im, ok2 := args[1].(Float)
+				if !ok1 || !ok2 || args[0].Type() != args[1].Type() {
+					return NewError("invalid argument: mismatched types %s and %s in complex", args[0].Type(), args[1].Type())
+				}
+				if args[0].Type() == FLOAT32_OBJ {
+					return &Complex64{Value: complex(float32(re.Float()), float32(im.Float()))}
+				}
+				return &Complex128{Value: complex(re.Float(), im.Float())}
+			},
+		},
+	},
+	{
+		"real", 1,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return complexPart("real", args, func(c complex128) float64 { return real(c) })
+			},
+		},
+	},
+	{
+		"imag", 1,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return complexPart("imag", args, func(c complex128) float64 { return imag(c) })
+			},
+		},
+	},
+	{
+		"complex64", 1,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return convertComplex(COMPLEX64_OBJ, args)
+			},
+		},
+	},
+	{
+		"complex128", 1,
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return convertComplex(COMPLEX128_OBJ, args)
+			},
+		},
+	},
+}
+
+// complexPart real 和 imag，complex64 的结果是 float32
+func complexPart(name string, args []Object, part func(complex128) float64) Object {
+	if len(args) != 1 {
+		return NewError("wrong number of arguments. want=1, got=%d", len(args))
+	}
+	c, ok := args[0].(Complex)
+	if !ok {
+		return NewError("invalid argument: %s must be of complex type in %s", args[0].Type(), name)
+	}
+	if args[0].Type() == COMPLEX64_OBJ {
+		return &Float32{Value: float32(part(c.Complex()))}
+	}
+	return &Float64{Value: part(c.Complex())}
+}
+
+// convertComplex 复数类型之间的转换，常量参数也可以是整数或浮点数
+func convertComplex(t ObjectType, args []Object) Object {
+	if len(args) != 1 {
+		return NewError("wrong number of arguments. want=1, got=%d", len(args))
+	}
+	switch args[0].(type) {
+	case Complex, Float, Integer:
+		return ConvertValueWithType(args[0], GetDefaultObject(t.String()))
+	default:
+		return NewError("cannot convert the type '%s' to type '%s'", args[0].Type(), t)
+	}
+}
+
+// TypedBuiltin 参数和结果类型相关的内置函数，常量参数按其他参数的类型转换
+func TypedBuiltin(name string) bool {
+	switch name {
+	case "min", "max", "complex", "real", "imag":
+		return true
+	}
+	return false
+}
+
+// IntBuiltin 结果为 int 的内置函数
+func IntBuiltin(name string) bool {
+	switch name {
+	case "len", "cap", "copy":
+		return true
+	}
+	return false
+}
+
+// BuiltinArgType 参数全是常量时内置函数参数的类型，complex 的参数是浮点数，real 和 imag 的参数是复数
+func BuiltinArgType(name string, exprs []ast.Expr, scope ConstScope) Object {
+	typ := ConstArgsType(exprs, scope)
+	switch name {
+	case "complex":
+		if typ == nil || !typ.Type().IsFloat() {
+			return &Float64{}
+		}
+	case "real", "imag":
+		if typ == nil || !typ.Type().IsComplex() {
+			return &Complex128{}
+		}
+	}
+	return typ
+}
+
+// BuiltinResultType 内置函数的结果类型，typ 为参数的类型
+func BuiltinResultType(name string, typ Object) Object {
+	switch name {
+	case "complex":
+		if typ.Type() == FLOAT32_OBJ {
+			return &Complex64{}
+		}
+		return &Complex128{}
+	case "real", "imag":
+		if typ.Type() == COMPLEX64_OBJ {
+			return &Float32{}
+		}
+		return &Float64{}
+	default:
+		return typ
+	}
+}
+
+// zeroOf 与 v 同一类型的零值，切片字面量没有记录元素类型
+func zeroOf(v Object) Object {
+	switch v := v.(type) {
+	case *Struct:
+		fields := make([]Object, len(v.Fields))
+		for i, field := range v.Fields {
+			fields[i] = zeroOf(field)
+		}
+		return &Struct{StructType: v.StructType, Fields: fields}
+	case *Pointer:
+		return &Pointer{Elem: v.Elem}
+	case *Interface:
+		return &Interface{InterfaceType: v.InterfaceType}
+	}
+	if zero := GetDefaultObject(v.Type().String()); !IsError(zero) {
+		return zero
+	}
+	return NULL
+}
+
+// ordered min 和 max 的参数必须是同一种有序类型，replace(x, y) 为真时结果换成 y
+func ordered(name string, args []Object, replace func(x, y Object) bool) Object {
+	if len(args) == 0 {
+		return NewError("not enough arguments in call to %s", name)
+	}
+	result := args[0]
+	for _, arg := range args {
+		if arg.Type() != result.Type() {
+			return NewError("invalid argument: mismatched types %s and %s in %s", result.Type(), arg.Type(), name)
+		}
+		t := arg.Type()
+		if !t.IsInteger() && !t.IsFloat() && t != STRING_OBJ {
+			return NewError("invalid argument: %s cannot be ordered", t)
+		}
+		if replace(result, arg) {
+			result = arg
+		}
+	}
+	return result
 }
 
 type builtin struct {
@@ -400,3 +753,60 @@ func GetBuiltinReturnNum(name string) (int, bool) {
 	}
 	return 0, false
 }
+
+// builtinArity 参数个数固定的内置函数
+var builtinArity = map[string]int{
+	"len": 1, "cap": 1, "close": 1, "clear": 1, "real": 1, "imag": 1, "panic": 1,
+	"copy": 2, "delete": 2, "complex": 2,
+}
+
+// builtinArgKinds 内置函数第一个参数允许的类型，以及不满足时的错误
+var builtinArgKinds = map[string]struct {
+	kinds []ObjectType
+	msg   string
+}{
+	"len":    {[]ObjectType{STRING_OBJ, ARRAY_OBJ, HASH_OBJ, CHANNEL_OBJ}, "argument to 'len' not support, got %s"},
+	"cap":    {[]ObjectType{ARRAY_OBJ, CHANNEL_OBJ}, "argument to 'cap' not support, got %s"},
+	"append": {[]ObjectType{ARRAY_OBJ}, "argument to 'append' must be array, got %s"},
+	"copy":   {[]ObjectType{ARRAY_OBJ}, "invalid argument: copy expects slice arguments, got %s"},
+	"delete": {[]ObjectType{HASH_OBJ}, "invalid argument: %s is not a map"},
+	"clear":  {[]ObjectType{HASH_OBJ, ARRAY_OBJ}, "invalid argument: clear expects a map or slice, got %s"},
+	"close":  {[]ObjectType{CHANNEL_OBJ}, "invalid operation: non-chan type %s"},
+}
+
+// CheckBuiltinArgs 编译时检查内置函数的参数，args 是参数的静态类型，未知时为 nil；
+// 接口、指针和类型参数要到运行时才能检查
+func CheckBuiltinArgs(name string, args []Object) error {
+	if want, ok := builtinArity[name]; ok && len(args) != want {
+		return fmt.Errorf("wrong number of arguments. want=%d, got=%d", want, len(args))
+	}
+	switch name {
+	case "append", "min", "max":
+		if len(args) == 0 {
+			return fmt.Errorf("not enough arguments in call to %s", name)
+		}
+	}
+	for i, arg := range args {
+		if arg == nil {
+			continue
+		}
+		t := Unnamed(arg).Type()
+		if !IsConstType(t) && t != ARRAY_OBJ && t != HASH_OBJ && t != CHANNEL_OBJ && t != STRUCT_OBJ {
+			continue
+		}
+		if name == "min" || name == "max" {
+			if !t.IsInteger() && !t.IsFloat() && t != STRING_OBJ {
+				return fmt.Errorf("invalid argument: %s cannot be ordered", t)
+			}
+			continue
+		}
+		allowed, ok := builtinArgKinds[name]
+		if !ok || i > 0 {
+			break
+		}
+		if !slices.Contains(allowed.kinds, t) {
+			return fmt.Errorf(allowed.msg, t)
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"go/ast"
 	"go/token"
+	"math"
 )
 
 var (
@@ -12,6 +13,7 @@ var (
 	FALSE    = &Boolean{Value: false}
 	CONTINUE = &Continue{}
 	BREAK    = &Break{}
+	RETURN   = &Return{}
 
 	PairToken = map[token.Token]token.Token{
 		token.ADD_ASSIGN:     token.ADD,
@@ -32,10 +34,24 @@ func NewError(format string, a ...any) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
 
+// NewPanic 运行时 panic，可以被 recover
+func NewPanic(format string, a ...any) *Error {
+	msg := fmt.Sprintf(format, a...)
+	return &Error{Message: msg, Value: &String{Value: msg}}
+}
+
 func IsError(obj Object) bool {
 	return obj != nil && obj.Type() == ERROR_OBJ
 }
 
+// PanicValue recover 得到的值，运行时错误返回错误信息
+func PanicValue(err *Error) Object {
+	if err.Value != nil {
+		return err.Value
+	}
+	return &String{Value: err.Message}
+}
+
 func ConvertToInt(oType ObjectType, val int64) Object {
 	var obj Object
 	switch oType {
@@ -78,6 +94,19 @@ func ConvertToFloat(oType ObjectType, val float64) Object {
 	return obj
 }
 
+func ConvertToComplex(oType ObjectType, val complex128) Object {
+	var obj Object
+	switch oType {
+	case COMPLEX64_OBJ:
+		obj = &Complex64{Value: complex64(val)}
+	case COMPLEX128_OBJ:
+		obj = &Complex128{Value: val}
+	default:
+		obj = NewError("complex no support %s", oType)
+	}
+	return obj
+}
+
 func ConvertToBoolean(b bool) Object {
 	if b {
 		return TRUE
@@ -86,22 +115,105 @@ func ConvertToBoolean(b bool) Object {
 	}
 }
 
-func GetDefaultValueWithExpr(expr ast.Expr) Object {
+type TypeResolver interface {
+	ResolveType(name string) (Object, bool)
+}
+
+func GetDefaultValueWithExpr(expr ast.Expr, resolver TypeResolver) Object {
 	switch expr := expr.(type) {
 	case *ast.Ident:
-		return GetDefaultObject(expr.Name)
+		obj := GetDefaultObject(expr.Name)
+		if IsError(obj) && resolver != nil {
+			if typ, ok := resolver.ResolveType(expr.Name); ok {
+				return GetDefaultValueWithType(typ, resolver)
+			}
+		}
+		return obj
 	case *ast.ArrayType:
-		elem := GetDefaultValueWithExpr(expr.Elt)
-		return &Array{ElemType: elem.Type()}
+		elem := GetDefaultValueWithExpr(expr.Elt, resolver)
+		if IsError(elem) || expr.Len == nil {
+			return &Array{ElemType: elem.Type()}
+		}
+		n, err := ArrayLen(expr.Len, resolver)
+		if err != nil {
+			return NewError("%s", err)
+		}
+		return ArrayOf(elem, n)
 	case *ast.MapType:
-		key := GetDefaultValueWithExpr(expr.Key)
-		value := GetDefaultValueWithExpr(expr.Value)
+		key := GetDefaultValueWithExpr(expr.Key, resolver)
+		value := GetDefaultValueWithExpr(expr.Value, resolver)
 		return &Hash{KeyType: key.Type(), ValueType: value.Type()}
+	case *ast.StructType:
+		return NewStructType("", expr).Zero(resolver)
+	case *ast.InterfaceType:
+		it := NewInterfaceType("", expr)
+		if resolver != nil {
+			if err := it.ResolveEmbeds(resolver); err != nil {
+				return NewError("%s", err)
+			}
+		}
+		return &Interface{InterfaceType: it}
+	case *ast.ChanType:
+		return &Channel{Elem: GetDefaultValueWithExpr(expr.Value, resolver)}
+	case *ast.FuncType:
+		return ParseFuncType(expr)
+	case *ast.StarExpr:
+		// 指向命名类型时不展开，结构体可以包含指向自身的指针
+		if ident, ok := expr.X.(*ast.Ident); ok && resolver != nil {
+			if typ, ok := resolver.ResolveType(ident.Name); ok {
+				if arg, ok := typ.(*TypeArg); ok {
+					return &Pointer{Elem: pointerElem(arg.Zero)}
+				}
+				return &Pointer{Elem: typ}
+			}
+		}
+		switch expr.X.(type) {
+		case *ast.IndexExpr, *ast.IndexListExpr:
+			st, err := InstantiateExpr(expr.X, resolver)
+			if err != nil {
+				return NewError("%s", err)
+			}
+			return &Pointer{Elem: st}
+		}
+		return &Pointer{Elem: GetDefaultValueWithExpr(expr.X, resolver)}
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		st, err := InstantiateExpr(expr, resolver)
+		if err != nil {
+			return NewError("%s", err)
+		}
+		return st.Zero(resolver)
+	case *ast.ParenExpr:
+		return GetDefaultValueWithExpr(expr.X, resolver)
 	default:
 		return NewError("GetDefaultValueWithExpr not support %T", expr)
 	}
 }
 
+func GetDefaultValueWithType(typ Object, resolver TypeResolver) Object {
+	switch typ := typ.(type) {
+	case *StructType:
+		return typ.Zero(resolver)
+	case *InterfaceType:
+		return &Interface{InterfaceType: typ}
+	case *TypeArg:
+		return CopyValue(typ.Zero)
+	case *NamedType:
+		return typ.Zero(resolver)
+	case *GenericType:
+		return NewError("cannot use generic type %s without instantiation", typ)
+	default:
+		return NewError("not known type: %s", typ)
+	}
+}
+
+// pointerElem 指针保存的指向类型，命名结构体用类型本身表示
+func pointerElem(zero Object) Object {
+	if s, ok := zero.(*Struct); ok && s.StructType.Name != "" {
+		return s.StructType
+	}
+	return zero
+}
+
 func GetDefaultObject(objType string) Object {
 	switch objType {
 	case "int":
@@ -132,10 +244,16 @@ func GetDefaultObject(objType string) Object {
 		return &Byte{Value: 0}
 	case "rune":
 		return &Rune{Value: 0}
+	case "complex64":
+		return &Complex64{}
+	case "complex128":
+		return &Complex128{}
 	case "string":
 		return &String{Value: ""}
 	case "bool":
 		return &Boolean{Value: false}
+	case "any":
+		return &Interface{InterfaceType: AnyType}
 	default:
 		return NewError("not known type: %s", objType)
 	}
@@ -145,19 +263,48 @@ func ConvertValueWithType(valObj, typeObj Object) Object {
 	if typeObj == nil {
 		return valObj
 	}
+	if n, ok := typeObj.(*Named); ok {
+		if NamedTypeOf(valObj) == n.NamedType {
+			return valObj
+		}
+		value := ConvertValueWithType(Unnamed(valObj), n.Value)
+		if IsError(value) {
+			return value
+		}
+		return n.NamedType.Wrap(value)
+	}
 	toType := typeObj.Type()
+	if toType != INTERFACE_OBJ {
+		valObj = Unnamed(valObj)
+	}
 	if toType.IsInteger() {
 		if tmp, ok := valObj.(Integer); ok {
 			return ConvertToInt(toType, tmp.Integer())
+		} else if tmp, ok := valObj.(Float); ok && tmp.Float() == math.Trunc(tmp.Float()) {
+			// 整数值的浮点常量可以赋给整数类型
+			return ConvertToInt(toType, int64(tmp.Float()))
 		} else {
 			return NewError("cannot convert (untyped '%s' constant) to type %s", valObj.Type(), toType)
 		}
 	} else if toType.IsFloat() {
 		if tmp, ok := valObj.(Float); ok {
 			return ConvertToFloat(toType, tmp.Float())
+		} else if tmp, ok := valObj.(Integer); ok {
+			return ConvertToFloat(toType, float64(tmp.Integer()))
 		} else {
 			return NewError("cannot convert (untyped '%s' constant) to type %s", valObj.Type(), toType)
 		}
+	} else if toType.IsComplex() {
+		switch tmp := valObj.(type) {
+		case Complex:
+			return ConvertToComplex(toType, tmp.Complex())
+		case Float:
+			return ConvertToComplex(toType, complex(tmp.Float(), 0))
+		case Integer:
+			return ConvertToComplex(toType, complex(float64(tmp.Integer()), 0))
+		default:
+			return NewError("cannot convert (untyped '%s' constant) to type %s", valObj.Type(), toType)
+		}
 	} else if toType == STRING_OBJ {
 		if valObj.Type() == STRING_OBJ {
 			return valObj
@@ -170,27 +317,63 @@ func ConvertValueWithType(valObj, typeObj Object) Object {
 		} else {
 			return NewError("cannot convert (untyped '%s' constant) to type bool", valObj.Type())
 		}
+	} else if toType == POINTER_OBJ {
+		if valObj == NULL {
+			return &Pointer{Elem: typeObj.(*Pointer).Elem}
+		}
+		if valObj.Type() != POINTER_OBJ {
+			return NewError("cannot convert (untyped '%s' constant) to type %s", valObj.Type(), TypeName(typeObj))
+		}
+		return valObj
 	} else if toType == ARRAY_OBJ {
-		array := &Array{ElemType: typeObj.(*Array).ElemType}
+		typ := typeObj.(*Array)
+		if arr, ok := valObj.(*Array); ok && arr.SameType(typ) {
+			return arr
+		}
+		if arr, ok := valObj.(*Array); (ok && arr.Fixed) || typ.Fixed {
+			if valObj == nil {
+				return typ.Copy()
+			}
+			return NewError("cannot use (value of type %s) as %s value", TypeName(valObj), TypeName(typ))
+		}
+		array := &Array{ElemType: typ.ElemType}
 		array.Elements = []Object{}
 		if valObj != nil {
 			defObj := GetDefaultObject(array.ElemType.String())
-			for _, elem := range valObj.(*Array).Elements {
-				tmp := ConvertValueWithType(elem, defObj)
-				array.Elements = append(array.Elements, tmp)
+			elements := valObj.(*Array).Elements
+			array.Elements = make([]Object, len(elements))
+			for i, elem := range elements {
+				array.Elements[i] = ConvertValueWithType(elem, defObj)
 			}
 		}
 		return array
+	} else if toType == INTERFACE_OBJ {
+		it := typeObj.(*Interface).InterfaceType
+		value := Underlying(valObj)
+		if value == NULL {
+			return &Interface{InterfaceType: it}
+		}
+		if msg := it.Missing(value); msg != "" {
+			return NewError("cannot use (value of type %s) as %s value: %s", TypeName(value), it, msg)
+		}
+		return &Interface{InterfaceType: it, Value: CopyValue(value)}
+	} else if toType == STRUCT_OBJ {
+		if valObj.Type() == STRUCT_OBJ && valObj.(*Struct).StructType == typeObj.(*Struct).StructType {
+			return valObj
+		} else {
+			return NewError("cannot use (value of type %s) as %s value", valObj.Type(), typeObj.(*Struct).StructType)
+		}
 	} else if toType == HASH_OBJ {
-		hash := &Hash{KeyType: typeObj.(*Hash).KeyType, ValueType: typeObj.(*Hash).ValueType}
-		hash.Pairs = map[HashKey]HashPair{}
+		hash := NewHash(typeObj.(*Hash).KeyType, typeObj.(*Hash).ValueType)
 		if valObj != nil {
 			defKObj := GetDefaultObject(hash.KeyType.String())
 			defVObj := GetDefaultObject(hash.ValueType.String())
-			for _, pair := range valObj.(*Hash).Pairs {
+			for _, pair := range valObj.(*Hash).Entries() {
 				k := ConvertValueWithType(pair.Key, defKObj)
 				v := ConvertValueWithType(pair.Value, defVObj)
-				hash.Pairs[k.(Hashable).HashKey()] = HashPair{Key: k, Value: v}
+				if err := hash.Set(k, v); err != nil {
+					return err
+				}
 			}
 		}
 		return hash
@@ -198,22 +381,332 @@ func ConvertValueWithType(valObj, typeObj Object) Object {
 	return valObj
 }
 
-func GetDefaultValueFromElem(elemType ElemType) Object {
+func GetDefaultValueFromElem(elemType ElemType, resolver TypeResolver) Object {
 	switch elemType.TypeElem {
-	case ElemBase:
-		return GetDefaultObject(elemType.Type.Name)
+	case ElemBase, ElemPointer:
+		if elemType.Type != nil {
+			return GetDefaultValueWithExpr(elemType.Type, resolver)
+		}
+		// 指针参数取指向类型的零值
+		if star, ok := elemType.Expr.(*ast.StarExpr); ok {
+			return GetDefaultValueWithExpr(star.X, resolver)
+		}
+		return GetDefaultValueWithExpr(elemType.Expr, resolver)
 	case ElemArray:
-		elem := GetDefaultObject(elemType.Type.Name)
+		if ty, ok := elemType.Expr.(*ast.ArrayType); ok {
+			return GetDefaultValueWithExpr(ty, resolver)
+		}
+		elem := GetDefaultValueWithExpr(elemType.Type, resolver)
 		return &Array{ElemType: elem.Type()}
 	case ElemHash:
-		key := GetDefaultObject(elemType.Types[0].Name)
-		value := GetDefaultObject(elemType.Types[1].Name)
+		key := GetDefaultValueWithExpr(elemType.Types[0], resolver)
+		value := GetDefaultValueWithExpr(elemType.Types[1], resolver)
 		return &Hash{KeyType: key.Type(), ValueType: value.Type()}
+	case ElemFunc:
+		return ParseFuncType(elemType.Expr.(*ast.FuncType))
+	case ElemChan:
+		if ty, ok := elemType.Expr.(*ast.ChanType); ok {
+			return GetDefaultValueWithExpr(ty, resolver)
+		}
+		return &Channel{Elem: GetDefaultValueWithExpr(elemType.Type, resolver)}
 	default:
 		return nil
 	}
 }
 
+// Zero 类型的零值，接口、通道和函数为 nil
+func Zero(typ Object) Object {
+	switch typ := typ.(type) {
+	case *Interface:
+		if typ.Value == nil {
+			return NULL
+		}
+	case *Channel:
+		return NULL
+	case *Function:
+		if typ.Body == nil {
+			return NULL
+		}
+	}
+	return CopyValue(typ)
+}
+
+// MakeSlice make([]T, length, capacity)，容量内的元素都初始化为零值
+func MakeSlice(elem Object, length, capacity int) Object {
+	if length < 0 {
+		return NewPanic("makeslice: len out of range")
+	}
+	if capacity < length {
+		return NewPanic("makeslice: cap out of range")
+	}
+	elems := make([]Object, capacity)
+	for i := range elems {
+		elems[i] = Zero(elem)
+	}
+	return &Array{ElemType: elem.Type(), Elements: elems[:length]}
+}
+
+// Slice 切片表达式 x[low:high:max]，缺省的下标为 nil
+func Slice(x, low, high, max Object) Object {
+	switch x := x.(type) {
+	case *Array:
+		l, h, m := 0, len(x.Elements), cap(x.Elements)
+		if max != nil {
+			m = sliceIndex(max)
+			if m < 0 || m > cap(x.Elements) {
+				return NewPanic("slice bounds out of range [::%d] with capacity %d", m, cap(x.Elements))
+			}
+		}
+		if high != nil {
+			h = sliceIndex(high)
+			if h < 0 || h > m {
+				if max != nil {
+					return NewPanic("slice bounds out of range [:%d:%d]", h, m)
+				}
+				return NewPanic("slice bounds out of range [:%d] with capacity %d", h, m)
+			}
+		}
+		if low != nil {
+			l = sliceIndex(low)
+		}
+		if l < 0 || l > h {
+			return NewPanic("slice bounds out of range [%d:%d]", l, h)
+		}
+		return &Array{ElemType: x.ElemType, Elements: x.Elements[l:h:m]}
+	case *String:
+		if max != nil {
+			return NewError("invalid operation: 3-index slice of string")
+		}
+		l, h := 0, len(x.Value)
+		if high != nil {
+			h = sliceIndex(high)
+			if h < 0 || h > len(x.Value) {
+				return NewPanic("slice bounds out of range [:%d] with length %d", h, len(x.Value))
+			}
+		}
+		if low != nil {
+			l = sliceIndex(low)
+		}
+		if l < 0 || l > h {
+			return NewPanic("slice bounds out of range [%d:%d]", l, h)
+		}
+		return &String{Value: x.Value[l:h]}
+	default:
+		return NewError("cannot slice (variable of type %s)", TypeName(x))
+	}
+}
+
+func sliceIndex(obj Object) int {
+	if i, ok := obj.(Integer); ok {
+		return int(i.Integer())
+	}
+	return -1
+}
+
+func CopyValue(obj Object) Object {
+	switch obj := obj.(type) {
+	case *Struct:
+		return obj.Copy()
+	case *Array:
+		if obj.Fixed {
+			return obj.Copy()
+		}
+		return obj
+	case *Named:
+		if value := CopyValue(obj.Value); value != obj.Value {
+			return &Named{NamedType: obj.NamedType, Value: value}
+		}
+		return obj
+	default:
+		return obj
+	}
+}
+
+func Equal(left, right Object) bool {
+	left, right = Underlying(left), Underlying(right)
+	if NamedTypeOf(left) != NamedTypeOf(right) {
+		return false
+	}
+	left, right = Unnamed(left), Unnamed(right)
+	if IsNil(left) || IsNil(right) {
+		return IsNil(left) && IsNil(right)
+	}
+	if left.Type() != right.Type() {
+		return false
+	}
+	switch {
+	case left.Type().IsInteger():
+		return left.(Integer).Integer() == right.(Integer).Integer()
+	case left.Type().IsFloat():
+		return left.(Float).Float() == right.(Float).Float()
+	case left.Type().IsComplex():
+		return left.(Complex).Complex() == right.(Complex).Complex()
+	case left.Type() == BOOLEAN_OBJ:
+		return left.(*Boolean).Value == right.(*Boolean).Value
+	case left.Type() == STRING_OBJ:
+		return left.(*String).Value == right.(*String).Value
+	case left.Type() == NULL_OBJ:
+		return true
+	case left.Type() == STRUCT_OBJ:
+		ls, rs := left.(*Struct), right.(*Struct)
+		if ls.StructType != rs.StructType {
+			return false
+		}
+		for i := range ls.Fields {
+			if !Equal(ls.Fields[i], rs.Fields[i]) {
+				return false
+			}
+		}
+		return true
+	case left.Type() == ARRAY_OBJ:
+		la, ra := left.(*Array), right.(*Array)
+		if !la.Fixed || !la.SameType(ra) {
+			return left == right
+		}
+		for i := range la.Elements {
+			if !Equal(la.Elements[i], ra.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case left.Type() == POINTER_OBJ:
+		return left.(*Pointer).Ref == right.(*Pointer).Ref
+	default:
+		return left == right
+	}
+}
+
+// Less 比较同一种有序类型的两个值，整数、浮点数和字符串
+func Less(left, right Object) bool {
+	left, right = Unnamed(left), Unnamed(right)
+	switch left := left.(type) {
+	case *Uint64:
+		return left.Value < right.(*Uint64).Value
+	case Integer:
+		return left.Integer() < right.(Integer).Integer()
+	case Float:
+		return left.Float() < right.(Float).Float()
+	case *String:
+		return left.Value < right.(*String).Value
+	default:
+		return false
+	}
+}
+
+// IsNil nil 和空指针
+func IsNil(obj Object) bool {
+	if p, ok := obj.(*Pointer); ok {
+		return p.IsNil()
+	}
+	return obj == NULL
+}
+
+// Underlying 接口值返回其动态值
+func Underlying(obj Object) Object {
+	if iface, ok := obj.(*Interface); ok {
+		return iface.Unwrap()
+	}
+	return obj
+}
+
+func TypeName(obj Object) string {
+	switch obj := obj.(type) {
+	case *Struct:
+		return obj.StructType.String()
+	case *Named:
+		return obj.NamedType.Name
+	case *Interface:
+		return obj.InterfaceType.String()
+	case *Array:
+		if obj.Fixed {
+			return fmt.Sprintf("[%d]%s", len(obj.Elements), obj.ElemType)
+		}
+		return "[]" + obj.ElemType.String()
+	case *Hash:
+		return fmt.Sprintf("map[%s]%s", obj.KeyType, obj.ValueType)
+	case *Channel:
+		return "chan " + TypeName(obj.Elem)
+	case *Pointer:
+		return "*" + TypeName(obj.Elem)
+	case *StructType, *InterfaceType, *GenericType, *NamedType:
+		return obj.String()
+	case *Null:
+		return "nil"
+	default:
+		return obj.Type().String()
+	}
+}
+
+// TypeOf 类型表达式用该类型的零值表示
+func TypeOf(expr ast.Expr, resolver TypeResolver) Object {
+	if ident, ok := expr.(*ast.Ident); ok && resolver != nil {
+		if typ, ok := resolver.ResolveType(ident.Name); ok {
+			return GetDefaultValueWithType(typ, resolver)
+		}
+	}
+	return GetDefaultValueWithExpr(expr, resolver)
+}
+
+// AssertType 判断 value 的动态类型是否为 typ
+func AssertType(value, typ Object) (Object, bool) {
+	value = Underlying(value)
+	if value == nil || value == NULL {
+		return CopyValue(typ), false
+	}
+	switch typ := typ.(type) {
+	case *Interface:
+		if typ.InterfaceType.Missing(value) != "" {
+			return CopyValue(typ), false
+		}
+		return value, true
+	case *Struct:
+		s, ok := value.(*Struct)
+		if !ok || s.StructType != typ.StructType {
+			return CopyValue(typ), false
+		}
+		return s.Copy(), true
+	case *Named:
+		if NamedTypeOf(value) != typ.NamedType {
+			return CopyValue(typ), false
+		}
+		return CopyValue(value), true
+	case *Array:
+		array, ok := value.(*Array)
+		if !ok || !array.SameType(typ) {
+			return CopyValue(typ), false
+		}
+		return CopyValue(value), true
+	case *Hash:
+		hash, ok := value.(*Hash)
+		if !ok || hash.KeyType != typ.KeyType || hash.ValueType != typ.ValueType {
+			return typ, false
+		}
+		return value, true
+	case *Pointer:
+		p, ok := value.(*Pointer)
+		if !ok || TypeName(p.Elem) != TypeName(typ.Elem) {
+			return &Pointer{Elem: typ.Elem}, false
+		}
+		return value, true
+	default:
+		if value.Type() != typ.Type() {
+			return typ, false
+		}
+		return value, true
+	}
+}
+
+func AssertError(value, typ Object) *Error {
+	value = Underlying(value)
+	if value == NULL {
+		return NewError("interface conversion: interface is nil, not %s", TypeName(typ))
+	}
+	if iface, ok := typ.(*Interface); ok {
+		return NewError("interface conversion: %s is not %s: %s", TypeName(value), iface.InterfaceType, iface.InterfaceType.Missing(value))
+	}
+	return NewError("interface conversion: interface {} is %s, not %s", TypeName(value), TypeName(typ))
+}
+
 func IsTruthy(condition Object) bool {
 	if condition == TRUE {
 		return true
@@ -224,3 +717,31 @@ func IsTruthy(condition Object) bool {
 	}
 	return false
 }
+
+// ElemConstType 数组元素或 map 值的类型，不是数值、字符串等类型时为 nil
+func ElemConstType(obj Object) Object {
+	var typ ObjectType
+	switch obj := Indexed(obj).(type) {
+	case *Array:
+		typ = obj.ElemType
+	case *Hash:
+		typ = obj.ValueType
+	default:
+		return nil
+	}
+	if !IsConstType(typ) {
+		return nil
+	}
+	return GetDefaultObject(typ.String())
+}
+
+// Indexed 下标和 range 的操作数，命名类型按底层类型，指向定长数组的指针自动解引用
+func Indexed(obj Object) Object {
+	obj = Unnamed(obj)
+	if p, ok := obj.(*Pointer); ok && !p.IsNil() {
+		if array, ok := Unnamed(p.Load()).(*Array); ok && array.Fixed {
+			return array
+		}
+	}
+	return obj
+}
@@ -0,0 +1,800 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"math"
+)
+
+// Constant 常量在编译期求值，无类型常量保持任意精度，使用时才按上下文确定类型
+type Constant struct {
+	Value constant.Value
+	Typ   Object // 有类型常量的类型，无类型常量为 nil
+	Rune  bool   // 无类型的字符常量，默认类型为 rune
+}
+
+func (c *Constant) Type() ObjectType { return CONSTANT_OBJ }
+func (c *Constant) String() string   { return c.Value.ExactString() }
+
+// ConstScope 按名字查找已声明的常量
+type ConstScope interface {
+	Const(name string) (*Constant, bool)
+}
+
+// ConstError 常量求值的错误，Pos 为出错的表达式
+type ConstError struct {
+	Pos token.Pos
+	Msg string
+}
+
+func (e *ConstError) Error() string { return e.Msg }
+
+// ErrNotConstant 表达式中有非常量的部分，需要在运行时求值
+var ErrNotConstant = errors.New("is not constant")
+
+func constError(node ast.Node, format string, a ...any) error {
+	return &ConstError{Pos: node.Pos(), Msg: fmt.Sprintf(format, a...)}
+}
+
+// TypeName 常量的类型，如 int8、untyped int
+func (c *Constant) TypeName() string {
+	if c.Typ != nil {
+		return TypeName(c.Typ)
+	}
+	if c.Rune {
+		return "untyped rune"
+	}
+	switch c.Value.Kind() {
+	case constant.Bool:
+		return "untyped bool"
+	case constant.String:
+		return "untyped string"
+	case constant.Int:
+		return "untyped int"
+	case constant.Complex:
+		return "untyped complex"
+	default:
+		return "untyped float"
+	}
+}
+
+// Describe 错误信息中对常量表达式的描述
+func (c *Constant) Describe(expr ast.Expr) string {
+	s := types.ExprString(expr)
+	if c.Typ != nil {
+		return fmt.Sprintf("%s (constant %s of type %s)", s, c.Value, TypeName(c.Typ))
+	}
+	if s == c.Value.String() {
+		return fmt.Sprintf("%s (%s constant)", s, c.TypeName())
+	}
+	return fmt.Sprintf("%s (%s constant %s)", s, c.TypeName(), c.Value)
+}
+
+// DefaultType 有类型常量是它的类型，无类型常量是对应的默认类型
+func (c *Constant) DefaultType() Object {
+	if c.Typ != nil {
+		return c.Typ
+	}
+	if c.Rune {
+		return &Rune{}
+	}
+	switch c.Value.Kind() {
+	case constant.Bool:
+		return FALSE
+	case constant.String:
+		return &String{}
+	case constant.Int:
+		return &Int{}
+	case constant.Complex:
+		return &Complex128{}
+	default:
+		return &Float64{}
+	}
+}
+
+// Convert 把常量转换为 typ 类型的值，typ 为 nil 或接口时使用默认类型；
+// 不能表示时 reason 为 overflows、truncated 或 mismatched
+func (c *Constant) Convert(typ Object) (Object, string) {
+	if typ == nil || typ.Type() == INTERFACE_OBJ {
+		def := c.DefaultType()
+		v, reason := representable(c.Value, typeKind(def))
+		if reason != "" {
+			return nil, reason
+		}
+		obj := constObject(v, def)
+		if typ != nil {
+			obj = ConvertValueWithType(obj, typ)
+		}
+		return obj, ""
+	}
+	if c.Typ != nil && !sameKind(c.Typ, typ) {
+		return nil, "mismatched"
+	}
+	v, reason := representable(c.Value, typeKind(typ))
+	if reason != "" {
+		return nil, reason
+	}
+	return constObject(v, typ), ""
+}
+
+// Assign 常量赋值给 typ 类型，context 说明赋值发生的位置，如 variable declaration
+func (c *Constant) Assign(expr ast.Expr, typ Object, context string) (Object, error) {
+	obj, reason := c.Convert(typ)
+	if reason == "" {
+		return obj, nil
+	}
+	if typ == nil {
+		typ = c.DefaultType()
+	}
+	if reason == "mismatched" {
+		return nil, constError(expr, "cannot use %s as %s value in %s", c.Describe(expr), TypeName(typ), context)
+	}
+	return nil, constError(expr, "cannot use %s as %s value in %s (%s)", c.Describe(expr), TypeName(typ), context, reason)
+}
+
+// WithType 常量声明中指定了类型，得到该类型的常量
+func (c *Constant) WithType(expr ast.Expr, typ Object) (*Constant, error) {
+	if !IsConstType(typeKind(typ)) {
+		return nil, constError(expr, "invalid constant type %s", TypeName(typ))
+	}
+	if _, err := c.Assign(expr, typ, "constant declaration"); err != nil {
+		return nil, err
+	}
+	v, _ := representable(c.Value, typeKind(typ))
+	return &Constant{Value: v, Typ: typ}, nil
+}
+
+// typeKind 常量类型的种类，命名类型按底层类型
+func typeKind(typ Object) ObjectType {
+	return Unnamed(typ).Type()
+}
+
+// sameKind 两个常量类型相同，命名类型还要是同一个类型
+func sameKind(x, y Object) bool {
+	return typeKind(x) == typeKind(y) && NamedTypeOf(x) == NamedTypeOf(y)
+}
+
+// IsConstType 常量只能是布尔、数值和字符串类型
+func IsConstType(t ObjectType) bool {
+	return t.IsInteger() || t.IsFloat() || t.IsComplex() || t == STRING_OBJ || t == BOOLEAN_OBJ
+}
+
+func intRange(t ObjectType) (min, max constant.Value) {
+	var bits uint
+	signed := true
+	switch t {
+	case INT8_OBJ:
+		bits = 8
+	case INT16_OBJ:
+		bits = 16
+	case INT32_OBJ:
+		bits = 32
+	case INT_OBJ, INT64_OBJ:
+		bits = 64
+	case UINT8_OBJ:
+		bits, signed = 8, false
+	case UINT16_OBJ:
+		bits, signed = 16, false
+	case UINT32_OBJ:
+		bits, signed = 32, false
+	default:
+		bits, signed = 64, false
+	}
+	one := constant.MakeInt64(1)
+	if signed {
+		max = constant.BinaryOp(constant.Shift(one, token.SHL, bits-1), token.SUB, one)
+		min = constant.UnaryOp(token.SUB, constant.Shift(one, token.SHL, bits-1), 0)
+		return min, max
+	}
+	max = constant.BinaryOp(constant.Shift(one, token.SHL, bits), token.SUB, one)
+	return constant.MakeInt64(0), max
+}
+
+// representable 常量值能否用 t 类型表示，返回转换后的值
+func representable(v constant.Value, t ObjectType) (constant.Value, string) {
+	switch {
+	case t.IsInteger():
+		iv := constant.ToInt(v)
+		if iv.Kind() != constant.Int {
+			if v.Kind() == constant.Float {
+				return nil, "truncated"
+			}
+			return nil, "mismatched"
+		}
+		min, max := intRange(t)
+		if constant.Compare(iv, token.LSS, min) || constant.Compare(iv, token.GTR, max) {
+			return nil, "overflows"
+		}
+		return iv, ""
+	case t.IsFloat():
+		fv := constant.ToFloat(v)
+		if fv.Kind() != constant.Float {
+			return nil, "mismatched"
+		}
+		if t == FLOAT32_OBJ {
+			if f, _ := constant.Float32Val(fv); math.IsInf(float64(f), 0) {
+				return nil, "overflows"
+			}
+		} else if f, _ := constant.Float64Val(fv); math.IsInf(f, 0) {
+			return nil, "overflows"
+		}
+		return fv, ""
+	case t.IsComplex():
+		cv := constant.ToComplex(v)
+		if cv.Kind() != constant.Complex {
+			return nil, "mismatched"
+		}
+		return cv, ""
+	case t == STRING_OBJ:
+		if v.Kind() != constant.String {
+			return nil, "mismatched"
+		}
+		return v, ""
+	case t == BOOLEAN_OBJ:
+		if v.Kind() != constant.Bool {
+			return nil, "mismatched"
+		}
+		return v, ""
+	default:
+		return nil, "mismatched"
+	}
+}
+
+// constObject 已经检查过能表示的常量值转换为运行时的值
+func constObject(v constant.Value, typ Object) Object {
+	if n, ok := typ.(*Named); ok {
+		return n.NamedType.Wrap(constObject(v, n.Value))
+	}
+	t := typ.Type()
+	switch {
+	case t.IsInteger():
+		if _, ok := typ.(*Rune); ok {
+			i, _ := constant.Int64Val(v)
+			return &Rune{Value: int32(i)}
+		}
+		if _, ok := typ.(*Byte); ok {
+			i, _ := constant.Int64Val(v)
+			return &Byte{Value: uint8(i)}
+		}
+		if i, ok := constant.Int64Val(v); ok {
+			return ConvertToInt(t, i)
+		}
+		u, _ := constant.Uint64Val(v)
+		return ConvertToInt(t, int64(u))
+	case t.IsFloat():
+		f, _ := constant.Float64Val(v)
+		return ConvertToFloat(t, f)
+	case t.IsComplex():
+		re, _ := constant.Float64Val(constant.Real(v))
+		im, _ := constant.Float64Val(constant.Imag(v))
+		return ConvertToComplex(t, complex(re, im))
+	case t == STRING_OBJ:
+		return &String{Value: constant.StringVal(v)}
+	default:
+		return ConvertToBoolean(constant.BoolVal(v))
+	}
+}
+
+// UsesConst 表达式是否引用了具名常量或 iota，这样的表达式按常量规则求值
+func UsesConst(expr ast.Expr, scope ConstScope) bool {
+	found := false
+	ast.Inspect(expr, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FuncLit, *ast.CompositeLit, *ast.SelectorExpr:
+			return false
+		case *ast.Ident:
+			if _, ok := scope.Const(node.Name); ok || node.Name == "iota" {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// ConstOperand 字面量和引用了常量的表达式，运算时按另一侧操作数确定类型
+func ConstOperand(expr ast.Expr, scope ConstScope) bool {
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		return true
+	case *ast.ParenExpr:
+		return ConstOperand(expr.X, scope)
+	case *ast.UnaryExpr:
+		if expr.Op == token.SUB || expr.Op == token.ADD {
+			return ConstOperand(expr.X, scope)
+		}
+	}
+	return UsesConst(expr, scope)
+}
+
+// ConstBinary 两侧都是常量的运算，如 1 + 2i，整体按常量求值
+func ConstBinary(expr ast.Expr, scope ConstScope) bool {
+	switch expr := expr.(type) {
+	case *ast.ParenExpr:
+		return ConstBinary(expr.X, scope)
+	case *ast.BinaryExpr:
+		return (ConstOperand(expr.X, scope) || ConstBinary(expr.X, scope)) &&
+			(ConstOperand(expr.Y, scope) || ConstBinary(expr.Y, scope))
+	}
+	return false
+}
+
+// EvalConst 计算常量表达式，iota 小于 0 表示不在常量声明中；
+// 表达式不是常量时返回 ErrNotConstant
+func EvalConst(expr ast.Expr, scope ConstScope, iota int) (*Constant, error) {
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		v := constant.MakeFromLiteral(expr.Value, expr.Kind, 0)
+		if v.Kind() == constant.Unknown {
+			return nil, constError(expr, "invalid constant %s", expr.Value)
+		}
+		return &Constant{Value: v, Rune: expr.Kind == token.CHAR}, nil
+	case *ast.Ident:
+		if c, ok := scope.Const(expr.Name); ok {
+			return c, nil
+		}
+		switch expr.Name {
+		case "iota":
+			if iota < 0 {
+				return nil, constError(expr, "cannot use iota outside constant declaration")
+			}
+			return &Constant{Value: constant.MakeInt64(int64(iota))}, nil
+		case "true", "false":
+			return &Constant{Value: constant.MakeBool(expr.Name == "true")}, nil
+		}
+		return nil, ErrNotConstant
+	case *ast.ParenExpr:
+		return EvalConst(expr.X, scope, iota)
+	case *ast.UnaryExpr:
+		return evalConstUnary(expr, scope, iota)
+	case *ast.BinaryExpr:
+		return evalConstBinary(expr, scope, iota)
+	case *ast.CallExpr:
+		return evalConstCall(expr, scope, iota)
+	default:
+		return nil, ErrNotConstant
+	}
+}
+
+func evalConstUnary(expr *ast.UnaryExpr, scope ConstScope, iota int) (*Constant, error) {
+	x, err := EvalConst(expr.X, scope, iota)
+	if err != nil {
+		return nil, err
+	}
+	kind := x.Value.Kind()
+	var prec uint
+	switch expr.Op {
+	case token.ADD, token.SUB:
+		if kind != constant.Int && kind != constant.Float && kind != constant.Complex {
+			return nil, constError(expr, "invalid operation: operator %s not defined on %s", expr.Op, x.Describe(expr.X))
+		}
+	case token.XOR:
+		if kind != constant.Int {
+			return nil, constError(expr, "invalid operation: operator %s not defined on %s", expr.Op, x.Describe(expr.X))
+		}
+		// 无符号类型按位取反限制在类型的位数内
+		if x.Typ != nil {
+			switch typeKind(x.Typ) {
+			case UINT8_OBJ:
+				prec = 8
+			case UINT16_OBJ:
+				prec = 16
+			case UINT32_OBJ:
+				prec = 32
+			case UINT_OBJ, UINT64_OBJ:
+				prec = 64
+			}
+		}
+	case token.NOT:
+		if kind != constant.Bool {
+			return nil, constError(expr, "invalid operation: operator %s not defined on %s", expr.Op, x.Describe(expr.X))
+		}
+	default:
+		return nil, ErrNotConstant
+	}
+	c := &Constant{Value: constant.UnaryOp(expr.Op, x.Value, prec), Typ: x.Typ, Rune: x.Rune}
+	return c, c.checkOverflow(expr)
+}
+
+func evalConstBinary(expr *ast.BinaryExpr, scope ConstScope, iota int) (*Constant, error) {
+	x, err := EvalConst(expr.X, scope, iota)
+	if err != nil {
+		return nil, err
+	}
+	y, err := EvalConst(expr.Y, scope, iota)
+	if err != nil {
+		return nil, err
+	}
+
+	if expr.Op == token.SHL || expr.Op == token.SHR {
+		s, ok := constant.Uint64Val(constant.ToInt(y.Value))
+		if !ok || y.Value.Kind() == constant.Bool || y.Value.Kind() == constant.String {
+			return nil, constError(expr.Y, "invalid shift count %s", y.Describe(expr.Y))
+		}
+		v := constant.ToInt(x.Value)
+		if v.Kind() != constant.Int || (x.Typ != nil && !typeKind(x.Typ).IsInteger()) {
+			return nil, constError(expr.X, "invalid operation: shifted operand %s must be integer", x.Describe(expr.X))
+		}
+		c := &Constant{Value: constant.Shift(v, expr.Op, uint(s)), Typ: x.Typ, Rune: x.Rune}
+		return c, c.checkOverflow(expr)
+	}
+
+	// 有类型的操作数决定结果的类型，无类型的一方转换为该类型
+	typ := x.Typ
+	switch {
+	case x.Typ != nil && y.Typ != nil:
+		if !sameKind(x.Typ, y.Typ) {
+			return nil, constError(expr, "invalid operation: %s (mismatched types %s and %s)",
+				types.ExprString(expr), TypeName(x.Typ), TypeName(y.Typ))
+		}
+	case x.Typ != nil:
+		if y, err = y.convertOperand(expr.Y, x.Typ); err != nil {
+			return nil, err
+		}
+	case y.Typ != nil:
+		typ = y.Typ
+		if x, err = x.convertOperand(expr.X, y.Typ); err != nil {
+			return nil, err
+		}
+	}
+
+	xk, yk := x.Value.Kind(), y.Value.Kind()
+	numeric := isNumericKind(xk) && isNumericKind(yk)
+	if !numeric && xk != yk {
+		return nil, constError(expr, "invalid operation: %s (mismatched types %s and %s)",
+			types.ExprString(expr), x.TypeName(), y.TypeName())
+	}
+
+	switch expr.Op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		if (xk == constant.Bool || xk == constant.Complex || yk == constant.Complex) && expr.Op != token.EQL && expr.Op != token.NEQ {
+			return nil, constError(expr, "invalid operation: %s (operator %s not defined on %s)",
+				types.ExprString(expr), expr.Op, x.Describe(expr.X))
+		}
+		return &Constant{Value: constant.MakeBool(constant.Compare(x.Value, expr.Op, y.Value))}, nil
+	}
+
+	integer := xk == constant.Int && yk == constant.Int
+	if typ != nil {
+		integer = typeKind(typ).IsInteger()
+	}
+	op := expr.Op
+	switch op {
+	case token.ADD:
+		if xk == constant.Bool {
+			return nil, constError(expr, "invalid operation: operator %s not defined on %s", op, x.Describe(expr.X))
+		}
+	case token.SUB, token.MUL:
+		if !numeric {
+			return nil, constError(expr, "invalid operation: operator %s not defined on %s", op, x.Describe(expr.X))
+		}
+	case token.QUO:
+		if !numeric {
+			return nil, constError(expr, "invalid operation: operator %s not defined on %s", op, x.Describe(expr.X))
+		}
+		if constant.Sign(y.Value) == 0 {
+			return nil, constError(expr.Y, "invalid operation: division by zero")
+		}
+		if integer {
+			op = token.QUO_ASSIGN
+		}
+	case token.REM, token.AND, token.OR, token.XOR, token.AND_NOT:
+		if !integer {
+			return nil, constError(expr, "invalid operation: operator %s not defined on %s", op, x.Describe(expr.X))
+		}
+		if op == token.REM && constant.Sign(y.Value) == 0 {
+			return nil, constError(expr.Y, "invalid operation: division by zero")
+		}
+		x.Value, y.Value = constant.ToInt(x.Value), constant.ToInt(y.Value)
+	case token.LAND, token.LOR:
+		if xk != constant.Bool {
+			return nil, constError(expr, "invalid operation: operator %s not defined on %s", op, x.Describe(expr.X))
+		}
+	default:
+		return nil, ErrNotConstant
+	}
+
+	v := constant.BinaryOp(x.Value, op, y.Value)
+	if integer {
+		v = constant.ToInt(v)
+	}
+	c := &Constant{Value: v, Typ: typ, Rune: typ == nil && v.Kind() == constant.Int && (x.Rune || y.Rune)}
+	return c, c.checkOverflow(expr)
+}
+
+func isNumericKind(k constant.Kind) bool {
+	return k == constant.Int || k == constant.Float || k == constant.Complex
+}
+
+// convertOperand 和有类型常量运算时，无类型常量先转换为对方的类型
+func (c *Constant) convertOperand(expr ast.Expr, typ Object) (*Constant, error) {
+	v, reason := representable(c.Value, typeKind(typ))
+	switch reason {
+	case "":
+		return &Constant{Value: v, Typ: typ}, nil
+	case "mismatched":
+		return nil, constError(expr, "cannot convert %s to type %s", c.Describe(expr), TypeName(typ))
+	default:
+		return nil, constError(expr, "%s %s %s", c.Describe(expr), reason, TypeName(typ))
+	}
+}
+
+// checkOverflow 有类型常量的运算结果必须能用该类型表示
+func (c *Constant) checkOverflow(expr ast.Expr) error {
+	if c.Typ == nil {
+		return nil
+	}
+	v, reason := representable(c.Value, typeKind(c.Typ))
+	if reason != "" {
+		return constError(expr, "%s (constant %s of type %s) overflows %s",
+			types.ExprString(expr), c.Value, TypeName(c.Typ), TypeName(c.Typ))
+	}
+	c.Value = v
+	return nil
+}
+
+// evalConstCall 常量的类型转换，如 int8(x)，以及字符串常量的长度
+func evalConstCall(expr *ast.CallExpr, scope ConstScope, iota int) (*Constant, error) {
+	ident, ok := expr.Fun.(*ast.Ident)
+	if ok && (ident.Name == "min" || ident.Name == "max") && len(expr.Args) > 0 {
+		return evalConstOrdered(expr, ident.Name, scope, iota)
+	}
+	if ok && ident.Name == "complex" && len(expr.Args) == 2 {
+		return evalConstComplex(expr, scope, iota)
+	}
+	if ok && (ident.Name == "real" || ident.Name == "imag") && len(expr.Args) == 1 {
+		return evalConstPart(expr, ident.Name, scope, iota)
+	}
+	if !ok || len(expr.Args) != 1 {
+		return nil, ErrNotConstant
+	}
+	if ident.Name == "len" {
+		x, err := EvalConst(expr.Args[0], scope, iota)
+		if err != nil {
+			return nil, err
+		}
+		if x.Value.Kind() != constant.String {
+			return nil, ErrNotConstant
+		}
+		return &Constant{Value: constant.MakeInt64(int64(len(constant.StringVal(x.Value)))), Typ: &Int{}}, nil
+	}
+	typ := GetDefaultObject(ident.Name)
+	if resolver, ok := scope.(TypeResolver); ok && IsError(typ) {
+		if nt, ok := resolver.ResolveType(ident.Name); ok {
+			typ = GetDefaultValueWithType(nt, resolver)
+		}
+	}
+	if IsError(typ) || !IsConstType(typeKind(typ)) {
+		return nil, ErrNotConstant
+	}
+	x, err := EvalConst(expr.Args[0], scope, iota)
+	if err != nil {
+		return nil, err
+	}
+	t := typeKind(typ)
+	if t == STRING_OBJ && x.Value.Kind() == constant.Int {
+		// 整数转换为字符串得到对应的字符
+		r := rune(0xFFFD)
+		if i, ok := constant.Int64Val(x.Value); ok && i >= 0 && i <= math.MaxInt32 {
+			r = rune(i)
+		}
+		return &Constant{Value: constant.MakeString(string(r)), Typ: typ}, nil
+	}
+	v := x.Value
+	if t.IsFloat() && v.Kind() == constant.Int {
+		v = constant.ToFloat(v)
+	}
+	v, reason := representable(v, t)
+	switch reason {
+	case "":
+		return &Constant{Value: v, Typ: typ}, nil
+	case "overflows":
+		return nil, constError(expr, "constant %s overflows %s", x.Value, TypeName(typ))
+	case "truncated":
+		return nil, constError(expr, "cannot convert %s to type %s (truncated)", x.Describe(expr.Args[0]), TypeName(typ))
+	default:
+		return nil, constError(expr, "cannot convert %s to type %s", x.Describe(expr.Args[0]), TypeName(typ))
+	}
+}
+
+// evalConstComplex 实部和虚部都是常量的 complex(re, im)
+func evalConstComplex(expr *ast.CallExpr, scope ConstScope, iota int) (*Constant, error) {
+	var parts [2]*Constant
+	var typ Object
+	for i, arg := range expr.Args {
+		x, err := EvalConst(arg, scope, iota)
+		if err != nil {
+			return nil, err
+		}
+		mismatched := x.Typ != nil && (!x.Typ.Type().IsFloat() || (typ != nil && typ.Type() != x.Typ.Type()))
+		if constant.ToFloat(x.Value).Kind() != constant.Float || mismatched {
+			return nil, constError(arg, "invalid argument: arguments have type %s, expected floating-point", x.TypeName())
+		}
+		if x.Typ != nil {
+			typ = x.Typ
+		}
+		parts[i] = x
+	}
+	v := constant.BinaryOp(constant.ToFloat(parts[0].Value), token.ADD, constant.MakeImag(constant.ToFloat(parts[1].Value)))
+	var ctyp Object
+	switch {
+	case typ == nil:
+	case typ.Type() == FLOAT32_OBJ:
+		ctyp = &Complex64{}
+	default:
+		ctyp = &Complex128{}
+	}
+	return &Constant{Value: v, Typ: ctyp}, nil
+}
+
+// evalConstPart 复数常量的实部和虚部
+func evalConstPart(expr *ast.CallExpr, name string, scope ConstScope, iota int) (*Constant, error) {
+	x, err := EvalConst(expr.Args[0], scope, iota)
+	if err != nil {
+		return nil, err
+	}
+	v := constant.ToComplex(x.Value)
+	if v.Kind() != constant.Complex || (x.Typ != nil && !x.Typ.Type().IsComplex()) {
+		return nil, constError(expr.Args[0], "invalid argument: %s must be of complex type", x.Describe(expr.Args[0]))
+	}
+	part := constant.Real(v)
+	if name == "imag" {
+		part = constant.Imag(v)
+	}
+	var typ Object
+	switch {
+	case x.Typ == nil:
+	case x.Typ.Type() == COMPLEX64_OBJ:
+		typ = &Float32{}
+	default:
+		typ = &Float64{}
+	}
+	return &Constant{Value: constant.ToFloat(part), Typ: typ}, nil
+}
+
+// evalConstOrdered 参数全是常量的 min 和 max 也是常量
+func evalConstOrdered(expr *ast.CallExpr, name string, scope ConstScope, iota int) (*Constant, error) {
+	op := token.LSS
+	if name == "max" {
+		op = token.GTR
+	}
+	var result *Constant
+	for _, arg := range expr.Args {
+		x, err := EvalConst(arg, scope, iota)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = x
+			continue
+		}
+		if x.Typ != nil && result.Typ != nil && x.Typ.Type() != result.Typ.Type() {
+			return nil, constError(expr, "invalid argument: mismatched types %s and %s in %s", TypeName(result.Typ), TypeName(x.Typ), name)
+		}
+		if !constOrdered(x.Value) || !constOrdered(result.Value) {
+			return nil, constError(arg, "invalid argument: %s cannot be ordered", x.Describe(arg))
+		}
+		typ := result.Typ
+		if typ == nil {
+			typ = x.Typ
+		}
+		// 整数和浮点数常量比较时结果是浮点数
+		if x.Value.Kind() == constant.Float || result.Value.Kind() == constant.Float {
+			x = &Constant{Value: constant.ToFloat(x.Value), Typ: x.Typ}
+			result = &Constant{Value: constant.ToFloat(result.Value), Typ: result.Typ}
+		}
+		if constant.Compare(x.Value, op, result.Value) {
+			result = x
+		}
+		result = &Constant{Value: result.Value, Typ: typ, Rune: result.Rune}
+	}
+	return result, nil
+}
+
+func constOrdered(v constant.Value) bool {
+	switch v.Kind() {
+	case constant.Int, constant.Float, constant.String:
+		return true
+	}
+	return false
+}
+
+// ConstArgsType 参数全是常量时使用其中最宽的默认类型，min(1, 2.5) 的参数都是 float64，
+// 1 + 2i 的两个操作数都是 complex128
+func ConstArgsType(exprs []ast.Expr, scope ConstScope) Object {
+	var typ Object
+	for _, expr := range exprs {
+		c, err := EvalConst(expr, scope, -1)
+		if err != nil {
+			return nil
+		}
+		if def := c.DefaultType(); typ == nil || kindRank(def.Type()) > kindRank(typ.Type()) {
+			typ = def
+		}
+	}
+	return typ
+}
+
+// ArrayLen 数组类型 [n]T 的长度，必须是非负的整数常量
+func ArrayLen(expr ast.Expr, resolver TypeResolver) (int, error) {
+	if _, ok := expr.(*ast.Ellipsis); ok {
+		return 0, errors.New("invalid use of [...] array (outside a composite literal)")
+	}
+	var scope ConstScope = noConsts{}
+	if cs, ok := resolver.(ConstScope); ok {
+		scope = cs
+	}
+	c, err := EvalConst(expr, scope, -1)
+	if err == ErrNotConstant {
+		return 0, fmt.Errorf("array length %s must be constant", types.ExprString(expr))
+	}
+	if err != nil {
+		return 0, err
+	}
+	v := constant.ToInt(c.Value)
+	n, ok := constant.Int64Val(v)
+	if v.Kind() != constant.Int || !ok || n < 0 || n > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid array length %s", types.ExprString(expr))
+	}
+	return int(n), nil
+}
+
+// noConsts 没有常量的作用域
+type noConsts struct{}
+
+func (noConsts) Const(string) (*Constant, bool) { return nil, false }
+
+// kindRank 无类型常量混合运算时，整数 < rune < 浮点数 < 复数
+func kindRank(t ObjectType) int {
+	switch {
+	case t.IsComplex():
+		return 3
+	case t.IsFloat():
+		return 2
+	case t == INT32_OBJ:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// DeclareConsts 依次计算常量声明中的常量，省略的类型和表达式沿用上一行，iota 为行号
+func DeclareConsts(decl *ast.GenDecl, scope ConstScope, resolver TypeResolver, define func(name *ast.Ident, c *Constant) error) error {
+	var typ ast.Expr
+	var values []ast.Expr
+	for iota, spec := range decl.Specs {
+		spec := spec.(*ast.ValueSpec)
+		if spec.Values != nil || spec.Type != nil {
+			typ, values = spec.Type, spec.Values
+		}
+		for i, name := range spec.Names {
+			if i >= len(values) {
+				return constError(name, "missing init expr for const declaration")
+			}
+			c, err := EvalConst(values[i], scope, iota)
+			if err == ErrNotConstant {
+				return constError(values[i], "%s is not constant", types.ExprString(values[i]))
+			}
+			if err != nil {
+				return err
+			}
+			if typ != nil {
+				c, err = c.WithType(values[i], TypeOf(typ, resolver))
+				if err != nil {
+					return err
+				}
+			}
+			if err = define(name, c); err != nil {
+				return err
+			}
+		}
+		if len(values) > len(spec.Names) && spec.Values != nil {
+			return constError(values[len(spec.Names)], "extra init expr")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package object
+
+import (
+	"go/ast"
+)
+
+// ParseFuncType 函数签名，函数字面量和函数类型的参数共用
+func ParseFuncType(node *ast.FuncType) *Function {
+	var fn Function
+	if node.Params != nil {
+		for _, field := range node.Params.List {
+			fn.Params = append(fn.Params, parseFunArgType(field)...)
+			_, fn.Variadic = field.Type.(*ast.Ellipsis)
+		}
+	}
+	if node.Results != nil {
+		for _, field := range node.Results.List {
+			fn.Results = append(fn.Results, parseResultType(field)...)
+		}
+	}
+	fn.TypeParams = node.TypeParams
+	return &fn
+}
+
+// ConstResultType 只有一个返回值的函数调用的结果类型，不是数值、字符串等类型时为 nil
+func ConstResultType(obj Object, resolver TypeResolver) Object {
+	fn, ok := obj.(*Function)
+	if !ok || fn.TypeParams != nil || len(fn.Results) != 1 {
+		return nil
+	}
+	typ := GetDefaultValueFromElem(fn.Results[0].Type, resolver)
+	if typ == nil || !IsConstType(Unnamed(typ).Type()) {
+		return nil
+	}
+	return typ
+}
+
+func parseFunArgType(field *ast.Field) []FunArg {
+	var args []FunArg
+
+	typ := field.Type
+	if ellipsis, ok := typ.(*ast.Ellipsis); ok {
+		// 可变参数 ...T 在函数内是 []T
+		typ = &ast.ArrayType{Lbrack: ellipsis.Pos(), Elt: ellipsis.Elt}
+	}
+	elemType := parseElemType(typ)
+	if field.Names != nil {
+		for _, name := range field.Names {
+			arg := FunArg{Symbol: name, Type: elemType}
+			args = append(args, arg)
+		}
+	} else {
+		args = append(args, FunArg{Type: elemType})
+	}
+	return args
+}
+
+func parseResultType(field *ast.Field) []FunResult {
+	var results []FunResult
+
+	elemType := parseElemType(field.Type)
+	if field.Names != nil {
+		for _, name := range field.Names {
+			rt := FunResult{Symbol: name, Type: elemType}
+			results = append(results, rt)
+		}
+	} else {
+		rt := FunResult{Type: elemType}
+		results = append(results, rt)
+	}
+	return results
+}
+
+// parseElemType 不能只用标识符描述的类型（函数、泛型实例等）由 Expr 给出
+func parseElemType(expr ast.Expr) ElemType {
+	var elemType ElemType
+	switch ty := expr.(type) {
+	case *ast.Ident:
+		elemType = ElemType{Type: ty}
+	case *ast.ArrayType:
+		if idt, ok := ty.Elt.(*ast.Ident); ok {
+			elemType = ElemType{Type: idt, TypeElem: ElemArray}
+		}
+	case *ast.MapType:
+		key, _ := ty.Key.(*ast.Ident)
+		value, _ := ty.Value.(*ast.Ident)
+		if key != nil && value != nil {
+			elemType = ElemType{TypeElem: ElemHash, Types: []*ast.Ident{key, value}}
+		}
+	case *ast.StarExpr:
+		idt, _ := ty.X.(*ast.Ident)
+		elemType = ElemType{Type: idt, TypeElem: ElemPointer}
+	case *ast.InterfaceType:
+		elemType = ElemType{Type: anyIdent(ty)}
+	case *ast.ChanType:
+		if idt, ok := ty.Value.(*ast.Ident); ok {
+			elemType = ElemType{Type: idt, TypeElem: ElemChan}
+		}
+	case *ast.FuncType:
+		elemType = ElemType{TypeElem: ElemFunc}
+	}
+	elemType.Expr = expr
+	return elemType
+}
+
+// anyIdent 参数和返回值中的 interface{} 按 any 处理
+func anyIdent(node *ast.InterfaceType) *ast.Ident {
+	return &ast.Ident{NamePos: node.Pos(), Name: "any"}
+}
@@ -0,0 +1,502 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// ComparableType 预声明的 comparable 约束
+var ComparableType = &InterfaceType{Name: "comparable", Methods: map[string]*ast.FuncType{}, Comparable: true}
+
+// TypeArg 绑定到类型参数的类型，用该类型的零值表示
+type TypeArg struct {
+	Name string
+	Zero Object
+}
+
+func (ta *TypeArg) Type() ObjectType { return TYPE_ARG_OBJ }
+func (ta *TypeArg) String() string   { return TypeName(ta.Zero) }
+
+// GenericType 泛型结构体，每组类型实参实例化为一个普通的结构体类型
+type GenericType struct {
+	Name       string
+	TypeParams *ast.FieldList
+	Struct     *StructType
+	Methods    map[string]*Function // 所有实例共享
+
+	instances map[string]*StructType
+	order     []*StructType
+}
+
+func NewGenericType(spec *ast.TypeSpec) Object {
+	node, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return NewError("generic type %s not support %T", spec.Name.Name, spec.Type)
+	}
+	return &GenericType{
+		Name:       spec.Name.Name,
+		TypeParams: spec.TypeParams,
+		Struct:     NewStructType(spec.Name.Name, node),
+		Methods:    make(map[string]*Function),
+		instances:  make(map[string]*StructType),
+	}
+}
+
+func (g *GenericType) Type() ObjectType { return GENERIC_TYPE_OBJ }
+func (g *GenericType) String() string {
+	var params []string
+	for _, field := range g.TypeParams.List {
+		var names []string
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		params = append(params, strings.Join(names, ", ")+" "+types.ExprString(field.Type))
+	}
+	return fmt.Sprintf("%s[%s]", g.Name, strings.Join(params, ", "))
+}
+
+// Instantiate 相同的类型实参得到同一个结构体类型
+func (g *GenericType) Instantiate(args []Object, resolver TypeResolver) (*StructType, error) {
+	names := TypeParamNames(g.TypeParams)
+	if len(args) < len(names) {
+		return nil, fmt.Errorf("not enough type arguments for type %s: have %d, want %d", g.Name, len(args), len(names))
+	} else if len(args) > len(names) {
+		return nil, fmt.Errorf("too many type arguments for type %s: have %d, want %d", g.Name, len(args), len(names))
+	}
+	name := instanceName(g.Name, args)
+	if st, ok := g.instances[name]; ok {
+		return st, nil
+	}
+	err := checkConstraints(g.TypeParams, args, resolver)
+	if err != nil {
+		return nil, err
+	}
+	st := &StructType{Name: name, Fields: g.Struct.Fields, Methods: g.Methods, Generic: g, TypeArgs: args}
+	g.instances[name] = st
+	g.order = append(g.order, st)
+	return st, nil
+}
+
+// Instances 按实例化的顺序返回所有实例
+func (g *GenericType) Instances() []*StructType {
+	return g.order
+}
+
+// MethodNames 按名字排序，保证编译结果稳定
+func (g *GenericType) MethodNames() []string {
+	var names []string
+	for name := range g.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func instanceName(name string, args []Object) string {
+	names := make([]string, len(args))
+	for i, arg := range args {
+		names[i] = TypeName(arg)
+	}
+	return fmt.Sprintf("%s[%s]", name, strings.Join(names, ","))
+}
+
+// TypeIndices 拆开 X[A, B] 形式的表达式
+func TypeIndices(expr ast.Expr) (ast.Expr, []ast.Expr) {
+	switch expr := expr.(type) {
+	case *ast.IndexExpr:
+		return expr.X, []ast.Expr{expr.Index}
+	case *ast.IndexListExpr:
+		return expr.X, expr.Indices
+	default:
+		return expr, nil
+	}
+}
+
+// InstantiateExpr 实例化 Name[Args] 形式的类型表达式
+func InstantiateExpr(expr ast.Expr, resolver TypeResolver) (*StructType, error) {
+	x, indices := TypeIndices(expr)
+	ident, ok := x.(*ast.Ident)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a generic type", types.ExprString(x))
+	}
+	var typ Object
+	if resolver != nil {
+		typ, ok = resolver.ResolveType(ident.Name)
+	}
+	if !ok {
+		return nil, fmt.Errorf("undefined: %s", ident.Name)
+	}
+	g, ok := typ.(*GenericType)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a generic type", ident.Name)
+	}
+	args, err := TypeArgsOf(indices, resolver)
+	if err != nil {
+		return nil, err
+	}
+	return g.Instantiate(args, resolver)
+}
+
+// TypeArgsOf 显式给出的类型实参
+func TypeArgsOf(exprs []ast.Expr, resolver TypeResolver) ([]Object, error) {
+	args := make([]Object, len(exprs))
+	for i, expr := range exprs {
+		args[i] = TypeOf(expr, resolver)
+		if IsError(args[i]) {
+			return nil, args[i].(*Error)
+		}
+	}
+	return args, nil
+}
+
+// TypeParamNames 按声明顺序展开类型参数的名字
+func TypeParamNames(params *ast.FieldList) []string {
+	var names []string
+	if params == nil {
+		return names
+	}
+	for _, field := range params.List {
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+// typeScope 类型参数到类型实参的绑定，其余的名字交给外层解析
+type typeScope struct {
+	args  map[string]Object
+	outer TypeResolver
+}
+
+func (s *typeScope) ResolveType(name string) (Object, bool) {
+	if arg, ok := s.args[name]; ok {
+		return &TypeArg{Name: name, Zero: arg}, true
+	}
+	if s.outer == nil {
+		return nil, false
+	}
+	return s.outer.ResolveType(name)
+}
+
+func BindTypeParams(params *ast.FieldList, args []Object, outer TypeResolver) TypeResolver {
+	scope := &typeScope{args: make(map[string]Object), outer: outer}
+	for i, name := range TypeParamNames(params) {
+		if i < len(args) {
+			scope.args[name] = args[i]
+		}
+	}
+	return scope
+}
+
+// Constraint 类型参数的约束都按接口处理
+func Constraint(expr ast.Expr, resolver TypeResolver) (*InterfaceType, error) {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		switch expr.Name {
+		case "any":
+			return AnyType, nil
+		case "comparable":
+			return ComparableType, nil
+		}
+		if resolver != nil {
+			if typ, ok := resolver.ResolveType(expr.Name); ok {
+				if it, ok := typ.(*InterfaceType); ok {
+					return it, nil
+				}
+				return &InterfaceType{Methods: map[string]*ast.FuncType{}, Terms: []ast.Expr{expr}}, nil
+			}
+		}
+		if IsError(GetDefaultObject(expr.Name)) {
+			return nil, fmt.Errorf("undefined: %s", expr.Name)
+		}
+		return &InterfaceType{Methods: map[string]*ast.FuncType{}, Terms: []ast.Expr{expr}}, nil
+	case *ast.InterfaceType:
+		it := NewInterfaceType("", expr)
+		return it, it.ResolveEmbeds(resolver)
+	case *ast.BinaryExpr, *ast.UnaryExpr:
+		it := &InterfaceType{Methods: map[string]*ast.FuncType{}, Terms: unionTerms(expr)}
+		return it, it.resolveTerms(resolver)
+	default:
+		return nil, fmt.Errorf("invalid constraint %s", types.ExprString(expr))
+	}
+}
+
+// unionTerms 展开 A | ~B | C
+func unionTerms(expr ast.Expr) []ast.Expr {
+	if bin, ok := expr.(*ast.BinaryExpr); ok && bin.Op == token.OR {
+		return append(unionTerms(bin.X), unionTerms(bin.Y)...)
+	}
+	return []ast.Expr{expr}
+}
+
+// resolveTerms 类型集中的约束接口替换为它的类型项
+func (it *InterfaceType) resolveTerms(resolver TypeResolver) error {
+	var terms []ast.Expr
+	for _, term := range it.Terms {
+		ident, ok := term.(*ast.Ident)
+		if !ok || !IsError(GetDefaultObject(ident.Name)) || resolver == nil {
+			terms = append(terms, term)
+			continue
+		}
+		typ, ok := resolver.ResolveType(ident.Name)
+		if !ok {
+			return fmt.Errorf("undefined: %s", ident.Name)
+		}
+		embedded, ok := typ.(*InterfaceType)
+		if !ok {
+			terms = append(terms, term)
+			continue
+		}
+		if err := embedded.ResolveEmbeds(resolver); err != nil {
+			return err
+		}
+		terms = append(terms, embedded.Terms...)
+	}
+	it.Terms = terms
+	return nil
+}
+
+func (it *InterfaceType) termsString() string {
+	terms := make([]string, len(it.Terms))
+	for i, term := range it.Terms {
+		terms[i] = types.ExprString(term)
+	}
+	return strings.Join(terms, " | ")
+}
+
+// hasTerm T 只匹配 T 本身，~T 匹配底层类型为 T 的所有类型
+func (it *InterfaceType) hasTerm(typ Object) bool {
+	for _, term := range it.Terms {
+		name := TypeName(typ)
+		if unary, ok := term.(*ast.UnaryExpr); ok && unary.Op == token.TILDE {
+			term = unary.X
+			name = TypeName(Unnamed(typ))
+		}
+		termName := types.ExprString(term)
+		if obj := GetDefaultObject(termName); !IsError(obj) {
+			termName = TypeName(obj)
+		}
+		if termName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Unsatisfied 返回类型实参不满足约束的原因，满足则返回空串
+func (it *InterfaceType) Unsatisfied(typ Object) string {
+	name := TypeName(typ)
+	if it.Comparable && !Comparable(typ) {
+		return fmt.Sprintf("%s does not satisfy comparable", name)
+	}
+	if len(it.Terms) > 0 && !it.hasTerm(typ) {
+		return fmt.Sprintf("%s does not satisfy %s (%s missing in %s)", name, it, name, it.termsString())
+	}
+	if msg := it.Missing(typ); msg != "" {
+		return strings.Replace(msg, "does not implement", "does not satisfy", 1)
+	}
+	return ""
+}
+
+// Comparable 切片、map 和函数不能比较，定长数组和结构体要求每个元素都能比较
+func Comparable(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Array:
+		if !obj.Fixed {
+			return false
+		}
+		for _, elem := range obj.Elements {
+			if !Comparable(elem) {
+				return false
+			}
+		}
+	case *Hash, *Function:
+		return false
+	case *Named:
+		return Comparable(obj.Value)
+	case *Struct:
+		for _, field := range obj.Fields {
+			if !Comparable(field) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func checkConstraints(params *ast.FieldList, args []Object, resolver TypeResolver) error {
+	i := 0
+	for _, field := range params.List {
+		it, err := Constraint(field.Type, resolver)
+		if err != nil {
+			return err
+		}
+		for range field.Names {
+			if msg := it.Unsatisfied(args[i]); msg != "" {
+				return errors.New(msg)
+			}
+			i++
+		}
+	}
+	return nil
+}
+
+// InferTypeArgs 未显式给出的类型实参由实参的类型推断，并检查约束
+// spread 为 f(s...) 调用，可变参数对应的实参是切片
+func InferTypeArgs(name string, fn *Function, args []Object, spread bool, resolver TypeResolver) ([]Object, error) {
+	names := TypeParamNames(fn.TypeParams)
+	if len(fn.TypeArgs) > len(names) {
+		return nil, fmt.Errorf("got %d type arguments but %s has %d type parameters", len(fn.TypeArgs), name, len(names))
+	}
+	inf := &inference{params: make(map[string]bool), bound: make(map[string]Object)}
+	for i, param := range names {
+		inf.params[param] = true
+		if i < len(fn.TypeArgs) {
+			inf.bound[param] = fn.TypeArgs[i]
+		}
+	}
+	for i, param := range fn.Params {
+		if i < len(args) && param.Type.Expr != nil {
+			if fn.Variadic && !spread && i == len(fn.Params)-1 {
+				elt := param.Type.Expr.(*ast.ArrayType).Elt
+				for _, arg := range args[i:] {
+					inf.unify(elt, arg, resolver)
+				}
+				break
+			}
+			inf.unify(param.Type.Expr, args[i], resolver)
+		}
+	}
+
+	result := make([]Object, len(names))
+	for i, param := range names {
+		arg, ok := inf.bound[param]
+		if !ok {
+			return nil, fmt.Errorf("in call to %s, cannot infer %s", name, param)
+		}
+		result[i] = arg
+	}
+	err := checkConstraints(fn.TypeParams, result, resolver)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+type inference struct {
+	params map[string]bool
+	bound  map[string]Object
+}
+
+// unify 把参数的类型表达式和实参的值对齐，找出类型参数对应的类型
+func (inf *inference) unify(expr ast.Expr, value Object, resolver TypeResolver) {
+	if value == nil || value == NULL || IsError(value) {
+		return
+	}
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		if _, ok := inf.bound[expr.Name]; inf.params[expr.Name] && !ok {
+			inf.bound[expr.Name] = ZeroOf(value)
+		}
+	case *ast.ParenExpr:
+		inf.unify(expr.X, value, resolver)
+	case *ast.ArrayType:
+		if array, ok := value.(*Array); ok {
+			if len(array.Elements) > 0 {
+				inf.unify(expr.Elt, array.Elements[0], resolver)
+			} else {
+				inf.unify(expr.Elt, GetDefaultObject(array.ElemType.String()), resolver)
+			}
+		}
+	case *ast.MapType:
+		if hash, ok := value.(*Hash); ok {
+			for _, pair := range hash.Entries() {
+				inf.unify(expr.Key, pair.Key, resolver)
+				inf.unify(expr.Value, pair.Value, resolver)
+				return
+			}
+			inf.unify(expr.Key, GetDefaultObject(hash.KeyType.String()), resolver)
+			inf.unify(expr.Value, GetDefaultObject(hash.ValueType.String()), resolver)
+		}
+	case *ast.StarExpr:
+		p, ok := value.(*Pointer)
+		if !ok {
+			// 方法的接收者总是以结构体传入
+			inf.unify(expr.X, value, resolver)
+		} else if st, ok := p.Elem.(*StructType); ok {
+			inf.unify(expr.X, st.Zero(resolver), resolver)
+		} else {
+			inf.unify(expr.X, p.Elem, resolver)
+		}
+	case *ast.ChanType:
+		if ch, ok := value.(*Channel); ok {
+			inf.unify(expr.Value, ch.Elem, resolver)
+		}
+	case *ast.FuncType:
+		fn, ok := value.(*Function)
+		if !ok {
+			return
+		}
+		fnResolver := resolver
+		if fn.Env != nil {
+			fnResolver = fn.Env
+		}
+		sig := ParseFuncType(expr)
+		for i, param := range sig.Params {
+			if i < len(fn.Params) {
+				inf.unify(param.Type.Expr, GetDefaultValueFromElem(fn.Params[i].Type, fnResolver), resolver)
+			}
+		}
+		for i, result := range sig.Results {
+			if i < len(fn.Results) {
+				inf.unify(result.Type.Expr, GetDefaultValueFromElem(fn.Results[i].Type, fnResolver), resolver)
+			}
+		}
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		s, ok := value.(*Struct)
+		if !ok || s.StructType.Generic == nil {
+			return
+		}
+		_, indices := TypeIndices(expr)
+		for i, index := range indices {
+			if i < len(s.StructType.TypeArgs) {
+				inf.unify(index, s.StructType.TypeArgs[i], resolver)
+			}
+		}
+	}
+}
+
+// ZeroOf 值所属类型的零值
+func ZeroOf(value Object) Object {
+	switch value := value.(type) {
+	case *Struct:
+		fields := make([]Object, len(value.Fields))
+		for i, field := range value.Fields {
+			fields[i] = ZeroOf(field)
+		}
+		return &Struct{StructType: value.StructType, Fields: fields}
+	case *Array:
+		return &Array{ElemType: value.ElemType}
+	case *Hash:
+		return &Hash{KeyType: value.KeyType, ValueType: value.ValueType}
+	case *Pointer:
+		return &Pointer{Elem: value.Elem}
+	case *Channel:
+		return &Channel{Elem: value.Elem}
+	case *Interface:
+		return &Interface{InterfaceType: value.InterfaceType}
+	case *Function, *Builtin:
+		return value
+	default:
+		if obj := GetDefaultObject(value.Type().String()); !IsError(obj) {
+			return obj
+		}
+		return value
+	}
+}
@@ -0,0 +1,144 @@
+package object
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+func NewHash(keyType, valueType ObjectType) *Hash {
+	return &Hash{KeyType: keyType, ValueType: valueType, Pairs: make(map[HashKey][]HashPair)}
+}
+
+// Get 先按 HashKey 找到桶，再逐个比较键，NaN 不等于任何键
+func (h *Hash) Get(key Object) (HashPair, bool) {
+	hk, err := HashOf(key)
+	if err != nil {
+		return HashPair{}, false
+	}
+	for _, pair := range h.Pairs[hk] {
+		if Equal(pair.Key, key) {
+			return pair, true
+		}
+	}
+	return HashPair{}, false
+}
+
+// Zero 不存在的键取值类型的零值，切片、map 等类型为 nil
+func (h *Hash) Zero() Object {
+	if h.ValueType == ARRAY_OBJ {
+		// nil 切片可以 len 和 append
+		return &Array{}
+	}
+	if zero := GetDefaultObject(h.ValueType.String()); !IsError(zero) {
+		return zero
+	}
+	return NULL
+}
+
+// KeyAssignable key 的类型是 map 的键类型，接口和命名类型的键不检查
+func (h *Hash) KeyAssignable(key Object) bool {
+	switch h.KeyType {
+	case ERROR_OBJ, INTERFACE_OBJ, NAMED_OBJ:
+		return true
+	}
+	return key.Type() == h.KeyType
+}
+
+// Set 键已存在时替换，否则加入对应的桶
+func (h *Hash) Set(key, value Object) *Error {
+	hk, err := HashOf(key)
+	if err != nil {
+		return err
+	}
+	if h.Pairs == nil {
+		h.Pairs = make(map[HashKey][]HashPair)
+	}
+	bucket := h.Pairs[hk]
+	for i, pair := range bucket {
+		if Equal(pair.Key, key) {
+			bucket[i] = HashPair{Key: key, Value: value}
+			return nil
+		}
+	}
+	h.Pairs[hk] = append(bucket, HashPair{Key: key, Value: value})
+	return nil
+}
+
+func (h *Hash) Delete(key Object) {
+	hk, err := HashOf(key)
+	if err != nil {
+		return
+	}
+	bucket := h.Pairs[hk]
+	for i, pair := range bucket {
+		if Equal(pair.Key, key) {
+			bucket = append(bucket[:i:i], bucket[i+1:]...)
+			break
+		}
+	}
+	if len(bucket) == 0 {
+		delete(h.Pairs, hk)
+	} else {
+		h.Pairs[hk] = bucket
+	}
+}
+
+func (h *Hash) Len() int {
+	n := 0
+	for _, bucket := range h.Pairs {
+		n += len(bucket)
+	}
+	return n
+}
+
+// Entries 所有键值对，顺序和 Go 的 map 一样不固定
+func (h *Hash) Entries() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, bucket := range h.Pairs {
+		pairs = append(pairs, bucket...)
+	}
+	return pairs
+}
+
+// HashOf 键的哈希值，接口按动态值计算，不可比较的值不能作为键
+func HashOf(key Object) (HashKey, *Error) {
+	key = Unnamed(Underlying(key))
+	if key == nil || key == NULL {
+		return HashKey{Type: NULL_OBJ}, nil
+	}
+	hashable, ok := key.(Hashable)
+	if !ok || !Comparable(key) {
+		return HashKey{}, NewError("runtime error: hash of unhashable type %s", TypeName(key))
+	}
+	return hashable.HashKey(), nil
+}
+
+// IsKeyType 类型能否作为 map 的键，typ 为该类型的零值，接口类型的键在运行时检查
+func IsKeyType(typ Object) bool {
+	if _, ok := typ.(*Interface); ok {
+		return true
+	}
+	_, ok := typ.(Hashable)
+	return ok && Comparable(typ)
+}
+
+// combineHash 按顺序组合各元素的哈希值
+func combineHash(objs []Object) int64 {
+	h := fnv.New64a()
+	for _, obj := range objs {
+		key, _ := HashOf(obj)
+		_, _ = fmt.Fprintf(h, "%d:%d;", key.Type, key.Value)
+	}
+	return int64(h.Sum64())
+}
+
+func (s *Struct) HashKey() HashKey {
+	return HashKey{Type: s.Type(), Value: combineHash(s.Fields)}
+}
+
+// HashKey 指针按指向的地址计算
+func (p *Pointer) HashKey() HashKey {
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%p", p.Ref)
+	return HashKey{Type: p.Type(), Value: int64(h.Sum64())}
+}
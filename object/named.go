@@ -0,0 +1,119 @@
+package object
+
+import (
+	"go/ast"
+)
+
+// NamedType 底层类型不是结构体的命名类型，如 type Weekday int，它的值为 *Named
+type NamedType struct {
+	Name       string
+	Underlying ast.Expr
+	Methods    map[string]*Function
+}
+
+// Named 命名类型的值，Value 为底层类型的值；运算按底层类型进行，结果仍属于该类型
+type Named struct {
+	NamedType *NamedType
+	Value     Object
+}
+
+func NewNamedType(name string, underlying ast.Expr) *NamedType {
+	return &NamedType{Name: name, Underlying: underlying, Methods: make(map[string]*Function)}
+}
+
+func (nt *NamedType) Type() ObjectType { return NAMED_TYPE_OBJ }
+func (nt *NamedType) String() string   { return nt.Name }
+
+// Zero 底层类型也是命名类型时取它底层的值
+func (nt *NamedType) Zero(resolver TypeResolver) Object {
+	zero := GetDefaultValueWithExpr(nt.Underlying, resolver)
+	if IsError(zero) {
+		return zero
+	}
+	return nt.Wrap(zero)
+}
+
+// Wrap 把底层类型的值作为该类型的值
+func (nt *NamedType) Wrap(value Object) Object {
+	return &Named{NamedType: nt, Value: Unnamed(value)}
+}
+
+// Conversion T(x) 转换为该类型，zero 为该类型的零值
+func (nt *NamedType) Conversion(zero Object) *Builtin {
+	return &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return NewError("wrong number of arguments. want=1, got=%d", len(args))
+			}
+			return ConvertValueWithType(args[0], zero)
+		},
+	}
+}
+
+func (n *Named) Type() ObjectType { return NAMED_OBJ }
+func (n *Named) String() string   { return n.Value.String() }
+
+func (n *Named) HashKey() HashKey {
+	if hashable, ok := n.Value.(Hashable); ok {
+		return hashable.HashKey()
+	}
+	return HashKey{Type: n.Type()}
+}
+
+// Unnamed 命名类型的值返回底层类型的值
+func Unnamed(obj Object) Object {
+	if n, ok := obj.(*Named); ok {
+		return n.Value
+	}
+	return obj
+}
+
+// NamedOperands 运算前去掉操作数的命名类型，返回结果所属的命名类型；
+// 移位的结果和左操作数的类型相同
+func NamedOperands(left, right Object, shift bool) (Object, Object, *NamedType) {
+	var nt *NamedType
+	if n, ok := right.(*Named); ok {
+		if !shift {
+			nt = n.NamedType
+		}
+		right = n.Value
+	}
+	if n, ok := left.(*Named); ok {
+		nt = n.NamedType
+		left = n.Value
+	}
+	return left, right, nt
+}
+
+// Result 运算结果属于命名类型，比较的结果是无类型的布尔值
+func (nt *NamedType) Result(obj Object) Object {
+	if nt == nil || obj == nil || IsError(obj) || obj.Type() == BOOLEAN_OBJ {
+		return obj
+	}
+	return nt.Wrap(obj)
+}
+
+// NamedTypeOf 值所属的命名类型，不是命名类型时为 nil
+func NamedTypeOf(obj Object) *NamedType {
+	if n, ok := obj.(*Named); ok {
+		return n.NamedType
+	}
+	return nil
+}
+
+// ApplyBuiltin 内置函数按底层类型处理参数，append 的结果和第一个参数的类型相同，
+// panic 的参数保留原来的类型
+func ApplyBuiltin(builtin *Builtin, args []Object) Object {
+	if builtin == GetBuiltinByName("panic") {
+		return builtin.Fn(args...)
+	}
+	unnamed := make([]Object, len(args))
+	for i, arg := range args {
+		unnamed[i] = Unnamed(arg)
+	}
+	result := builtin.Fn(unnamed...)
+	if len(args) > 0 && builtin == GetBuiltinByName("append") {
+		return NamedTypeOf(args[0]).Result(result)
+	}
+	return result
+}
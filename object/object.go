@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"fmt"
 	"go/ast"
+	"go/token"
+	"go/types"
 	"goscript/code"
 	"hash/fnv"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -26,6 +30,8 @@ const (
 	UINT64_OBJ
 	FLOAT32_OBJ
 	FLOAT64_OBJ
+	COMPLEX64_OBJ
+	COMPLEX128_OBJ
 	BOOLEAN_OBJ
 	STRING_OBJ
 	NULL_OBJ
@@ -49,26 +55,49 @@ const (
 	RANGELOOP_OBJ
 
 	BUILTIN_OBJ
+
+	STRUCT_OBJ
+	STRUCT_TYPE_OBJ
+	BOUND_METHOD_OBJ
+	INTERFACE_OBJ
+	INTERFACE_TYPE_OBJ
+	CHANNEL_OBJ
+	POINTER_OBJ
+	CONSTANT_OBJ
+	TYPE_ARG_OBJ
+	GENERIC_TYPE_OBJ
+	BRANCH_OBJ
+	NAMED_OBJ
+	NAMED_TYPE_OBJ
 )
 
 var typeLiteral = map[ObjectType]string{
-	ERROR_OBJ:   "error",
-	INT_OBJ:     "int",
-	INT8_OBJ:    "int8",
-	INT16_OBJ:   "int16",
-	INT32_OBJ:   "int32",
-	INT64_OBJ:   "int64",
-	UINT_OBJ:    "uint",
-	UINT8_OBJ:   "uint8",
-	UINT16_OBJ:  "uint16",
-	UINT32_OBJ:  "uint32",
-	UINT64_OBJ:  "uint64",
-	FLOAT32_OBJ: "float32",
-	FLOAT64_OBJ: "float64",
-	BOOLEAN_OBJ: "bool",
-	STRING_OBJ:  "string",
-	ARRAY_OBJ:   "array",
-	HASH_OBJ:    "hash",
+	ERROR_OBJ:      "error",
+	INT_OBJ:        "int",
+	INT8_OBJ:       "int8",
+	INT16_OBJ:      "int16",
+	INT32_OBJ:      "int32",
+	INT64_OBJ:      "int64",
+	UINT_OBJ:       "uint",
+	UINT8_OBJ:      "uint8",
+	UINT16_OBJ:     "uint16",
+	UINT32_OBJ:     "uint32",
+	UINT64_OBJ:     "uint64",
+	FLOAT32_OBJ:    "float32",
+	FLOAT64_OBJ:    "float64",
+	COMPLEX64_OBJ:  "complex64",
+	COMPLEX128_OBJ: "complex128",
+	BOOLEAN_OBJ:    "bool",
+	STRING_OBJ:     "string",
+	ARRAY_OBJ:      "array",
+	HASH_OBJ:       "hash",
+	STRUCT_OBJ:     "struct",
+	INTERFACE_OBJ:  "interface",
+	CHANNEL_OBJ:    "chan",
+	POINTER_OBJ:    "pointer",
+	CONSTANT_OBJ:   "constant",
+	TYPE_ARG_OBJ:   "type",
+	NAMED_OBJ:      "named",
 }
 
 func (t ObjectType) String() string {
@@ -83,8 +112,12 @@ func (t ObjectType) IsFloat() bool {
 	return t == FLOAT32_OBJ || t == FLOAT64_OBJ
 }
 
+func (t ObjectType) IsComplex() bool {
+	return t == COMPLEX64_OBJ || t == COMPLEX128_OBJ
+}
+
 func (t ObjectType) IsRange() bool {
-	return t == STRING_OBJ || t == ARRAY_OBJ || t == HASH_OBJ
+	return t == STRING_OBJ || t == ARRAY_OBJ || t == HASH_OBJ || t == CHANNEL_OBJ
 }
 
 type Object interface {
@@ -92,21 +125,34 @@ type Object interface {
 	String() string
 }
 
+// HashKey 键的哈希值，不同的键可能有相同的 HashKey，Hash 中再用 Equal 区分
 type HashKey struct {
 	Type  ObjectType
 	Value int64
 }
 
+// Hashable 可以作为 map 键的值，相等的值必须有相同的 HashKey
 type Hashable interface {
 	HashKey() HashKey
 }
 
 type Error struct {
 	Message string
+	Value   Object       // panic 传入的值，运行时错误为 nil
+	Pos     token.Pos    // vm 中出错指令的位置，evaluator 把位置写在 Message 中
+	Stack   []StackFrame // vm 中出错时的调用栈，最内层在前
+}
+
+// StackFrame 调用栈中的一个函数，循环帧并入所在的函数
+type StackFrame struct {
+	Function string
+	Pos      token.Pos
+	Args     []Object
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) String() string   { return e.Message }
+func (e *Error) Error() string    { return e.Message }
 
 type Null struct {
 }
@@ -224,6 +270,11 @@ func (f *Float64) Float() float64 { return f.Value }
 func (f *Float32) Type() ObjectType { return FLOAT32_OBJ }
 func (f *Float64) Type() ObjectType { return FLOAT64_OBJ }
 
+func (f *Float32) HashKey() HashKey {
+	return HashKey{Type: f.Type(), Value: int64(floatBits(f.Float()))}
+}
+func (f *Float64) HashKey() HashKey { return HashKey{Type: f.Type(), Value: int64(floatBits(f.Value))} }
+
 func (f *Float32) String() string {
 	return strconv.FormatFloat(float64(f.Value), 'f', -1, 32)
 }
@@ -231,30 +282,56 @@ func (f *Float64) String() string {
 	return strconv.FormatFloat(f.Value, 'f', -1, 64)
 }
 
-type Byte struct {
-	Value uint8
-}
+type (
+	Complex interface {
+		Complex() complex128
+	}
+
+	Complex64 struct {
+		Value complex64
+	}
+
+	Complex128 struct {
+		Value complex128
+	}
+)
+
+func (c *Complex64) Complex() complex128  { return complex128(c.Value) }
+func (c *Complex128) Complex() complex128 { return c.Value }
 
-func (b *Byte) Type() ObjectType { return UINT8_OBJ }
-func (b *Byte) String() string {
-	return strconv.FormatUint(uint64(b.Value), 10)
+func (c *Complex64) Type() ObjectType  { return COMPLEX64_OBJ }
+func (c *Complex128) Type() ObjectType { return COMPLEX128_OBJ }
+
+func (c *Complex64) String() string {
+	return strconv.FormatComplex(complex128(c.Value), 'f', -1, 64)
 }
-func (b *Byte) HashKey() HashKey {
-	return HashKey{Type: b.Type(), Value: int64(b.Value)}
+func (c *Complex128) String() string {
+	return strconv.FormatComplex(c.Value, 'f', -1, 128)
 }
 
-type Rune struct {
-	Value int32
-}
+func (c *Complex64) HashKey() HashKey  { return complexHashKey(c.Type(), c.Complex()) }
+func (c *Complex128) HashKey() HashKey { return complexHashKey(c.Type(), c.Value) }
 
-func (r *Rune) Type() ObjectType { return INT32_OBJ }
-func (r *Rune) String() string {
-	return strconv.FormatInt(int64(r.Value), 10)
+func complexHashKey(t ObjectType, v complex128) HashKey {
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%d:%d", floatBits(real(v)), floatBits(imag(v)))
+	return HashKey{Type: t, Value: int64(h.Sum64())}
 }
-func (r *Rune) HashKey() HashKey {
-	return HashKey{Type: r.Type(), Value: int64(r.Value)}
+
+// floatBits +0 和 -0 相等，哈希值也要相同
+func floatBits(f float64) uint64 {
+	if f == 0 {
+		return 0
+	}
+	return math.Float64bits(f)
 }
 
+// byte 和 rune 是 uint8 和 int32 的别名
+type (
+	Byte = Uint8
+	Rune = Int32
+)
+
 type Boolean struct {
 	Value bool
 }
@@ -274,10 +351,12 @@ type (
 		Value string
 	}
 
+	// Array 即切片，Elements 的底层数组在切片表达式和 append 之间共享，cap(Elements) 为容量
+	// Fixed 为定长数组 [n]T，是值类型，赋值和传参时复制，长度是类型的一部分
 	Array struct {
 		ElemType ObjectType
 		Elements []Object
-		Len      int
+		Fixed    bool
 	}
 
 	HashPair struct {
@@ -285,23 +364,53 @@ type (
 		Value Object
 	}
 
+	// Hash 的键按 HashKey 分桶，同一个桶中的键用 Equal 比较，通过 Get、Set 和 Delete 访问
 	Hash struct {
 		KeyType   ObjectType
 		ValueType ObjectType
-		Pairs     map[HashKey]HashPair
+		Pairs     map[HashKey][]HashPair
 	}
 )
 
 func NewArray(elemType ObjectType, elems []Object, fixed bool, fixLen int) Array {
-	if fixed && len(elems) == 0 && fixLen > 0 {
-		for i := 0; i < fixLen; i++ {
-			elems = append(elems, GetDefaultObject(elemType.String()))
-		}
+	// 定长数组未给出的元素为零值
+	for fixed && len(elems) < fixLen {
+		elems = append(elems, GetDefaultObject(elemType.String()))
 	}
-	array := Array{elemType, elems, len(elems)}
+	array := Array{ElemType: elemType, Elements: elems, Fixed: fixed}
 	return array
 }
 
+// ArrayOf 元素为 elem 零值的定长数组，也用来表示数组类型 [n]T
+func ArrayOf(elem Object, n int) *Array {
+	elems := make([]Object, n)
+	for i := range elems {
+		elems[i] = CopyValue(elem)
+	}
+	return &Array{ElemType: elem.Type(), Elements: elems, Fixed: true}
+}
+
+func (a *Array) Copy() *Array {
+	elems := make([]Object, len(a.Elements))
+	for i, elem := range a.Elements {
+		elems[i] = CopyValue(elem)
+	}
+	return &Array{ElemType: a.ElemType, Elements: elems, Fixed: a.Fixed}
+}
+
+// SameType 定长数组的长度也要相同
+func (a *Array) SameType(other *Array) bool {
+	if a.ElemType != other.ElemType || a.Fixed != other.Fixed {
+		return false
+	}
+	return !a.Fixed || len(a.Elements) == len(other.Elements)
+}
+
+// HashKey 定长数组按元素计算
+func (a *Array) HashKey() HashKey {
+	return HashKey{Type: a.Type(), Value: combineHash(a.Elements)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	_, _ = h.Write([]byte(s.Value))
@@ -327,7 +436,7 @@ func (a *Array) String() string {
 func (h *Hash) String() string {
 	var out bytes.Buffer
 	var pairs []string
-	for _, pair := range h.Pairs {
+	for _, pair := range h.Entries() {
 		pairs = append(pairs, fmt.Sprintf("%s :%s", pair.Key.String(), pair.Value.String()))
 	}
 	out.WriteString("{")
@@ -336,6 +445,356 @@ func (h *Hash) String() string {
 	return out.String()
 }
 
+type (
+	StructField struct {
+		Name     string
+		Type     ast.Expr
+		Embedded bool
+	}
+
+	StructType struct {
+		Name    string
+		Fields  []StructField
+		Methods map[string]*Function
+
+		Generic  *GenericType // 泛型类型的实例
+		TypeArgs []Object
+	}
+
+	Struct struct {
+		StructType *StructType
+		Fields     []Object
+	}
+)
+
+func NewStructType(name string, node *ast.StructType) *StructType {
+	st := &StructType{Name: name, Methods: make(map[string]*Function)}
+	for _, field := range node.Fields.List {
+		if field.Names == nil {
+			// 匿名字段以类型名作为字段名
+			fieldName := ""
+			switch ty := field.Type.(type) {
+			case *ast.Ident:
+				fieldName = ty.Name
+			case *ast.StarExpr:
+				if idt, ok := ty.X.(*ast.Ident); ok {
+					fieldName = idt.Name
+				}
+			}
+			st.Fields = append(st.Fields, StructField{Name: fieldName, Type: field.Type, Embedded: true})
+			continue
+		}
+		for _, name := range field.Names {
+			st.Fields = append(st.Fields, StructField{Name: name.Name, Type: field.Type})
+		}
+	}
+	return st
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+func (st *StructType) String() string {
+	if st.Name != "" {
+		return st.Name
+	}
+	var fields []string
+	for _, field := range st.Fields {
+		fields = append(fields, field.Name)
+	}
+	return fmt.Sprintf("struct{%s}", strings.Join(fields, "; "))
+}
+
+func (st *StructType) FieldIndex(name string) int {
+	for i, field := range st.Fields {
+		if field.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (st *StructType) Zero(resolver TypeResolver) Object {
+	if st.Generic != nil {
+		resolver = BindTypeParams(st.Generic.TypeParams, st.TypeArgs, resolver)
+	}
+	values := make([]Object, len(st.Fields))
+	for i, field := range st.Fields {
+		value := GetDefaultValueWithExpr(field.Type, resolver)
+		if IsError(value) {
+			return value
+		}
+		if fn, ok := value.(*Function); ok && fn.Body == nil {
+			value = NULL
+		}
+		values[i] = value
+	}
+	return &Struct{StructType: st, Fields: values}
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) String() string {
+	var fields []string
+	for _, field := range s.Fields {
+		fields = append(fields, field.String())
+	}
+	return fmt.Sprintf("{%s}", strings.Join(fields, " "))
+}
+
+func (s *Struct) Get(name string) (Object, bool) {
+	if idx := s.StructType.FieldIndex(name); idx >= 0 {
+		return s.Fields[idx], true
+	}
+	for i, field := range s.StructType.Fields {
+		if !field.Embedded {
+			continue
+		}
+		if embedded, ok := embeddedStruct(s.Fields[i]); ok {
+			if value, ok := embedded.Get(name); ok {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (s *Struct) Set(name string, value Object) bool {
+	if idx := s.StructType.FieldIndex(name); idx >= 0 {
+		s.Fields[idx] = value
+		return true
+	}
+	for i, field := range s.StructType.Fields {
+		if !field.Embedded {
+			continue
+		}
+		if embedded, ok := embeddedStruct(s.Fields[i]); ok && embedded.Set(name, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldRef 字段所在的位置，用于取字段的地址
+func (s *Struct) FieldRef(name string) *Object {
+	if idx := s.StructType.FieldIndex(name); idx >= 0 {
+		return &s.Fields[idx]
+	}
+	for i, field := range s.StructType.Fields {
+		if !field.Embedded {
+			continue
+		}
+		if embedded, ok := embeddedStruct(s.Fields[i]); ok {
+			if ref := embedded.FieldRef(name); ref != nil {
+				return ref
+			}
+		}
+	}
+	return nil
+}
+
+// embeddedStruct 嵌入字段可以是结构体或指向结构体的指针
+func embeddedStruct(obj Object) (*Struct, bool) {
+	if p, ok := obj.(*Pointer); ok && !p.IsNil() {
+		obj = *p.Ref
+	}
+	st, ok := obj.(*Struct)
+	return st, ok
+}
+
+func (s *Struct) Copy() *Struct {
+	fields := make([]Object, len(s.Fields))
+	for i, field := range s.Fields {
+		fields[i] = CopyValue(field)
+	}
+	return &Struct{StructType: s.StructType, Fields: fields}
+}
+
+// Method 查找方法，返回实际的接收者（可能是嵌入字段）
+func (s *Struct) Method(name string) (*Struct, *Function) {
+	if fn, ok := s.StructType.Methods[name]; ok {
+		return s, fn
+	}
+	for i, field := range s.StructType.Fields {
+		if !field.Embedded {
+			continue
+		}
+		if embedded, ok := embeddedStruct(s.Fields[i]); ok {
+			if recv, fn := embedded.Method(name); fn != nil {
+				return recv, fn
+			}
+		}
+	}
+	return nil, nil
+}
+
+type BoundMethod struct {
+	Recv Object
+	Fn   Object
+}
+
+func (bm *BoundMethod) Type() ObjectType { return BOUND_METHOD_OBJ }
+func (bm *BoundMethod) String() string   { return fmt.Sprintf("method[%s]", bm.Recv) }
+
+/*-----------------------------------*/
+
+var AnyType = &InterfaceType{Methods: map[string]*ast.FuncType{}}
+
+type (
+	InterfaceType struct {
+		Name       string
+		Methods    map[string]*ast.FuncType
+		Embeds     []string
+		Terms      []ast.Expr // 约束的类型集，~int | float64
+		Comparable bool
+	}
+
+	// Interface 接口值，Value 为 nil 表示 nil 接口
+	Interface struct {
+		InterfaceType *InterfaceType
+		Value         Object
+	}
+)
+
+func NewInterfaceType(name string, node *ast.InterfaceType) *InterfaceType {
+	it := &InterfaceType{Name: name, Methods: make(map[string]*ast.FuncType)}
+	for _, field := range node.Methods.List {
+		switch ty := field.Type.(type) {
+		case *ast.FuncType:
+			for _, name := range field.Names {
+				it.Methods[name.Name] = ty
+			}
+		case *ast.Ident:
+			if ty.Name == "comparable" {
+				it.Comparable = true
+			} else if ty.Name != "any" && !IsError(GetDefaultObject(ty.Name)) {
+				it.Terms = append(it.Terms, ty)
+			} else {
+				it.Embeds = append(it.Embeds, ty.Name)
+			}
+		case *ast.BinaryExpr, *ast.UnaryExpr:
+			it.Terms = append(it.Terms, unionTerms(ty)...)
+		}
+	}
+	return it
+}
+
+func (it *InterfaceType) Type() ObjectType { return INTERFACE_TYPE_OBJ }
+func (it *InterfaceType) String() string {
+	if it.Name != "" {
+		return it.Name
+	}
+	if len(it.Methods) == 0 && len(it.Terms) > 0 {
+		return it.termsString()
+	}
+	if len(it.Methods) == 0 {
+		return "interface {}"
+	}
+	return fmt.Sprintf("interface { %s }", strings.Join(it.MethodNames(), "; "))
+}
+
+func (it *InterfaceType) MethodNames() []string {
+	var names []string
+	for name := range it.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveEmbeds 合并嵌入接口的方法和类型集
+func (it *InterfaceType) ResolveEmbeds(resolver TypeResolver) error {
+	for _, name := range it.Embeds {
+		typ, ok := resolver.ResolveType(name)
+		if !ok {
+			return fmt.Errorf("undefined: %s", name)
+		}
+		embedded, ok := typ.(*InterfaceType)
+		if !ok {
+			return fmt.Errorf("interface contains type constraints: %s", name)
+		}
+		if err := embedded.ResolveEmbeds(resolver); err != nil {
+			return err
+		}
+		for method, fn := range embedded.Methods {
+			it.Methods[method] = fn
+		}
+		if len(it.Terms) == 0 {
+			it.Terms = embedded.Terms
+		}
+		it.Comparable = it.Comparable || embedded.Comparable
+	}
+	it.Embeds = nil
+	return it.resolveTerms(resolver)
+}
+
+// Missing 返回 value 未实现接口的原因，实现了则返回空串
+func (it *InterfaceType) Missing(value Object) string {
+	// *T 的方法集还包含接收者为 *T 的方法
+	recv, pointer := value, false
+	if p, ok := value.(*Pointer); ok {
+		recv, pointer = p.Elem, true
+	}
+	for _, name := range it.MethodNames() {
+		var fn *Function
+		switch recv := recv.(type) {
+		case *Struct:
+			_, fn = recv.Method(name)
+		case *Named:
+			fn = recv.NamedType.Methods[name]
+		}
+		if fn == nil {
+			return fmt.Sprintf("%s does not implement %s (missing method %s)", TypeName(value), it, name)
+		}
+		if fn.PointerRecv() && !pointer {
+			return fmt.Sprintf("%s does not implement %s (method %s has pointer receiver)", TypeName(value), it, name)
+		}
+		if !sameSignature(fn, ParseFuncType(it.Methods[name])) {
+			return fmt.Sprintf("%s does not implement %s (wrong type for method %s)", TypeName(value), it, name)
+		}
+	}
+	return ""
+}
+
+// sameSignature 方法和接口中的方法的参数、返回值类型相同，方法的第一个参数是接收者
+func sameSignature(method, want *Function) bool {
+	if len(method.Params)-1 != len(want.Params) || len(method.Results) != len(want.Results) || method.Variadic != want.Variadic {
+		return false
+	}
+	for i, param := range want.Params {
+		if typeString(method.Params[i+1].Type) != typeString(param.Type) {
+			return false
+		}
+	}
+	for i, result := range want.Results {
+		if typeString(method.Results[i].Type) != typeString(result.Type) {
+			return false
+		}
+	}
+	return true
+}
+
+// typeString interface{} 和 any 是同一类型
+func typeString(typ ElemType) string {
+	if typ.TypeElem == ElemBase && typ.Type != nil && typ.Type.Name == "any" {
+		return "any"
+	}
+	return types.ExprString(typ.Expr)
+}
+
+func (i *Interface) Type() ObjectType { return INTERFACE_OBJ }
+func (i *Interface) String() string {
+	if i.Value == nil {
+		return "<nil>"
+	}
+	return i.Value.String()
+}
+
+// Unwrap 返回接口的动态值
+func (i *Interface) Unwrap() Object {
+	if i.Value == nil {
+		return NULL
+	}
+	return i.Value
+}
+
 /*-----------------------------------*/
 
 type MapExist struct {
@@ -387,6 +846,15 @@ type Break struct {
 func (bk *Break) Type() ObjectType { return BREAK_OBJ }
 func (bk *Break) String() string   { return "break" }
 
+// Branch 带标签的 break、continue 和 goto，穿过外层的块和循环直到找到标签
+type Branch struct {
+	Tok   token.Token
+	Label string
+}
+
+func (br *Branch) Type() ObjectType { return BRANCH_OBJ }
+func (br *Branch) String() string   { return br.Tok.String() + " " + br.Label }
+
 /*-----------------------------------*/
 
 type BuiltinFunction func(args ...Object) Object
@@ -405,6 +873,9 @@ const (
 	ElemArray
 	ElemHash
 	ElemStruct
+	ElemPointer
+	ElemChan
+	ElemFunc
 )
 
 type (
@@ -412,6 +883,7 @@ type (
 		Type     *ast.Ident
 		TypeElem ElemTypeEnum
 		Types    []*ast.Ident
+		Expr     ast.Expr // 完整的类型表达式
 	}
 
 	FunArg struct {
@@ -420,32 +892,44 @@ type (
 	}
 
 	FunResult struct {
-		Symbol  *ast.Ident
-		Type    ElemType
-		IsFun   bool
-		Params  []FunArg
-		Results []FunResult
+		Symbol *ast.Ident
+		Type   ElemType
 	}
 
 	Function struct {
-		Name    string
-		Params  []FunArg
-		Results []FunResult
-		Body    *ast.BlockStmt
-		Env     *Environment
+		Name       string
+		Params     []FunArg
+		Results    []FunResult
+		Body       *ast.BlockStmt
+		Env        *Environment
+		TypeParams *ast.FieldList
+		TypeArgs   []Object // 显式给出或已推断的类型实参
+		Variadic   bool     // 最后一个参数为 ...T
 	}
 )
 
 func (fn *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (fn *Function) String() string   { return "function" }
 
+// PointerRecv 方法的接收者为第一个参数
+func (fn *Function) PointerRecv() bool {
+	return len(fn.Params) > 0 && fn.Params[0].Type.TypeElem == ElemPointer
+}
+
 type CompiledFunction struct {
 	Name         string
 	Instructions code.Instructions
 	NumLocals    int
 	NumParams    int
 	NumResult    int
+	ResultHeap   []bool // 具名返回值是否分配在堆上，槽位中是指向它的指针
 	FreeNum      int
+	Variadic     bool
+
+	// 调试信息：指令的源码位置，局部变量和自由变量按槽位的名字
+	Lines      code.LineTable
+	LocalNames []string
+	FreeNames  []string
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -467,6 +951,13 @@ type ForLoop struct {
 	Post      code.Instructions
 	NumLocals int
 	FreeNum   int
+
+	InitLines  code.LineTable
+	CondLines  code.LineTable
+	BodyLines  code.LineTable
+	PostLines  code.LineTable
+	LocalNames []string
+	FreeNames  []string
 }
 
 func (fl *ForLoop) Type() ObjectType { return FORLOOP_OBJ }
@@ -478,7 +969,163 @@ type RangeLoop struct {
 	IsAnonymous bool
 	NumLocals   int
 	FreeNum     int
+
+	XLines     code.LineTable
+	BodyLines  code.LineTable
+	LocalNames []string
+	FreeNames  []string
 }
 
 func (rl *RangeLoop) Type() ObjectType { return RANGELOOP_OBJ }
 func (rl *RangeLoop) String() string   { return fmt.Sprintf("forr") }
+
+// Channel 等待队列由 vm 的调度器维护
+type Channel struct {
+	Elem   Object // 元素类型的零值
+	Cap    int
+	Buffer []Object
+	Closed bool
+	RecvQ  []*Waiter
+	SendQ  []*Waiter
+}
+
+func (ch *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (ch *Channel) String() string   { return fmt.Sprintf("chan %s[%p]", TypeName(ch.Elem), ch) }
+
+// Close 唤醒所有等待者，接收方得到零值，发送方 panic
+func (ch *Channel) Close() *Error {
+	if ch.Closed {
+		return NewPanic("close of closed channel")
+	}
+	ch.Closed = true
+	for w := ch.Receiver(); w != nil; w = ch.Receiver() {
+		w.Value, w.Ok = ch.Zero(), false
+		w.Wake()
+	}
+	for w := ch.Sender(); w != nil; w = ch.Sender() {
+		w.Ok = false
+		w.Wake()
+	}
+	return nil
+}
+
+// Zero 从已关闭的通道接收到的零值
+func (ch *Channel) Zero() Object {
+	return Zero(ch.Elem)
+}
+
+// Receiver 取出第一个仍在等待的接收者
+func (ch *Channel) Receiver() *Waiter {
+	return dequeue(&ch.RecvQ)
+}
+
+// Sender 取出第一个仍在等待的发送者
+func (ch *Channel) Sender() *Waiter {
+	return dequeue(&ch.SendQ)
+}
+
+// CanRecv 接收不会阻塞
+func (ch *Channel) CanRecv() bool {
+	ch.SendQ = prune(ch.SendQ)
+	return len(ch.Buffer) > 0 || len(ch.SendQ) > 0 || ch.Closed
+}
+
+// CanSend 发送不会阻塞，向已关闭的通道发送会立即 panic
+func (ch *Channel) CanSend() bool {
+	ch.RecvQ = prune(ch.RecvQ)
+	return len(ch.RecvQ) > 0 || len(ch.Buffer) < ch.Cap || ch.Closed
+}
+
+// Remove select 结束后撤掉其余分支的等待者
+func (ch *Channel) Remove(w *Waiter) {
+	ch.RecvQ = remove(ch.RecvQ, w)
+	ch.SendQ = remove(ch.SendQ, w)
+}
+
+func dequeue(q *[]*Waiter) *Waiter {
+	for len(*q) > 0 {
+		w := (*q)[0]
+		*q = (*q)[1:]
+		if w.claim() {
+			return w
+		}
+	}
+	return nil
+}
+
+func prune(q []*Waiter) []*Waiter {
+	for len(q) > 0 && q[0].Select != nil && q[0].Select.Chosen != nil {
+		q = q[1:]
+	}
+	return q
+}
+
+func remove(q []*Waiter, w *Waiter) []*Waiter {
+	for i, item := range q {
+		if item == w {
+			return append(q[:i:i], q[i+1:]...)
+		}
+	}
+	return q
+}
+
+// Waiter 阻塞在通道上的 goroutine，Ok 表示收发是否成功
+type Waiter struct {
+	Value  Object
+	Ok     bool
+	Wake   func()
+	Case   int         // select 中的分支
+	Select *SelectWait // 同一个 select 的等待者共享，只有一个能被唤醒
+}
+
+func (w *Waiter) claim() bool {
+	if w.Select == nil {
+		return true
+	}
+	if w.Select.Chosen != nil {
+		return false
+	}
+	w.Select.Chosen = w
+	return true
+}
+
+type SelectWait struct {
+	Chosen *Waiter
+}
+
+// Pointer 指向变量、结构体字段或切片元素所在的位置，Ref 为 nil 时是空指针
+type Pointer struct {
+	Elem Object // 指向类型的零值，命名结构体用类型本身表示
+	Ref  *Object
+}
+
+func NewPointer(value Object) *Pointer {
+	return &Pointer{Elem: value, Ref: &value}
+}
+
+func (p *Pointer) Type() ObjectType { return POINTER_OBJ }
+func (p *Pointer) String() string {
+	if p.IsNil() {
+		return "nil"
+	}
+	return fmt.Sprintf("%p", p.Ref)
+}
+
+func (p *Pointer) IsNil() bool {
+	return p.Ref == nil
+}
+
+func (p *Pointer) Load() Object {
+	return *p.Ref
+}
+
+// Store 结构体原地赋值，已经取得的字段指针仍然有效
+func (p *Pointer) Store(value Object) {
+	if old, ok := (*p.Ref).(*Struct); ok {
+		if st, ok := value.(*Struct); ok && old != st {
+			copy(old.Fields, st.Copy().Fields)
+			return
+		}
+	}
+	*p.Ref = value
+}
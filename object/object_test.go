@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -58,3 +61,78 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestComplexHashKey(t *testing.T) {
+	c1 := &Complex128{Value: 1 + 2i}
+	c2 := &Complex128{Value: 1 + 2i}
+	diff := &Complex128{Value: 2 + 1i}
+
+	if c1.HashKey() != c2.HashKey() {
+		t.Errorf("complexes with same content have different hash keys")
+	}
+
+	if c1.HashKey() == diff.HashKey() {
+		t.Errorf("complexes with different content have same hash keys")
+	}
+
+	if c1.String() != "(1+2i)" || (&Complex64{Value: -1.5i}).String() != "(0-1.5i)" {
+		t.Errorf("wrong complex format. got=%s, %s", c1, &Complex64{Value: -1.5i})
+	}
+}
+
+func TestArrayHashKey(t *testing.T) {
+	a1 := &Array{ElemType: INT_OBJ, Elements: []Object{&Int{Value: 1}, &Int{Value: 2}}, Fixed: true}
+	a2 := a1.Copy()
+	diff := &Array{ElemType: INT_OBJ, Elements: []Object{&Int{Value: 2}, &Int{Value: 1}}, Fixed: true}
+
+	if a1.HashKey() != a2.HashKey() || !Equal(a1, a2) {
+		t.Errorf("arrays with same content have different hash keys")
+	}
+
+	if a1.HashKey() == diff.HashKey() || Equal(a1, diff) {
+		t.Errorf("arrays with different content have same hash keys")
+	}
+
+	if TypeName(a1) != "[2]int" || IsKeyType(&Array{ElemType: INT_OBJ}) {
+		t.Errorf("wrong array type. got=%s", TypeName(a1))
+	}
+}
+
+func TestHashCollision(t *testing.T) {
+	h := NewHash(STRING_OBJ, INT_OBJ)
+	other := &String{Value: "other"}
+	key := &String{Value: "key"}
+	// 人为制造冲突，把另一个键放进 key 的桶
+	h.Pairs[key.HashKey()] = []HashPair{{Key: other, Value: &Int{Value: 1}}}
+
+	if _, ok := h.Get(key); ok {
+		t.Fatalf("colliding key found before set")
+	}
+
+	h.Set(key, &Int{Value: 2})
+	h.Set(&String{Value: "key"}, &Int{Value: 3})
+	if pair, ok := h.Get(key); !ok || pair.Value.(*Int).Value != 3 || h.Len() != 2 {
+		t.Fatalf("set overwrote wrong key. len=%d", h.Len())
+	}
+
+	h.Delete(key)
+	if _, ok := h.Get(key); ok || h.Len() != 1 {
+		t.Fatalf("delete removed wrong key. len=%d", h.Len())
+	}
+}
+
+func TestFloatHashKey(t *testing.T) {
+	zero := &Float64{Value: 0}
+	negZero := &Float64{Value: math.Copysign(0, -1)}
+	if zero.HashKey() != negZero.HashKey() {
+		t.Errorf("+0 and -0 have different hash keys")
+	}
+
+	h := NewHash(FLOAT64_OBJ, INT_OBJ)
+	nan := &Float64{Value: math.NaN()}
+	h.Set(nan, &Int{Value: 1})
+	h.Set(nan, &Int{Value: 2})
+	if _, ok := h.Get(nan); ok || h.Len() != 2 {
+		t.Errorf("NaN keys must never be equal. len=%d", h.Len())
+	}
+}
@@ -0,0 +1,78 @@
+package object
+
+import (
+	"unicode/utf8"
+)
+
+// ConvertToString string(x)，整数按码点转换，[]byte 和 []rune 按元素拼接
+func ConvertToString(arg Object) Object {
+	switch arg := arg.(type) {
+	case *String:
+		return arg
+	case *Uint64:
+		if arg.Value > utf8.MaxRune {
+			return &String{Value: string(utf8.RuneError)}
+		}
+		return &String{Value: string(rune(arg.Value))}
+	case Integer:
+		v := arg.Integer()
+		if v < 0 || v > utf8.MaxRune {
+			return &String{Value: string(utf8.RuneError)}
+		}
+		return &String{Value: string(rune(v))}
+	case *Array:
+		switch arg.ElemType {
+		case UINT8_OBJ:
+			bs := make([]byte, len(arg.Elements))
+			for i, elem := range arg.Elements {
+				bs[i] = byte(elem.(Integer).Integer())
+			}
+			return &String{Value: string(bs)}
+		case INT32_OBJ:
+			rs := make([]rune, len(arg.Elements))
+			for i, elem := range arg.Elements {
+				rs[i] = rune(elem.(Integer).Integer())
+			}
+			return &String{Value: string(rs)}
+		}
+	}
+	return NewError("cannot convert the type '%s' to type 'string'", TypeName(arg))
+}
+
+// ConvertToSlice []byte(s) 和 []rune(s)，结果是新的切片
+func ConvertToSlice(elem ObjectType, arg Object) Object {
+	switch arg := arg.(type) {
+	case *String:
+		var elems []Object
+		switch elem {
+		case UINT8_OBJ:
+			for i := 0; i < len(arg.Value); i++ {
+				elems = append(elems, &Byte{Value: arg.Value[i]})
+			}
+		case INT32_OBJ:
+			for _, r := range arg.Value {
+				elems = append(elems, &Rune{Value: r})
+			}
+		default:
+			return NewError("cannot convert the type 'string' to type '[]%s'", elem)
+		}
+		return &Array{ElemType: elem, Elements: elems}
+	case *Array:
+		if arg.ElemType == elem {
+			return arg
+		}
+	}
+	return NewError("cannot convert the type '%s' to type '[]%s'", TypeName(arg), elem)
+}
+
+// SliceConversion 转换到切片类型的函数，编译时作为常量调用
+func SliceConversion(elem ObjectType) *Builtin {
+	return &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return NewError("wrong number of arguments. want=1, got=%d", len(args))
+			}
+			return ConvertToSlice(elem, args[0])
+		},
+	}
+}
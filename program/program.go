@@ -1,23 +1,28 @@
 package program
 
 import (
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/token"
+	"go/types"
 	"goscript/object"
 	"goscript/parser"
+	"strings"
 )
 
 type Input struct {
 	Name    string
 	Content string
 	IsStmt  bool
+	IsDecl  bool // 内容只有顶层声明，没有 package 子句
 	IsCheck bool
 }
 
 type Program struct {
 	Statements  []ast.Stmt
 	Env         *object.Environment
+	Fset        *token.FileSet // 多次 ParseInto 的输入共用，之前输入中的函数也能找到位置
 	TokenFile   *token.File
 	GlobalDecls int
 }
@@ -26,6 +31,7 @@ func NewProgram() *Program {
 	var prog Program
 	env := object.NewEnvironment()
 	prog.Env = env
+	prog.Fset = token.NewFileSet()
 	return &prog
 }
 
@@ -34,50 +40,127 @@ func main() {
 %s
 }`
 
+var declTmpl = `package tmp
+%s`
+
 func ParseFile(input Input) (*Program, error) {
-	fset := token.NewFileSet()
+	prog := NewProgram()
+	err := ParseInto(prog, input)
+	if err != nil {
+		return nil, err
+	}
+	return prog, nil
+}
+
+// ParseInto 把输入中的声明加入已有的 prog，Statements 换成输入中 main 的语句，
+// REPL 用它在多次输入之间保留函数、类型和常量
+func ParseInto(prog *Program, input Input) error {
+	fset := prog.Fset
 
 	content := input.Content
+	lines := 0
+	tmpl := ""
 	if input.IsStmt {
-		content = fmt.Sprintf(goTmpl, content)
+		tmpl = goTmpl
+		lines = 2
+	} else if input.IsDecl {
+		tmpl = declTmpl
+		lines = 1
+	}
+	if tmpl != "" {
+		content = fmt.Sprintf(tmpl, content)
 	}
 
 	astFile, tokenFile, err := parser.ParseFile(fset, input.Name, content, 0)
 	if err != nil {
-		if input.IsStmt {
-			err = formatError(err, 2)
+		if lines > 0 {
+			err = formatError(err, lines)
 		}
-		return nil, err
+		return err
+	}
+	if tmpl != "" {
+		// 模板加在输入前面的行不计入行号，之后的编译和运行时错误都按输入的行号
+		tokenFile.AddLineInfo(strings.Index(tmpl, "%s"), input.Name, 1)
 	}
 
 	if input.IsCheck {
-		err = check(fset, astFile)
+		err = check(fset, astFile, input.IsStmt)
 		if err != nil {
-			if input.IsStmt {
-				err = formatError(err, 2)
-			}
-			return nil, err
+			return err
 		}
 	}
 
-	prog := NewProgram()
+	posError := func(p token.Pos, msg any) error {
+		pos := tokenFile.Position(p)
+		return fmt.Errorf("%d:%d %s", pos.Line, pos.Column, msg)
+	}
+
+	if lerr, ok := checkLabels(astFile).(*labelError); ok {
+		return posError(lerr.Pos, lerr.Msg)
+	}
+
+	prog.Statements = nil
+	var methods []*ast.FuncDecl
 	for _, decl := range astFile.Decls {
 		switch decl := decl.(type) {
 		case *ast.FuncDecl:
 			name := decl.Name.Name
-			if name == "main" {
+			if decl.Recv != nil {
+				methods = append(methods, decl)
+			} else if name == "main" {
 				prog.Statements = decl.Body.List
 			} else {
+				if _, ok := prog.Env.Get(name); ok {
+					return posError(decl.Name.Pos(), name+" redeclared in this block")
+				}
 				addFunc(prog, name, decl)
 				prog.GlobalDecls++
 			}
 		case *ast.GenDecl:
+			if decl.Tok == token.TYPE {
+				for _, spec := range decl.Specs {
+					spec := spec.(*ast.TypeSpec)
+					if _, ok := prog.Env.Get(spec.Name.Name); ok {
+						return posError(spec.Name.Pos(), spec.Name.Name+" redeclared in this block")
+					}
+					err = addType(prog, spec)
+					if err != nil {
+						return posError(spec.Pos(), err)
+					}
+				}
+			} else if decl.Tok == token.CONST {
+				err = object.DeclareConsts(decl, prog.Env, prog.Env, func(name *ast.Ident, c *object.Constant) error {
+					prog.Env.Define(name.Name, c)
+					return nil
+				})
+				if cerr, ok := err.(*object.ConstError); ok {
+					return posError(cerr.Pos, cerr.Msg)
+				}
+			}
 		default:
 		}
 	}
 
+	resolveNamedTypes(prog.Env)
+	for name, value := range prog.Env.GetStore() {
+		if it, ok := value.(*object.InterfaceType); ok {
+			err = it.ResolveEmbeds(prog.Env)
+			if err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+		}
+	}
+
+	for _, decl := range methods {
+		err = addMethod(prog, decl)
+		if err != nil {
+			return posError(decl.Recv.Pos(), err)
+		}
+		prog.GlobalDecls++
+	}
+
 	prog.TokenFile = tokenFile
-	return prog, nil
+	return nil
 }
 
 func addFunc(prog *Program, name string, funcDecl *ast.FuncDecl) {
@@ -88,103 +171,205 @@ func addFunc(prog *Program, name string, funcDecl *ast.FuncDecl) {
 	prog.Env.Set(name, function)
 }
 
-func ParseFuncLit(node *ast.FuncLit, env *object.Environment) object.Object {
-	var fn object.Function
+// 方法按普通函数处理，接收者作为第一个参数
+func addMethod(prog *Program, funcDecl *ast.FuncDecl) error {
+	recv := *funcDecl.Recv.List[0]
+	recvType := recv.Type
+	if star, ok := recvType.(*ast.StarExpr); ok {
+		recvType = star.X
+	}
+	// 泛型类型的接收者带有类型参数 Stack[T]
+	recvType, indices := object.TypeIndices(recvType)
+	typeName := ""
+	if idt, ok := recvType.(*ast.Ident); ok {
+		typeName = idt.Name
+	}
 
-	if node.Type != nil {
-		if node.Type.Params != nil {
-			for _, field := range node.Type.Params.List {
-				args := parseFunArgType(field)
-				fn.Params = append(fn.Params, args...)
+	typ, ok := prog.Env.ResolveType(typeName)
+	if !ok {
+		return fmt.Errorf("undefined: %s", typeName)
+	}
+	var st *object.StructType
+	var typeParams *ast.FieldList
+	switch typ := typ.(type) {
+	case *object.StructType:
+		if indices != nil {
+			return fmt.Errorf("%s is not a generic type", typeName)
+		}
+		st = typ
+	case *object.NamedType:
+		if indices != nil {
+			return fmt.Errorf("%s is not a generic type", typeName)
+		}
+		// 方法集放在命名类型上，没有字段
+		st = &object.StructType{Name: typeName, Methods: typ.Methods}
+	case *object.GenericType:
+		if len(indices) != len(object.TypeParamNames(typ.TypeParams)) {
+			return fmt.Errorf("cannot use generic type %s without instantiation", typ)
+		}
+		typeParams = &ast.FieldList{List: []*ast.Field{{Type: &ast.Ident{Name: "any"}}}}
+		for _, index := range indices {
+			idt, ok := index.(*ast.Ident)
+			if !ok {
+				return fmt.Errorf("receiver type parameter %s must be an identifier", types.ExprString(index))
 			}
+			typeParams.List[0].Names = append(typeParams.List[0].Names, idt)
 		}
+		st = &object.StructType{Name: typeName, Fields: typ.Struct.Fields, Methods: typ.Methods}
+	default:
+		return fmt.Errorf("invalid receiver type %s", typeName)
+	}
+	name := funcDecl.Name.Name
+	if _, ok := st.Methods[name]; ok {
+		return fmt.Errorf("method %s.%s already declared", typeName, name)
+	}
+	if st.FieldIndex(name) >= 0 {
+		return fmt.Errorf("field and method with the same name %s", name)
 	}
 
-	if node.Type.Results != nil {
-		for _, field := range node.Type.Results.List {
-			results := parseResultType(field)
-			fn.Results = append(fn.Results, results...)
+	funcType := *funcDecl.Type
+	funcType.Params = &ast.FieldList{List: []*ast.Field{&recv}}
+	if funcDecl.Type.Params != nil {
+		funcType.Params.List = append(funcType.Params.List, funcDecl.Type.Params.List...)
+	}
+
+	var funcLit ast.FuncLit
+	funcLit.Type = &funcType
+	funcLit.Body = funcDecl.Body
+	function := ParseFuncLit(&funcLit, prog.Env).(*object.Function)
+	function.Name = MethodName(typeName, name)
+	st.Methods[name] = function
+	if typeParams != nil {
+		// 泛型类型的方法在实例化时才确定接收者的类型
+		function.TypeParams = typeParams
+		return nil
+	}
+	prog.Env.Set(function.Name, function)
+	return nil
+}
+
+func MethodName(typeName, name string) string {
+	return typeName + "." + name
+}
+
+// MethodExprFunc 方法表达式 T.M 或 (*T).M 对应的方法，T 的方法集不包含指针接收者的方法
+func MethodExprFunc(recv ast.Expr, typ object.Object, name string) (*object.Function, error) {
+	var fn *object.Function
+	switch typ := typ.(type) {
+	case *object.StructType:
+		fn = typ.Methods[name]
+	case *object.NamedType:
+		fn = typ.Methods[name]
+	}
+	if fn == nil {
+		return nil, fmt.Errorf("%s undefined (type %s has no method %s)", MethodName(typ.String(), name), typ, name)
+	}
+	if _, ok := recv.(*ast.StarExpr); !ok && fn.PointerRecv() {
+		return nil, fmt.Errorf("invalid method expression %s (needs pointer receiver (*%s).%s)", MethodName(typ.String(), name), typ, name)
+	}
+	return fn, nil
+}
+
+// MethodExprLit 方法表达式 (*T).M 中 M 的接收者为 T 时，相当于 func(r *T, args...) { return r.M(args...) }
+func MethodExprLit(node *ast.SelectorExpr, recv ast.Expr, fn *object.Function) *ast.FuncLit {
+	pos := node.Sel.Pos()
+	ident := func(name string) *ast.Ident {
+		return &ast.Ident{NamePos: pos, Name: name}
+	}
+	params := []*ast.Field{{Names: []*ast.Ident{ident("_recv")}, Type: &ast.StarExpr{Star: pos, X: recv}}}
+	call := &ast.CallExpr{Fun: &ast.SelectorExpr{X: ident("_recv"), Sel: ident(node.Sel.Name)}, Lparen: pos, Rparen: pos}
+	for i, param := range fn.Params[1:] {
+		name := fmt.Sprintf("_arg%d", i)
+		typ := param.Type.Expr
+		if array, ok := typ.(*ast.ArrayType); ok && fn.Variadic && i == len(fn.Params)-2 {
+			typ = &ast.Ellipsis{Ellipsis: pos, Elt: array.Elt}
+			call.Ellipsis = pos
 		}
+		params = append(params, &ast.Field{Names: []*ast.Ident{ident(name)}, Type: typ})
+		call.Args = append(call.Args, ident(name))
+	}
+	var results []*ast.Field
+	for _, result := range fn.Results {
+		results = append(results, &ast.Field{Type: result.Type.Expr})
 	}
 
-	fn.Body = node.Body
-	fn.Env = env
-	return &fn
+	var body ast.Stmt = &ast.ExprStmt{X: call}
+	if len(results) > 0 {
+		body = &ast.ReturnStmt{Return: pos, Results: []ast.Expr{call}}
+	}
+	funcType := &ast.FuncType{Func: pos, Params: &ast.FieldList{List: params}}
+	if results != nil {
+		funcType.Results = &ast.FieldList{List: results}
+	}
+	return &ast.FuncLit{Type: funcType, Body: &ast.BlockStmt{Lbrace: pos, List: []ast.Stmt{body}, Rbrace: pos}}
 }
 
-func parseFunArgType(field *ast.Field) []object.FunArg {
-	var args []object.FunArg
-
-	var elemType object.ElemType
-	switch ty := field.Type.(type) {
-	case *ast.Ident:
-		elemType = object.ElemType{Type: ty}
-	case *ast.ArrayType:
-		elemType = object.ElemType{Type: ty.Elt.(*ast.Ident), TypeElem: object.ElemArray}
-	case *ast.MapType:
-		elemType = object.ElemType{TypeElem: object.ElemHash}
-		elemType.Types = make([]*ast.Ident, 2)
-		elemType.Types[0] = ty.Key.(*ast.Ident)
-		elemType.Types[1] = ty.Value.(*ast.Ident)
+func addType(prog *Program, spec *ast.TypeSpec) error {
+	typ := ParseTypeSpec(spec)
+	if object.IsError(typ) {
+		return errors.New(typ.String())
+	}
+	prog.Env.Set(spec.Name.Name, typ)
+	return nil
+}
+
+func ParseTypeSpec(spec *ast.TypeSpec) object.Object {
+	if spec.TypeParams != nil {
+		return object.NewGenericType(spec)
+	}
+	switch ty := spec.Type.(type) {
+	case *ast.StructType:
+		return object.NewStructType(spec.Name.Name, ty)
+	case *ast.InterfaceType:
+		return object.NewInterfaceType(spec.Name.Name, ty)
 	default:
+		return object.NewNamedType(spec.Name.Name, ty)
 	}
+}
 
-	if field.Names != nil {
-		for _, name := range field.Names {
-			arg := object.FunArg{Symbol: name, Type: elemType}
-			args = append(args, arg)
+// resolveNamedTypes 底层类型为结构体或接口的命名类型复制它的字段或方法签名，方法集是独立的
+func resolveNamedTypes(env *object.Environment) {
+	for name, value := range env.GetStore() {
+		nt, ok := value.(*object.NamedType)
+		if !ok {
+			continue
+		}
+		switch typ := underlyingType(nt, env).(type) {
+		case *object.StructType:
+			env.Define(name, &object.StructType{Name: name, Fields: typ.Fields, Methods: make(map[string]*object.Function)})
+		case *object.InterfaceType:
+			it := *typ
+			it.Name = name
+			env.Define(name, &it)
 		}
-	} else {
-		args = append(args, object.FunArg{Type: elemType})
 	}
-	return args
 }
 
-func parseResultType(field *ast.Field) []object.FunResult {
-	var results []object.FunResult
-
-	ft := fmt.Sprintf("%T", field.Type)
-	if ft == "*ast.FuncType" {
-		var funResult object.FunResult
-		funResult.IsFun = true
-		funcType := field.Type.(*ast.FuncType)
-		if funcType.Params != nil {
-			for _, item := range funcType.Params.List {
-				args := parseFunArgType(item)
-				funResult.Params = append(funResult.Params, args...)
-			}
-		}
-		if funcType.Results != nil {
-			for _, item := range funcType.Results.List {
-				rts := parseResultType(item)
-				funResult.Results = append(funResult.Results, rts...)
-			}
+// underlyingType 沿着命名类型找到底层的结构体或接口类型
+func underlyingType(nt *object.NamedType, env *object.Environment) object.Object {
+	seen := map[*object.NamedType]bool{}
+	for !seen[nt] {
+		seen[nt] = true
+		ident, ok := nt.Underlying.(*ast.Ident)
+		if !ok {
+			return nil
 		}
-		results = append(results, funResult)
-	} else {
-		var elemType object.ElemType
-		switch ty := field.Type.(type) {
-		case *ast.Ident:
-			elemType = object.ElemType{Type: ty}
-		case *ast.ArrayType:
-			elemType = object.ElemType{Type: ty.Elt.(*ast.Ident), TypeElem: object.ElemArray}
-		case *ast.MapType:
-			elemType = object.ElemType{TypeElem: object.ElemHash}
-			elemType.Types = make([]*ast.Ident, 2)
-			elemType.Types[0] = ty.Key.(*ast.Ident)
-			elemType.Types[1] = ty.Value.(*ast.Ident)
-		default:
+		typ, ok := env.ResolveType(ident.Name)
+		if !ok {
+			return nil
 		}
-
-		if field.Names != nil {
-			for _, name := range field.Names {
-				rt := object.FunResult{Symbol: name, Type: elemType}
-				results = append(results, rt)
-			}
-		} else {
-			rt := object.FunResult{Type: elemType}
-			results = append(results, rt)
+		next, ok := typ.(*object.NamedType)
+		if !ok {
+			return typ
 		}
+		nt = next
 	}
-	return results
+	return nil
+}
+
+func ParseFuncLit(node *ast.FuncLit, env *object.Environment) object.Object {
+	fn := object.ParseFuncType(node.Type)
+	fn.Body = node.Body
+	fn.Env = env
+	return fn
 }
@@ -9,11 +9,35 @@ import (
 	"strings"
 )
 
-func check(fset *token.FileSet, file *ast.File) error {
-	conf := types.Config{Importer: nil}
-	_, err := conf.Check("", fset, []*ast.File{file}, nil)
-	if err != nil {
-		return err
+// check 类型检查，isStmt 时最后一个表达式的值会被打印，不算未使用
+func check(fset *token.FileSet, file *ast.File, isStmt bool) error {
+	var result ast.Expr
+	if isStmt {
+		result = lastExpr(file)
+	}
+	var first error
+	conf := types.Config{Importer: nil, Error: func(err error) {
+		if terr, ok := err.(types.Error); ok && result != nil && terr.Pos == result.Pos() && strings.HasSuffix(terr.Msg, "is not used") {
+			return
+		}
+		if first == nil {
+			first = err
+		}
+	}}
+	_, _ = conf.Check("", fset, []*ast.File{file}, nil)
+	return first
+}
+
+// lastExpr main 中最后一个表达式语句
+func lastExpr(file *ast.File) ast.Expr {
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Name.Name != "main" || len(fn.Body.List) == 0 {
+			continue
+		}
+		if stmt, ok := fn.Body.List[len(fn.Body.List)-1].(*ast.ExprStmt); ok {
+			return stmt.X
+		}
 	}
 	return nil
 }
@@ -26,3 +50,196 @@ func formatError(err error, n int) error {
 	str = str[idx:]
 	return fmt.Errorf("%d%s", line-n, str)
 }
+
+type labelError struct {
+	Pos token.Pos
+	Msg string
+}
+
+func (e *labelError) Error() string { return e.Msg }
+
+// checkLabels 检查函数体中的标签，parser 已按函数的 label scope 把标签解析到 Label.Obj
+func checkLabels(file *ast.File) error {
+	var err error
+	ast.Inspect(file, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		var body *ast.BlockStmt
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			body = n.Body
+		case *ast.FuncLit:
+			body = n.Body
+		}
+		if body != nil {
+			lc := &labelChecker{used: make(map[*ast.Object]bool)}
+			err = lc.checkBody(body)
+		}
+		return true
+	})
+	return err
+}
+
+type labelChecker struct {
+	labels  []*ast.LabeledStmt
+	used    map[*ast.Object]bool
+	targets []*ast.LabeledStmt // 外层带标签的语句，break 和 continue 只能指向它们
+	blocks  []*stmtList        // 外层的语句列表，goto 只能跳到其中的标签
+}
+
+type stmtList struct {
+	list []ast.Stmt
+	idx  int
+}
+
+func (lc *labelChecker) checkBody(body *ast.BlockStmt) error {
+	err := lc.walkList(body.List)
+	if err != nil {
+		return err
+	}
+	for _, s := range lc.labels {
+		if !lc.used[s.Label.Obj] {
+			return &labelError{s.Label.Pos(), fmt.Sprintf("label %s defined and not used", s.Label.Name)}
+		}
+	}
+	return nil
+}
+
+func (lc *labelChecker) walkList(list []ast.Stmt) error {
+	block := &stmtList{list: list}
+	lc.blocks = append(lc.blocks, block)
+	for i, s := range list {
+		block.idx = i
+		err := lc.walk(s)
+		if err != nil {
+			return err
+		}
+	}
+	lc.blocks = lc.blocks[:len(lc.blocks)-1]
+	return nil
+}
+
+func (lc *labelChecker) walk(s ast.Stmt) error {
+	switch s := s.(type) {
+	case *ast.LabeledStmt:
+		for _, l := range lc.labels {
+			if l.Label.Name == s.Label.Name {
+				return &labelError{s.Label.Pos(), fmt.Sprintf("label %s already defined", s.Label.Name)}
+			}
+		}
+		lc.labels = append(lc.labels, s)
+		lc.targets = append(lc.targets, s)
+		err := lc.walk(s.Stmt)
+		lc.targets = lc.targets[:len(lc.targets)-1]
+		return err
+	case *ast.BlockStmt:
+		return lc.walkList(s.List)
+	case *ast.IfStmt:
+		err := lc.walkList(s.Body.List)
+		if err != nil || s.Else == nil {
+			return err
+		}
+		return lc.walk(s.Else)
+	case *ast.ForStmt:
+		return lc.walkList(s.Body.List)
+	case *ast.RangeStmt:
+		return lc.walkList(s.Body.List)
+	case *ast.SwitchStmt:
+		return lc.walkClauses(s.Body)
+	case *ast.TypeSwitchStmt:
+		return lc.walkClauses(s.Body)
+	case *ast.SelectStmt:
+		return lc.walkClauses(s.Body)
+	case *ast.BranchStmt:
+		return lc.checkBranch(s)
+	}
+	return nil
+}
+
+func (lc *labelChecker) walkClauses(body *ast.BlockStmt) error {
+	for _, stmt := range body.List {
+		var list []ast.Stmt
+		switch clause := stmt.(type) {
+		case *ast.CaseClause:
+			list = clause.Body
+		case *ast.CommClause:
+			list = clause.Body
+		}
+		err := lc.walkList(list)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (lc *labelChecker) checkBranch(s *ast.BranchStmt) error {
+	if s.Label == nil {
+		return nil
+	}
+	name := s.Label.Name
+	if s.Label.Obj == nil {
+		return &labelError{s.Label.Pos(), fmt.Sprintf("label %s undefined", name)}
+	}
+	lc.used[s.Label.Obj] = true
+	target := s.Label.Obj.Decl.(*ast.LabeledStmt)
+
+	switch s.Tok {
+	case token.BREAK:
+		switch target.Stmt.(type) {
+		case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			if lc.encloses(target) {
+				return nil
+			}
+		}
+		return &labelError{s.Label.Pos(), fmt.Sprintf("invalid break label %s", name)}
+	case token.CONTINUE:
+		switch target.Stmt.(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			if lc.encloses(target) {
+				return nil
+			}
+		}
+		return &labelError{s.Label.Pos(), fmt.Sprintf("invalid continue label %s", name)}
+	}
+
+	// goto 不能跳进块中，也不能向前越过变量声明
+	for i := len(lc.blocks) - 1; i >= 0; i-- {
+		block := lc.blocks[i]
+		for j, stmt := range block.list {
+			if stmt != target {
+				continue
+			}
+			for k := block.idx + 1; k < j; k++ {
+				if declares(block.list[k]) {
+					return &labelError{s.Label.Pos(), fmt.Sprintf("goto %s jumps over variable declaration", name)}
+				}
+			}
+			return nil
+		}
+	}
+	return &labelError{s.Label.Pos(), fmt.Sprintf("goto %s jumps into block", name)}
+}
+
+func (lc *labelChecker) encloses(target *ast.LabeledStmt) bool {
+	for _, s := range lc.targets {
+		if s == target {
+			return true
+		}
+	}
+	return false
+}
+
+func declares(s ast.Stmt) bool {
+	switch s := s.(type) {
+	case *ast.DeclStmt:
+		decl, ok := s.Decl.(*ast.GenDecl)
+		return ok && decl.Tok == token.VAR
+	case *ast.AssignStmt:
+		return s.Tok == token.DEFINE
+	case *ast.LabeledStmt:
+		return declares(s.Stmt)
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go/ast"
+	"goscript/compiler"
+	"goscript/evaluator"
+	"goscript/object"
+	"goscript/program"
+	"goscript/vm"
+	"io"
+	"strings"
+)
+
+const (
+	PROMPT       = ">> "
+	CONTINUATION = ".. "
+)
+
+// ErrIncomplete 输入还没有结束，需要继续读入下一行
+var ErrIncomplete = errors.New("incomplete input")
+
+// Session 在多次输入之间保留函数、类型、常量和全局变量
+type Session struct {
+	prog   *program.Program
+	isTree bool
+
+	comp    *compiler.Compiler
+	globals []object.Object
+}
+
+// NewSession engine 为 tree 时使用 evaluator，否则使用 vm
+func NewSession(engine string) *Session {
+	return &Session{
+		prog:    program.NewProgram(),
+		isTree:  engine == "tree",
+		comp:    compiler.New(),
+		globals: make([]object.Object, vm.GlobalsSize),
+	}
+}
+
+// Eval 执行一次输入，最后一条语句是表达式时返回它的值
+func (s *Session) Eval(src string) (object.Object, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	before := s.prog.Env.GetStore()
+	err := s.parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.run()
+	if err != nil {
+		s.rollback(before)
+		return nil, err
+	}
+	n := len(s.prog.Statements)
+	if n == 0 || result == object.NULL {
+		return nil, nil
+	}
+	if _, ok := s.prog.Statements[n-1].(*ast.ExprStmt); !ok {
+		return nil, nil
+	}
+	return result, nil
+}
+
+func (s *Session) run() (object.Object, error) {
+	if s.isTree {
+		result := evaluator.EvalProgram(s.prog)
+		if rerr, ok := result.(*object.Error); ok {
+			return nil, errors.New(rerr.Message)
+		}
+		return result, nil
+	}
+
+	err := s.comp.CompileProgram(s.prog)
+	if err != nil {
+		return nil, err
+	}
+	machine := vm.NewWithGlobals(s.comp.Bytecode(), s.globals)
+	err = machine.Run()
+	if err != nil {
+		return nil, err
+	}
+	return machine.LastPoppedStackElem(), nil
+}
+
+// rollback 撤销没有编译成功的声明，否则之后的每次输入都会重新编译它们
+func (s *Session) rollback(before map[string]object.Object) {
+	if s.isTree {
+		return
+	}
+	for name := range s.prog.Env.GetStore() {
+		if _, ok := before[name]; ok {
+			continue
+		}
+		if _, ok := s.comp.SymbolTable.Resolve(name); !ok {
+			s.prog.Env.Delete(name)
+		}
+	}
+}
+
+// parse 先按 main 中的语句解析，失败时再按顶层声明解析，函数和方法的声明只能出现在顶层
+func (s *Session) parse(src string) error {
+	if strings.HasPrefix(strings.TrimSpace(src), "type ") {
+		return incomplete(program.ParseInto(s.prog, program.Input{Content: src, IsDecl: true}))
+	}
+	err := incomplete(program.ParseInto(s.prog, program.Input{Content: src, IsStmt: true}))
+	if err == nil || err == ErrIncomplete || !strings.HasPrefix(strings.TrimSpace(src), "func") {
+		return err
+	}
+	return incomplete(program.ParseInto(s.prog, program.Input{Content: src, IsDecl: true}))
+}
+
+// incomplete 花括号没有闭合时 go/parser 报告 expected '}'
+func incomplete(err error) error {
+	if err != nil && strings.Contains(err.Error(), "expected '}', found 'EOF'") {
+		return ErrIncomplete
+	}
+	return err
+}
+
+// Start 逐行读入，花括号没有闭合时继续读入下一行
+func Start(in io.Reader, out io.Writer, engine string) {
+	scanner := bufio.NewScanner(in)
+	session := NewSession(engine)
+	var buf strings.Builder
+
+	for {
+		if buf.Len() == 0 {
+			fmt.Fprint(out, PROMPT)
+		} else {
+			fmt.Fprint(out, CONTINUATION)
+		}
+		if !scanner.Scan() {
+			return
+		}
+		buf.WriteString(scanner.Text())
+		buf.WriteString("\n")
+
+		result, err := session.Eval(buf.String())
+		if err == ErrIncomplete {
+			continue
+		}
+		buf.Reset()
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		if result != nil {
+			fmt.Fprintln(out, result.String())
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x := 40", ""},
+		{"func add(a, b int) int {\n\treturn a + b\n}", ""},
+		{"add(x, 2)", "42"},
+		{"type P struct {\n\tX int\n}", ""},
+		{"func (p P) Double() int { return p.X * 2 }", ""},
+		{"p := P{21}\np.Double()", "42"},
+		{"if x > 1 {\n\tx++\n}\nx", "41"},
+		{"const K = 7", ""},
+		{"f := func(a int) int { return a * K }\nf(x)", "287"},
+		{"var y int", ""},
+		{"g := func() {}\ng()", ""},
+		{"func h() {\n}", ""},
+		{"h()", ""},
+	}
+
+	for _, engine := range []string{"vm", "tree"} {
+		session := NewSession(engine)
+		for _, tt := range tests {
+			result, err := session.Eval(tt.input)
+			if err != nil {
+				t.Fatalf("%s: %q: %s", engine, tt.input, err)
+			}
+			got := ""
+			if result != nil {
+				got = result.String()
+			}
+			if got != tt.expected {
+				t.Errorf("%s: %q: want=%q, got=%q", engine, tt.input, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestSessionErrors(t *testing.T) {
+	for _, engine := range []string{"vm", "tree"} {
+		session := NewSession(engine)
+		if _, err := session.Eval("func f() int {"); err != ErrIncomplete {
+			t.Errorf("%s: expected incomplete input, got=%v", engine, err)
+		}
+		if _, err := session.Eval("func g() int { return 1 }"); err != nil {
+			t.Fatalf("%s: %s", engine, err)
+		}
+		if _, err := session.Eval("func g() int { return 2 }"); err == nil || !strings.Contains(err.Error(), "g redeclared") {
+			t.Errorf("%s: expected redeclared error, got=%v", engine, err)
+		}
+		if _, err := session.Eval("s := []int{1}\ns[5]"); err == nil {
+			t.Errorf("%s: expected runtime error", engine)
+		}
+		// 行号从本次输入的第一行算起
+		if _, err := session.Eval("z := 0\n\n1 / z"); err == nil || !strings.HasPrefix(err.Error(), "3:1 ") {
+			t.Errorf("%s: wrong error position. got=%v", engine, err)
+		}
+		// 出错之后之前的状态仍然可用
+		result, err := session.Eval("g() + len(s)")
+		if err != nil || result.String() != "2" {
+			t.Errorf("%s: wrong result after error. got=%v, err=%v", engine, result, err)
+		}
+	}
+
+	session := NewSession("vm")
+	if _, err := session.Eval("func bad() int { return nope }"); err == nil {
+		t.Fatalf("expected compiler error")
+	}
+	// 编译失败的函数被撤销，可以重新定义
+	if _, err := session.Eval("func bad() int { return 3 }"); err != nil {
+		t.Fatalf("redefine failed: %s", err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	in := strings.NewReader("func sq(n int) int {\n\treturn n * n\n}\nsq(9)\n")
+	var out bytes.Buffer
+	Start(in, &out, "vm")
+
+	expected := ">> .. .. >> 81\n>> "
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
@@ -0,0 +1,120 @@
+package vm
+
+import (
+	"fmt"
+	"go/token"
+	"goscript/object"
+	"strconv"
+	"strings"
+)
+
+// RuntimeError vm 中没有被 recover 的 panic 或运行时错误，保留出错时的调用栈
+type RuntimeError struct {
+	Message   string
+	Value     object.Object // panic 传入的值，运行时错误为 nil
+	Pos       token.Position
+	Goroutine int
+	Frames    []TraceFrame // 最内层在前
+}
+
+// TraceFrame 调用栈中的一个函数，Pos 是其中正在执行的位置
+type TraceFrame struct {
+	Function string
+	Pos      token.Position
+	Args     []object.Object
+}
+
+// Error 和 evaluator 一样在错误信息前加上出错的位置 file:line:col
+func (e *RuntimeError) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Message
+	}
+	return fmt.Sprintf("%s %s", e.Pos, e.Message)
+}
+
+// Trace 仿照 Go 程序崩溃时的输出
+func (e *RuntimeError) Trace() string {
+	var out strings.Builder
+	if !strings.HasPrefix(e.Message, "panic: ") {
+		out.WriteString("panic: ")
+	}
+	out.WriteString(e.Message)
+	fmt.Fprintf(&out, "\n\ngoroutine %d [running]:\n", e.Goroutine)
+	for _, frame := range e.Frames {
+		args := make([]string, len(frame.Args))
+		for i, arg := range frame.Args {
+			args[i] = argString(arg)
+		}
+		fmt.Fprintf(&out, "%s(%s)\n", frame.Function, strings.Join(args, ", "))
+		if frame.Pos.IsValid() {
+			fmt.Fprintf(&out, "\t%s\n", frame.Pos)
+		} else {
+			out.WriteString("\t?\n")
+		}
+	}
+	return out.String()
+}
+
+func argString(arg object.Object) string {
+	switch arg := unwrapValue(arg).(type) {
+	case nil:
+		return "nil"
+	case *object.String:
+		return strconv.Quote(arg.Value)
+	default:
+		return arg.String()
+	}
+}
+
+// stackTrace 从当前帧向外记录调用栈，循环帧并入所在的函数，位置取最内层的帧
+func (vm *VM) stackTrace() []object.StackFrame {
+	var stack []object.StackFrame
+	pos := token.NoPos
+	inner := true
+	for i := vm.frameIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		if inner {
+			pos = frame.Cl.Fn.Lines.Lookup(frame.Ip)
+			inner = false
+		}
+		if frame.IsLoop {
+			continue
+		}
+		fn := frame.Cl.Fn
+		name := fn.Name
+		if name == "" {
+			name = "func literal"
+		}
+		args := make([]object.Object, fn.NumParams)
+		copy(args, vm.stack[frame.BasePointer:frame.BasePointer+fn.NumParams])
+		stack = append(stack, object.StackFrame{Function: name, Pos: pos, Args: args})
+		inner = true
+	}
+	return stack
+}
+
+// runtimeError 把 goroutine 结束时的错误转换为 *RuntimeError，死锁等其他错误原样返回
+func (vm *VM) runtimeError(err error) error {
+	if fe, ok := err.(fatalError); ok {
+		if rerr, ok := fe.err.(*RuntimeError); ok {
+			return rerr
+		}
+		return err
+	}
+	p, ok := err.(*object.Error)
+	if !ok {
+		return err
+	}
+	rerr := &RuntimeError{Message: p.Message, Value: p.Value, Pos: vm.position(p.Pos), Goroutine: vm.id}
+	for _, frame := range p.Stack {
+		rerr.Frames = append(rerr.Frames, TraceFrame{Function: frame.Function, Pos: vm.position(frame.Pos), Args: frame.Args})
+	}
+	return rerr
+}
+
+func (vm *VM) position(pos token.Pos) token.Position {
+	if !pos.IsValid() || vm.fset == nil {
+		return token.Position{}
+	}
+	return vm.fset.Position(pos)
+}
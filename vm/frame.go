@@ -11,6 +11,13 @@ type Frame struct {
 	BasePointer int
 	IsLoop      bool
 	IsMain      bool
+	Signal      object.Object // 循环帧结束的原因：break、continue、带标签的跳转或 return 的值
+	Defers      []*deferredCall
+}
+
+type deferredCall struct {
+	fn   object.Object
+	args []object.Object
 }
 
 func NewFrame(fn *object.Closure, basePointer int) *Frame {
@@ -0,0 +1,351 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"goscript/code"
+	"goscript/object"
+	"math/rand"
+	"runtime"
+)
+
+var errDeadlock = errors.New("all goroutines are asleep - deadlock!")
+
+// scheduler 同一时刻只有一个 goroutine 在执行，按就绪顺序轮流运行
+type scheduler struct {
+	main  *VM
+	ready []*VM
+	err   error // goroutine 中未恢复的 panic 或死锁，交给 main 返回
+	quit  chan struct{}
+	count int // 已创建的 goroutine 数，main 是 1
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{quit: make(chan struct{}), count: 1}
+}
+
+// fatalError 不能被 recover，也不执行 defer
+type fatalError struct {
+	err error
+}
+
+func (e fatalError) Error() string { return e.err.Error() }
+
+func (s *scheduler) next() *VM {
+	if len(s.ready) == 0 {
+		return nil
+	}
+	g := s.ready[0]
+	s.ready = s.ready[1:]
+	return g
+}
+
+func (s *scheduler) waker(vm *VM) func() {
+	return func() {
+		s.ready = append(s.ready, vm)
+	}
+}
+
+// exit goroutine 结束，把执行权交给下一个就绪的 goroutine
+func (s *scheduler) exit(err error) {
+	next := s.next()
+	if err != nil {
+		s.err = err
+		next = s.main
+	} else if next == nil {
+		s.err = errDeadlock
+		next = s.main
+	}
+	next.wake <- struct{}{}
+}
+
+// stop main 结束时其余 goroutine 随之退出
+func (s *scheduler) stop() {
+	close(s.quit)
+	s.quit = make(chan struct{})
+	s.ready = nil
+	s.err = nil
+}
+
+// park 阻塞当前 goroutine，直到被通道操作唤醒
+func (vm *VM) park() error {
+	s := vm.sched
+	next := s.next()
+	if next == nil {
+		if vm == s.main {
+			return fatalError{errDeadlock}
+		}
+		s.err = errDeadlock
+		next = s.main
+	}
+	next.wake <- struct{}{}
+
+	select {
+	case <-vm.wake:
+	case <-vm.quit:
+		runtime.Goexit()
+	}
+	if vm == s.main && s.err != nil {
+		return fatalError{s.err}
+	}
+	return nil
+}
+
+// block nil 通道上的收发永远阻塞
+func (vm *VM) block() error {
+	for {
+		err := vm.park()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// execGo 新的 goroutine 有自己的栈和帧，共享常量和全局变量
+func (vm *VM) execGo(numArgs int) {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	fn := vm.stack[vm.sp-1-numArgs]
+	vm.sp = vm.sp - numArgs - 1
+
+	vm.sched.count++
+	g := &VM{
+		id:        vm.sched.count,
+		constants: vm.constants,
+		stack:     make([]object.Object, StackSize),
+		globals:   vm.globals,
+		methods:   vm.methods,
+		frames:    make([]*Frame, MaxFrames),
+		sched:     vm.sched,
+		wake:      make(chan struct{}, 1),
+		quit:      vm.sched.quit,
+		fset:      vm.fset,
+	}
+	vm.sched.ready = append(vm.sched.ready, g)
+	go g.start(&deferredCall{fn: fn, args: args})
+}
+
+func (vm *VM) start(call *deferredCall) {
+	select {
+	case <-vm.wake:
+	case <-vm.quit:
+		return
+	}
+	err := vm.invoke(call)
+	if _, ok := err.(fatalError); ok {
+		return
+	}
+	if err != nil {
+		err = vm.runtimeError(err)
+	}
+	vm.sched.exit(err)
+}
+
+func (vm *VM) send(ch *object.Channel, value object.Object) error {
+	if ch.Closed {
+		return object.NewPanic("send on closed channel")
+	}
+	if w := ch.Receiver(); w != nil {
+		w.Value, w.Ok = value, true
+		w.Wake()
+		return nil
+	}
+	if len(ch.Buffer) < ch.Cap {
+		ch.Buffer = append(ch.Buffer, value)
+		return nil
+	}
+
+	w := &object.Waiter{Value: value, Wake: vm.sched.waker(vm)}
+	ch.SendQ = append(ch.SendQ, w)
+	err := vm.park()
+	if err != nil {
+		return err
+	}
+	if !w.Ok {
+		return object.NewPanic("send on closed channel")
+	}
+	return nil
+}
+
+// recv 通道关闭且缓冲为空时返回零值和 false
+func (vm *VM) recv(ch *object.Channel) (object.Object, bool, error) {
+	if len(ch.Buffer) > 0 {
+		value := ch.Buffer[0]
+		ch.Buffer = ch.Buffer[1:]
+		if w := ch.Sender(); w != nil {
+			ch.Buffer = append(ch.Buffer, w.Value)
+			w.Ok = true
+			w.Wake()
+		}
+		return value, true, nil
+	}
+	if w := ch.Sender(); w != nil {
+		w.Ok = true
+		w.Wake()
+		return w.Value, true, nil
+	}
+	if ch.Closed {
+		return ch.Zero(), false, nil
+	}
+
+	w := &object.Waiter{Wake: vm.sched.waker(vm)}
+	ch.RecvQ = append(ch.RecvQ, w)
+	err := vm.park()
+	if err != nil {
+		return nil, false, err
+	}
+	return w.Value, w.Ok, nil
+}
+
+func (vm *VM) execSend() error {
+	value := unwrapValue(vm.pop())
+	switch ch := unwrapValue(vm.pop()).(type) {
+	case *object.Channel:
+		return vm.send(ch, value)
+	case *object.Null:
+		return vm.block()
+	default:
+		return fmt.Errorf("invalid operation: cannot send to non-chan type %s", ch.Type())
+	}
+}
+
+func (vm *VM) execRecv(commaOk bool) error {
+	var value object.Object
+	var ok bool
+	var err error
+	switch ch := unwrapValue(vm.pop()).(type) {
+	case *object.Channel:
+		value, ok, err = vm.recv(ch)
+	case *object.Null:
+		err = vm.block()
+	default:
+		return fmt.Errorf("invalid operation: cannot receive from non-chan type %s", ch.Type())
+	}
+	if err != nil {
+		return err
+	}
+	if commaOk {
+		return vm.push(&object.MapExist{Value: value, Exist: ok})
+	}
+	return vm.push(value)
+}
+
+type selectCase struct {
+	index int
+	send  bool
+	ch    *object.Channel
+	value object.Object
+}
+
+// execSelect 随机选择一个就绪的分支，都未就绪时执行 default 或在所有通道上等待
+func (vm *VM) execSelect(kinds []object.Object) error {
+	slots := 0
+	for _, kind := range kinds {
+		switch kind.(*object.Int).Value {
+		case code.SelectRecv:
+			slots++
+		case code.SelectSend:
+			slots += 2
+		}
+	}
+	start := vm.sp - slots
+	pos := start
+
+	var cases []selectCase
+	defaultIdx := -1
+	for i, kind := range kinds {
+		sc := selectCase{index: i}
+		var ch object.Object
+		switch kind.(*object.Int).Value {
+		case code.SelectRecv:
+			ch = unwrapValue(vm.stack[pos])
+			pos++
+		case code.SelectSend:
+			ch = unwrapValue(vm.stack[pos])
+			sc.value = unwrapValue(vm.stack[pos+1])
+			sc.send = true
+			pos += 2
+		default:
+			defaultIdx = i
+			continue
+		}
+		switch ch := ch.(type) {
+		case *object.Channel:
+			sc.ch = ch
+			cases = append(cases, sc)
+		case *object.Null:
+			// nil 通道的分支永远不会就绪
+		default:
+			return fmt.Errorf("invalid operation: select on non-chan type %s", ch.Type())
+		}
+	}
+	vm.sp = start
+
+	var ready []selectCase
+	for _, sc := range cases {
+		if (sc.send && sc.ch.CanSend()) || (!sc.send && sc.ch.CanRecv()) {
+			ready = append(ready, sc)
+		}
+	}
+	if len(ready) > 0 {
+		sc := ready[rand.Intn(len(ready))]
+		if sc.send {
+			err := vm.send(sc.ch, sc.value)
+			if err != nil {
+				return err
+			}
+			return vm.pushSelected(sc.index, nil, false)
+		}
+		value, ok, err := vm.recv(sc.ch)
+		if err != nil {
+			return err
+		}
+		return vm.pushSelected(sc.index, value, ok)
+	}
+	if defaultIdx >= 0 {
+		return vm.pushSelected(defaultIdx, nil, false)
+	}
+	if len(cases) == 0 {
+		return vm.block()
+	}
+
+	sel := &object.SelectWait{}
+	waiters := make([]*object.Waiter, len(cases))
+	for i, sc := range cases {
+		w := &object.Waiter{Value: sc.value, Wake: vm.sched.waker(vm), Case: sc.index, Select: sel}
+		if sc.send {
+			sc.ch.SendQ = append(sc.ch.SendQ, w)
+		} else {
+			sc.ch.RecvQ = append(sc.ch.RecvQ, w)
+		}
+		waiters[i] = w
+	}
+	err := vm.park()
+	for i, sc := range cases {
+		sc.ch.Remove(waiters[i])
+	}
+	if err != nil {
+		return err
+	}
+
+	w := sel.Chosen
+	if kinds[w.Case].(*object.Int).Value == code.SelectSend {
+		if !w.Ok {
+			return object.NewPanic("send on closed channel")
+		}
+		return vm.pushSelected(w.Case, nil, false)
+	}
+	return vm.pushSelected(w.Case, w.Value, w.Ok)
+}
+
+// pushSelected 接收到的值和选中的分支序号，分支中的赋值语句从栈上取值
+func (vm *VM) pushSelected(index int, value object.Object, ok bool) error {
+	if value == nil {
+		value = object.NULL
+	}
+	err := vm.push(&object.MapExist{Value: value, Exist: ok})
+	if err != nil {
+		return err
+	}
+	return vm.push(&object.Int{Value: index})
+}
@@ -2,8 +2,10 @@ package vm
 
 import (
 	"errors"
+	"go/token"
 	"goscript/compiler"
 	"goscript/object"
+	"strings"
 )
 
 const (
@@ -19,36 +21,67 @@ type VM struct {
 	sp    int // 始终指向栈中的下一个空槽位
 
 	globals    []object.Object
+	methods    map[string]*object.Closure
 	frames     []*Frame
 	frameIndex int
+
+	panicking  *object.Error // 正在执行 defer 的 panic
+	deferFrame int           // 被 defer 直接调用的函数帧，recover 只在这里生效
+
+	sched *scheduler
+	wake  chan struct{}
+	quit  chan struct{}
+
+	fset *token.FileSet // 错误信息中的位置
+	id   int            // goroutine 的编号
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	return NewWithGlobals(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobals 使用已有的全局变量，REPL 每次输入都新建 VM 但保留全局变量
+func NewWithGlobals(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	mainFn := &object.CompiledFunction{Name: "main", Instructions: bytecode.Instructions, Lines: bytecode.Lines}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, bytecode.SymbolTable.NumDefinitions)
 	mainFrame.IsMain = true
 
-	globals := make([]object.Object, GlobalsSize)
-	j := 0
+	methods := make(map[string]*object.Closure)
 	for i := 0; i < len(bytecode.Constants); i++ {
 		fn, ok := bytecode.Constants[i].(*object.CompiledFunction)
-		if ok && fn.Name != "" {
-			globals[j] = &object.Closure{Fn: fn, Free: make([]object.Object, 0)}
-			j++
+		if ok && strings.Contains(fn.Name, "[") {
+			// 泛型类型实例的方法只能通过接收者调用，泛型函数的实例从常量池加载，都不占用全局变量的槽位
+			methods[fn.Name] = &object.Closure{Fn: fn, Free: make([]object.Object, 0)}
+		} else if ok && fn.Name != "" {
+			closure := &object.Closure{Fn: fn, Free: make([]object.Object, 0)}
+			// 函数和 main 中的变量共用全局槽位，按符号表中的位置放置
+			if symbol, ok := bytecode.SymbolTable.Store[fn.Name]; ok {
+				globals[symbol.Index] = closure
+			}
+			if strings.Contains(fn.Name, ".") {
+				methods[fn.Name] = closure
+			}
 		}
 	}
 
 	frames := make([]*Frame, MaxFrames)
 	frames[0] = mainFrame
-	return &VM{
+	vm := &VM{
 		constants:  bytecode.Constants,
 		stack:      make([]object.Object, StackSize),
 		sp:         0,
 		globals:    globals,
+		methods:    methods,
 		frames:     frames,
 		frameIndex: 1,
+		sched:      newScheduler(),
+		wake:       make(chan struct{}, 1),
+		fset:       bytecode.Fset,
+		id:         1,
 	}
+	vm.sched.main = vm
+	return vm
 }
 
 func (vm *VM) push(obj object.Object) error {
@@ -5,219 +5,470 @@ import (
 	"fmt"
 	"goscript/code"
 	"goscript/object"
+	"goscript/program"
 	"strings"
 )
 
 func (vm *VM) Run() error {
-	var ip int
-	var ins code.Instructions
-	var op code.Opcode
-
-	for vm.currentFrame().Ip < len(vm.currentFrame().Instructions())-1 {
-		vm.currentFrame().Ip++
+	err := vm.run(vm.frameIndex)
+	vm.sched.stop()
+	if err != nil {
+		return vm.runtimeError(err)
+	}
+	return nil
+}
 
-		ip = vm.currentFrame().Ip
-		ins = vm.currentFrame().Instructions()
-		op = code.Opcode(ins[ip])
+// locate 记录出错时的调用栈，循环帧中的错误已经在内层记录过
+func (vm *VM) locate(err error) error {
+	if _, ok := err.(fatalError); ok {
+		return err
+	}
+	p := toPanic(err)
+	if p.Stack == nil {
+		p.Stack = vm.stackTrace()
+		if !p.Pos.IsValid() && len(p.Stack) > 0 {
+			p.Pos = p.Stack[0].Pos
+		}
+	}
+	return p
+}
 
-		switch op {
-		case code.OpPop:
-			vm.execPop()
-		case code.OpTrue:
-			err := vm.push(object.TRUE)
-			if err != nil {
-				return err
-			}
-		case code.OpFalse:
-			err := vm.push(object.FALSE)
-			if err != nil {
-				return err
-			}
-		case code.OpConstant:
-			idx := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().Ip += 2
-			err := vm.push(vm.constants[idx])
-			if err != nil {
-				return err
-			}
-		case code.OpClosure:
-			constIdx := code.ReadUint16(ins[ip+1:])
-			numFrees := code.ReadUint8(ins[ip+3:])
-			vm.currentFrame().Ip += 3
-			err := vm.pushClosure(int(constIdx), int(numFrees))
-			if err != nil {
-				return err
-			}
-		case code.OpCurrentClosure:
-			currentClosure := vm.currentFrame().Cl
-			err := vm.push(currentClosure)
-			if err != nil {
-				return err
-			}
-		case code.OpGetBuiltin:
-			builtinIdx := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().Ip += 1
-			definition := object.Builtins[builtinIdx]
-			err := vm.push(definition.Builtin)
-			if err != nil {
-				return err
-			}
-		case code.OpADD, code.OpSUB, code.OpMUL, code.OpQUO, code.OpREM,
-			code.OpAND, code.OpOR, code.OpXOR, code.OpSHL, code.OpSHR, code.OpAND_NOT,
-			code.OpEQL, code.OpLSS, code.OpGTR,
-			code.OpNEQ, code.OpLEQ, code.OpGEQ,
-			code.OpLAND, code.OpLOR:
-			right := vm.pop()
-			left := vm.pop()
-
-			rt := doBinaryExpr(op, left, right)
-			if object.IsError(rt) {
-				return errors.New(rt.(*object.Error).Message)
-			}
-			err := vm.push(rt)
-			if err != nil {
-				return err
-			}
-		case code.OpPrefixSub, code.OpPrefixAdd, code.OpNOT, code.OpINC, code.OpDEC:
-			obj := vm.pop()
-			rt := doUnaryExpr(op, obj)
-			if object.IsError(rt) {
-				return errors.New(rt.(*object.Error).Message)
-			}
-			err := vm.push(rt)
+// run 执行到 depth 处的帧结束，出错时按 panic 展开调用栈
+func (vm *VM) run(depth int) error {
+	for vm.frameIndex >= depth && vm.currentFrame().Ip < len(vm.currentFrame().Instructions())-1 {
+		err := vm.step()
+		if err != nil {
+			err = vm.unwind(depth, vm.locate(err))
 			if err != nil {
 				return err
 			}
-		case code.OpJumpNotTruthy:
-			pos := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().Ip += 2
+		}
+	}
 
-			condition := vm.pop()
-			if !object.IsTruthy(condition) {
-				vm.currentFrame().Ip = pos - 1
-			}
-		case code.OpJump:
-			pos := int(code.ReadUint16(ins[ip+1:]))
+	// main 没有 return 指令，结束时执行 defer
+	if vm.frameIndex >= depth && vm.currentFrame().IsMain {
+		last := vm.stack[vm.sp]
+		if p := vm.runDefers(vm.currentFrame(), nil); p != nil {
+			return p
+		}
+		vm.stack[vm.sp] = last
+	}
+	return nil
+}
+
+func (vm *VM) step() error {
+	vm.currentFrame().Ip++
+
+	ip := vm.currentFrame().Ip
+	ins := vm.currentFrame().Instructions()
+	op := code.Opcode(ins[ip])
+
+	switch op {
+	case code.OpPop:
+		vm.execPop()
+	case code.OpTrue:
+		err := vm.push(object.TRUE)
+		if err != nil {
+			return err
+		}
+	case code.OpFalse:
+		err := vm.push(object.FALSE)
+		if err != nil {
+			return err
+		}
+	case code.OpConstant:
+		idx := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().Ip += 2
+		err := vm.push(vm.constants[idx])
+		if err != nil {
+			return err
+		}
+	case code.OpClosure:
+		constIdx := code.ReadUint16(ins[ip+1:])
+		numFrees := code.ReadUint8(ins[ip+3:])
+		vm.currentFrame().Ip += 3
+		err := vm.pushClosure(int(constIdx), int(numFrees))
+		if err != nil {
+			return err
+		}
+	case code.OpCurrentClosure:
+		currentClosure := vm.currentFrame().Cl
+		err := vm.push(currentClosure)
+		if err != nil {
+			return err
+		}
+	case code.OpGetBuiltin:
+		builtinIdx := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().Ip += 1
+		definition := object.Builtins[builtinIdx]
+		err := vm.push(definition.Builtin)
+		if err != nil {
+			return err
+		}
+	case code.OpADD, code.OpSUB, code.OpMUL, code.OpQUO, code.OpREM,
+		code.OpAND, code.OpOR, code.OpXOR, code.OpSHL, code.OpSHR, code.OpAND_NOT,
+		code.OpEQL, code.OpLSS, code.OpGTR,
+		code.OpNEQ, code.OpLEQ, code.OpGEQ,
+		code.OpLAND, code.OpLOR:
+		right := vm.pop()
+		left := vm.pop()
+
+		rt := doBinaryExpr(op, left, right)
+		if object.IsError(rt) {
+			return errors.New(rt.(*object.Error).Message)
+		}
+		err := vm.push(rt)
+		if err != nil {
+			return err
+		}
+	case code.OpPrefixSub, code.OpPrefixAdd, code.OpNOT, code.OpINC, code.OpDEC:
+		obj := vm.pop()
+		rt := doUnaryExpr(op, obj)
+		if object.IsError(rt) {
+			return errors.New(rt.(*object.Error).Message)
+		}
+		err := vm.push(rt)
+		if err != nil {
+			return err
+		}
+	case code.OpJumpNotTruthy:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().Ip += 2
+
+		condition := unwrapValue(vm.pop())
+		if !object.IsTruthy(condition) {
 			vm.currentFrame().Ip = pos - 1
-		case code.OpGetGlobal:
-			idx := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().Ip += 2
-			err := vm.push(vm.globals[idx])
-			if err != nil {
-				return err
-			}
-		case code.OpGetLocal:
-			localIdx := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().Ip += 2
-			frame := vm.currentFrame()
-			err := vm.push(vm.stack[frame.BasePointer+int(localIdx)])
-			if err != nil {
-				return err
-			}
-		case code.OpGetFree:
-			freeIdx := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().Ip += 1
+		}
+	case code.OpJump:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().Ip = pos - 1
+	case code.OpGetGlobal:
+		idx := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().Ip += 2
+		err := vm.push(vm.globals[idx])
+		if err != nil {
+			return err
+		}
+	case code.OpGetLocal:
+		localIdx := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().Ip += 2
+		frame := vm.currentFrame()
+		err := vm.push(vm.stack[frame.BasePointer+int(localIdx)])
+		if err != nil {
+			return err
+		}
+	case code.OpGetFree:
+		freeIdx := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().Ip += 1
 
-			currentClosure := vm.currentFrame().currentClosure()
-			err := vm.push(currentClosure.Free[freeIdx])
-			if err != nil {
-				return err
-			}
-		case code.OpSetGlobal, code.OpSetLocal:
-			tip, err := vm.execSetGlobalLocal(op, ins, ip)
-			if err != nil {
-				return err
-			}
-			vm.currentFrame().Ip = tip
-		case code.OpSetFree:
-			tip, err := vm.execSetFree(ins, ip)
-			if err != nil {
-				return err
-			}
-			vm.currentFrame().Ip = tip
-		case code.OpSetNil:
-			err := vm.execSetNil()
-			if err != nil {
-				return err
-			}
-		case code.OpNull:
-			err := vm.push(object.NULL)
-			if err != nil {
-				return err
-			}
-		case code.OpArray:
-			nums := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().Ip += 2
+		currentClosure := vm.currentFrame().currentClosure()
+		err := vm.push(currentClosure.Free[freeIdx])
+		if err != nil {
+			return err
+		}
+	case code.OpSetGlobal, code.OpSetLocal:
+		tip, err := vm.execSetGlobalLocal(op, ins, ip)
+		if err != nil {
+			return err
+		}
+		vm.currentFrame().Ip = tip
+	case code.OpSetFree:
+		tip, err := vm.execSetFree(ins, ip)
+		if err != nil {
+			return err
+		}
+		vm.currentFrame().Ip = tip
+	case code.OpSetNil:
+		err := vm.execSetNil()
+		if err != nil {
+			return err
+		}
+	case code.OpNull:
+		err := vm.push(object.NULL)
+		if err != nil {
+			return err
+		}
+	case code.OpArray:
+		nums := int(code.ReadUint16(ins[ip+1:]))
+		elemType := object.ObjectType(code.ReadUint8(ins[ip+3:]))
+		vm.currentFrame().Ip += 3
 
-			array := vm.buildArray(vm.sp-nums, vm.sp)
-			vm.sp = vm.sp - nums
+		array := vm.buildArray(vm.sp-nums, vm.sp).(*object.Array)
+		array.ElemType = elemType
+		vm.sp = vm.sp - nums
 
-			err := vm.push(array)
-			if err != nil {
-				return err
-			}
-		case code.OpHash:
-			nums := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().Ip += 2
+		err := vm.push(array)
+		if err != nil {
+			return err
+		}
+	case code.OpFixedArray:
+		idx := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().Ip += 2
+
+		typ := vm.constants[idx].(*object.Array)
+		nums := len(typ.Elements)
+		array := vm.buildArray(vm.sp-nums, vm.sp).(*object.Array)
+		array.ElemType = typ.ElemType
+		array.Fixed = true
+		vm.sp = vm.sp - nums
+
+		err := vm.push(array)
+		if err != nil {
+			return err
+		}
+	case code.OpHash:
+		nums := int(code.ReadUint16(ins[ip+1:]))
+		keyType := object.ObjectType(code.ReadUint8(ins[ip+3:]))
+		valueType := object.ObjectType(code.ReadUint8(ins[ip+4:]))
+		vm.currentFrame().Ip += 4
 
-			hash, err := vm.buildHash(vm.sp-nums, vm.sp)
-			if err != nil {
-				return err
-			}
-			vm.sp = vm.sp - nums
+		hash, err := vm.buildHash(vm.sp-nums, vm.sp)
+		if err != nil {
+			return err
+		}
+		hash.KeyType, hash.ValueType = keyType, valueType
+		vm.sp = vm.sp - nums
 
-			err = vm.push(hash)
-			if err != nil {
-				return err
-			}
-		case code.OpIndex:
-			index := vm.pop()
-			left := vm.pop()
+		err = vm.push(hash)
+		if err != nil {
+			return err
+		}
+	case code.OpIndex:
+		index := vm.pop()
+		left := vm.pop()
 
-			err := vm.execIndexExpr(left, index)
-			if err != nil {
-				return err
-			}
-		case code.OpCall:
-			numArgs := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().Ip += 1
+		err := vm.execIndexExpr(left, index)
+		if err != nil {
+			return err
+		}
+	case code.OpCall:
+		numArgs := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().Ip += 1
 
-			err := vm.executeCall(int(numArgs))
-			if err != nil {
-				return err
-			}
-		case code.OpForLoop:
-			err := vm.execForLoop()
-			if err != nil {
-				return err
-			}
-		case code.OpRangeLoop:
-			err := vm.execRangeLoop()
-			if err != nil {
-				return err
-			}
-		case code.OpSetGlobalIndex, code.OpSetLocalIndex:
-			tip, err := vm.execSetIndex(op, ins, ip)
-			if err != nil {
-				return err
-			}
-			vm.currentFrame().Ip = tip
-		case code.OpReturnValue:
-			err := vm.execReturnValue(ins, ip)
-			if err != nil {
-				return err
-			}
-		case code.OpReturn:
-			err := vm.execReturn()
-			if err != nil {
-				return err
-			}
-		case code.OpContinue, code.OpBreak:
-			tip, err := vm.execContinueOrBreak(op)
-			if err != nil {
-				return err
-			}
-			vm.currentFrame().Ip = tip
+		err := vm.executeCall(int(numArgs), false)
+		if err != nil {
+			return err
+		}
+	case code.OpForLoop:
+		err := vm.execForLoop()
+		if err != nil {
+			return err
+		}
+	case code.OpRangeLoop:
+		err := vm.execRangeLoop()
+		if err != nil {
+			return err
+		}
+	case code.OpSetIndex:
+		err := vm.execSetIndex()
+		if err != nil {
+			return err
+		}
+	case code.OpReturnValue:
+		err := vm.execReturnValue(ins, ip)
+		if err != nil {
+			return err
+		}
+	case code.OpReturn:
+		err := vm.execReturn()
+		if err != nil {
+			return err
+		}
+	case code.OpContinue, code.OpBreak:
+		tip, err := vm.execContinueOrBreak(op)
+		if err != nil {
+			return err
+		}
+		vm.currentFrame().Ip = tip
+	case code.OpBranch:
+		idx := code.ReadUint16(ins[ip+1:])
+		frame := vm.currentFrame()
+		frame.Signal = vm.constants[idx]
+		vm.sp = frame.BasePointer + frame.Cl.Fn.NumLocals
+		frame.Ip = len(frame.Instructions()) - 1
+	case code.OpJumpBranch:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		idx := code.ReadUint16(ins[ip+3:])
+		frame := vm.currentFrame()
+		frame.Ip += 4
+
+		signal, ok := frame.Signal.(*object.Branch)
+		branch := vm.constants[idx].(*object.Branch)
+		if ok && signal.Tok == branch.Tok && signal.Label == branch.Label {
+			frame.Signal = nil
+			frame.Ip = pos - 1
+		}
+	case code.OpStruct:
+		idx := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().Ip += 2
+
+		st := vm.constants[idx].(*object.StructType)
+		nums := len(st.Fields)
+		obj := vm.buildStruct(st, vm.sp-nums, vm.sp)
+		vm.sp = vm.sp - nums
+
+		err := vm.push(obj)
+		if err != nil {
+			return err
+		}
+	case code.OpGetField:
+		idx := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().Ip += 2
+
+		err := vm.execGetField(vm.constants[idx].(*object.String).Value)
+		if err != nil {
+			return err
+		}
+	case code.OpSetField:
+		idx := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().Ip += 2
+
+		err := vm.execSetField(vm.constants[idx].(*object.String).Value)
+		if err != nil {
+			return err
+		}
+	case code.OpTypeAssert:
+		idx := code.ReadUint16(ins[ip+1:])
+		commaOk := code.ReadUint8(ins[ip+3:]) == 1
+		vm.currentFrame().Ip += 3
+
+		err := vm.execTypeAssert(vm.constants[idx], commaOk)
+		if err != nil {
+			return err
+		}
+	case code.OpCase:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().Ip += 2
+
+		value := vm.pop()
+		rt := doBinaryExpr(code.OpEQL, vm.stack[vm.sp-1], value)
+		if object.IsError(rt) {
+			return errors.New(rt.(*object.Error).Message)
+		}
+		if object.IsTruthy(rt) {
+			vm.pop()
+			vm.currentFrame().Ip = pos - 1
+		}
+	case code.OpTypeCase:
+		idx := code.ReadUint16(ins[ip+1:])
+		pos := int(code.ReadUint16(ins[ip+3:]))
+		vm.currentFrame().Ip += 4
+
+		if matchType(vm.stack[vm.sp-1], vm.constants[idx]) {
+			vm.currentFrame().Ip = pos - 1
+		}
+	case code.OpDefer:
+		numArgs := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().Ip += 1
+
+		vm.execDefer(int(numArgs))
+	case code.OpGo:
+		numArgs := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().Ip += 1
+
+		vm.execGo(int(numArgs))
+	case code.OpChannel:
+		idx := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().Ip += 2
+
+		size, ok := unwrapValue(vm.pop()).(object.Integer)
+		if !ok || size.Integer() < 0 {
+			return errors.New("makechan: size out of range")
+		}
+		err := vm.push(&object.Channel{Elem: vm.constants[idx], Cap: int(size.Integer())})
+		if err != nil {
+			return err
+		}
+	case code.OpSend:
+		err := vm.execSend()
+		if err != nil {
+			return err
+		}
+	case code.OpARROW:
+		commaOk := code.ReadUint8(ins[ip+1:]) == 1
+		vm.currentFrame().Ip += 1
+
+		err := vm.execRecv(commaOk)
+		if err != nil {
+			return err
+		}
+	case code.OpSlice:
+		err := vm.execSlice()
+		if err != nil {
+			return err
+		}
+	case code.OpMakeSlice:
+		idx := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().Ip += 2
+
+		capacity := unwrapValue(vm.pop())
+		length, ok := unwrapValue(vm.pop()).(object.Integer)
+		if !ok {
+			return errors.New("makeslice: len out of range")
+		}
+		if capacity == object.NULL {
+			capacity = length.(object.Object)
+		}
+		size, ok := capacity.(object.Integer)
+		if !ok {
+			return errors.New("makeslice: cap out of range")
+		}
+		slice := object.MakeSlice(vm.constants[idx], int(length.Integer()), int(size.Integer()))
+		if err, ok := slice.(*object.Error); ok {
+			return err
+		}
+		err := vm.push(slice)
+		if err != nil {
+			return err
+		}
+	case code.OpELLIPSIS:
+		numArgs := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().Ip += 1
+
+		err := vm.spreadCall(int(numArgs))
+		if err != nil {
+			return err
+		}
+	case code.OpSelect:
+		idx := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().Ip += 2
+
+		err := vm.execSelect(vm.constants[idx].(*object.Array).Elements)
+		if err != nil {
+			return err
+		}
+	case code.OpPointer:
+		value, _, _ := extractData(vm.pop())
+		err := vm.push(object.NewPointer(object.CopyValue(value)))
+		if err != nil {
+			return err
+		}
+	case code.OpDeref:
+		value, err := deref(vm.pop())
+		if err != nil {
+			return err
+		}
+		err = vm.push(value)
+		if err != nil {
+			return err
+		}
+	case code.OpSetDeref:
+		err := vm.execSetDeref()
+		if err != nil {
+			return err
+		}
+	case code.OpIndexAddr:
+		err := vm.execIndexAddr()
+		if err != nil {
+			return err
+		}
+	case code.OpFieldAddr:
+		idx := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().Ip += 2
+
+		err := vm.execFieldAddr(vm.constants[idx].(*object.String).Value)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
@@ -249,65 +500,230 @@ func (vm *VM) pushClosure(idx, numFrees int) error {
 	return vm.push(closure)
 }
 
-func (vm *VM) executeCall(numArgs int) error {
+// executeCall spread 为 f(args, s...) 调用，最后一个参数是传给可变参数的切片
+func (vm *VM) executeCall(numArgs int, spread bool) error {
 	callee := vm.stack[vm.sp-1-numArgs]
 	switch callee := callee.(type) {
 	case *object.Closure:
-		return vm.callClosure(callee, numArgs)
+		return vm.callClosure(callee, numArgs, spread)
 	case *object.Builtin:
 		return vm.callBuiltin(callee, numArgs)
 	case *object.SingleReturn:
-		tmp := callee.Value.(*object.Closure)
-		vm.stack[vm.sp-1-numArgs] = tmp
-		return vm.executeCall(numArgs)
+		vm.stack[vm.sp-1-numArgs] = callee.Value
+		return vm.executeCall(numArgs, spread)
+	case *object.MapExist:
+		vm.stack[vm.sp-1-numArgs] = callee.Value
+		return vm.executeCall(numArgs, spread)
+	case *object.BoundMethod:
+		// 接收者插入到第一个参数的位置
+		copy(vm.stack[vm.sp-numArgs+1:vm.sp+1], vm.stack[vm.sp-numArgs:vm.sp])
+		vm.stack[vm.sp-numArgs] = callee.Recv
+		vm.stack[vm.sp-numArgs-1] = callee.Fn
+		vm.sp++
+		return vm.executeCall(numArgs+1, spread)
+	case *object.Null:
+		return errNilDeref
 	default:
 		return fmt.Errorf("calling non-function and non-built-in")
 	}
 }
 
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	if builtin == recoverBuiltin {
+		vm.sp = vm.sp - numArgs - 1
+		return vm.push(vm.recover())
+	}
+
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	result := builtin.Fn(args...)
+	for i, arg := range args {
+		args[i] = unwrapValue(arg)
+	}
+	result := object.ApplyBuiltin(builtin, args)
 	vm.sp = vm.sp - numArgs - 1
+	if err, ok := result.(*object.Error); ok {
+		// panic 带有传入的值，其余是参数错误
+		if err.Value != nil {
+			return err
+		}
+		return errors.New(err.Message)
+	}
 	if result != nil {
 		return vm.push(result)
 	}
-	return nil
+	return nil
+}
+
+// spreadCall f(args, s...) 可变参数函数直接接收切片，内置函数展开最后一个切片参数
+func (vm *VM) spreadCall(numArgs int) error {
+	var elems []object.Object
+	switch last := unwrapValue(vm.stack[vm.sp-1]).(type) {
+	case *object.Array:
+		elems = last.Elements
+	case *object.Null:
+	default:
+		return fmt.Errorf("cannot use ... with non-slice argument")
+	}
+	if _, ok := unwrapValue(vm.stack[vm.sp-1-numArgs]).(*object.Builtin); !ok {
+		return vm.executeCall(numArgs, true)
+	}
+
+	vm.sp--
+	for _, elem := range elems {
+		err := vm.push(elem)
+		if err != nil {
+			return err
+		}
+	}
+	return vm.executeCall(numArgs-1+len(elems), false)
+}
+
+func (vm *VM) execSlice() error {
+	var indexes [3]object.Object
+	for i := 2; i >= 0; i-- {
+		if index := unwrapValue(vm.pop()); index != object.NULL {
+			indexes[i] = index
+		}
+	}
+	x := unwrapValue(vm.pop())
+	rt := object.Slice(x, indexes[0], indexes[1], indexes[2])
+	if err, ok := rt.(*object.Error); ok {
+		return err
+	}
+	return vm.push(rt)
+}
+
+var recoverBuiltin = object.GetBuiltinByName("recover")
+
+func (vm *VM) recover() object.Object {
+	if vm.panicking == nil || vm.frameIndex != vm.deferFrame {
+		return object.NULL
+	}
+	value := object.PanicValue(vm.panicking)
+	vm.panicking = nil
+	return value
+}
+
+// execDefer 登记到最近的函数帧，循环帧共用外层函数的 defer
+func (vm *VM) execDefer(numArgs int) {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	fn := vm.stack[vm.sp-1-numArgs]
+	vm.sp = vm.sp - numArgs - 1
+
+	i := vm.frameIndex - 1
+	for i > 0 && vm.frames[i].IsLoop {
+		i--
+	}
+	frame := vm.frames[i]
+	frame.Defers = append(frame.Defers, &deferredCall{fn: fn, args: args})
+}
+
+// runDefers 后进先出执行 defer，返回未被 recover 的 panic
+func (vm *VM) runDefers(frame *Frame, p *object.Error) *object.Error {
+	for len(frame.Defers) > 0 {
+		n := len(frame.Defers) - 1
+		call := frame.Defers[n]
+		frame.Defers = frame.Defers[:n]
+
+		panicking, deferFrame := vm.panicking, vm.deferFrame
+		vm.panicking, vm.deferFrame = p, vm.frameIndex+1
+		err := vm.invoke(call)
+		p = vm.panicking
+		vm.panicking, vm.deferFrame = panicking, deferFrame
+		if err != nil {
+			p = toPanic(err)
+		}
+	}
+	return p
+}
+
+func (vm *VM) invoke(call *deferredCall) error {
+	sp := vm.sp
+	err := vm.push(call.fn)
+	if err != nil {
+		return err
+	}
+	for _, arg := range call.args {
+		err = vm.push(arg)
+		if err != nil {
+			return err
+		}
+	}
+
+	depth := vm.frameIndex + 1
+	err = vm.executeCall(len(call.args), false)
+	if err == nil {
+		err = vm.run(depth)
+	}
+	vm.sp = sp
+	return err
+}
+
+// unwind 逐帧执行 defer，recover 后所在函数正常返回
+func (vm *VM) unwind(depth int, err error) error {
+	if _, ok := err.(fatalError); ok {
+		return err
+	}
+	p := toPanic(err)
+	for vm.frameIndex >= depth {
+		frame := vm.currentFrame()
+		if len(frame.Defers) > 0 {
+			p = vm.runDefers(frame, p)
+			if p == nil {
+				return vm.execReturn()
+			}
+		}
+		vm.popFrame()
+	}
+	return p
+}
+
+func toPanic(err error) *object.Error {
+	if p, ok := err.(*object.Error); ok {
+		return p
+	}
+	return &object.Error{Message: err.Error()}
 }
 
 func (vm *VM) buildArray(startIdx, endIdx int) object.Object {
 	elements := make([]object.Object, endIdx-startIdx)
 	for i := startIdx; i < endIdx; i++ {
-		elements[i-startIdx] = vm.stack[i]
+		elements[i-startIdx] = object.CopyValue(unwrapValue(vm.stack[i]))
 	}
 	return &object.Array{Elements: elements}
 }
 
-func (vm *VM) buildHash(startIdx, endIdx int) (object.Object, error) {
-	pairs := make(map[object.HashKey]object.HashPair)
+func (vm *VM) buildStruct(st *object.StructType, startIdx, endIdx int) object.Object {
+	fields := make([]object.Object, endIdx-startIdx)
+	for i := startIdx; i < endIdx; i++ {
+		fields[i-startIdx] = object.CopyValue(unwrapValue(vm.stack[i]))
+	}
+	return &object.Struct{StructType: st, Fields: fields}
+}
+
+func (vm *VM) buildHash(startIdx, endIdx int) (*object.Hash, error) {
+	hash := &object.Hash{Pairs: make(map[object.HashKey][]object.HashPair)}
 	for i := startIdx; i < endIdx; i += 2 {
-		key := vm.stack[i]
-		value := vm.stack[i+1]
-		pair := object.HashPair{Key: key, Value: value}
-		hashKey, ok := pair.Key.(object.Hashable)
-		if !ok {
-			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		key := object.CopyValue(unwrapValue(vm.stack[i]))
+		value := object.CopyValue(unwrapValue(vm.stack[i+1]))
+		if err := hash.Set(key, value); err != nil {
+			return nil, err
 		}
-		pairs[hashKey.HashKey()] = pair
 	}
-	return &object.Hash{Pairs: pairs}, nil
+	return hash, nil
 }
 
 func (vm *VM) execIndexExpr(left object.Object, index object.Object) error {
+	left = object.Indexed(left)
 	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INT_OBJ:
-		return vm.execArrayIndex(left, index)
+	case left.Type() == object.ARRAY_OBJ && object.Unnamed(index).Type() == object.INT_OBJ:
+		return vm.execArrayIndex(left, object.Unnamed(index))
 	case left.Type() == object.HASH_OBJ:
 		return vm.execHashIndex(left, index)
 	case left.Type() == object.MAP_EXIST_OBJ:
 		return vm.execIndexExpr(left.(*object.MapExist).Value, index)
 	case left.Type() == object.STRING_OBJ:
-		return vm.execStringIndex(left, index)
+		return vm.execStringIndex(left, object.Unnamed(index))
 	default:
 		return fmt.Errorf("index operator not supported: %s", left.Type())
 	}
@@ -317,12 +733,11 @@ func (vm *VM) execArrayIndex(left, index object.Object) error {
 	arrayObj := left.(*object.Array)
 	idx := index.(*object.Int).Value
 
-	maxIdx := len(arrayObj.Elements) - 1
 	if idx < 0 {
 		return fmt.Errorf("index out of range [%d]", idx)
 	}
-	if idx > maxIdx {
-		return fmt.Errorf("index out of range [%d] with length %d", idx, maxIdx)
+	if idx >= len(arrayObj.Elements) {
+		return fmt.Errorf("index out of range [%d] with length %d", idx, len(arrayObj.Elements))
 	}
 
 	return vm.push(arrayObj.Elements[idx])
@@ -330,18 +745,17 @@ func (vm *VM) execArrayIndex(left, index object.Object) error {
 
 func (vm *VM) execHashIndex(left, index object.Object) error {
 	hashObj := left.(*object.Hash)
-	key, ok := index.(object.Hashable)
-	if !ok {
-		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	if _, err := object.HashOf(index); err != nil {
+		return err
 	}
 
-	pair, ok := hashObj.Pairs[key.HashKey()]
+	pair, ok := hashObj.Get(index)
 	var mapExist object.MapExist
 	mapExist.Exist = ok
 	if ok {
 		mapExist.Value = pair.Value
 	} else {
-		mapExist.Value = object.NULL
+		mapExist.Value = hashObj.Zero()
 	}
 	return vm.push(&mapExist)
 }
@@ -350,16 +764,188 @@ func (vm *VM) execStringIndex(left, index object.Object) error {
 	str := left.(*object.String).Value
 	idx := index.(*object.Int).Value
 
-	maxIdx := len(str) - 1
 	if idx < 0 {
 		return fmt.Errorf("index out of range [%d]", idx)
 	}
-	if idx > maxIdx {
-		return fmt.Errorf("index out of range [%d] with length %d", idx, maxIdx)
+	if idx >= len(str) {
+		return fmt.Errorf("index out of range [%d] with length %d", idx, len(str))
 	}
 	return vm.push(&object.Uint8{Value: str[idx]})
 }
 
+func (vm *VM) execGetField(name string) error {
+	x := vm.pop()
+	obj, err := deref(x)
+	if err != nil {
+		return err
+	}
+	if named, ok := obj.(*object.Named); ok {
+		return vm.namedMethod(x, named, name)
+	}
+	st, ok := obj.(*object.Struct)
+	if !ok {
+		return fmt.Errorf("%s.%s undefined (type %s has no field or method %s)", obj.Type(), name, obj.Type(), name)
+	}
+	value, ok := st.Get(name)
+	if ok {
+		return vm.push(unwrapValue(value))
+	}
+
+	recv, fn := st.Method(name)
+	if fn == nil {
+		return fmt.Errorf("%s undefined (type %s has no field or method %s)", name, st.StructType, name)
+	}
+	method, ok := vm.methods[program.MethodName(recv.StructType.Name, name)]
+	if !ok {
+		return fmt.Errorf("method %s.%s not compiled", recv.StructType, name)
+	}
+	if fn.PointerRecv() {
+		return vm.push(&object.BoundMethod{Recv: recv, Fn: method})
+	}
+	return vm.push(&object.BoundMethod{Recv: recv.Copy(), Fn: method})
+}
+
+// namedMethod 命名类型的方法，指针接收者需要 x 是指向该值的指针
+func (vm *VM) namedMethod(x object.Object, named *object.Named, name string) error {
+	fn := named.NamedType.Methods[name]
+	if fn == nil {
+		return fmt.Errorf("%s undefined (type %s has no field or method %s)", name, named.NamedType, name)
+	}
+	method, ok := vm.methods[program.MethodName(named.NamedType.Name, name)]
+	if !ok {
+		return fmt.Errorf("method %s.%s not compiled", named.NamedType, name)
+	}
+	if !fn.PointerRecv() {
+		return vm.push(&object.BoundMethod{Recv: object.CopyValue(named), Fn: method})
+	}
+	if _, ok := x.(*object.Pointer); !ok {
+		return fmt.Errorf("cannot call pointer method %s on %s", name, named.NamedType)
+	}
+	return vm.push(&object.BoundMethod{Recv: x, Fn: method})
+}
+
+func (vm *VM) execTypeAssert(typ object.Object, commaOk bool) error {
+	obj := unwrapValue(vm.pop())
+	value, ok := object.AssertType(obj, typ)
+	value = unwrapValue(value)
+	if commaOk {
+		return vm.push(&object.MapExist{Value: value, Exist: ok})
+	}
+	if !ok {
+		return errors.New(object.AssertError(obj, typ).Message)
+	}
+	return vm.push(value)
+}
+
+func matchType(value, typ object.Object) bool {
+	value = unwrapValue(value)
+	if typ == object.NULL {
+		return value == object.NULL
+	}
+	_, ok := object.AssertType(value, typ)
+	return ok
+}
+
+func (vm *VM) execSetField(name string) error {
+	obj, err := deref(vm.pop())
+	if err != nil {
+		return err
+	}
+
+	pos := vm.sp - 1
+	newValue, source, needPop := extractData(vm.stack[pos])
+	if needPop {
+		vm.pop()
+	} else {
+		vm.stack[pos] = source
+	}
+
+	st, ok := obj.(*object.Struct)
+	if !ok || !st.Set(name, object.CopyValue(newValue)) {
+		return fmt.Errorf("%s undefined (type %s has no field or method %s)", name, obj.Type(), name)
+	}
+	return nil
+}
+
+var errNilDeref = errors.New("invalid memory address or nil pointer dereference")
+
+// deref 取指针指向的值，指针接收者方法中的接收者就是结构体本身
+func deref(obj object.Object) (object.Object, error) {
+	obj = unwrapValue(obj)
+	if object.IsNil(obj) {
+		return nil, errNilDeref
+	}
+	if p, ok := obj.(*object.Pointer); ok {
+		return unwrapValue(p.Load()), nil
+	}
+	return obj, nil
+}
+
+func (vm *VM) execSetDeref() error {
+	target := unwrapValue(vm.pop())
+
+	pos := vm.sp - 1
+	newValue, source, needPop := extractData(vm.stack[pos])
+	if needPop {
+		vm.pop()
+	} else {
+		vm.stack[pos] = source
+	}
+
+	switch target := target.(type) {
+	case *object.Pointer:
+		if target.IsNil() {
+			return errNilDeref
+		}
+		target.Store(object.CopyValue(newValue))
+	case *object.Struct:
+		st, ok := unwrapValue(newValue).(*object.Struct)
+		if !ok {
+			return fmt.Errorf("cannot assign %s to *%s", newValue.Type(), target.StructType)
+		}
+		copy(target.Fields, st.Copy().Fields)
+	default:
+		return errNilDeref
+	}
+	return nil
+}
+
+func (vm *VM) execIndexAddr() error {
+	index := object.Unnamed(unwrapValue(vm.pop()))
+	switch x := object.Indexed(unwrapValue(vm.pop())).(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Int)
+		if !ok {
+			return fmt.Errorf("invalid argument: index %s must be integer", index.Type())
+		}
+		if idx.Value < 0 || idx.Value >= len(x.Elements) {
+			return fmt.Errorf("index out of range [%d] with length %d", idx.Value, len(x.Elements))
+		}
+		ref := &x.Elements[idx.Value]
+		return vm.push(&object.Pointer{Elem: *ref, Ref: ref})
+	case *object.Hash:
+		return fmt.Errorf("cannot take address of map element")
+	default:
+		return fmt.Errorf("cannot take address of %s element", x.Type())
+	}
+}
+
+func (vm *VM) execFieldAddr(name string) error {
+	obj, err := deref(vm.pop())
+	if err != nil {
+		return err
+	}
+	st, ok := obj.(*object.Struct)
+	if !ok {
+		return fmt.Errorf("%s.%s undefined (type %s has no field or method %s)", obj.Type(), name, obj.Type(), name)
+	}
+	ref := st.FieldRef(name)
+	if ref == nil {
+		return fmt.Errorf("%s undefined (type %s has no field or method %s)", name, st.StructType, name)
+	}
+	return vm.push(&object.Pointer{Elem: *ref, Ref: ref})
+}
+
 func (vm *VM) execReturnValue(ins code.Instructions, ip int) error {
 	frame := vm.currentFrame()
 
@@ -381,6 +967,21 @@ func (vm *VM) execReturnValue(ins code.Instructions, ip int) error {
 		}
 	}
 
+	// 循环帧中的 return 交给外层函数帧处理
+	if frame.IsLoop {
+		frame.Signal = rt
+		frame.Ip = len(frame.Instructions()) - 1
+		return nil
+	}
+	return vm.returnValue(rt)
+}
+
+func (vm *VM) returnValue(rt object.Object) error {
+	frame := vm.currentFrame()
+	if p := vm.runDefers(frame, nil); p != nil {
+		return p
+	}
+
 	// 特殊处理
 	if !frame.IsMain {
 		vm.stack[frame.BasePointer-1] = rt
@@ -395,7 +996,20 @@ func (vm *VM) execReturnValue(ins code.Instructions, ip int) error {
 }
 
 func (vm *VM) execReturn() error {
-	frame := vm.popFrame()
+	frame := vm.currentFrame()
+	if frame.IsLoop {
+		frame.Signal = object.RETURN
+		frame.Ip = len(frame.Instructions()) - 1
+		return nil
+	}
+	if p := vm.runDefers(frame, nil); p != nil {
+		return p
+	}
+	if frame.IsMain {
+		frame.Ip = len(frame.Instructions()) - 1
+		return nil
+	}
+	vm.popFrame()
 
 	numArgs := frame.Cl.Fn.NumParams
 	numResult := frame.Cl.Fn.NumResult
@@ -403,6 +1017,9 @@ func (vm *VM) execReturn() error {
 	if numResult > 0 {
 		for i := 0; i < numResult; i++ {
 			rts[i] = vm.stack[frame.BasePointer+numArgs+i]
+			if frame.Cl.Fn.ResultHeap[i] {
+				rts[i] = rts[i].(*object.Pointer).Load()
+			}
 		}
 	}
 	if len(rts) == 0 {
@@ -426,6 +1043,11 @@ func (vm *VM) execReturn() error {
 }
 
 func (vm *VM) execPop() {
+	// 无返回值的调用不会入栈，也就没有最后弹出的值
+	if vm.sp == 0 {
+		vm.stack[0] = nil
+		return
+	}
 	obj := vm.pop()
 	switch rt := obj.(type) {
 	case *object.SingleReturn:
@@ -436,8 +1058,21 @@ func (vm *VM) execPop() {
 	}
 }
 
-func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
-	if numArgs != cl.Fn.NumParams+cl.Fn.NumResult {
+func (vm *VM) callClosure(cl *object.Closure, numArgs int, spread bool) error {
+	if cl.Fn.Variadic && !spread {
+		// 多出的参数打包为切片，作为最后一个参数
+		fixed := cl.Fn.NumParams - 1
+		if numArgs < fixed {
+			return fmt.Errorf("execute function wrong number of arguments: want>=%d, got=%d", fixed, numArgs)
+		}
+		start := vm.sp - (numArgs - fixed)
+		vm.stack[start] = vm.buildArray(start, vm.sp)
+		vm.sp = start + 1
+		numArgs = cl.Fn.NumParams
+	} else if spread && !cl.Fn.Variadic {
+		return fmt.Errorf("cannot use ... in call to non-variadic function")
+	}
+	if numArgs != cl.Fn.NumParams {
 		return fmt.Errorf("execute function wrong number of arguments: want=%d, got=%d", cl.Fn.NumParams, numArgs)
 	}
 
@@ -457,41 +1092,45 @@ func (vm *VM) execForLoop() error {
 	if forLoop.Init != nil {
 		initFn := &object.CompiledFunction{
 			Instructions: forLoop.Init,
+			Lines:        forLoop.InitLines,
 			NumLocals:    forLoop.NumLocals,
 			NumParams:    0,
 			FreeNum:      forLoop.FreeNum,
 		}
-		initFrame = NewFrame(&object.Closure{Fn: initFn, Free: closure.Free}, vm.sp)
+		initFrame = NewLoopFrame(&object.Closure{Fn: initFn, Free: closure.Free}, vm.sp)
 	}
 
 	condFn := &object.CompiledFunction{
 		Instructions: forLoop.Cond,
+		Lines:        forLoop.CondLines,
 		NumLocals:    forLoop.NumLocals,
 		NumParams:    0,
 		FreeNum:      forLoop.FreeNum,
 	}
-	condFrame = NewFrame(&object.Closure{Fn: condFn, Free: closure.Free}, vm.sp)
+	condFrame = NewLoopFrame(&object.Closure{Fn: condFn, Free: closure.Free}, vm.sp)
 
 	bodyFn := &object.CompiledFunction{
 		Instructions: forLoop.Body,
+		Lines:        forLoop.BodyLines,
 		NumLocals:    forLoop.NumLocals,
 		NumParams:    0,
 		FreeNum:      forLoop.FreeNum,
 	}
-	bodyFrame = NewFrame(&object.Closure{Fn: bodyFn, Free: closure.Free}, vm.sp)
+	bodyFrame = NewLoopFrame(&object.Closure{Fn: bodyFn, Free: closure.Free}, vm.sp)
 
 	postFn := &object.CompiledFunction{
 		Instructions: forLoop.Post,
+		Lines:        forLoop.PostLines,
 		NumLocals:    forLoop.NumLocals,
 		NumParams:    0,
 		FreeNum:      forLoop.FreeNum,
 	}
-	postFrame = NewFrame(&object.Closure{Fn: postFn, Free: closure.Free}, vm.sp)
+	postFrame = NewLoopFrame(&object.Closure{Fn: postFn, Free: closure.Free}, vm.sp)
 
 	if initFrame != nil {
 		vm.pushFrame(initFrame)
 		vm.sp = initFrame.BasePointer + forLoop.NumLocals
-		err := vm.Run()
+		err := vm.run(vm.frameIndex)
 		if err != nil {
 			return err
 		}
@@ -500,7 +1139,7 @@ func (vm *VM) execForLoop() error {
 
 	vm.pushFrame(condFrame)
 	vm.sp = condFrame.BasePointer + forLoop.NumLocals
-	err := vm.Run()
+	err := vm.run(vm.frameIndex)
 	if err != nil {
 		return err
 	}
@@ -509,30 +1148,24 @@ func (vm *VM) execForLoop() error {
 	cond := vm.pop()
 	for object.IsTruthy(cond) {
 		bodyFrame.Ip = -1
+		bodyFrame.Signal = nil
 		vm.pushFrame(bodyFrame)
-		err = vm.Run()
+		err = vm.run(vm.frameIndex)
 		if err != nil {
 			return err
 		}
 		vm.popFrame()
 
-		tmpObj := vm.stack[vm.sp-1]
-		objType := tmpObj.Type()
-		if objType > 15 && objType < 21 {
-			vm.pop()
-			if objType == object.BREAK_OBJ {
-				break
-			} else if objType < 19 {
-				curFrame := vm.popFrame()
-				vm.stack[curFrame.BasePointer-1] = tmpObj
-				vm.sp = curFrame.BasePointer
-				return nil
-			}
+		if bodyFrame.Signal == object.BREAK {
+			break
+		} else if bodyFrame.Signal != nil && bodyFrame.Signal != object.CONTINUE {
+			vm.endLoop(pos, bodyFrame)
+			return vm.loopReturn(bodyFrame.Signal)
 		}
 
 		postFrame.Ip = -1
 		vm.pushFrame(postFrame)
-		err = vm.Run()
+		err = vm.run(vm.frameIndex)
 		if err != nil {
 			return err
 		}
@@ -540,7 +1173,7 @@ func (vm *VM) execForLoop() error {
 
 		condFrame.Ip = -1
 		vm.pushFrame(condFrame)
-		err = vm.Run()
+		err = vm.run(vm.frameIndex)
 		if err != nil {
 			return err
 		}
@@ -549,12 +1182,7 @@ func (vm *VM) execForLoop() error {
 		cond = vm.pop()
 	}
 
-	vm.sp = pos
-	if bodyFn.FreeNum > 0 {
-		for i := 0; i < bodyFn.FreeNum; i++ {
-			vm.stack[pos-1-i] = bodyFrame.Cl.Free[bodyFn.FreeNum-1-i]
-		}
-	}
+	vm.endLoop(pos, bodyFrame)
 	return nil
 }
 
@@ -567,119 +1195,152 @@ func (vm *VM) execRangeLoop() error {
 	var xFrame, bodyFrame *Frame
 	xFn := &object.CompiledFunction{
 		Instructions: rangeLoop.X,
+		Lines:        rangeLoop.XLines,
 		NumLocals:    rangeLoop.NumLocals,
 		NumParams:    0,
 		FreeNum:      rangeLoop.FreeNum,
 	}
-	xFrame = NewFrame(&object.Closure{Fn: xFn, Free: closure.Free}, vm.sp)
+	xFrame = NewLoopFrame(&object.Closure{Fn: xFn, Free: closure.Free}, vm.sp)
 
 	bodyFn := &object.CompiledFunction{
 		Instructions: rangeLoop.Body,
+		Lines:        rangeLoop.BodyLines,
 		NumLocals:    rangeLoop.NumLocals,
 		NumParams:    0,
 		FreeNum:      rangeLoop.FreeNum,
 	}
-	bodyFrame = NewFrame(&object.Closure{Fn: bodyFn, Free: closure.Free}, vm.sp)
+	bodyFrame = NewLoopFrame(&object.Closure{Fn: bodyFn, Free: closure.Free}, vm.sp)
 
 	vm.pushFrame(xFrame)
-	err := vm.Run()
+	err := vm.run(vm.frameIndex)
 	if err != nil {
 		return err
 	}
 	vm.popFrame()
 
-	obj := vm.pop()
-	switch obj := obj.(type) {
-	case *object.Array:
-		for i, elem := range obj.Elements {
-			if rangeLoop.IsAnonymous {
-				vm.stack[bodyFrame.BasePointer+1] = &object.Int{Value: i}
-				vm.stack[bodyFrame.BasePointer+2] = elem
-			} else {
-				vm.stack[bodyFrame.BasePointer+0] = &object.Int{Value: i}
-				vm.stack[bodyFrame.BasePointer+1] = elem
-			}
+	next := vm.rangeIter(vm.pop())
+	for {
+		key, value, ok, err := next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if rangeLoop.IsAnonymous {
+			vm.stack[bodyFrame.BasePointer+1] = key
+			vm.stack[bodyFrame.BasePointer+2] = value
+		} else {
+			vm.stack[bodyFrame.BasePointer+0] = key
+			vm.stack[bodyFrame.BasePointer+1] = value
+		}
 
-			bodyFrame.Ip = -1
-			vm.pushFrame(bodyFrame)
-			vm.sp = bodyFrame.BasePointer + rangeLoop.NumLocals
-			err := vm.Run()
-			if err != nil {
-				return err
-			}
-			vm.popFrame()
-
-			tmpObj := vm.stack[vm.sp-1]
-			objType := tmpObj.Type()
-			if objType > 15 && objType < 21 {
-				vm.pop()
-				if objType == object.BREAK_OBJ {
-					break
-				} else if objType < 19 {
-					curFrame := vm.popFrame()
-					vm.stack[curFrame.BasePointer-1] = tmpObj
-					vm.sp = curFrame.BasePointer
-					return nil
-				}
-			}
+		bodyFrame.Ip = -1
+		bodyFrame.Signal = nil
+		vm.pushFrame(bodyFrame)
+		vm.sp = bodyFrame.BasePointer + rangeLoop.NumLocals
+		err = vm.run(vm.frameIndex)
+		if err != nil {
+			return err
 		}
-	case *object.Hash:
-		for _, pair := range obj.Pairs {
-			if rangeLoop.IsAnonymous {
-				vm.stack[bodyFrame.BasePointer+1] = pair.Key
-				vm.stack[bodyFrame.BasePointer+2] = pair.Value
-			} else {
-				vm.stack[bodyFrame.BasePointer+0] = pair.Key
-				vm.stack[bodyFrame.BasePointer+1] = pair.Value
-			}
+		vm.popFrame()
 
-			bodyFrame.Ip = -1
-			vm.pushFrame(bodyFrame)
-			vm.sp = bodyFrame.BasePointer + rangeLoop.NumLocals
-			err := vm.Run()
-			if err != nil {
-				return err
-			}
-			vm.popFrame()
-
-			tmpObj := vm.stack[vm.sp-1]
-			objType := tmpObj.Type()
-			if objType > 15 && objType < 21 {
-				vm.pop()
-				if objType == object.BREAK_OBJ {
-					break
-				} else if objType < 19 {
-					curFrame := vm.popFrame()
-					vm.stack[curFrame.BasePointer-1] = tmpObj
-					vm.sp = curFrame.BasePointer
-					return nil
-				}
-			}
+		if bodyFrame.Signal == object.BREAK {
+			break
+		} else if bodyFrame.Signal != nil && bodyFrame.Signal != object.CONTINUE {
+			vm.endLoop(pos, bodyFrame)
+			return vm.loopReturn(bodyFrame.Signal)
 		}
 	}
 
-	vm.sp = pos
-	if bodyFn.FreeNum > 0 {
-		for i := 0; i < bodyFn.FreeNum; i++ {
-			vm.stack[pos-1-i] = bodyFrame.Cl.Free[bodyFn.FreeNum-1-i]
+	vm.endLoop(pos, bodyFrame)
+	return nil
+}
+
+// rangeIter 数组、map 和字符串先取出全部键值，通道每次迭代接收一个值直到关闭
+func (vm *VM) rangeIter(obj object.Object) func() (key, value object.Object, ok bool, err error) {
+	if ch, isChan := unwrapValue(obj).(*object.Channel); isChan {
+		return func() (object.Object, object.Object, bool, error) {
+			value, ok, err := vm.recv(ch)
+			return value, nil, ok, err
 		}
 	}
-	return nil
+
+	var keys, values []object.Object
+	// 数组遍历的是副本，切片和指向数组的指针读取当前的元素
+	switch obj := object.Indexed(object.CopyValue(obj)).(type) {
+	case *object.Array:
+		n, i := len(obj.Elements), 0
+		return func() (object.Object, object.Object, bool, error) {
+			if i >= n {
+				return nil, nil, false, nil
+			}
+			i++
+			return &object.Int{Value: i - 1}, obj.Elements[i-1], true, nil
+		}
+	case *object.Hash:
+		for _, pair := range obj.Entries() {
+			keys = append(keys, pair.Key)
+			values = append(values, pair.Value)
+		}
+	case *object.String:
+		// 按 UTF-8 解码，键是每个字符首字节的下标
+		for i, r := range obj.Value {
+			keys = append(keys, &object.Int{Value: i})
+			values = append(values, &object.Rune{Value: r})
+		}
+	}
+	i := 0
+	return func() (object.Object, object.Object, bool, error) {
+		if i >= len(keys) {
+			return nil, nil, false, nil
+		}
+		i++
+		return keys[i-1], values[i-1], true, nil
+	}
 }
 
 func (vm *VM) execContinueOrBreak(op code.Opcode) (int, error) {
 	frame := vm.currentFrame()
 	if frame.IsLoop {
 		if op == code.OpContinue {
-			vm.stack[frame.BasePointer+frame.Cl.Fn.NumLocals] = object.CONTINUE
+			frame.Signal = object.CONTINUE
 		} else {
-			vm.stack[frame.BasePointer+frame.Cl.Fn.NumLocals] = object.BREAK
+			frame.Signal = object.BREAK
 		}
 	}
-	vm.sp = frame.BasePointer + frame.Cl.Fn.NumLocals + 1
+	vm.sp = frame.BasePointer + frame.Cl.Fn.NumLocals
 	return len(frame.Cl.Fn.Instructions) - 1, nil
 }
 
+// loopReturn 循环体中的 return，外层仍是循环帧时继续向外传递；
+// 带标签的跳转先执行写回自由变量的指令，再由 OpJumpBranch 处理
+func (vm *VM) loopReturn(signal object.Object) error {
+	frame := vm.currentFrame()
+	if _, ok := signal.(*object.Branch); ok {
+		frame.Signal = signal
+		return nil
+	}
+	if frame.IsLoop {
+		frame.Signal = signal
+		frame.Ip = len(frame.Instructions()) - 1
+		return nil
+	}
+	if signal == object.RETURN {
+		return vm.execReturn()
+	}
+	return vm.returnValue(signal)
+}
+
+// endLoop 弹出循环闭包，自由变量压栈，由编译器生成的指令写回外层
+func (vm *VM) endLoop(pos int, bodyFrame *Frame) {
+	vm.sp = pos
+	for _, free := range bodyFrame.Cl.Free {
+		vm.stack[vm.sp] = free
+		vm.sp++
+	}
+}
+
 func (vm *VM) execSetGlobalLocal(op code.Opcode, ins code.Instructions, ip int) (int, error) {
 	idx := int(code.ReadUint16(ins[ip+1:]))
 	ip += 2
@@ -693,6 +1354,7 @@ func (vm *VM) execSetGlobalLocal(op code.Opcode, ins code.Instructions, ip int)
 		vm.stack[pos] = obj
 	}
 
+	newValue = object.CopyValue(newValue)
 	if op == code.OpSetGlobal {
 		vm.globals[idx] = newValue
 	} else {
@@ -730,57 +1392,52 @@ func (vm *VM) execSetFree(ins code.Instructions, ip int) (int, error) {
 		vm.stack[pos] = obj
 	}
 
-	free[idx] = newValue
+	free[idx] = object.CopyValue(newValue)
 	frame.Cl.Free = free
 	vm.stack[frame.BasePointer-1] = frame.Cl
 	return ip, nil
 }
 
-func (vm *VM) execSetIndex(op code.Opcode, ins code.Instructions, ip int) (int, error) {
-	idx := int(code.ReadUint16(ins[ip+1:]))
-	ip += 2
-
-	frame := vm.currentFrame()
-	idxObj := vm.pop()
-	complexObj := vm.pop()
-
+// execSetIndex 容器在值的下面，原地修改，闭包、循环和指针看到的是同一个容器
+func (vm *VM) execSetIndex() error {
 	pos := vm.sp - 1
-	newObj := vm.stack[pos]
-	newValue, newObj, needPop := extractData(newObj)
-	if needPop {
-		vm.pop()
-	} else {
-		vm.stack[pos] = newObj
+	newValue, source, needPop := extractData(vm.stack[pos])
+	idxObj := unwrapValue(vm.stack[pos-1])
+	complexObj := object.Indexed(unwrapValue(vm.stack[pos-2]))
+	vm.sp -= 3
+	if !needPop {
+		// comma-ok 的另一个值还要赋给下一个变量
+		if err := vm.push(source); err != nil {
+			return err
+		}
 	}
+	newValue = object.CopyValue(newValue)
 
 	switch cobj := complexObj.(type) {
 	case *object.Array:
-		index := idxObj.(*object.Int).Value
-		cobj.Elements[index] = newValue
-		if op == code.OpSetGlobalIndex {
-			vm.globals[idx] = cobj
-		} else {
-			vm.stack[frame.BasePointer+idx] = cobj
+		idx, ok := object.Unnamed(idxObj).(object.Integer)
+		if !ok {
+			return fmt.Errorf("invalid argument: index %s must be integer", idxObj.Type())
 		}
-	case *object.Hash:
-		index := idxObj.(object.Hashable).HashKey()
-		_, ok := cobj.Pairs[index]
-		if ok {
-			cobj.Pairs[index] = object.HashPair{Key: idxObj, Value: newValue}
-		} else {
-			pair := object.HashPair{Key: idxObj, Value: newValue}
-			cobj.Pairs[index] = pair
+		index := idx.Integer()
+		if index < 0 || index >= int64(len(cobj.Elements)) {
+			return fmt.Errorf("index out of range [%d] with length %d", index, len(cobj.Elements))
 		}
-		if op == code.OpSetGlobalIndex {
-			vm.globals[idx] = cobj
-		} else {
-			vm.stack[frame.BasePointer+idx] = cobj
+		cobj.Elements[index] = newValue
+	case *object.Hash:
+		if err := cobj.Set(object.CopyValue(idxObj), newValue); err != nil {
+			return err
 		}
+	default:
+		return fmt.Errorf("index operator not supported: %s", complexObj.Type())
 	}
-	return ip, nil
+	return nil
 }
 
 func doUnaryExpr(op code.Opcode, obj object.Object) object.Object {
+	if named, ok := obj.(*object.Named); ok {
+		return named.NamedType.Result(doUnaryExpr(op, named.Value))
+	}
 	switch op {
 	case code.OpNOT:
 		if obj == object.TRUE {
@@ -795,6 +1452,8 @@ func doUnaryExpr(op code.Opcode, obj object.Object) object.Object {
 			return object.ConvertToInt(obj.Type(), -obj.(object.Integer).Integer())
 		} else if obj.Type().IsFloat() {
 			return object.ConvertToFloat(obj.Type(), -obj.(object.Float).Float())
+		} else if obj.Type().IsComplex() {
+			return object.ConvertToComplex(obj.Type(), -obj.(object.Complex).Complex())
 		} else {
 			return object.NewError("operator - not defined on %s", obj.Type())
 		}
@@ -825,20 +1484,26 @@ func doUnaryExpr(op code.Opcode, obj object.Object) object.Object {
 }
 
 func doBinaryExpr(op code.Opcode, left, right object.Object) object.Object {
-	switch left.Type() {
-	case object.SINGLE_RETURN_OBJ:
-		left = left.(*object.SingleReturn).Value
-	case object.MAP_EXIST_OBJ:
-		left = left.(*object.MapExist).Value
-	}
+	left, right = unwrapValue(left), unwrapValue(right)
 
-	switch right.Type() {
-	case object.SINGLE_RETURN_OBJ:
-		right = right.(*object.SingleReturn).Value
-	case object.MAP_EXIST_OBJ:
-		right = right.(*object.MapExist).Value
+	if object.IsNil(left) || object.IsNil(right) {
+		switch op {
+		case code.OpEQL:
+			return object.ConvertToBoolean(object.IsNil(left) && object.IsNil(right))
+		case code.OpNEQ:
+			return object.ConvertToBoolean(!object.IsNil(left) || !object.IsNil(right))
+		}
+	}
+	if object.NamedTypeOf(left) != nil || object.NamedTypeOf(right) != nil {
+		if op == code.OpEQL || op == code.OpNEQ {
+			ln, rn := object.NamedTypeOf(left), object.NamedTypeOf(right)
+			if ln != nil && rn != nil && ln != rn {
+				return object.ConvertToBoolean(op == code.OpNEQ)
+			}
+		}
+		left, right, nt := object.NamedOperands(left, right, op == code.OpSHL || op == code.OpSHR)
+		return nt.Result(doBinaryExpr(op, left, right))
 	}
-
 	if left.Type() != right.Type() {
 		return object.NewError("Binary mismatched types %s and %s", left.Type(), right.Type())
 	}
@@ -848,10 +1513,18 @@ func doBinaryExpr(op code.Opcode, left, right object.Object) object.Object {
 		return doIntegerBinaryExpr(op, left, right)
 	case left.Type().IsFloat():
 		return doFloatBinaryExpr(op, left, right)
+	case left.Type().IsComplex():
+		return doComplexBinaryExpr(op, left, right)
 	case left.Type() == object.BOOLEAN_OBJ:
 		return doBooleanBinaryExpr(op, left, right)
 	case left.Type() == object.STRING_OBJ:
 		return doStringBinaryExpr(op, left, right)
+	case left.Type() == object.STRUCT_OBJ:
+		return doStructBinaryExpr(op, left, right)
+	case left.Type() == object.ARRAY_OBJ && left.(*object.Array).Fixed:
+		return doArrayBinaryExpr(op, left, right)
+	case left.Type() == object.POINTER_OBJ:
+		return doPointerBinaryExpr(op, left, right)
 	case left.Type() == object.SINGLE_RETURN_OBJ:
 		return doBinaryExpr(op, left.(*object.SingleReturn).Value, right.(*object.SingleReturn).Value)
 	default:
@@ -862,6 +1535,9 @@ func doBinaryExpr(op code.Opcode, left, right object.Object) object.Object {
 func doIntegerBinaryExpr(op code.Opcode, left, right object.Object) object.Object {
 	lv := left.(object.Integer).Integer()
 	rv := right.(object.Integer).Integer()
+	if rv == 0 && (op == code.OpQUO || op == code.OpREM) {
+		return object.NewError("integer divide by zero")
+	}
 	switch op {
 	case code.OpADD:
 		return object.ConvertToInt(left.Type(), lv+rv)
@@ -931,6 +1607,27 @@ func doFloatBinaryExpr(op code.Opcode, left, right object.Object) object.Object
 	}
 }
 
+func doComplexBinaryExpr(op code.Opcode, left, right object.Object) object.Object {
+	lv := left.(object.Complex).Complex()
+	rv := right.(object.Complex).Complex()
+	switch op {
+	case code.OpADD:
+		return object.ConvertToComplex(left.Type(), lv+rv)
+	case code.OpSUB:
+		return object.ConvertToComplex(left.Type(), lv-rv)
+	case code.OpMUL:
+		return object.ConvertToComplex(left.Type(), lv*rv)
+	case code.OpQUO:
+		return object.ConvertToComplex(left.Type(), lv/rv)
+	case code.OpEQL:
+		return object.ConvertToBoolean(lv == rv)
+	case code.OpNEQ:
+		return object.ConvertToBoolean(lv != rv)
+	default:
+		return object.NewError("the operator %s is not defined on %s", op, left.Type())
+	}
+}
+
 func doBooleanBinaryExpr(op code.Opcode, left, right object.Object) object.Object {
 	lv := left.(*object.Boolean).Value
 	rv := right.(*object.Boolean).Value
@@ -953,24 +1650,72 @@ func doStringBinaryExpr(op code.Opcode, left, right object.Object) object.Object
 	rv := right.(*object.String).Value
 	if op == code.OpADD {
 		return &object.String{Value: lv + rv}
-	} else {
-		cp := strings.Compare(lv, rv)
-		switch op {
-		case code.OpEQL:
-			if cp == 0 {
-				return object.TRUE
-			} else {
-				return object.FALSE
-			}
-		case code.OpNEQ:
-			if cp != 0 {
-				return object.TRUE
-			} else {
-				return object.FALSE
-			}
-		default:
-			return object.NewError("the operator %s is not defined on %s", op, left.Type())
-		}
+	}
+	cp := strings.Compare(lv, rv)
+	switch op {
+	case code.OpEQL:
+		return object.ConvertToBoolean(cp == 0)
+	case code.OpNEQ:
+		return object.ConvertToBoolean(cp != 0)
+	case code.OpLSS:
+		return object.ConvertToBoolean(cp < 0)
+	case code.OpLEQ:
+		return object.ConvertToBoolean(cp <= 0)
+	case code.OpGTR:
+		return object.ConvertToBoolean(cp > 0)
+	case code.OpGEQ:
+		return object.ConvertToBoolean(cp >= 0)
+	default:
+		return object.NewError("the operator %s is not defined on %s", op, left.Type())
+	}
+}
+
+func doStructBinaryExpr(op code.Opcode, left, right object.Object) object.Object {
+	switch op {
+	case code.OpEQL:
+		return object.ConvertToBoolean(object.Equal(left, right))
+	case code.OpNEQ:
+		return object.ConvertToBoolean(!object.Equal(left, right))
+	default:
+		return object.NewError("the operator %s is not defined on %s", op, left.(*object.Struct).StructType)
+	}
+}
+
+func doArrayBinaryExpr(op code.Opcode, left, right object.Object) object.Object {
+	if !left.(*object.Array).SameType(right.(*object.Array)) {
+		return object.NewError("invalid operation: mismatched types %s and %s", object.TypeName(left), object.TypeName(right))
+	}
+	switch op {
+	case code.OpEQL:
+		return object.ConvertToBoolean(object.Equal(left, right))
+	case code.OpNEQ:
+		return object.ConvertToBoolean(!object.Equal(left, right))
+	default:
+		return object.NewError("the operator %s is not defined on %s", op, object.TypeName(left))
+	}
+}
+
+func doPointerBinaryExpr(op code.Opcode, left, right object.Object) object.Object {
+	switch op {
+	case code.OpEQL:
+		return object.ConvertToBoolean(object.Equal(left, right))
+	case code.OpNEQ:
+		return object.ConvertToBoolean(!object.Equal(left, right))
+	default:
+		return object.NewError("the operator %s is not defined on %s", op, object.TypeName(left))
+	}
+}
+
+func unwrapValue(obj object.Object) object.Object {
+	switch tobj := obj.(type) {
+	case *object.SingleReturn:
+		return tobj.Value
+	case *object.MapExist:
+		return tobj.Value
+	case *object.Interface:
+		return tobj.Unwrap()
+	default:
+		return obj
 	}
 }
 
@@ -981,7 +1726,7 @@ func extractData(obj object.Object) (newValue, sourceObj object.Object, needPop
 			tobj.SkipValue = true
 			newValue = tobj.Value
 		} else {
-			newValue = &object.Boolean{Value: tobj.Exist}
+			newValue = object.ConvertToBoolean(tobj.Exist)
 			needPop = true
 		}
 		sourceObj = tobj
@@ -1,10 +1,12 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
 	"goscript/compiler"
 	"goscript/object"
 	"goscript/program"
+	"strings"
 	"testing"
 )
 
@@ -20,12 +22,27 @@ func runVmTests(t *testing.T, tests []vmTestCase, isStmt bool) {
 		prog := parseProgram(t, tt.input, isStmt)
 		comp := compiler.New()
 		err := comp.CompileProgram(prog)
+		if expected, ok := tt.expected.(*object.Error); ok && err != nil {
+			// 参数类型已知时内置函数的参数错误是编译错误，比较时去掉位置
+			if _, msg, _ := strings.Cut(err.Error(), " "); msg != expected.Message {
+				t.Errorf("wrong compiler error. expected=%s, got=%s", expected.Message, err)
+			}
+			continue
+		}
 		if err != nil {
 			t.Fatalf("compiler error: %s", err)
 		}
 
 		vm := New(comp.Bytecode())
 		err = vm.Run()
+		var rerr *RuntimeError
+		if expected, ok := tt.expected.(*object.Error); ok && errors.As(err, &rerr) {
+			// 参数类型到运行时才知道时是运行时错误
+			if rerr.Message != expected.Message {
+				t.Errorf("wrong error message. expected=%s, got=%s", expected.Message, rerr.Message)
+			}
+			continue
+		}
 		if err != nil {
 			t.Fatalf("vm error: %s", err)
 		}
@@ -141,6 +158,8 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"+50 + 100 + -50", 100},
 		{"5 * (2 + 10)", 60},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"0x10 + 1_000 + 0b11 + 0o7 + 017", 1041},
+		{"x := 0xFF; x", 255},
 	}
 
 	runVmTests(t, tests, true)
@@ -638,19 +657,19 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 			`
 					func() { 1 }(1)
 				`,
-			"execute function wrong number of arguments: want=0, got=1",
+			"2:6 execute function wrong number of arguments: want=0, got=1",
 		},
 		{
 			`
 					func(a int) { a }()
 				`,
-			"execute function wrong number of arguments: want=1, got=0",
+			"2:6 execute function wrong number of arguments: want=1, got=0",
 		},
 		{
 			`
 					func(a, b int) { a + b }(1)
 				`,
-			"execute function wrong number of arguments: want=2, got=1",
+			"2:6 execute function wrong number of arguments: want=2, got=1",
 		},
 	}
 
@@ -702,9 +721,137 @@ func TestBuiltinFunctions(t *testing.T) {
 			`append(1, 1)`,
 			&object.Error{Message: "argument to 'append' must be array, got int"},
 		},
+		{
+			`
+					m := map[string]int{"a": 1, "b": 2}
+					delete(m, "a")
+					delete(m, "z")
+					len(m)
+				`,
+			1,
+		},
+		{
+			`delete(1, 2)`,
+			&object.Error{Message: "invalid argument: int is not a map"},
+		},
+		{
+			`max()`,
+			&object.Error{Message: "not enough arguments in call to max"},
+		},
+		{
+			`clear(3)`,
+			&object.Error{Message: "invalid argument: clear expects a map or slice, got int"},
+		},
+		{
+			`
+					var i any = "ab"
+					len(i)
+				`,
+			2,
+		},
+		{
+			`
+					var i any = 3
+					len(i)
+				`,
+			&object.Error{Message: "argument to 'len' not support, got int"},
+		},
+		{
+			`
+					m := map[int8]int{1: 2}
+					delete(m, 1)
+					len(m)
+				`,
+			0,
+		},
+		{
+			`
+					m := map[string]int{}
+					k := 1
+					delete(m, k)
+				`,
+			&object.Error{Message: "cannot use int as string value in argument to delete"},
+		},
+		{
+			`
+					x := min()
+					x
+				`,
+			&object.Error{Message: "not enough arguments in call to min"},
+		},
+		{
+			`
+					x := cap(map[int]int{})
+					x
+				`,
+			&object.Error{Message: "argument to 'cap' not support, got hash"},
+		},
+		{
+			`
+					x := append()
+					x
+				`,
+			&object.Error{Message: "not enough arguments in call to append"},
+		},
+		{
+			`
+					s := []int{1, 2}
+					m := map[int]int{1: 1}
+					clear(s)
+					clear(m)
+					append(s, len(m))
+				`,
+			[]int{0, 0, 0},
+		},
+		{`min(3, 1, 2)`, 1},
+		{`max("a", "c", "b")`, "c"},
+		{
+			`
+					x := 2.5
+					f := max(1, x)
+					int(f * 10)
+				`,
+			25,
+		},
+		{
+			`
+					const c = max(1, 2.5)
+					int(c * 10)
+				`,
+			25,
+		},
+		{
+			`
+					a := 1
+					b := "a"
+					min(a, b)
+				`,
+			&object.Error{Message: "invalid argument: mismatched types int and string in min"},
+		},
+		{
+			`
+					f := 2.7
+					int(f) + int(uint8(f))
+				`,
+			4,
+		},
+		{
+			`
+					max := 2
+					var make int = 3
+					max * make
+				`,
+			6,
+		},
 	}
 
 	runVmTests(t, tests, true)
+
+	prog := parseProgram(t, "delete(map[string]int{}, 1)", true)
+	err := compiler.New().CompileProgram(prog)
+	if err == nil || err.Error() != "1:26 cannot use 1 (untyped int constant) as string value in argument to delete" {
+		t.Fatalf("wrong compiler error: %v", err)
+	}
 }
 
 func TestClosures(t *testing.T) {
@@ -853,150 +1000,3603 @@ func TestRecursiveFunctions(t *testing.T) {
 	runVmTests(t, tests, false)
 }
 
-func testExpectedObject(t *testing.T, expected any, actual object.Object) {
-	t.Helper()
-	switch expected := expected.(type) {
-	case int:
-		err := testIntegerObject(t, expected, actual)
-		if err != nil {
-			t.Errorf("testIntegerObject failed: %s", err)
-		}
-	case float64:
-		err := testFloatObject(t, expected, actual)
-		if err != nil {
-			t.Errorf("testFloatObject failed: %s", err)
-		}
-	case bool:
-		err := testBooleanObject(t, expected, actual)
-		if err != nil {
-			t.Errorf("testBooleanObject failed: %s", err)
-		}
-	case byte:
-		err := testByteObject(t, expected, actual)
-		if err != nil {
-			t.Errorf("testByteObject failed: %s", err)
-		}
-	case string:
-		err := testStringObject(t, expected, actual)
-		if err != nil {
-			t.Errorf("testStringObject failed: %s", err)
-		}
-	case *object.Null:
-		err := testNullObject(t, expected, actual)
-		if err != nil {
-			t.Errorf("testNullObject failed: %s", err)
-		}
-	case []int:
-		array, ok := actual.(*object.Array)
-		if !ok {
-			t.Errorf("object is not array: %T (%+v)", actual, actual)
-		}
-		if len(array.Elements) != len(expected) {
-			t.Errorf("wrong number of elements. want=%d, got=%d", len(expected), len(array.Elements))
-		}
-		for i, elem := range array.Elements {
-			err := testIntegerObject(t, expected[i], elem)
-			if err != nil {
-				t.Errorf("testIntegerObject failed: %s", err)
-			}
-		}
-	case map[object.HashKey]int:
-		hashObj, ok := actual.(*object.Hash)
-		if !ok {
-			t.Errorf("object is not hash: %T (%+v)", actual, actual)
-		}
-		if len(hashObj.Pairs) != len(expected) {
-			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(expected), len(hashObj.Pairs))
-			return
-		}
-		for ekey, eValue := range expected {
-			pair, ok := hashObj.Pairs[ekey]
-			if !ok {
-				t.Errorf("no pair for given key in pairs")
-			}
-			err := testIntegerObject(t, eValue, pair.Value)
-			if err != nil {
-				t.Errorf("testIntegerObject failed: %s", err)
-			}
-		}
-	case *object.Error:
-		errObj, ok := actual.(*object.Error)
-		if !ok {
-			t.Errorf("object is not Error: %T (%+v)", expected, actual)
-			return
-		}
-		if errObj.Message != expected.Message {
-			t.Errorf("wrong error message. expected=%s, got=%s", expected, errObj.Message)
-		}
-	default:
-		t.Errorf("object is not support. got=%T (%+v)", actual, actual)
-	}
-}
+func TestStructs(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
 
-func testIntegerObject(t *testing.T, expected int, obj object.Object) error {
-	t.Helper()
-	result, ok := obj.(object.Integer)
-	if !ok {
-		return fmt.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
-	}
-	if result.Integer() != int64(expected) {
-		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Integer(), expected)
-	}
-	return nil
-}
+					type Point struct {
+						x, y int
+					}
 
-func testFloatObject(t *testing.T, expected float64, obj object.Object) error {
-	t.Helper()
-	result, ok := obj.(object.Float)
-	if !ok {
-		return fmt.Errorf("object is not Float. got=%T (%+v)", obj, obj)
-	}
-	if result.Float() != expected {
-		return fmt.Errorf("object has wrong value. got=%f, want=%f", result.Float(), expected)
-	}
-	return nil
-}
+					func main() {
+						p := Point{x: 1, y: 2}
+						p.x = p.x + 10
+						p.y++
+						p.x + p.y
+					}
+				`,
+			14,
+		},
+		{
+			`
+					package tmp
 
-func testByteObject(t *testing.T, expected byte, obj object.Object) error {
-	t.Helper()
-	result, ok := obj.(*object.Byte)
-	if !ok {
-		return fmt.Errorf("object is not Byte. got=%T (%+v)", obj, obj)
-	}
-	if result.Value != expected {
-		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
-	}
-	return nil
-}
+					type Point struct {
+						x, y int
+					}
 
-func testBooleanObject(t *testing.T, expected bool, obj object.Object) error {
-	t.Helper()
-	result, ok := obj.(*object.Boolean)
-	if !ok {
-		return fmt.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
-	}
-	if result.Value != expected {
-		return fmt.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+					type Line struct {
+						a, b Point
+						name string
+					}
+
+					func main() {
+						l := Line{a: Point{1, 2}, b: Point{y: 4}}
+						l.b.x = 3
+						m := l
+						m.a.x = 100
+						l.a.x + l.b.x + l.b.y
+					}
+				`,
+			8,
+		},
+		{
+			`
+					package tmp
+
+					type Point struct {
+						x, y int
+					}
+
+					func move(p Point) int {
+						p.x = 10
+						return p.x
+					}
+
+					func main() {
+						ps := []Point{{1, 2}, {3, 4}}
+						move(ps[0])
+						ps[1].x = 5
+						ps[0].x + ps[1].x
+					}
+				`,
+			6,
+		},
+		{
+			`
+					package tmp
+
+					type Base struct {
+						id int
+					}
+
+					type User struct {
+						Base
+						name string
+					}
+
+					func main() {
+						u := User{Base{7}, "go"}
+						u.id = u.id * 2
+						u.id
+					}
+				`,
+			14,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						type Point struct {
+							x, y int
+						}
+						var a Point
+						b := Point{}
+						a == b && a != Point{1, 0}
+					}
+				`,
+			true,
+		},
 	}
-	return nil
+
+	runVmTests(t, tests, false)
 }
 
-func testStringObject(t *testing.T, expected string, obj object.Object) error {
-	t.Helper()
-	result, ok := obj.(*object.String)
-	if !ok {
-		return fmt.Errorf("object is not string. got=%T (%+v)", obj, obj)
-	}
-	if result.Value != expected {
+func TestMethods(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					type Point struct {
+						x, y int
+					}
+
+					func (p Point) Sum() int {
+						return p.x + p.y
+					}
+
+					func (p *Point) Move(dx, dy int) {
+						p.x += dx
+						p.y += dy
+					}
+
+					func (p Point) Reset() {
+						p.x = 0
+					}
+
+					func main() {
+						p := Point{1, 2}
+						p.Move(10, 20)
+						p.Reset()
+						p.Sum()
+					}
+				`,
+			33,
+		},
+		{
+			`
+					package tmp
+
+					type Counter struct {
+						n int
+					}
+
+					func (c *Counter) Inc() {
+						c.n++
+					}
+
+					func (c Counter) Get() (v int) {
+						v = c.n * 10
+						return
+					}
+
+					func main() {
+						c := Counter{}
+						inc := c.Inc
+						inc()
+						inc()
+						get := Counter.Get
+						get(c)
+					}
+				`,
+			20,
+		},
+		{
+			`
+					package tmp
+
+					type Base struct {
+						id int
+					}
+
+					func (b Base) ID() int {
+						return b.id
+					}
+
+					type User struct {
+						Base
+						name string
+					}
+
+					func (u User) Describe() int {
+						return u.ID() + len(u.name)
+					}
+
+					func main() {
+						u := User{Base{40}, "go"}
+						u.Describe()
+					}
+				`,
+			42,
+		},
+		{
+			`
+					package tmp
+
+					type Point struct {
+						x, y int
+					}
+
+					func (p *Point) Scale(k int) {
+						p.x *= k
+						p.y *= k
+					}
+
+					func (p Point) Sum() int {
+						return p.x + p.y
+					}
+
+					func main() {
+						p := Point{1, 2}
+						scale := (*Point).Scale
+						scale(&p, 10)
+						sum := (*Point).Sum
+						sum(&p) + Point.Sum(p)
+					}
+				`,
+			60,
+		},
+		{
+			`
+					package tmp
+
+					type Weekday int
+
+					const (
+						Sunday Weekday = iota
+						Monday
+						Tuesday
+					)
+
+					func (d Weekday) Next() Weekday {
+						return (d + 1) % 3
+					}
+
+					type Nexter interface {
+						Next() Weekday
+					}
+
+					type IntList []int
+
+					func (l IntList) Sum() int {
+						s := 0
+						for _, v := range l {
+							s += v
+						}
+						return s
+					}
+
+					func (l *IntList) Add(v int) {
+						*l = append(*l, v)
+					}
+
+					type Count int
+
+					func (c *Count) Inc() {
+						*c++
+					}
+
+					func main() {
+						l := IntList{1, 2}
+						l.Add(int(Tuesday.Next().Next()))
+						var n Nexter = Monday
+						d := n.Next()
+						names := map[Weekday]int{Tuesday: 100}
+						switch d {
+						case Tuesday:
+							l.Add(names[d])
+						}
+						var c Count
+						c.Inc()
+						inc := (*Count).Inc
+						inc(&c)
+						l.Sum() + int(d)*1000 + int(c)*10000
+					}
+				`,
+			22104,
+		},
+	}
+
+	runVmTests(t, tests, false)
+}
+
+func TestInterfaces(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					type Shape interface {
+						Area() int
+					}
+
+					type Rect struct {
+						w, h int
+					}
+
+					func (r Rect) Area() int {
+						return r.w * r.h
+					}
+
+					type Square struct {
+						side int
+					}
+
+					func (s Square) Area() int {
+						return s.side * s.side
+					}
+
+					func total(a, b Shape) int {
+						return a.Area() + b.Area()
+					}
+
+					func main() {
+						var s Shape = Rect{2, 3}
+						n := s.Area()
+						s = Square{4}
+						total(s, Rect{1, 5}) + n
+					}
+				`,
+			27,
+		},
+		{
+			`
+					package tmp
+
+					func describe(v any) int {
+						if n, ok := v.(int); ok {
+							return n
+						}
+						if s, ok := v.(string); ok {
+							return len(s)
+						}
+						return -1
+					}
+
+					func main() {
+						var x interface{} = 40
+						y := x.(int)
+						describe(y) + describe("go") + describe(true)
+					}
+				`,
+			41,
+		},
+		{
+			`
+					package tmp
+
+					type Namer interface {
+						Name() string
+					}
+
+					type Ager interface {
+						Age() int
+					}
+
+					type Person interface {
+						Namer
+						Ager
+					}
+
+					type Cat struct {
+						age int
+					}
+
+					func (c Cat) Name() string {
+						return "cat"
+					}
+
+					func (c Cat) Age() int {
+						return c.age
+					}
+
+					type Rock struct {
+						kind string
+					}
+
+					func (r Rock) Name() string {
+						return r.kind
+					}
+
+					func score(n Namer) int {
+						p, ok := n.(Person)
+						if !ok {
+							return len(n.Name())
+						}
+						return p.Age() + len(p.Name())
+					}
+
+					func main() {
+						var p Person
+						n := 0
+						if p == nil {
+							n = 100
+						}
+						score(Cat{7}) + score(Rock{"rock"}) + n
+					}
+				`,
+			114,
+		},
+		{
+			`
+					package tmp
+
+					type Shape interface {
+						Area() int
+					}
+
+					type Sq struct {
+						S int
+					}
+
+					func (s Sq) Area() int {
+						return s.S * s.S
+					}
+
+					type Bad struct{}
+
+					func (b Bad) Area() string {
+						return "x"
+					}
+
+					func main() {
+						n := 0
+						var x interface{} = []int{1, 2}
+						if v, ok := x.([]int); ok {
+							n += len(v)
+						}
+						switch v := x.(type) {
+						case []string:
+							n += 100
+						case []int:
+							n += v[1] * 10
+						}
+						var m interface{} = map[string]int{"a": 3}
+						switch v := m.(type) {
+						case map[string]bool:
+							n += 1000
+						case map[string]int:
+							n += v["a"] * 1000
+						}
+						if _, ok := m.(map[int]int); ok {
+							n += 10000
+						}
+						var b interface{} = Bad{}
+						if _, ok := b.(Shape); !ok {
+							n += 100000
+						}
+						var s interface{} = Sq{2}
+						if sh, ok := s.(Shape); ok {
+							n += sh.Area() * 1000000
+						}
+						n
+					}
+				`,
+			4103022,
+		},
+	}
+
+	runVmTests(t, tests, false)
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+					package tmp
+
+					type Shape interface {
+						Area() int
+					}
+
+					type No struct{}
+
+					func use(s Shape) int {
+						return s.Area()
+					}
+
+					func main() {
+						use(No{})
+					}
+				`,
+			"15:11 cannot use No{} (value of type No) as Shape value in argument to use: No does not implement Shape (missing method Area)",
+		},
+	}
+
+	for _, tt := range errTests {
+		prog := parseProgram(t, tt.input, false)
+		comp := compiler.New()
+		err := comp.CompileProgram(prog)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong compiler error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					func grade(n int) int {
+						r := 0
+						switch m := n % 10; m {
+						case 1, 2:
+							r = 10
+						default:
+							r = 30
+						case 3:
+							r = 20
+							fallthrough
+						case 4:
+							r += 5
+						}
+						return r
+					}
+
+					func main() {
+						grade(1) + grade(13) + grade(4) + grade(7)
+					}
+				`,
+			70,
+		},
+		{
+			`
+					package tmp
+
+					func sign(x int) int {
+						switch {
+						case x < 0:
+							return -1
+						case x == 0:
+							break
+						default:
+							return 1
+						}
+						return 0
+					}
+
+					func main() {
+						total := 0
+						for i := -2; i <= 2; i++ {
+							switch sign(i) {
+							case 1:
+								total += 10
+							case -1:
+								total += 1
+							}
+						}
+						total
+					}
+				`,
+			22,
+		},
+		{
+			`
+					package tmp
+
+					type Point struct {
+						x, y int
+					}
+
+					func kind(v any) int {
+						switch t := v.(type) {
+						case int:
+							return t * 2
+						case string, bool:
+							return 100
+						case Point:
+							return t.x + t.y
+						case nil:
+							return -1
+						default:
+							return 0
+						}
+					}
+
+					func main() {
+						kind(21) + kind("s") + kind(Point{3, 4}) + kind(nil) + kind(1.5)
+					}
+				`,
+			148,
+		},
+	}
+
+	runVmTests(t, tests, false)
+}
+
+func TestDeferPanicRecover(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					func find(arr []int, x int) int {
+						for i, v := range arr {
+							for j := 0; j < 3; j++ {
+								if v == x && j == 2 {
+									return i*100 + j
+								}
+							}
+						}
+						return -1
+					}
+
+					func main() {
+						n := 0
+						for i := 0; i < 10; i++ {
+							if i == 3 {
+								break
+							}
+							n += i
+						}
+						find([]int{4, 5, 6}, 6) + n
+					}
+				`,
+			205,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						order := ""
+						protect := func(s string) {
+							defer func() {
+								r := recover()
+								if r != nil {
+									order = order + r.(string)
+								}
+							}()
+							defer func() { order = order + "a" }()
+							for i := 0; i < 3; i++ {
+								defer func() { order = order + "b" }()
+								if i == 1 {
+									panic(s)
+								}
+							}
+							order = order + "x"
+						}
+						protect("boom")
+						order = order + "!"
+						order
+					}
+				`,
+			"bbaboom!",
+		},
+		{
+			`
+					package tmp
+
+					func div(a, b int) (msg string) {
+						defer func() {
+							msg = recover().(string)
+						}()
+						a = a / b
+						return ""
+					}
+
+					func main() {
+						div(1, 0)
+					}
+				`,
+			"integer divide by zero",
+		},
+		{
+			`
+					package tmp
+
+					func div(a, b int) (q int) {
+						defer func() {
+							recover()
+						}()
+						q = -1
+						return a / b
+					}
+
+					func main() {
+						div(7, 2) * 10 + div(1, 0)
+					}
+				`,
+			29,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						got := 0
+						helper := func() {
+							if r := recover(); r != nil {
+								got = 100
+							}
+						}
+						f := func() {
+							defer func() {
+								helper()
+								if r := recover(); r != nil {
+									got = got + r.(int)
+								}
+							}()
+							arr := []int{1, 2, 3}
+							for _, v := range arr {
+								for j := 0; j < 2; j++ {
+									if v == 2 {
+										panic(v * 10)
+									}
+								}
+							}
+						}
+						for i := 0; i < 2; i++ {
+							f()
+						}
+						r := recover()
+						r == nil && got == 40
+					}
+				`,
+			true,
+		},
+		{
+			`
+					package tmp
+
+					func scale() (n int) {
+						defer func() { n *= 10 }()
+						n = 2
+						return n + 1
+					}
+
+					func rescue() (n int) {
+						defer func() {
+							recover()
+							n = 7
+						}()
+						panic("x")
+					}
+
+					func pair() (int, int) { return 3, 4 }
+
+					func swap() (a, b int) {
+						defer func() { a, b = b, a }()
+						return pair()
+					}
+
+					func find() (n int) {
+						defer func() { n++ }()
+						for i := 0; i < 10; i++ {
+							if i == 4 {
+								return i * 2
+							}
+						}
+						return 0
+					}
+
+					func main() {
+						a, b := swap()
+						scale()*1000 + rescue()*100 + find()*10 + a - b
+					}
+				`,
+			30791,
+		},
+	}
+
+	runVmTests(t, tests, false)
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+					package tmp
+
+					func f(n int) int {
+						for i := 0; i < n; i++ {
+							if i == 3 {
+								panic(i * 14)
+							}
+						}
+						return n
+					}
+
+					func main() {
+						f(10)
+					}
+				`,
+			"7:9 panic: 42",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						f := func() {
+							defer func() {
+								panic("second")
+							}()
+							panic("first")
+						}
+						f()
+					}
+				`,
+			"7:9 panic: second",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a := 0
+						1 / a
+					}
+				`,
+			"6:7 integer divide by zero",
+		},
+	}
+
+	for _, tt := range errTests {
+		prog := parseProgram(t, tt.input, false)
+		comp := compiler.New()
+		err := comp.CompileProgram(prog)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected vm error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func testExpectedObject(t *testing.T, expected any, actual object.Object) {
+	t.Helper()
+	switch expected := expected.(type) {
+	case int:
+		err := testIntegerObject(t, expected, actual)
+		if err != nil {
+			t.Errorf("testIntegerObject failed: %s", err)
+		}
+	case float64:
+		err := testFloatObject(t, expected, actual)
+		if err != nil {
+			t.Errorf("testFloatObject failed: %s", err)
+		}
+	case complex128:
+		err := testComplexObject(t, expected, actual)
+		if err != nil {
+			t.Errorf("testComplexObject failed: %s", err)
+		}
+	case bool:
+		err := testBooleanObject(t, expected, actual)
+		if err != nil {
+			t.Errorf("testBooleanObject failed: %s", err)
+		}
+	case byte:
+		err := testByteObject(t, expected, actual)
+		if err != nil {
+			t.Errorf("testByteObject failed: %s", err)
+		}
+	case string:
+		err := testStringObject(t, expected, actual)
+		if err != nil {
+			t.Errorf("testStringObject failed: %s", err)
+		}
+	case *object.Null:
+		err := testNullObject(t, expected, actual)
+		if err != nil {
+			t.Errorf("testNullObject failed: %s", err)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object is not array: %T (%+v)", actual, actual)
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong number of elements. want=%d, got=%d", len(expected), len(array.Elements))
+		}
+		for i, elem := range array.Elements {
+			err := testIntegerObject(t, expected[i], elem)
+			if err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	case map[object.HashKey]int:
+		hashObj, ok := actual.(*object.Hash)
+		if !ok {
+			t.Errorf("object is not hash: %T (%+v)", actual, actual)
+		}
+		if hashObj.Len() != len(expected) {
+			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(expected), hashObj.Len())
+			return
+		}
+		for ekey, eValue := range expected {
+			bucket, ok := hashObj.Pairs[ekey]
+			if !ok || len(bucket) != 1 {
+				t.Errorf("no pair for given key in pairs")
+				continue
+			}
+			err := testIntegerObject(t, eValue, bucket[0].Value)
+			if err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	case *object.Error:
+		errObj, ok := actual.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error: %T (%+v)", expected, actual)
+			return
+		}
+		if errObj.Message != expected.Message {
+			t.Errorf("wrong error message. expected=%s, got=%s", expected, errObj.Message)
+		}
+	default:
+		t.Errorf("object is not support. got=%T (%+v)", actual, actual)
+	}
+}
+
+func testIntegerObject(t *testing.T, expected int, obj object.Object) error {
+	t.Helper()
+	result, ok := obj.(object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+	}
+	if result.Integer() != int64(expected) {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Integer(), expected)
+	}
+	return nil
+}
+
+func testFloatObject(t *testing.T, expected float64, obj object.Object) error {
+	t.Helper()
+	result, ok := obj.(object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+	}
+	if result.Float() != expected {
+		return fmt.Errorf("object has wrong value. got=%f, want=%f", result.Float(), expected)
+	}
+	return nil
+}
+
+func testComplexObject(t *testing.T, expected complex128, obj object.Object) error {
+	t.Helper()
+	result, ok := obj.(object.Complex)
+	if !ok {
+		return fmt.Errorf("object is not Complex. got=%T (%+v)", obj, obj)
+	}
+	if result.Complex() != expected {
+		return fmt.Errorf("object has wrong value. got=%v, want=%v", result.Complex(), expected)
+	}
+	return nil
+}
+
+func testByteObject(t *testing.T, expected byte, obj object.Object) error {
+	t.Helper()
+	result, ok := obj.(*object.Byte)
+	if !ok {
+		return fmt.Errorf("object is not Byte. got=%T (%+v)", obj, obj)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+	return nil
+}
+
+func testBooleanObject(t *testing.T, expected bool, obj object.Object) error {
+	t.Helper()
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+	}
+	return nil
+}
+
+func testStringObject(t *testing.T, expected string, obj object.Object) error {
+	t.Helper()
+	result, ok := obj.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not string. got=%T (%+v)", obj, obj)
+	}
+	if result.Value != expected {
 		return fmt.Errorf("object has wrong value. got=%s, want=%s", result.Value, expected)
 	}
-	return nil
+	return nil
+}
+
+func testNullObject(t *testing.T, expected any, obj object.Object) error {
+	t.Helper()
+	if expected == nil && obj == nil {
+		return nil
+	}
+	return fmt.Errorf("object is not nil. got=%T, want=nil", obj)
+}
+
+func TestGoroutineChannel(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					func produce(ch chan int, n int) {
+						for i := 1; i <= n; i++ {
+							ch <- i
+						}
+						close(ch)
+					}
+
+					func main() {
+						ch := make(chan int)
+						go produce(ch, 4)
+						sum := 0
+						for v := range ch {
+							sum = sum*10 + v
+						}
+						sum
+					}
+				`,
+			1234,
+		},
+		{
+			`
+					package tmp
+
+					type Node struct {
+						V int
+					}
+
+					func main() {
+						done := make(chan struct{})
+						nodes := make(chan *Node, 1)
+						parts := make(chan []int, 1)
+						go func() {
+							nodes <- &Node{V: 4}
+							parts <- []int{1, 2}
+							done <- struct{}{}
+						}()
+						<-done
+						n := <-nodes
+						n.V*10 + len(<-parts)
+					}
+				`,
+			42,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						ch := make(chan string, 3)
+						ch <- "a"
+						ch <- "b"
+						n := len(ch)*10 + cap(ch)
+						s := <-ch
+						s = s + <-ch
+						close(ch)
+						v, ok := <-ch
+						if !ok && v == "" && n == 23 {
+							s = s + "!"
+						}
+						s
+					}
+				`,
+			"ab!",
+		},
+		{
+			`
+					package tmp
+
+					func worker(id int, jobs chan int, results chan int) {
+						for j := range jobs {
+							results <- j * id
+						}
+					}
+
+					func main() {
+						jobs := make(chan int, 2)
+						results := make(chan int)
+						done := make(chan bool)
+						total := 0
+						go func() {
+							for i := 0; i < 6; i++ {
+								total += <-results
+							}
+							done <- true
+						}()
+						go worker(1, jobs, results)
+						go worker(10, jobs, results)
+						for i := 1; i <= 6; i++ {
+							jobs <- i
+						}
+						close(jobs)
+						<-done
+						total > 21
+					}
+				`,
+			true,
+		},
+	}
+
+	runVmTests(t, tests, false)
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+					package tmp
+
+					func main() {
+						ch := make(chan int)
+						ch <- 1
+					}
+				`,
+			"all goroutines are asleep - deadlock!",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						ch := make(chan int)
+						go func() {
+							panic("worker")
+						}()
+						defer func() {
+							recover()
+						}()
+						<-ch
+					}
+				`,
+			"7:8 panic: worker",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						ch := make(chan int, 1)
+						close(ch)
+						ch <- 1
+					}
+				`,
+			"7:7 send on closed channel",
+		},
+	}
+
+	for _, tt := range errTests {
+		prog := parseProgram(t, tt.input, false)
+		comp := compiler.New()
+		err := comp.CompileProgram(prog)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					func main() {
+						ch := make(chan int, 1)
+						s := ""
+						for i := 0; i < 4; i++ {
+							select {
+							case v := <-ch:
+								s = s + "r"
+								if v != i-1 {
+									s = s + "?"
+								}
+							case ch <- i:
+								s = s + "s"
+							}
+						}
+						s
+					}
+				`,
+			"srsr",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						ok := false
+						x := 5
+						ch := make(chan int, 1)
+						ch <- 3
+						n := 0
+						select {
+						case x, ok := <-ch:
+							if ok {
+								n = x
+							}
+						}
+						if !ok {
+							n = n*10 + x
+						}
+						n
+					}
+				`,
+			35,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						ch := make(chan int)
+						n := 0
+						select {
+						case v := <-ch:
+							n = v
+						default:
+							n = -1
+						}
+						close(ch)
+						select {
+						case v, ok := <-ch:
+							if !ok {
+								n = n*10 + v
+							}
+						default:
+							n = 100
+						}
+						n
+					}
+				`,
+			-10,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a := make(chan int)
+						b := make(chan string)
+						quit := make(chan bool)
+						go func() {
+							for i := 1; i <= 3; i++ {
+								a <- i
+							}
+							b <- "x"
+							quit <- true
+						}()
+						sum := 0
+						s := ""
+						done := false
+						for !done {
+							select {
+							case v := <-a:
+								sum += v
+							case v := <-b:
+								s = s + v
+							case <-quit:
+								done = true
+							}
+						}
+						s == "x" && sum == 6
+					}
+				`,
+			true,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						out := make(chan int)
+						res := make(chan int)
+						go func() {
+							total := 0
+							for v := range out {
+								total += v
+							}
+							res <- total
+						}()
+						for i := 0; i < 5; i++ {
+							select {
+							case out <- i:
+							}
+						}
+						close(out)
+						<-res
+					}
+				`,
+			10,
+		},
+	}
+
+	runVmTests(t, tests, false)
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+					package tmp
+
+					func main() {
+						a := make(chan int)
+						b := make(chan int)
+						select {
+						case <-a:
+						case b <- 1:
+						}
+					}
+				`,
+			"all goroutines are asleep - deadlock!",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						select {}
+					}
+				`,
+			"all goroutines are asleep - deadlock!",
+		},
+	}
+
+	for _, tt := range errTests {
+		prog := parseProgram(t, tt.input, false)
+		comp := compiler.New()
+		err := comp.CompileProgram(prog)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestSlices(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					func main() {
+						a := []int{1, 2, 3, 4, 5}
+						b := a[1:3]
+						b[0] = 20
+						b = append(b, 40)
+						len(b)*1000 + cap(b)*100 + a[1] + a[3]
+					}
+				`,
+			3460,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a := []int{1, 2, 3, 4, 5}
+						b := a[1:3:4]
+						b = append(b, 6)
+						b = append(b, 7)
+						b[0] = 9
+						a[1]*100 + a[3]*10 + cap(a[2:])
+					}
+				`,
+			263,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						s := make([]int, 2, 5)
+						t := append(s, 3)
+						s = append(s, 4)
+						len(s)*1000 + cap(s)*100 + t[2]
+					}
+				`,
+			3504,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						dst := make([]int, 3)
+						n := copy(dst, []int{7, 8, 9, 10})
+						a := []int{1}
+						a = append(a, dst[1:]...)
+						n*10000 + a[0]*100 + a[1]*10 + a[2]
+					}
+				`,
+			30189,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						s := "hello, world"
+						s[7:] + s[:5] + s[5:6]
+					}
+				`,
+			"worldhello,",
+		},
+	}
+
+	runVmTests(t, tests, false)
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+					package tmp
+
+					func main() {
+						a := make([]int, 2, 3)
+						a[1:4]
+					}
+				`,
+			"6:7 slice bounds out of range [:4] with capacity 3",
+		},
+	}
+
+	for _, tt := range errTests {
+		prog := parseProgram(t, tt.input, false)
+		comp := compiler.New()
+		err := comp.CompileProgram(prog)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestPointers(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					func counter() *int {
+						n := 10
+						return &n
+					}
+
+					func main() {
+						p := counter()
+						q := counter()
+						*p = *p + 1
+						*q++
+						*p*100 + *q
+					}
+				`,
+			1111,
+		},
+		{
+			`
+					package tmp
+
+					func f(c bool) int {
+						if c {
+							x := 1
+							_ = x
+						}
+						x := 2
+						p := &x
+						*p = 7
+						return x
+					}
+
+					func main() {
+						f(false)*10 + f(true)
+					}
+				`,
+			77,
+		},
+		{
+			`
+					package tmp
+
+					func inc(p *int) {
+						*p += 5
+					}
+
+					func main() {
+						x := 1
+						inc(&x)
+						inc(&x)
+						x
+					}
+				`,
+			11,
+		},
+		{
+			`
+					package tmp
+
+					type Node struct {
+						val  int
+						next *Node
+					}
+
+					func main() {
+						var head *Node
+						for i := 1; i <= 3; i++ {
+							head = &Node{val: i, next: head}
+						}
+						sum := 0
+						for n := head; n != nil; n = n.next {
+							sum = sum*10 + n.val
+						}
+						sum
+					}
+				`,
+			321,
+		},
+		{
+			`
+					package tmp
+
+					type Point struct {
+						X, Y int
+					}
+
+					func main() {
+						a := []int{1, 2, 3}
+						p := &a[1]
+						*p = 20
+						s := Point{1, 2}
+						q := &s.Y
+						*q = 30
+						r := new(int)
+						*r = a[1] + s.Y
+						*r
+					}
+				`,
+			50,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						x := 1
+						y := 1
+						p, q, r := &x, &x, &y
+						var n *int
+						p == q && p != r && n == nil && r != nil
+					}
+				`,
+			true,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						x := 0
+						p := &x
+						add := func(n int) {
+							x += n
+						}
+						add(3)
+						add(4)
+						*p * 10 + x
+					}
+				`,
+			77,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						var ps []*int
+						for i := 0; i < 3; i++ {
+							v := i * 10
+							ps = append(ps, &v)
+						}
+						*ps[0] + *ps[1] + *ps[2]
+					}
+				`,
+			30,
+		},
+		{
+			`
+					package tmp
+
+					type Point struct {
+						X, Y int
+					}
+
+					func move(p *Point) {
+						p.X += 10
+					}
+
+					func main() {
+						pt := Point{1, 2}
+						move(&pt)
+						pp := &pt
+						pp.Y = 5
+						(*pp).Y++
+						pt.X*10 + pt.Y
+					}
+				`,
+			116,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a := [3]int{1, 2, 3}
+						p := &a
+						p[0] = 5
+						sum := 0
+						for _, v := range p {
+							sum += v
+						}
+						a[0]*1000 + p[1]*100 + len(p)*10 + sum - 10
+					}
+				`,
+			5230,
+		},
+		{
+			`
+					package tmp
+
+					type Shape interface {
+						Area() int
+					}
+
+					type Rect struct {
+						W, H int
+					}
+
+					func (r *Rect) Area() int {
+						return r.W * r.H
+					}
+
+					func main() {
+						var s Shape = &Rect{2, 3}
+						var x interface{} = &Rect{4, 5}
+						total := s.Area()
+						if sh, ok := x.(Shape); ok {
+							total += sh.Area() * 10
+						}
+						switch v := x.(type) {
+						case Shape:
+							total += v.Area() * 100
+						}
+						var y interface{} = Rect{1, 1}
+						if _, ok := y.(Shape); !ok {
+							total += 5000
+						}
+						total
+					}
+				`,
+			7206,
+		},
+	}
+
+	runVmTests(t, tests, false)
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+					package tmp
+
+					func main() {
+						var p *int
+						*p = 1
+					}
+				`,
+			"6:7 invalid memory address or nil pointer dereference",
+		},
+	}
+
+	for _, tt := range errTests {
+		prog := parseProgram(t, tt.input, false)
+		comp := compiler.New()
+		err := comp.CompileProgram(prog)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestConstants(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					const (
+						Sunday = iota
+						Monday
+						Tuesday
+						_
+						Thursday
+					)
+
+					func main() {
+						Sunday*1000 + Monday*100 + Tuesday*10 + Thursday
+					}
+				`,
+			124,
+		},
+		{
+			`
+					package tmp
+
+					const (
+						_  = iota
+						KB = 1 << (10 * iota)
+						MB
+						GB
+					)
+
+					func main() {
+						GB / MB
+					}
+				`,
+			1024,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						const big = 1 << 100
+						big >> 98
+					}
+				`,
+			4,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						const (
+							a, b = iota, iota * 10
+							c, d
+						)
+						c*100 + d
+					}
+				`,
+			110,
+		},
+		{
+			`
+					package tmp
+
+					func limit() int8 {
+						const max int8 = 100
+						return max + 27
+					}
+
+					func main() {
+						limit()
+					}
+				`,
+			127,
+		},
+		{
+			`
+					package tmp
+
+					const scale = 2.5
+
+					func main() {
+						x := 4.0
+						x * scale
+					}
+				`,
+			10.0,
+		},
+		{
+			`
+					package tmp
+
+					func two() int {
+						return 2
+					}
+
+					func main() {
+						xs := []int{1, 2, 3}
+						d := '0' + len(xs)
+						e := 'a' + xs[1]
+						f := '0' + two()
+						var b byte = 'a' + 1
+						s := string(rune('a' + len(xs)))
+						(d*1000000+e*1000+f)*10 + int(b) - 'a' + len(s)
+					}
+				`,
+			510990502,
+		},
+		{
+			`
+					package tmp
+
+					const prefix = "go"
+					const name = prefix + "script"
+
+					func main() {
+						const n = len(name)
+						s := make([]int, 3)
+						len(s) * 10 + len(name)
+					}
+				`,
+			38,
+		},
+		{
+			`
+					package tmp
+
+					type Celsius float64
+
+					func half(x float64) float64 {
+						return x / 2
+					}
+
+					func G[T any](a T, b float64) T {
+						return a
+					}
+
+					func main() {
+						f := 2.0
+						f = 3
+						var c Celsius = 1
+						m := map[float64]int{2: 1}
+						delete(m, 2)
+						f + 0.5 + half(1) + G[float64](1, 2.5) + float64(c) + float64(len(m))
+					}
+				`,
+			6.0,
+		},
+	}
+
+	runVmTests(t, tests, false)
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+					package tmp
+
+					func main() {
+						const (
+							A int8 = 100
+							B      = A * 2
+						)
+					}
+				`,
+			"7:17 A * 2 (constant 200 of type int8) overflows int8",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						const c int8 = 300
+					}
+				`,
+			"5:22 cannot use 300 (untyped int constant) as int8 value in constant declaration (overflows)",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						const big = 1 << 100
+						z := big
+					}
+				`,
+			"6:12 cannot use big (untyped int constant 1267650600228229401496703205376) as int value in assignment (overflows)",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						var u uint = -1
+					}
+				`,
+			"5:20 cannot use -1 (untyped int constant) as uint value in variable declaration (overflows)",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						const n = 400
+						x := int8(n)
+					}
+				`,
+			"6:12 constant 400 overflows int8",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						const n = 1
+						n = 2
+					}
+				`,
+			"cannot assign to n (neither addressable nor a map index expression)",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						x := 1 << 64
+					}
+				`,
+			"5:12 cannot use 1 << 64 (untyped int constant 18446744073709551616) as int value in assignment (overflows)",
+		},
+		{
+			`
+					package tmp
+
+					func f(n int) int {
+						return n
+					}
+
+					func main() {
+						f(1.5)
+					}
+				`,
+			"9:9 cannot use 1.5 (untyped float constant) as int value in argument to f (truncated)",
+		},
+	}
+
+	for _, tt := range errTests {
+		prog := parseProgram(t, tt.input, false)
+		comp := compiler.New()
+		err := comp.CompileProgram(prog)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong compiler error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestGenerics(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					func Map[T, U any](xs []T, f func(T) U) []U {
+						var result []U
+						for _, x := range xs {
+							result = append(result, f(x))
+						}
+						return result
+					}
+
+					func main() {
+						words := Map([]int{1, 22, 333}, func(n int) string {
+							if n > 10 {
+								return "big"
+							}
+							return "small"
+						})
+						words[0] + words[2]
+					}
+				`,
+			"smallbig",
+		},
+		{
+			`
+					package tmp
+
+					type MyInt int
+
+					type Num interface {
+						~int | ~float64
+					}
+
+					func Double[T Num](x T) T {
+						return x * 2
+					}
+
+					func main() {
+						n := Double(MyInt(4))
+						int(n) + int(Double(2.5))
+					}
+				`,
+			13,
+		},
+		{
+			`
+					package tmp
+
+					type Number interface {
+						~int | ~int64 | ~float64
+					}
+
+					func Sum[T Number](xs []T) T {
+						var total T
+						for _, x := range xs {
+							total += x
+						}
+						return total
+					}
+
+					func main() {
+						Sum([]float64{1.5, 2.5}) + float64(Sum[int]([]int{1, 2, 3}))
+					}
+				`,
+			10.0,
+		},
+		{
+			`
+					package tmp
+
+					type Stack[T any] struct {
+						items []T
+					}
+
+					func (s *Stack[T]) Push(v T) {
+						s.items = append(s.items, v)
+					}
+
+					func (s *Stack[T]) Pop() T {
+						var zero T
+						if len(s.items) == 0 {
+							return zero
+						}
+						v := s.items[len(s.items)-1]
+						s.items = s.items[:len(s.items)-1]
+						return v
+					}
+
+					func main() {
+						s := &Stack[int]{}
+						s.Push(1)
+						s.Push(2)
+						s.Pop()*10 + s.Pop() + s.Pop()
+					}
+				`,
+			21,
+		},
+		{
+			`
+					package tmp
+
+					type Pair[K comparable, V any] struct {
+						Key   K
+						Value V
+					}
+
+					func Swap[K, V comparable](p Pair[K, V]) Pair[V, K] {
+						return Pair[V, K]{Key: p.Value, Value: p.Key}
+					}
+
+					func main() {
+						p := Swap(Pair[string, int]{"a", 7})
+						p.Key
+					}
+				`,
+			7,
+		},
+	}
+	runVmTests(t, tests, false)
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+					package tmp
+
+					func Zero[T any]() T {
+						var zero T
+						return zero
+					}
+
+					func main() {
+						Zero()
+					}
+				`,
+			"10:7 in call to Zero, cannot infer T",
+		},
+		{
+			`
+					package tmp
+
+					type Number interface {
+						~int | ~float64
+					}
+
+					func Sum[T Number](xs []T) T {
+						var total T
+						return total
+					}
+
+					func main() {
+						Sum([]string{"a"})
+					}
+				`,
+			"14:7 string does not satisfy Number (string missing in ~int | ~float64)",
+		},
+		{
+			`
+					package tmp
+
+					type MyInt int
+
+					func Inc[T int | float64](x T) T {
+						return x + 1
+					}
+
+					func main() {
+						Inc(MyInt(1))
+					}
+				`,
+			"11:7 MyInt does not satisfy int | float64 (MyInt missing in int | float64)",
+		},
+	}
+
+	for _, tt := range errTests {
+		prog := parseProgram(t, tt.input, false)
+		comp := compiler.New()
+		err := comp.CompileProgram(prog)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong compiler error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					func main() {
+						grid := [][]int{{1, 2}, {3, 4}, {5, 6}}
+						found := 0
+					outer:
+						for i := 0; i < len(grid); i++ {
+							for _, v := range grid[i] {
+								if v == 4 {
+									found = i*10 + v
+									break outer
+								}
+							}
+						}
+						found
+					}
+				`,
+			14,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						count := 0
+					outer:
+						for i := 0; i < 4; i++ {
+							for j := 0; j < 4; j++ {
+								if j > i {
+									continue outer
+								}
+								count++
+							}
+						}
+						count
+					}
+				`,
+			10,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						n := 0
+					loop:
+						for i := 0; i < 3; i++ {
+							for j := 0; j < 3; j++ {
+								for k := 0; k < 3; k++ {
+									switch {
+									case i == 1 && k == 1:
+										break loop
+									case k == 2:
+										continue loop
+									}
+									n++
+								}
+							}
+						}
+						n
+					}
+				`,
+			3,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						x := 0
+					sw:
+						switch x {
+						case 0:
+							for i := 0; i < 10; i++ {
+								if i == 3 {
+									break sw
+								}
+								x += i
+							}
+							x = 100
+						}
+						x
+					}
+				`,
+			3,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						ch := make(chan int, 1)
+						ch <- 5
+						got := 0
+					sel:
+						select {
+						case v := <-ch:
+							for {
+								got = v
+								break sel
+							}
+							got = -1
+						}
+						got
+					}
+				`,
+			5,
+		},
+		{
+			`
+					package tmp
+
+					func abs(n int) int {
+						if n < 0 {
+							goto neg
+						}
+						return n
+					neg:
+						return -n
+					}
+
+					func main() {
+						i, sum := 0, 0
+					loop:
+						if i < 5 {
+							sum += i
+							i++
+							goto loop
+						}
+						abs(-3)*100 + abs(2)*10 + sum
+					}
+				`,
+			330,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						r := 0
+						for i := 0; i < 3; i++ {
+							for j := 0; j < 3; j++ {
+								if i*j == 2 {
+									r = i*10 + j
+									goto done
+								}
+							}
+						}
+						r = -1
+					done:
+						r
+					}
+				`,
+			12,
+		},
+	}
+	runVmTests(t, tests, false)
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+					for {
+						break missing
+					}
+				`,
+			"3:13 label missing undefined",
+		},
+		{
+			`
+					unused:
+					for {
+						break
+					}
+				`,
+			"2:6 label unused defined and not used",
+		},
+		{
+			`
+					sw:
+					switch {
+					default:
+						for {
+							continue sw
+						}
+					}
+				`,
+			"6:17 invalid continue label sw",
+		},
+		{
+			`
+					goto inner
+					{
+					inner:
+						println(1)
+					}
+				`,
+			"2:11 goto inner jumps into block",
+		},
+		{
+			`
+					goto end
+					x := 1
+					println(x)
+					end:
+				`,
+			"2:11 goto end jumps over variable declaration",
+		},
+	}
+
+	for _, tt := range errTests {
+		in := program.Input{Name: "", Content: tt.input, IsStmt: true, IsCheck: false}
+		_, err := program.ParseFile(in)
+		if err == nil {
+			t.Fatalf("expected parser error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong parser error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestVariadic(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					func sum(xs ...int) int {
+						total := 0
+						for _, x := range xs {
+							total += x
+						}
+						return total
+					}
+
+					func main() {
+						nums := []int{4, 5}
+						sum() + sum(1) + sum(1, 2, 3)*10 + sum(nums...)*100
+					}
+				`,
+			961,
+		},
+		{
+			`
+					package tmp
+
+					func join(sep string, parts ...string) string {
+						out := ""
+						for i, p := range parts {
+							if i > 0 {
+								out += sep
+							}
+							out += p
+						}
+						return out
+					}
+
+					func main() {
+						join("-", "a", "b", "c") + join("+")
+					}
+				`,
+			"a-b-c",
+		},
+		{
+			`
+					package tmp
+
+					func zero(xs ...int) {
+						xs[0] = 0
+					}
+
+					func push(s []int, xs ...int) []int {
+						return append(s, xs...)
+					}
+
+					func main() {
+						s := []int{7, 8}
+						zero(s...)
+						s = push(s, 1, 2)
+						s[0] + s[1] + len(s)*100
+					}
+				`,
+			408,
+		},
+		{
+			`
+					package tmp
+
+					type Acc struct {
+						n int
+					}
+
+					func (a *Acc) Add(xs ...int) {
+						for _, x := range xs {
+							a.n += x
+						}
+					}
+
+					func main() {
+						a := &Acc{}
+						a.Add(1, 2)
+						a.Add()
+						a.Add([]int{3}...)
+						f := func(prefix int, xs ...int) int {
+							return prefix + len(xs)
+						}
+						a.n*10 + f(100, 1, 2)
+					}
+				`,
+			162,
+		},
+		{
+			`
+					package tmp
+
+					type Number interface {
+						~int | ~float64
+					}
+
+					func Max[T Number](first T, rest ...T) T {
+						m := first
+						for _, x := range rest {
+							if x > m {
+								m = x
+							}
+						}
+						return m
+					}
+
+					func main() {
+						Max(3, 9, 4) + Max(2)
+					}
+				`,
+			11,
+		},
+	}
+	runVmTests(t, tests, false)
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+					f := func(a int, xs ...int) {}
+					f()
+				`,
+			"3:6 execute function wrong number of arguments: want>=1, got=0",
+		},
+		{
+			`
+					f := func(a int, b int) {}
+					f([]int{1, 2}...)
+				`,
+			"3:6 cannot use ... in call to non-variadic function",
+		},
+	}
+
+	for _, tt := range errTests {
+		prog := parseProgram(t, tt.input, true)
+		comp := compiler.New()
+		err := comp.CompileProgram(prog)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected vm error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestFuncValues(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					type Handler struct {
+						name string
+						fn   func(int) int
+					}
+
+					func getF() func(int) int {
+						return func(x int) int { return x + 1 }
+					}
+
+					func main() {
+						var f func(int) int
+						f = func(x int) int { return x * 3 }
+						m := map[string]func(int) int{"inc": func(x int) int { return x + 1 }}
+						fs := []func() int{func() int { return 7 }}
+						h := Handler{name: "h", fn: f}
+						m["inc"](1) + fs[0]() + getF()(1) + h.fn(2) + f(1)
+					}
+				`,
+			20,
+		},
+		{
+			`
+					package tmp
+
+					func apply(xs []int, f func(int) int) []int {
+						var out []int
+						for _, x := range xs {
+							out = append(out, f(x))
+						}
+						return out
+					}
+
+					func compose(f, g func(int) int) func(int) int {
+						return func(x int) int { return f(g(x)) }
+					}
+
+					func pair() func() (int, int) {
+						return func() (int, int) { return 1, 2 }
+					}
+
+					func main() {
+						double := func(x int) int { return x * 2 }
+						r := apply([]int{1, 2}, compose(double, double))
+						a, b := pair()()
+						r[0] + r[1] + a*100 + b*1000
+					}
+				`,
+			2112,
+		},
+		{
+			`
+					package tmp
+
+					type Handler struct {
+						fn func()
+					}
+
+					func main() {
+						var f func(int) int
+						var h Handler
+						n := 0
+						if f == nil {
+							n += 1
+						}
+						if h.fn == nil {
+							n += 10
+						}
+						f = func(x int) int { return x }
+						if f != nil {
+							n += 100
+						}
+						f = nil
+						if f == nil {
+							n += 1000
+						}
+						n
+					}
+				`,
+			1111,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						var fib func(int) int
+						fib = func(n int) int {
+							if n < 2 {
+								return n
+							}
+							return fib(n-1) + fib(n-2)
+						}
+						fib(10)
+					}
+				`,
+			55,
+		},
+	}
+	runVmTests(t, tests, false)
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+					var f func() int
+					f()
+				`,
+			"3:6 invalid memory address or nil pointer dereference",
+		},
+	}
+
+	for _, tt := range errTests {
+		prog := parseProgram(t, tt.input, true)
+		comp := compiler.New()
+		err := comp.CompileProgram(prog)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected vm error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					func main() {
+						s := "héllo, 世界"
+						n := 0
+						out := ""
+						for i, r := range s {
+							n += i
+							out = string(r) + out
+						}
+						out + string(rune(n))
+					}
+				`,
+			"界世 ,olléh-",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						n := 0
+						for range "abc" {
+							n++
+						}
+						for range []int{1, 2} {
+							n++
+						}
+						n*1000 + int("abc"[1])
+					}
+				`,
+			5098,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						s := "héllo"
+						bs := []byte(s)
+						rs := []rune(s)
+						bs[0] = 'j'
+						rs[1] = 'e'
+						string(bs) + "|" + string(rs) + "|" + s
+					}
+				`,
+			"jéllo|hello|héllo",
+		},
+		{
+			`
+					package tmp
+
+					func atoi(s string) int {
+						n := 0
+						for i := 0; i < len(s); i++ {
+							if s[i] < '0' || s[i] > '9' {
+								return -1
+							}
+							n = n*10 + int(s[i]-'0')
+						}
+						return n
+					}
+
+					func main() {
+						atoi("409") + atoi("4x")
+					}
+				`,
+			408,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						raw := ` + "`a\\n\"b\"`" + `
+						esc := "\x41\101é\t\U0001F600"
+						raw + "|" + esc
+					}
+				`,
+			"a\\n\"b\"|AAé\t😀",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						n := 0
+						if "apple" < "banana" {
+							n += 1
+						}
+						if "b" > "abc" {
+							n += 10
+						}
+						if "a" <= "a" && "a" >= "a" {
+							n += 100
+						}
+						if "b" < "a" || "b" <= "a" {
+							n += 1000
+						}
+						n
+					}
+				`,
+			111,
+		},
+	}
+	runVmTests(t, tests, false)
+}
+
+func TestParallelAssign(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					func main() {
+						a, b, c := 1, 2, 3
+						a, b, c = b, c, a
+						s := []int{1, 2, 3}
+						i, j := 0, 2
+						s[i], s[j] = s[j], s[i]
+						a*100 + b*10 + c + s[0]*1000
+					}
+				`,
+			3231,
+		},
+		{
+			`
+					package tmp
+
+					type P struct {
+						X int
+						Y int
+					}
+
+					func pair(a, b int) (int, int) {
+						return b, a
+					}
+
+					func main() {
+						p := &P{X: 5, Y: 8}
+						p.X, p.Y = p.Y, p.X
+						a, b := 1, 2
+						b, a = pair(a, b)
+						_, b = pair(a, 7)
+						var c int
+						c, _ = pair(3, 4)
+						p.X*10000 + p.Y*1000 + a*100 + b*10 + c
+					}
+				`,
+			85114,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						m := map[string]int{"a": 1}
+						var i interface{} = 3
+						var v int
+						var ok bool
+						n := 0
+						v, ok = m["a"]
+						if ok {
+							n += v
+						}
+						_, ok = m["b"]
+						if !ok {
+							n += 10
+						}
+						v, ok = i.(int)
+						if ok {
+							n += v * 100
+						}
+						var s string
+						s, ok = i.(string)
+						if !ok && s == "" {
+							n += 1000
+						}
+						n
+					}
+				`,
+			1311,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						ch := make(chan int, 1)
+						ch <- 5
+						close(ch)
+						var v int
+						var ok bool
+						n := 0
+						v, ok = <-ch
+						if ok {
+							n += v
+						}
+						v, ok = <-ch
+						if !ok {
+							n += 10 + v
+						}
+						n
+					}
+				`,
+			15,
+		},
+		{
+			`
+					package tmp
+
+					func reverse(xs []int) {
+						for i, j := 0, len(xs)-1; i < j; i, j = i+1, j-1 {
+							xs[i], xs[j] = xs[j], xs[i]
+						}
+					}
+
+					func rotate(xs []int, m map[string]int) {
+						shift := func() {
+							for i := 0; i < len(xs)-1; i++ {
+								xs[i], xs[i+1] = xs[i+1], xs[i]
+							}
+							m["a"] = xs[0]
+						}
+						shift()
+					}
+
+					func main() {
+						xs := []int{1, 2, 3, 4}
+						reverse(xs)
+						m := map[string]int{}
+						rotate(xs, m)
+						i := 0
+						ys := []int{0, 0}
+						i, ys[i] = 1, 9
+						i*10000 + xs[0]*1000 + xs[3]*100 + m["a"]*10 + ys[0]
+					}
+				`,
+			13439,
+		},
+	}
+	runVmTests(t, tests, false)
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+					package tmp
+
+					func main() {
+						a, b := 1, 2
+						a, b = b
+					}
+				`,
+			"6:7 assignment mismatch: 2 variables but 1 value",
+		},
+		{
+			`
+					package tmp
+
+					const K = 1
+
+					func main() {
+						K[0] = 1
+					}
+				`,
+			"7:7 cannot assign to K[0] (neither addressable nor a map index expression)",
+		},
+	}
+
+	for _, tt := range errTests {
+		prog := parseProgram(t, tt.input, false)
+		comp := compiler.New()
+		err := comp.CompileProgram(prog)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong compiler error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestComplex(t *testing.T) {
+	tests := []vmTestCase{
+		{`1 + 2i`, 1 + 2i},
+		{
+			`
+					z := 1 + 2i
+					w := complex(3, -1)
+					z * w
+				`,
+			5 + 5i,
+		},
+		{
+			`
+					z := 1 + 2i
+					z += complex(3, -1)
+					-z / 2
+				`,
+			-2 - 0.5i,
+		},
+		{
+			`
+					var c complex64 = 2i
+					c = c * c
+					real(c) == -4 && imag(c) == 0
+				`,
+			true,
+		},
+		{
+			`
+					const k = complex(1, 1) * 2
+					imag(k) + real(1+3i)
+				`,
+			3.0,
+		},
+		{
+			`
+					var x float64 = 0.5
+					r := complex(x, 2)
+					real(r)*4 + imag(r)
+				`,
+			4.0,
+		},
+		{
+			`
+					m := map[complex128]int{1i: 7, 2i: 8}
+					m[2i] - m[1i]
+				`,
+			1,
+		},
+		{`complex128(1) == 1+0i && 1+2i != 1`, true},
+		{`1 + 2.5`, 3.5},
+		{`'a' + 1`, 98},
+		{
+			`
+					a := 1
+					b := 2.5
+					complex(a, b)
+				`,
+			&object.Error{Message: "invalid argument: mismatched types int and float64 in complex"},
+		},
+	}
+	runVmTests(t, tests, true)
+}
+
+func TestFixedArrays(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					func bump(a [3]int) int {
+						a[0] = 100
+						return a[0]
+					}
+
+					func main() {
+						var a [3]int
+						b := a
+						b[0] = 5
+						c := [3]int{1, 2}
+						n := bump(c)
+						a[0]*1000 + b[0]*100 + c[0]*10 + c[2] + n*0 + len(c)*10000
+					}
+				`,
+			30510,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						c := [3]int{1, 2}
+						d := [...]int{1, 2, 0}
+						e := [3]int{1, 2, 3}
+						c == d && c != e && len(d) == 3
+					}
+				`,
+			true,
+		},
+		{
+			`
+					package tmp
+
+					type P struct {
+						X int
+					}
+
+					func main() {
+						var ps [3]P
+						qs := ps
+						q := qs[1]
+						q.X = 5
+						qs[1] = q
+						grid := [2][2]int{{1, 2}, {3}}
+						cp := grid
+						row := cp[0]
+						row[0] = 9
+						cp[0] = row
+						ps[1].X*1000 + qs[1].X*100 + grid[0][0]*10 + cp[0][0]
+					}
+				`,
+			519,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						seen := map[[2]string]int{{"a", "b"}: 1}
+						seen[[2]string{"a", "b"}] += 2
+						seen[[2]string{"b", "a"}] = 10
+						key := [2]string{"a", "b"}
+						seen[key]*100 + len(seen)
+					}
+				`,
+			302,
+		},
+		{
+			`
+					package tmp
+
+					type T struct {
+						Arr [3]int
+						M   map[string][]int
+					}
+
+					func main() {
+						var g [2][2]int
+						g[1][0] = 9
+						g[0][1] += 2
+						t := T{M: map[string][]int{"a": {1, 2}}}
+						t.Arr[0] = 5
+						t.Arr[1]++
+						t.M["a"][1] = 7
+						p := &t
+						p.Arr[2] = 4
+						ts := []T{{}, {}}
+						ts[1].Arr[2] = 3
+						f := func() {
+							g[0][0] = 1
+						}
+						f()
+						n := g[0][0]*1000000 + g[1][0]*100000 + g[0][1]*10000 + t.Arr[0]*1000 + t.Arr[1]*100 + t.Arr[2]*10 + t.M["a"][1]
+						n*10 + ts[1].Arr[2]
+					}
+				`,
+			19251473,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a := [3]int{1, 2, 3}
+						s := 0
+						for i, v := range a {
+							a[2] = 100
+							if i == 2 {
+								s += v
+							}
+						}
+						b := [3]int{1, 2, 3}
+						for i, v := range &b {
+							b[2] = 100
+							if i == 2 {
+								s += v * 10
+							}
+						}
+						s
+					}
+				`,
+			1003,
+		},
+		{
+			`
+					package tmp
+
+					const N = 3
+
+					func main() {
+						var w [N * 2]string
+						w[5] = "z"
+						len(w)*10 + len(w[5])
+					}
+				`,
+			61,
+		},
+	}
+	runVmTests(t, tests, false)
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+					package tmp
+
+					func main() {
+						var a [3]int
+						var b [4]int
+						a = b
+					}
+				`,
+			"7:7 cannot use value of type [4]int as [3]int value in assignment",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a := [3]int{}
+						a == [4]int{}
+					}
+				`,
+			"6:7 invalid operation: a == [4]int{} (mismatched types [3]int and [4]int)",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						a := [2]int{1, 2, 3}
+					}
+				`,
+			"5:25 array index 2 out of bounds [0:2]",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						n := 3
+						var a [n]int
+					}
+				`,
+			"6:13 array length n must be constant",
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						m := map[[]int]int{}
+					}
+				`,
+			"5:16 key not a HashKey type",
+		},
+	}
+
+	for _, tt := range errTests {
+		prog := parseProgram(t, tt.input, false)
+		comp := compiler.New()
+		err := comp.CompileProgram(prog)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong compiler error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
 }
 
-func testNullObject(t *testing.T, expected any, obj object.Object) error {
-	t.Helper()
-	if expected == nil && obj == nil {
-		return nil
+func TestHashKeys(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`
+					package tmp
+
+					func main() {
+						fm := map[float64]int{}
+						fm[2] = 3
+						fm[0] = 4
+						zero := 0.0
+						nan := zero / zero
+						fm[nan] = 5
+						fm[nan] = 6
+						s := 0
+						for k, v := range fm {
+							if k != k {
+								s += v
+							}
+						}
+						fm[2.0]*100000 + fm[-zero]*10000 + s*100 + len(fm)
+					}
+				`,
+			341104,
+		},
+		{
+			`
+					package tmp
+
+					type P struct {
+						X, Y int
+					}
+
+					func main() {
+						bm := map[bool]int{true: 1}
+						pm := map[P]int{P{1, 2}: 7}
+						pm[P{1, 2}] = 8
+						p := &P{1, 2}
+						q := &P{1, 2}
+						ptr := map[*P]int{p: 1, q: 2}
+						am := map[any]int{1: 1, "a": 2, 2.5: 3, P{1, 1}: 4}
+						ar := map[[2]int]int{{1, 2}: 9}
+						bm[true]*10000 + pm[P{1, 2}]*1000 + len(ptr)*100 + am[P{1, 1}]*10 + ar[[2]int{1, 2}] + len(pm)*0
+					}
+				`,
+			18249,
+		},
+		{
+			`
+					package tmp
+
+					func main() {
+						m := map[string]int{}
+						m["a"]++
+						m["b"] += 3
+						x := m["zz"] + 1
+						s := map[string]string{}
+						t := s["q"] + "!"
+						l := map[string][]int{}
+						l["k"] = append(l["k"], 4)
+						m["a"]*100000 + m["b"]*10000 + x*1000 + len(t)*100 + len(l["k"])*10 + len(l["none"])
+					}
+				`,
+			131110,
+		},
+	}
+	runVmTests(t, tests, false)
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+					package tmp
+
+					func main() {
+						am := map[any]int{}
+						var s []int
+						am[s] = 1
+					}
+				`,
+			"7:7 runtime error: hash of unhashable type []int",
+		},
+	}
+
+	for _, tt := range errTests {
+		prog := parseProgram(t, tt.input, false)
+		comp := compiler.New()
+		err := comp.CompileProgram(prog)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected vm error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestRuntimeErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`package tmp
+
+func get(a []int, i int) int {
+	return a[i]
+}
+
+func main() {
+	a := []int{1, 2, 3}
+	sum := 0
+	for i := 0; i < 10; i++ {
+		sum += get(a, i)
+	}
+}
+`,
+			"main.go:4:9 index out of range [3] with length 3",
+		},
+		{
+			`package tmp
+
+func main() {
+	a := []int{1, 2, 3}
+	sum := 0
+	for _, v := range a {
+		if v > 1 {
+			sum += 10 / (v - 2)
+		}
+	}
+}
+`,
+			"main.go:8:11 integer divide by zero",
+		},
+		{
+			`package tmp
+
+func main() {
+	s := "abc"
+	println(s[5])
+}
+`,
+			"main.go:5:10 index out of range [5] with length 3",
+		},
+	}
+
+	for _, tt := range tests {
+		prog, err := program.ParseFile(program.Input{Name: "main.go", Content: tt.input})
+		if err != nil {
+			t.Fatalf("parser error: %s", err)
+		}
+		comp := compiler.New()
+		err = comp.CompileProgram(prog)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected vm error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestRuntimeErrorTrace(t *testing.T) {
+	tests := []struct {
+		input     string
+		goroutine int
+		functions []string
+		trace     string
+	}{
+		{
+			`package tmp
+
+type P struct {
+	X int
+}
+
+func get(a []int, i int, name string, p P) int {
+	return a[i]
+}
+
+func sum(a []int) int {
+	s := 0
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 1; j++ {
+			s += get(a, i, "x", P{i})
+		}
+	}
+	return s
+}
+
+func main() {
+	f := func(n int) int { return sum([]int{n, 2, 3}) }
+	f(1)
+}
+`,
+			1,
+			[]string{"get", "sum", "func literal", "main"},
+			`panic: index out of range [3] with length 3
+
+goroutine 1 [running]:
+get([1, 2, 3], 3, "x", {3})
+	main.go:8:9
+sum([1, 2, 3])
+	main.go:15:9
+func literal(1)
+	main.go:22:32
+main()
+	main.go:23:2
+`,
+		},
+		{
+			`package tmp
+
+func At[T any](xs []T, i int) T {
+	return xs[i]
+}
+
+func main() {
+	At([]int{1}, 3)
+}
+`,
+			1,
+			[]string{"At[int]", "main"},
+			`panic: index out of range [3] with length 1
+
+goroutine 1 [running]:
+At[int]([1], 3)
+	main.go:4:9
+main()
+	main.go:8:2
+`,
+		},
+		{
+			`package tmp
+
+func work(ch chan int, n int) {
+	if n > 1 {
+		panic("bad worker")
+	}
+	ch <- n
+}
+
+func main() {
+	ch := make(chan int)
+	for i := 0; i < 3; i++ {
+		go work(ch, i)
+	}
+	for i := 0; i < 3; i++ {
+		<-ch
+	}
+}
+`,
+			// goroutine 中的 panic 只有 goroutine 自己的调用栈
+			4,
+			[]string{"work"},
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		prog, err := program.ParseFile(program.Input{Name: "main.go", Content: tt.input})
+		if err != nil {
+			t.Fatalf("parser error: %s", err)
+		}
+		comp := compiler.New()
+		err = comp.CompileProgram(prog)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		var rerr *RuntimeError
+		if !errors.As(err, &rerr) {
+			t.Fatalf("expected *RuntimeError, got=%T (%v)", err, err)
+		}
+		if rerr.Goroutine != tt.goroutine {
+			t.Errorf("wrong goroutine: want=%d, got=%d", tt.goroutine, rerr.Goroutine)
+		}
+		if len(rerr.Frames) != len(tt.functions) {
+			t.Fatalf("wrong number of frames: want=%d, got=%d", len(tt.functions), len(rerr.Frames))
+		}
+		for i, fn := range tt.functions {
+			if rerr.Frames[i].Function != fn {
+				t.Errorf("wrong function in frame %d: want=%q, got=%q", i, fn, rerr.Frames[i].Function)
+			}
+		}
+		if rerr.Frames[0].Pos != rerr.Pos {
+			t.Errorf("innermost frame should be at the error position. want=%s, got=%s", rerr.Pos, rerr.Frames[0].Pos)
+		}
+		if tt.trace != "" && rerr.Trace() != tt.trace {
+			t.Errorf("wrong trace: want=%q, got=%q", tt.trace, rerr.Trace())
+		}
 	}
-	return fmt.Errorf("object is not nil. got=%T, want=nil", obj)
 }